@@ -16,6 +16,55 @@ type Config struct {
 	SMTPUser string
 	SMTPPass string
 	SMTPFrom string
+
+	// SMS settings
+	SMSGatewayURL   string // HTTP endpoint texts are posted to; unset prints them to console
+	SMSGatewayToken string // bearer token for the gateway
+	SMSFrom         string // sender number or name
+
+	// FX settings
+	FXRatesFile string // JSON rate table served by the file-backed provider
+	FXSpread    string // fraction taken off the mid rate, e.g. "0.005"
+
+	// Reconciliation settings
+	ReconciliationTime string // local time of day for the nightly run, "HH:MM"
+
+	// Blob storage settings
+	BlobDir string // root directory of the local blob store, e.g. for receipts
+
+	// Statement settings
+	StatementSigningKey string // base64 Ed25519 seed used to sign archived statements
+
+	// Linked bank account settings
+	BankAccountKey string // base64 AES-256 key sealing linked account numbers
+
+	// ACH settings
+	ACHOriginRouting string // routing number of the sponsor bank that sends our ACH files
+	ACHOriginBank    string
+	ACHCompanyName   string
+	ACHCompanyID     string // "1" followed by the EIN
+	ACHOutboxDir     string // where outbound NACHA files are written
+	ACHReturnsDir    string // where the bank drops return files
+	ACHBatchInterval string // how often the ACH batch runs, e.g. "1h"
+
+	// Environment settings
+	Environment string // "development" or "production"
+
+	// Card processor settings
+	PaymentProcessor       string // "fake" (development only) or "none" to turn card top-ups off
+	ProcessorWebhookSecret string // shared secret the processor signs webhooks with
+
+	// Savings settings
+	SavingsAPY string // APY in percent that pockets start earning; admins change it later
+
+	// Claim link settings
+	ClaimLinkExpiry string // how long money sent to someone without an account waits before it is refunded, e.g. "336h"
+
+	// Transfer verification settings
+	TransferOTPThreshold string // USD value above which a transfer needs a one-time code
+
+	// Admin settings
+	AdminEmails string // comma-separated emails of users given the admin role at startup
 }
 
 // Load reads configuration from environment variables with sensible defaults
@@ -31,6 +80,41 @@ func Load() *Config {
 		SMTPUser:    getEnv("SMTP_USER", ""),
 		SMTPPass:    getEnv("SMTP_PASS", ""),
 		SMTPFrom:    getEnv("SMTP_FROM", "noreply@gatorpay.app"),
+		FXRatesFile: getEnv("FX_RATES_FILE", "data/fx_rates.json"),
+		FXSpread:    getEnv("FX_SPREAD", "0.005"),
+
+		SMSGatewayURL:   getEnv("SMS_GATEWAY_URL", ""),
+		SMSGatewayToken: getEnv("SMS_GATEWAY_TOKEN", ""),
+		SMSFrom:         getEnv("SMS_FROM", "GatorPay"),
+
+		ReconciliationTime: getEnv("RECONCILIATION_TIME", "02:00"),
+
+		BlobDir: getEnv("BLOB_DIR", "data/blobs"),
+
+		StatementSigningKey: getEnv("STATEMENT_SIGNING_KEY", ""),
+
+		BankAccountKey: getEnv("BANK_ACCOUNT_KEY", ""),
+
+		ACHOriginRouting: getEnv("ACH_ORIGIN_ROUTING", "063100277"),
+		ACHOriginBank:    getEnv("ACH_ORIGIN_BANK", "Sponsor Bank"),
+		ACHCompanyName:   getEnv("ACH_COMPANY_NAME", "GatorPay"),
+		ACHCompanyID:     getEnv("ACH_COMPANY_ID", "1000000000"),
+		ACHOutboxDir:     getEnv("ACH_OUTBOX_DIR", "data/ach/outbound"),
+		ACHReturnsDir:    getEnv("ACH_RETURNS_DIR", "data/ach/returns"),
+		ACHBatchInterval: getEnv("ACH_BATCH_INTERVAL", "1h"),
+
+		Environment: getEnv("APP_ENV", "development"),
+
+		PaymentProcessor:       getEnv("PAYMENT_PROCESSOR", "fake"),
+		ProcessorWebhookSecret: getEnv("PROCESSOR_WEBHOOK_SECRET", ""),
+
+		SavingsAPY: getEnv("SAVINGS_APY", "0"),
+
+		ClaimLinkExpiry: getEnv("CLAIM_LINK_EXPIRY", "336h"),
+
+		TransferOTPThreshold: getEnv("TRANSFER_OTP_THRESHOLD", "1000"),
+
+		AdminEmails: getEnv("ADMIN_EMAILS", ""),
 	}
 }
 
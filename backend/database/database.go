@@ -29,6 +29,13 @@ func Connect(dsn string) {
 
 // Migrate runs auto-migrations for all models
 func Migrate() {
+	// Wallets were unique per user before multi-currency; they are now unique per user and currency
+	if DB.Migrator().HasIndex(&models.Wallet{}, "idx_wallets_user_id") {
+		if err := DB.Migrator().DropIndex(&models.Wallet{}, "idx_wallets_user_id"); err != nil {
+			log.Fatal("Failed to drop wallet user index:", err)
+		}
+	}
+
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Wallet{},
@@ -47,6 +54,7 @@ func Migrate() {
 		&models.InsightReport{},
 		&models.BudgetGoal{},
 		&models.AutoSaveRule{},
+		&models.Pocket{},
 		&models.Subscription{},
 		&models.FraudAlert{},
 		&models.RiskEvent{},
@@ -57,6 +65,39 @@ func Migrate() {
 		&models.FeedReaction{},
 		&models.Invoice{},
 		&models.PaymentLink{},
+		// Double-entry ledger
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.Posting{},
+		&models.IdempotencyKey{},
+		&models.FXQuote{},
+		&models.Hold{},
+		&models.ReconciliationRun{},
+		&models.ReconciliationMismatch{},
+		&models.ReconciliationDiscrepancy{},
+		&models.ScheduledTransfer{},
+		&models.ScheduledTransferRun{},
+		&models.SpendingLimit{},
+		&models.LimitUsage{},
+		&models.SharedWallet{},
+		&models.SharedWalletMember{},
+		&models.SharedWalletPayout{},
+		&models.TransactionAnnotation{},
+		&models.Receipt{},
+		&models.ArchivedStatement{},
+		&models.LinkedBankAccount{},
+		&models.Withdrawal{},
+		&models.Deposit{},
+		&models.ACHFile{},
+		&models.CardTopUp{},
+		&models.InterestRate{},
+		&models.InterestAccrual{},
+		&models.InterestPayout{},
+		&models.PaymentRequest{},
+		&models.ExpenseGroup{}, &models.ExpenseGroupMember{}, &models.GroupExpense{}, &models.GroupExpenseShare{}, &models.GroupSettlement{},
+		&models.ClaimLink{},
+		&models.PendingTransfer{},
+		&models.BulkPayout{}, &models.BulkPayoutRow{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnnotationHandler handles transaction annotation and receipt requests
+type AnnotationHandler struct {
+	service *services.AnnotationService
+}
+
+// NewAnnotationHandler creates a new AnnotationHandler
+func NewAnnotationHandler(service *services.AnnotationService) *AnnotationHandler {
+	return &AnnotationHandler{service: service}
+}
+
+// GetAnnotation returns a transaction's category, tags, note and receipts
+func (h *AnnotationHandler) GetAnnotation(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	annotation, err := h.service.GetAnnotation(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Annotation retrieved", annotation)
+}
+
+// Annotate sets a transaction's category override, tags or note
+func (h *AnnotationHandler) Annotate(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.AnnotateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	annotation, err := h.service.Annotate(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Annotation saved", annotation)
+}
+
+// UploadReceipt attaches the multipart "file" to a transaction
+func (h *AnnotationHandler) UploadReceipt(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: a receipt file is required")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	receipt, err := h.service.AddReceipt(userID.(string), c.Param("id"), header.Filename, file)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Receipt uploaded", receipt)
+}
+
+// DownloadReceipt streams a receipt file
+func (h *AnnotationHandler) DownloadReceipt(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	receipt, body, err := h.service.OpenReceipt(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, receipt.Size, receipt.ContentType, body, map[string]string{
+		"Content-Disposition": "inline; filename=" + strconv.Quote(receipt.FileName),
+	})
+}
+
+// DeleteReceipt removes a receipt
+func (h *AnnotationHandler) DeleteReceipt(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.service.DeleteReceipt(userID.(string), c.Param("id")); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Receipt deleted", nil)
+}
@@ -104,6 +104,37 @@ func (h *AuthHandler) GoogleAuth(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Authentication successful", response)
 }
 
+// SendPhoneCode texts a verification code to the user's phone number
+func (h *AuthHandler) SendPhoneCode(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.authService.SendPhoneCode(userID.(string)); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Verification code sent", nil)
+}
+
+// VerifyPhone marks the user's phone number verified
+func (h *AuthHandler) VerifyPhone(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.VerifyPhoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	user, err := h.authService.VerifyPhone(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Phone number verified", user)
+}
+
 // GetMe returns the currently authenticated user
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -99,3 +99,52 @@ func (h *BudgetHandler) ExecuteRoundup(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Roundup executed", result)
 }
+
+// MoveToPocket moves money from the wallet into a goal's pocket
+func (h *BudgetHandler) MoveToPocket(c *gin.Context) {
+	h.movePocket(c, h.service.MoveToPocket, "Money moved to pocket")
+}
+
+// MoveFromPocket moves money from a goal's pocket back to the wallet
+func (h *BudgetHandler) MoveFromPocket(c *gin.Context) {
+	h.movePocket(c, h.service.MoveFromPocket, "Money moved from pocket")
+}
+
+func (h *BudgetHandler) movePocket(c *gin.Context, move func(userID, goalID string, req models.PocketMoveRequest) (*models.BudgetGoal, error), message string) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.PocketMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	goal, err := move(userID.(string), c.Param("id"), req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, message, goal)
+}
+
+// GetSpending returns a month's spending by category, honouring the user's overrides
+func (h *BudgetHandler) GetSpending(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	breakdown, err := h.service.GetSpendingByCategory(userID.(string), c.Query("month"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Spending retrieved", breakdown)
+}
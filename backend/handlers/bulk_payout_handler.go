@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BulkPayoutHandler handles paying many people at once from a CSV file
+type BulkPayoutHandler struct {
+	service *services.BulkPayoutService
+}
+
+// NewBulkPayoutHandler creates a new BulkPayoutHandler
+func NewBulkPayoutHandler(service *services.BulkPayoutService) *BulkPayoutHandler {
+	return &BulkPayoutHandler{service: service}
+}
+
+// Upload checks the multipart "file" of recipient, amount and note rows with
+// a dry-run, optionally in the form's currency, and returns the report
+func (h *BulkPayoutHandler) Upload(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: a payout file is required")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	payout, err := h.service.Upload(userID.(string), header.Filename, c.PostForm("currency"), file)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Payout file checked", payout)
+}
+
+// List returns the user's bulk payouts
+func (h *BulkPayoutHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	payouts, err := h.service.GetPayouts(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payouts retrieved", payouts)
+}
+
+// Get returns a bulk payout with the result of every row
+func (h *BulkPayoutHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	payout, err := h.service.GetPayout(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payout retrieved", payout)
+}
+
+// Execute sends a checked bulk payout
+func (h *BulkPayoutHandler) Execute(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ExecuteBulkPayoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	payout, err := h.service.Execute(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if payout.Status == models.BulkPayoutValidated {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to send this payout", payout)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payout sent", payout)
+}
+
+// Download returns a bulk payout and the result of every row as CSV
+func (h *BulkPayoutHandler) Download(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	fileName, data, err := h.service.ResultFile(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
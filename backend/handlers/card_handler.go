@@ -94,3 +94,22 @@ func (h *CardHandler) FreezeCard(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Card status updated", card)
 }
+
+func (h *CardHandler) Authorize(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	cardID := c.Param("id")
+
+	var input services.CardAuthorizeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	hold, err := h.cardService.Authorize(cardID, userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Card spend authorized", hold)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimHandler handles money sent by claim link to people without an account
+type ClaimHandler struct {
+	service *services.ClaimService
+}
+
+// NewClaimHandler creates a new ClaimHandler
+func NewClaimHandler(service *services.ClaimService) *ClaimHandler {
+	return &ClaimHandler{service: service}
+}
+
+// List returns the claim links the user sent, or with ?role=received the
+// ones sent to their email, optionally filtered by ?status=
+func (h *ClaimHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	claims, err := h.service.GetClaims(userID.(string), c.Query("role"), c.Query("status"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Claim links retrieved", claims)
+}
+
+// Claim pays the money behind a claim link's token into the user's wallet
+func (h *ClaimHandler) Claim(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ClaimInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	claim, err := h.service.Claim(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Money claimed", claim)
+}
+
+// Cancel takes back money sent by claim link before it is claimed
+func (h *ClaimHandler) Cancel(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	claim, err := h.service.Cancel(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Transfer cancelled", claim)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExpenseGroupHandler handles shared expense group requests
+type ExpenseGroupHandler struct {
+	service *services.ExpenseGroupService
+}
+
+// NewExpenseGroupHandler creates a new ExpenseGroupHandler
+func NewExpenseGroupHandler(service *services.ExpenseGroupService) *ExpenseGroupHandler {
+	return &ExpenseGroupHandler{service: service}
+}
+
+// Create starts an expense group with the user in it
+func (h *ExpenseGroupHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.CreateExpenseGroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	group, err := h.service.Create(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Expense group created", group)
+}
+
+// List returns the expense groups the user belongs to
+func (h *ExpenseGroupHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	groups, err := h.service.GetGroups(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Expense groups retrieved", groups)
+}
+
+// Get returns an expense group with its members
+func (h *ExpenseGroupHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	group, err := h.service.GetGroup(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Expense group retrieved", group)
+}
+
+// AddMember adds a user to an expense group
+func (h *ExpenseGroupHandler) AddMember(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ExpenseGroupMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	member, err := h.service.AddMember(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Member added", member)
+}
+
+// RemoveMember takes a settled-up member out of an expense group
+func (h *ExpenseGroupHandler) RemoveMember(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.service.RemoveMember(userID.(string), c.Param("id"), c.Param("userId")); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Member removed", nil)
+}
+
+// AddExpense logs an expense and splits it between participants
+func (h *ExpenseGroupHandler) AddExpense(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.GroupExpenseInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	expense, err := h.service.AddExpense(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Expense added", expense)
+}
+
+// GetExpenses returns an expense group's expenses
+func (h *ExpenseGroupHandler) GetExpenses(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	expenses, err := h.service.GetExpenses(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Expenses retrieved", expenses)
+}
+
+// DeleteExpense removes an expense from an expense group
+func (h *ExpenseGroupHandler) DeleteExpense(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.service.DeleteExpense(userID.(string), c.Param("id"), c.Param("expenseId")); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Expense deleted", nil)
+}
+
+// GetBalances returns who owes whom in an expense group and the simplest
+// way to settle it
+func (h *ExpenseGroupHandler) GetBalances(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	balances, err := h.service.GetBalances(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Balances retrieved", balances)
+}
+
+// GetSettlements returns the payments made to settle up in an expense group
+func (h *ExpenseGroupHandler) GetSettlements(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	settlements, err := h.service.GetSettlements(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Settlements retrieved", settlements)
+}
+
+// SettleUp pays everything the user owes in an expense group
+func (h *ExpenseGroupHandler) SettleUp(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.SettleUpInput
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	settlements, err := h.service.SettleUp(userID.(string), c.Param("id"), input)
+	if errors.Is(err, services.ErrTransferCodeRequired) {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to settle up", nil)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Settled up", settlements)
+}
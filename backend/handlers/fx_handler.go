@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FXHandler handles currency rate, quote and conversion requests
+type FXHandler struct {
+	fxService *services.FXService
+}
+
+// NewFXHandler creates a new FXHandler
+func NewFXHandler(fxService *services.FXService) *FXHandler {
+	return &FXHandler{fxService: fxService}
+}
+
+// GetRates returns current mid-market rates
+func (h *FXHandler) GetRates(c *gin.Context) {
+	rates, err := h.fxService.GetRates()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "FX rates retrieved successfully", rates)
+}
+
+// CreateQuote prices a conversion the user can execute before it expires
+func (h *FXHandler) CreateQuote(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.FXQuoteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	quote, err := h.fxService.CreateQuote(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Quote created successfully", quote)
+}
+
+// Convert executes a quote between the user's currency wallets
+func (h *FXHandler) Convert(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.FXConvertInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	result, err := h.fxService.Convert(userID.(string), input.QuoteID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Conversion successful", result)
+}
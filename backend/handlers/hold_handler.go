@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HoldHandler handles authorization hold requests
+type HoldHandler struct {
+	holdService *services.HoldService
+}
+
+// NewHoldHandler creates a new HoldHandler
+func NewHoldHandler(holdService *services.HoldService) *HoldHandler {
+	return &HoldHandler{holdService: holdService}
+}
+
+// GetHolds lists the user's holds, optionally filtered by ?status=
+func (h *HoldHandler) GetHolds(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	holds, err := h.holdService.GetHolds(userID.(string), c.Query("status"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Holds retrieved successfully", holds)
+}
+
+// Capture settles a hold in full or in part
+func (h *HoldHandler) Capture(c *gin.Context) {
+	var input services.CaptureHoldInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	hold, err := h.holdService.Capture(c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hold captured", hold)
+}
+
+// Release frees whatever a hold still reserves
+func (h *HoldHandler) Release(c *gin.Context) {
+	hold, err := h.holdService.Release(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hold released", hold)
+}
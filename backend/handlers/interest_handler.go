@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InterestHandler handles savings interest requests
+type InterestHandler struct {
+	service *services.InterestService
+}
+
+// NewInterestHandler creates a new InterestHandler
+func NewInterestHandler(service *services.InterestService) *InterestHandler {
+	return &InterestHandler{service: service}
+}
+
+// GetSummary returns the user's savings interest for a year, this year by default
+func (h *InterestHandler) GetSummary(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	year := time.Now().Year()
+	if y := c.Query("year"); y != "" {
+		parsed, err := strconv.Atoi(y)
+		if err != nil || parsed < 2000 || parsed > 9999 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "year must be a four-digit year")
+			return
+		}
+		year = parsed
+	}
+
+	summary, err := h.service.GetSummary(userID.(string), year)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Interest summary retrieved", summary)
+}
+
+// GetRates returns the savings APY history
+func (h *InterestHandler) GetRates(c *gin.Context) {
+	rates, err := h.service.GetRates()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Interest rates retrieved", rates)
+}
+
+// SetRate schedules a new savings APY
+func (h *InterestHandler) SetRate(c *gin.Context) {
+	adminID, _ := c.Get("userID")
+
+	var req models.SetInterestRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	rate, err := h.service.SetRate(adminID.(string), req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Interest rate set", rate)
+}
+
+// Accrue accrues one day's interest again and pays out finished months.
+// Pockets that already have the day are left as they are.
+func (h *InterestHandler) Accrue(c *gin.Context) {
+	var req models.AccrueInterestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+	day, err := time.ParseInLocation("2006-01-02", req.Date, time.Local)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "date must be a date like 2006-01-02")
+		return
+	}
+
+	accrued, err := h.service.AccrueDay(day)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	paid, err := h.service.PayDue(time.Now())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Interest accrued", gin.H{"date": req.Date, "accrued": accrued, "paid": paid})
+}
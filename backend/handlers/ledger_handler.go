@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LedgerHandler handles double-entry ledger reporting requests
+type LedgerHandler struct {
+	service *services.LedgerService
+}
+
+// NewLedgerHandler creates a new LedgerHandler
+func NewLedgerHandler(service *services.LedgerService) *LedgerHandler {
+	return &LedgerHandler{service: service}
+}
+
+// GetTrialBalance returns debit and credit totals for every ledger account
+func (h *LedgerHandler) GetTrialBalance(c *gin.Context) {
+	trialBalance, err := h.service.GetTrialBalance()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Trial balance retrieved", trialBalance)
+}
+
+// CheckWallets compares stored wallet balances with their ledger postings
+func (h *LedgerHandler) CheckWallets(c *gin.Context) {
+	checks, err := h.service.CheckWallets()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	mismatches := 0
+	for _, check := range checks {
+		if !check.Matches {
+			mismatches++
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Wallet ledger check complete", gin.H{
+		"wallets":    checks,
+		"mismatches": mismatches,
+	})
+}
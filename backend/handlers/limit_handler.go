@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitHandler handles spending limit requests
+type LimitHandler struct {
+	service *services.LimitService
+}
+
+// NewLimitHandler creates a new LimitHandler
+func NewLimitHandler(service *services.LimitService) *LimitHandler {
+	return &LimitHandler{service: service}
+}
+
+// GetRemaining returns how much of each limit the user has left
+func (h *LimitHandler) GetRemaining(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	summary, err := h.service.GetRemaining(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Limits retrieved", summary)
+}
+
+// GetLimits lists the configured limits of every KYC tier
+func (h *LimitHandler) GetLimits(c *gin.Context) {
+	limits, err := h.service.GetLimits()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Limits retrieved", limits)
+}
+
+// SetLimit configures one limit of a KYC tier
+func (h *LimitHandler) SetLimit(c *gin.Context) {
+	var input services.SetLimitInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	limit, err := h.service.SetLimit(input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Limit updated", limit)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LinkedAccountHandler handles linked bank account requests
+type LinkedAccountHandler struct {
+	service *services.LinkedAccountService
+}
+
+// NewLinkedAccountHandler creates a new LinkedAccountHandler
+func NewLinkedAccountHandler(service *services.LinkedAccountService) *LinkedAccountHandler {
+	return &LinkedAccountHandler{service: service}
+}
+
+// LinkAccount links a bank account and sends its micro-deposits
+func (h *LinkedAccountHandler) LinkAccount(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input models.LinkAccountRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	account, err := h.service.LinkAccount(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Micro-deposits sent, confirm their amounts to verify the account", account)
+}
+
+// VerifyAccount confirms a bank account's micro-deposit amounts
+func (h *LinkedAccountHandler) VerifyAccount(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input models.VerifyAccountRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	account, err := h.service.VerifyAccount(userID.(string), c.Param("id"), input.Amounts)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Bank account verified", account)
+}
+
+// GetAccounts lists the user's linked bank accounts
+func (h *LinkedAccountHandler) GetAccounts(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	accounts, err := h.service.GetAccounts(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Bank accounts retrieved", accounts)
+}
+
+// RemoveAccount unlinks a bank account
+func (h *LinkedAccountHandler) RemoveAccount(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.service.RemoveAccount(userID.(string), c.Param("id")); err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Bank account removed", nil)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaymentRequestHandler handles requests for money between users
+type PaymentRequestHandler struct {
+	service *services.PaymentRequestService
+}
+
+// NewPaymentRequestHandler creates a new PaymentRequestHandler
+func NewPaymentRequestHandler(service *services.PaymentRequestService) *PaymentRequestHandler {
+	return &PaymentRequestHandler{service: service}
+}
+
+// Create asks another user for money
+func (h *PaymentRequestHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.PaymentRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	request, err := h.service.Create(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Money requested", request)
+}
+
+// List returns the requests the user sent, or with ?role=received the ones
+// they were sent, optionally filtered by ?status=
+func (h *PaymentRequestHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	requests, err := h.service.GetRequests(userID.(string), c.Query("role"), c.Query("status"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payment requests retrieved", requests)
+}
+
+// Get returns one request the user sent or received
+func (h *PaymentRequestHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	request, err := h.service.GetRequest(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payment request retrieved", request)
+}
+
+// Pay pays a request the user received
+func (h *PaymentRequestHandler) Pay(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.PayRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	request, err := h.service.Pay(userID.(string), c.Param("id"), input)
+	if errors.Is(err, services.ErrTransferCodeRequired) {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to pay this request", nil)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Request paid", request)
+}
+
+// Decline turns down a request the user received
+func (h *PaymentRequestHandler) Decline(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.DeclineRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	request, err := h.service.Decline(userID.(string), c.Param("id"), input.Reason)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Request declined", request)
+}
+
+// Remind nudges the payer of a request the user sent
+func (h *PaymentRequestHandler) Remind(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	request, err := h.service.Remind(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reminder sent", request)
+}
+
+// Cancel withdraws a request the user sent
+func (h *PaymentRequestHandler) Cancel(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	request, err := h.service.Cancel(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Request cancelled", request)
+}
@@ -103,3 +103,65 @@ func (h *QRHandler) PayViaQR(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "QR Payment Successful", nil)
 }
+
+// AuthorizeQR holds a QR payment for the merchant to capture later
+func (h *QRHandler) AuthorizeQR(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req QRPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid pay payload")
+		return
+	}
+
+	hold, err := h.qrService.AuthorizeQR(userID.(string), req.CodeString, decimal.NewFromFloat(req.Amount))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "QR payment authorized, waiting for the merchant", hold)
+}
+
+func (h *QRHandler) GetPendingPayments(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	holds, err := h.qrService.GetPendingPayments(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Pending payments retrieved", holds)
+}
+
+type QRCaptureRequest struct {
+	Amount float64 `json:"amount"` // zero captures the full amount
+}
+
+func (h *QRHandler) CapturePayment(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req QRCaptureRequest
+	c.ShouldBindJSON(&req)
+
+	hold, err := h.qrService.CapturePayment(userID.(string), c.Param("id"), decimal.NewFromFloat(req.Amount))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "QR payment captured", hold)
+}
+
+func (h *QRHandler) ReleasePayment(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	hold, err := h.qrService.ReleasePayment(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "QR payment released", hold)
+}
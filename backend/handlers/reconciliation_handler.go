@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReconciliationHandler handles balance reconciliation requests
+type ReconciliationHandler struct {
+	service *services.ReconciliationService
+}
+
+// NewReconciliationHandler creates a new ReconciliationHandler
+func NewReconciliationHandler(service *services.ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{service: service}
+}
+
+// Run reconciles every wallet now and returns the saved run
+func (h *ReconciliationHandler) Run(c *gin.Context) {
+	run, err := h.service.Run(models.ReconciliationTriggerManual)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reconciliation complete", run)
+}
+
+// GetRuns lists recent reconciliation runs
+func (h *ReconciliationHandler) GetRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	runs, err := h.service.GetRuns(limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reconciliation runs retrieved", runs)
+}
+
+// GetRun returns a run with its mismatches and the transactions behind them
+func (h *ReconciliationHandler) GetRun(c *gin.Context) {
+	run, err := h.service.GetRun(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reconciliation run retrieved", run)
+}
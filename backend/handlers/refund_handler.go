@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefundHandler handles refund and reversal requests
+type RefundHandler struct {
+	refundService *services.RefundService
+}
+
+// NewRefundHandler creates a new RefundHandler
+func NewRefundHandler(refundService *services.RefundService) *RefundHandler {
+	return &RefundHandler{refundService: refundService}
+}
+
+// Refund lets the recipient of a P2P or QR payment send some or all of it back
+func (h *RefundHandler) Refund(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.RefundInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	response, err := h.refundService.Refund(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Refund successful", response)
+}
+
+// GetRefunds lists the refunds booked against a payment
+func (h *RefundHandler) GetRefunds(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	refunds, err := h.refundService.GetRefunds(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Refunds retrieved successfully", refunds)
+}
+
+// Reverse refunds any P2P, bill or QR payment on the platform's authority
+func (h *RefundHandler) Reverse(c *gin.Context) {
+	var input services.RefundInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	response, err := h.refundService.Reverse(c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payment reversed", response)
+}
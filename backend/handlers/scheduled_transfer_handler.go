@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduledTransferHandler handles scheduled and recurring transfer requests
+type ScheduledTransferHandler struct {
+	service *services.ScheduledTransferService
+}
+
+// NewScheduledTransferHandler creates a new ScheduledTransferHandler
+func NewScheduledTransferHandler(service *services.ScheduledTransferService) *ScheduledTransferHandler {
+	return &ScheduledTransferHandler{service: service}
+}
+
+// Create schedules a one-off or recurring transfer
+func (h *ScheduledTransferHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ScheduledTransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	st, err := h.service.Create(userID.(string), input)
+	if errors.Is(err, services.ErrTransferCodeRequired) {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to schedule this transfer", nil)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Transfer scheduled", st)
+}
+
+// List returns the user's scheduled transfers, optionally filtered by ?status=
+func (h *ScheduledTransferHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	transfers, err := h.service.GetScheduledTransfers(userID.(string), c.Query("status"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Scheduled transfers retrieved", transfers)
+}
+
+// Get returns a scheduled transfer with its run history
+func (h *ScheduledTransferHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	st, err := h.service.GetScheduledTransfer(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Scheduled transfer retrieved", st)
+}
+
+// Update edits a scheduled transfer
+func (h *ScheduledTransferHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.UpdateScheduledTransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	st, err := h.service.Update(userID.(string), c.Param("id"), input)
+	if errors.Is(err, services.ErrTransferCodeRequired) {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to change this transfer", nil)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Scheduled transfer updated", st)
+}
+
+// Pause stops a scheduled transfer until it is resumed
+func (h *ScheduledTransferHandler) Pause(c *gin.Context) {
+	h.changeStatus(c, h.service.Pause, "Scheduled transfer paused")
+}
+
+// Resume reactivates a paused scheduled transfer
+func (h *ScheduledTransferHandler) Resume(c *gin.Context) {
+	h.changeStatus(c, h.service.Resume, "Scheduled transfer resumed")
+}
+
+// Cancel permanently stops a scheduled transfer
+func (h *ScheduledTransferHandler) Cancel(c *gin.Context) {
+	h.changeStatus(c, h.service.Cancel, "Scheduled transfer cancelled")
+}
+
+func (h *ScheduledTransferHandler) changeStatus(c *gin.Context, change func(userID, id string) (*models.ScheduledTransfer, error), message string) {
+	userID, _ := c.Get("userID")
+
+	st, err := change(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, message, st)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SharedWalletHandler handles joint wallet requests
+type SharedWalletHandler struct {
+	service *services.SharedWalletService
+}
+
+// NewSharedWalletHandler creates a new SharedWalletHandler
+func NewSharedWalletHandler(service *services.SharedWalletService) *SharedWalletHandler {
+	return &SharedWalletHandler{service: service}
+}
+
+// Create opens a shared wallet owned by the user
+func (h *SharedWalletHandler) Create(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.CreateSharedWalletInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	shared, err := h.service.Create(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Shared wallet created", shared)
+}
+
+// List returns the shared wallets the user belongs to
+func (h *SharedWalletHandler) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	wallets, err := h.service.GetSharedWallets(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Shared wallets retrieved", wallets)
+}
+
+// Get returns a shared wallet with its balance and members
+func (h *SharedWalletHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	shared, err := h.service.GetSharedWallet(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Shared wallet retrieved", shared)
+}
+
+// Update changes a shared wallet's settings
+func (h *SharedWalletHandler) Update(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.UpdateSharedWalletInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	shared, err := h.service.Update(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Shared wallet updated", shared)
+}
+
+// AddMember adds a user to a shared wallet
+func (h *SharedWalletHandler) AddMember(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.SharedMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	member, err := h.service.AddMember(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Member added", member)
+}
+
+// UpdateMember changes a member's role or spending cap
+func (h *SharedWalletHandler) UpdateMember(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.UpdateSharedMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	member, err := h.service.UpdateMember(userID.(string), c.Param("id"), c.Param("userId"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Member updated", member)
+}
+
+// RemoveMember removes a member, or lets a member leave
+func (h *SharedWalletHandler) RemoveMember(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := h.service.RemoveMember(userID.(string), c.Param("id"), c.Param("userId")); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Member removed", nil)
+}
+
+// Contribute moves money from the user's wallet into the shared wallet
+func (h *SharedWalletHandler) Contribute(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ContributeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	shared, err := h.service.Contribute(userID.(string), c.Param("id"), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Contribution added", shared)
+}
+
+// RequestPayout pays out of the shared wallet, or queues the payout for approval
+func (h *SharedWalletHandler) RequestPayout(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.SharedPayoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	payout, err := h.service.RequestPayout(userID.(string), c.Param("id"), input)
+	if errors.Is(err, services.ErrTransferCodeRequired) {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, send the code we emailed you to request this payout", nil)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if payout.Status == models.SharedPayoutPending {
+		utils.SuccessResponse(c, http.StatusAccepted, "Payout awaiting approval", payout)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "Payout sent", payout)
+}
+
+// GetPayouts lists a shared wallet's payouts, optionally filtered by ?status=
+func (h *SharedWalletHandler) GetPayouts(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	payouts, err := h.service.GetPayouts(userID.(string), c.Param("id"), c.Query("status"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payouts retrieved", payouts)
+}
+
+// ApprovePayout approves and sends another member's pending payout
+func (h *SharedWalletHandler) ApprovePayout(c *gin.Context) {
+	h.decide(c, h.service.ApprovePayout, "Payout approved")
+}
+
+// RejectPayout declines another member's pending payout
+func (h *SharedWalletHandler) RejectPayout(c *gin.Context) {
+	h.decide(c, h.service.RejectPayout, "Payout rejected")
+}
+
+func (h *SharedWalletHandler) decide(c *gin.Context, decide func(userID, id, payoutID string) (*models.SharedWalletPayout, error), message string) {
+	userID, _ := c.Get("userID")
+
+	payout, err := decide(userID.(string), c.Param("id"), c.Param("payoutId"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, message, payout)
+}
+
+// GetTransactions returns the shared wallet's history, showing which member
+// made each movement
+func (h *SharedWalletHandler) GetTransactions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var query services.TransactionQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+
+	history, err := h.service.GetTransactions(userID.(string), c.Param("id"), query)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Transactions retrieved", history)
+}
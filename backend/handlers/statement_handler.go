@@ -12,28 +12,112 @@ import (
 
 type StatementHandler struct {
 	statementService *services.StatementService
+	archiveService   *services.StatementArchiveService
 }
 
-func NewStatementHandler(ss *services.StatementService) *StatementHandler {
-	return &StatementHandler{statementService: ss}
+func NewStatementHandler(ss *services.StatementService, archive *services.StatementArchiveService) *StatementHandler {
+	return &StatementHandler{statementService: ss, archiveService: archive}
 }
 
+// GetStatement downloads a wallet statement as CSV, PDF, OFX, QIF or
+// camt.053 XML
 func (h *StatementHandler) GetStatement(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	format := c.Query("format")
-	start := c.Query("start")
-	end := c.Query("end")
 
-	if format != "csv" && format != "pdf" {
-		format = "csv"
+	var query services.StatementQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+
+	file, err := h.statementService.GenerateStatement(userID.(string), query)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.FileName))
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
+
+// GetArchivedStatements lists the user's issued monthly statements
+func (h *StatementHandler) GetArchivedStatements(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	statements, err := h.archiveService.GetStatements(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Statements retrieved", statements)
+}
+
+// DownloadArchivedStatement streams an issued statement exactly as it was stored
+func (h *StatementHandler) DownloadArchivedStatement(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	st, body, err := h.archiveService.OpenStatement(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, st.Size, "application/pdf", body, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", st.FileName),
+		"Digest":              "sha-256=" + st.SHA256,
+	})
+}
+
+// VerifyArchivedStatement checks a stored statement against its digest and signature
+func (h *StatementHandler) VerifyArchivedStatement(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	result, err := h.archiveService.Verify(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
 	}
 
-	data, contentType, err := h.statementService.GenerateStatement(userID.(string), format, start, end)
+	utils.SuccessResponse(c, http.StatusOK, "Statement checked", result)
+}
+
+// VerifyStatementFile checks an uploaded statement file against the archive
+func (h *StatementHandler) VerifyStatementFile(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "A statement file is required")
+		return
+	}
+	f, err := file.Open()
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to generate statement")
+		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to read upload")
 		return
 	}
+	defer f.Close()
+
+	result, err := h.archiveService.VerifyDocument(f)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Statement checked", result)
+}
+
+// IssueStatements issues a past month's statements for wallets still missing one
+func (h *StatementHandler) IssueStatements(c *gin.Context) {
+	issued, err := h.archiveService.IssueMonth(c.Query("period"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Statements issued", gin.H{"issued": issued})
+}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement.%s", format))
-	c.Data(http.StatusOK, contentType, data)
+// GetSigningKey returns the public key statements are signed with
+func (h *StatementHandler) GetSigningKey(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "Signing key retrieved", h.archiveService.GetSigningKey())
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookSize bounds processor webhook bodies
+const maxWebhookSize = 1 << 20
+
+// TopUpHandler handles card top-up and payment processor webhook requests
+type TopUpHandler struct {
+	service *services.TopUpService
+}
+
+// NewTopUpHandler creates a new TopUpHandler
+func NewTopUpHandler(service *services.TopUpService) *TopUpHandler {
+	return &TopUpHandler{service: service}
+}
+
+// GetTopUps lists the user's card top-ups
+func (h *TopUpHandler) GetTopUps(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	topUps, err := h.service.GetTopUps(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Top-ups retrieved", topUps)
+}
+
+// GetTopUp returns one card top-up, e.g. to poll it after a card check
+func (h *TopUpHandler) GetTopUp(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	topUp, err := h.service.GetTopUp(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Top-up retrieved", topUp)
+}
+
+// CompleteSimulated finishes a top-up's card check or delayed capture with
+// the fake processor, standing in for the cardholder and the processor
+func (h *TopUpHandler) CompleteSimulated(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	topUp, err := h.service.CompleteSimulated(userID.(string), c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Top-up completed", topUp)
+}
+
+// Refund takes a top-up back out of the wallet and refunds the card
+func (h *TopUpHandler) Refund(c *gin.Context) {
+	topUp, err := h.service.Refund(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Top-up refunded", topUp)
+}
+
+// Webhook receives payment events from the processor
+func (h *TopUpHandler) Webhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to read webhook")
+		return
+	}
+
+	if err := h.service.HandleWebhook(payload, c.GetHeader("X-Processor-Signature")); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Webhook processed", nil)
+}
@@ -35,6 +35,31 @@ func (h *TransferHandler) SendMoney(c *gin.Context) {
 		return
 	}
 
+	if response.Verification != nil {
+		utils.SuccessResponse(c, http.StatusAccepted, "Verification required, enter the code we emailed you to send this transfer", response)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Money sent successfully", response)
+}
+
+// ConfirmTransfer sends a transfer held for verification once the sender
+// enters the code
+func (h *TransferHandler) ConfirmTransfer(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var input services.ConfirmTransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	response, err := h.transferService.ConfirmTransfer(userID.(string), input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, "Money sent successfully", response)
 }
 
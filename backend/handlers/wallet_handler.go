@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 
+	"gatorpay-backend/models"
 	"gatorpay-backend/services"
 	"gatorpay-backend/utils"
 
@@ -13,14 +13,15 @@ import (
 // WalletHandler handles wallet-related HTTP requests
 type WalletHandler struct {
 	walletService *services.WalletService
+	topUpService  *services.TopUpService
 }
 
 // NewWalletHandler creates a new WalletHandler
-func NewWalletHandler(walletService *services.WalletService) *WalletHandler {
-	return &WalletHandler{walletService: walletService}
+func NewWalletHandler(walletService *services.WalletService, topUpService *services.TopUpService) *WalletHandler {
+	return &WalletHandler{walletService: walletService, topUpService: topUpService}
 }
 
-// AddMoney handles adding money to the wallet
+// AddMoney handles adding money to the wallet from a linked bank account or a card
 func (h *WalletHandler) AddMoney(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
@@ -30,13 +31,38 @@ func (h *WalletHandler) AddMoney(c *gin.Context) {
 		return
 	}
 
-	wallet, err := h.walletService.AddMoney(userID.(string), input)
+	if input.PaymentMethod != "" {
+		h.topUp(c, userID.(string), input)
+		return
+	}
+
+	deposit, err := h.walletService.AddMoney(userID.(string), input)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Money added successfully", wallet)
+	utils.SuccessResponse(c, http.StatusAccepted, "Your deposit is on its way; the money will be available once your bank sends it", deposit)
+}
+
+// topUp charges a card and reports where the top-up stands
+func (h *WalletHandler) topUp(c *gin.Context, userID string, input services.AddMoneyInput) {
+	topUp, err := h.topUpService.TopUp(userID, input)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch topUp.Status {
+	case models.TopUpSucceeded:
+		utils.SuccessResponse(c, http.StatusOK, "Money added successfully", topUp)
+	case models.TopUpRequiresAction:
+		utils.SuccessResponse(c, http.StatusAccepted, "Complete the card check to finish adding money", topUp)
+	case models.TopUpProcessing:
+		utils.SuccessResponse(c, http.StatusAccepted, "Your card payment is processing", topUp)
+	default:
+		utils.ErrorResponse(c, http.StatusPaymentRequired, topUp.FailureMessage)
+	}
 }
 
 // Withdraw handles withdrawing money from the wallet
@@ -58,14 +84,34 @@ func (h *WalletHandler) Withdraw(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Withdrawal successful", wallet)
 }
 
-// GetTransactions returns paginated transactions
+// GetWallets returns the balance of every currency the user holds
+func (h *WalletHandler) GetWallets(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	wallets, err := h.walletService.GetWallets(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Wallets retrieved successfully", wallets)
+}
+
+// GetTransactions returns a filtered page of transaction history. Pages are
+// walked with ?cursor=; ?page= still selects offset paging.
 func (h *WalletHandler) GetTransactions(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	var query services.TransactionQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
 
-	response, err := h.walletService.GetTransactions(userID.(string), page, limit)
+	response, err := h.walletService.GetTransactions(userID.(string), query)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 		return
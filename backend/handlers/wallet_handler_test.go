@@ -12,7 +12,7 @@ import (
 
 // TestNewWalletHandler verifies handler construction
 func TestNewWalletHandler(t *testing.T) {
-	handler := NewWalletHandler(nil)
+	handler := NewWalletHandler(nil, nil)
 	if handler == nil {
 		t.Error("expected non-nil WalletHandler")
 	}
@@ -20,7 +20,7 @@ func TestNewWalletHandler(t *testing.T) {
 
 // TestAddMoneyInvalidInput tests AddMoney with invalid JSON
 func TestAddMoneyInvalidInput(t *testing.T) {
-	handler := NewWalletHandler(nil)
+	handler := NewWalletHandler(nil, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -43,7 +43,7 @@ func TestAddMoneyInvalidInput(t *testing.T) {
 
 // TestAddMoneyMissingFields tests AddMoney with missing required fields
 func TestAddMoneyMissingFields(t *testing.T) {
-	handler := NewWalletHandler(nil)
+	handler := NewWalletHandler(nil, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -60,7 +60,7 @@ func TestAddMoneyMissingFields(t *testing.T) {
 
 // TestWithdrawInvalidInput tests Withdraw with invalid JSON
 func TestWithdrawInvalidInput(t *testing.T) {
-	handler := NewWalletHandler(nil)
+	handler := NewWalletHandler(nil, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -77,7 +77,7 @@ func TestWithdrawInvalidInput(t *testing.T) {
 
 // TestWithdrawMissingBankAccount tests Withdraw without bank_account
 func TestWithdrawMissingBankAccount(t *testing.T) {
-	handler := NewWalletHandler(nil)
+	handler := NewWalletHandler(nil, nil)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithdrawalHandler handles withdrawal and deposit status and ACH batch requests
+type WithdrawalHandler struct {
+	service *services.WithdrawalService
+}
+
+// NewWithdrawalHandler creates a new WithdrawalHandler
+func NewWithdrawalHandler(service *services.WithdrawalService) *WithdrawalHandler {
+	return &WithdrawalHandler{service: service}
+}
+
+// GetWithdrawals lists the user's withdrawals and where each one is
+func (h *WithdrawalHandler) GetWithdrawals(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	withdrawals, err := h.service.GetWithdrawals(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Withdrawals retrieved", withdrawals)
+}
+
+// GetDeposits lists the user's bank deposits and where each one is
+func (h *WithdrawalHandler) GetDeposits(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	deposits, err := h.service.GetDeposits(userID.(string))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Deposits retrieved", deposits)
+}
+
+// RunBatch applies return files, settles and submits withdrawals and deposits now
+func (h *WithdrawalHandler) RunBatch(c *gin.Context) {
+	if err := h.service.RunBatch(); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	files, _ := h.service.GetFiles(5)
+	utils.SuccessResponse(c, http.StatusOK, "ACH batch complete", files)
+}
+
+// GetFiles lists recent ACH files
+func (h *WithdrawalHandler) GetFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	files, err := h.service.GetFiles(limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "ACH files retrieved", files)
+}
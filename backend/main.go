@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"strings"
+	"time"
 
 	"gatorpay-backend/config"
 	"gatorpay-backend/database"
@@ -14,6 +15,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
 )
 
 func main() {
@@ -33,37 +35,145 @@ func main() {
 	// Initialize services
 	tokenService := services.NewTokenService(cfg)
 	emailService := services.NewEmailService(cfg)
+	smsService := services.NewSMSService(cfg)
 	otpService := services.NewOTPService(database.DB, emailService)
-	authService := services.NewAuthService(database.DB, tokenService, otpService)
-	walletService := services.NewWalletService(database.DB)
+	authService := services.NewAuthService(database.DB, tokenService, otpService, smsService)
 	rewardService := services.NewRewardService(database.DB)
-	transferService := services.NewTransferService(database.DB, rewardService)
-	billService := services.NewBillService(database.DB, rewardService)
+	fxSpread, err := decimal.NewFromString(cfg.FXSpread)
+	if err != nil {
+		log.Fatal("Invalid FX_SPREAD:", err)
+	}
+	fxService := services.NewFXService(database.DB, services.NewFileRateProvider(cfg.FXRatesFile), fxSpread)
+	limitService := services.NewLimitService(database.DB, fxService)
+	walletService := services.NewWalletService(database.DB, limitService)
+	production := cfg.Environment == "production"
+	if cfg.ProcessorWebhookSecret == "" && cfg.PaymentProcessor != services.ProcessorNone {
+		if production {
+			log.Fatal("PROCESSOR_WEBHOOK_SECRET must be set in production")
+		}
+		log.Println("⚠️  PROCESSOR_WEBHOOK_SECRET not set, deriving the webhook secret from JWT_SECRET")
+	}
+	webhookSecret := services.NewWebhookSecret(cfg.ProcessorWebhookSecret, cfg.JWTSecret)
+	processor, err := services.NewPaymentProcessor(cfg.PaymentProcessor, webhookSecret, production)
+	if err != nil {
+		log.Fatal("Invalid PAYMENT_PROCESSOR:", err)
+	}
+	if processor == nil {
+		log.Println("⚠️  No card processor configured, card top-ups are turned off")
+	}
+	topUpService := services.NewTopUpService(database.DB, processor)
+	transferService := services.NewTransferService(database.DB, rewardService, fxService, limitService)
+	billService := services.NewBillService(database.DB, rewardService, limitService)
 	loanService := services.NewLoanService(database.DB)
 	cardService := services.NewCardService(database.DB)
-	qrService := services.NewQRService(database.DB)
+	qrService := services.NewQRService(database.DB, limitService)
 	statementService := services.NewStatementService(database.DB)
+	ledgerService := services.NewLedgerService(database.DB)
+	idempotencyService := services.NewIdempotencyService(database.DB)
+	holdService := services.NewHoldService(database.DB)
+	refundService := services.NewRefundService(database.DB)
+	reconciliationService := services.NewReconciliationService(database.DB)
+	scheduledTransferService := services.NewScheduledTransferService(database.DB, transferService)
+	sharedWalletService := services.NewSharedWalletService(database.DB, limitService, transferService)
+	interestService := services.NewInterestService(database.DB)
+	paymentRequestService := services.NewPaymentRequestService(database.DB, transferService)
+	expenseGroupService := services.NewExpenseGroupService(database.DB, transferService)
+	claimExpiry, err := time.ParseDuration(cfg.ClaimLinkExpiry)
+	if err != nil {
+		log.Fatal("Invalid CLAIM_LINK_EXPIRY:", err)
+	}
+	claimService := services.NewClaimService(database.DB, transferService, emailService, smsService, cfg.FrontendURL, claimExpiry)
+	transferService.SetClaims(claimService)
+	bulkPayoutService := services.NewBulkPayoutService(database.DB, transferService)
+
+	if err := limitService.EnsureDefaults(); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	if err := interestService.EnsureRate(cfg.SavingsAPY); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	// Give wallets funded before the ledger existed an opening balance entry
+	if n, err := ledgerService.BackfillOpeningBalances(); err != nil {
+		log.Printf("⚠️  Ledger backfill failed: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ Backfilled opening balances for %d wallets", n)
+	}
 
 	// Sprint 4 services
 	insightService := services.NewInsightService(database.DB)
 	budgetService := services.NewBudgetService(database.DB)
 	subscriptionService := services.NewSubscriptionService(database.DB)
 	fraudService := services.NewFraudService(database.DB)
+	transferOTPThreshold, err := decimal.NewFromString(cfg.TransferOTPThreshold)
+	if err != nil {
+		log.Fatal("Invalid TRANSFER_OTP_THRESHOLD:", err)
+	}
+	transferService.SetVerification(services.NewTransferVerificationService(database.DB, transferService, otpService, fraudService, transferOTPThreshold))
 	notificationService := services.NewNotificationService(database.DB)
 	socialService := services.NewSocialService(database.DB)
 	adminService := services.NewAdminService(database.DB)
+	if n, err := adminService.GrantAdmins(strings.Split(cfg.AdminEmails, ",")); err != nil {
+		log.Printf("⚠️  %v", err)
+	} else if n > 0 {
+		log.Printf("✅ Granted the admin role to %d users", n)
+	}
 	invoiceService := services.NewInvoiceService(database.DB)
+	blobStore := services.NewLocalBlobStore(cfg.BlobDir)
+	annotationService := services.NewAnnotationService(database.DB, blobStore, insightService)
+	if cfg.StatementSigningKey == "" {
+		log.Println("⚠️  STATEMENT_SIGNING_KEY not set, deriving the statement key from JWT_SECRET")
+	}
+	statementKey, err := services.NewStatementSigningKey(cfg.StatementSigningKey, cfg.JWTSecret)
+	if err != nil {
+		log.Fatal("Invalid STATEMENT_SIGNING_KEY:", err)
+	}
+	statementArchiveService := services.NewStatementArchiveService(database.DB, statementService, blobStore, statementKey)
+	if cfg.BankAccountKey == "" {
+		log.Println("⚠️  BANK_ACCOUNT_KEY not set, deriving the bank account key from JWT_SECRET")
+	}
+	bankAccountKey, err := services.NewBankAccountKey(cfg.BankAccountKey, cfg.JWTSecret)
+	if err != nil {
+		log.Fatal("Invalid BANK_ACCOUNT_KEY:", err)
+	}
+	linkedAccountService := services.NewLinkedAccountService(database.DB, services.NewSimulatedBankAdapter(), bankAccountKey)
+	if !services.ValidRoutingNumber(cfg.ACHOriginRouting) {
+		log.Fatal("Invalid ACH_ORIGIN_ROUTING: ", cfg.ACHOriginRouting)
+	}
+	withdrawalService := services.NewWithdrawalService(database.DB, linkedAccountService, services.ACHOriginator{
+		RoutingNumber: cfg.ACHOriginRouting,
+		BankName:      cfg.ACHOriginBank,
+		CompanyName:   cfg.ACHCompanyName,
+		CompanyID:     cfg.ACHCompanyID,
+	}, cfg.ACHOutboxDir, cfg.ACHReturnsDir)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	walletHandler := handlers.NewWalletHandler(walletService)
+	walletHandler := handlers.NewWalletHandler(walletService, topUpService)
 	transferHandler := handlers.NewTransferHandler(transferService)
 	billHandler := handlers.NewBillHandler(billService)
 	rewardHandler := handlers.NewRewardHandler(rewardService)
 	loanHandler := handlers.NewLoanHandler(loanService)
 	cardHandler := handlers.NewCardHandler(cardService, otpService)
 	qrHandler := handlers.NewQRHandler(qrService)
-	statementHandler := handlers.NewStatementHandler(statementService)
+	statementHandler := handlers.NewStatementHandler(statementService, statementArchiveService)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
+	fxHandler := handlers.NewFXHandler(fxService)
+	holdHandler := handlers.NewHoldHandler(holdService)
+	refundHandler := handlers.NewRefundHandler(refundService)
+	reconciliationHandler := handlers.NewReconciliationHandler(reconciliationService)
+	scheduledTransferHandler := handlers.NewScheduledTransferHandler(scheduledTransferService)
+	limitHandler := handlers.NewLimitHandler(limitService)
+	sharedWalletHandler := handlers.NewSharedWalletHandler(sharedWalletService)
+	annotationHandler := handlers.NewAnnotationHandler(annotationService)
+	linkedAccountHandler := handlers.NewLinkedAccountHandler(linkedAccountService)
+	withdrawalHandler := handlers.NewWithdrawalHandler(withdrawalService)
+	topUpHandler := handlers.NewTopUpHandler(topUpService)
+	interestHandler := handlers.NewInterestHandler(interestService)
+	paymentRequestHandler := handlers.NewPaymentRequestHandler(paymentRequestService)
+	expenseGroupHandler := handlers.NewExpenseGroupHandler(expenseGroupService)
+	claimHandler := handlers.NewClaimHandler(claimService)
+	bulkPayoutHandler := handlers.NewBulkPayoutHandler(bulkPayoutService)
 
 	// Sprint 4 handlers
 	insightHandler := handlers.NewInsightHandler(insightService)
@@ -75,6 +185,32 @@ func main() {
 	adminHandler := handlers.NewAdminHandler(adminService)
 	invoiceHandler := handlers.NewInvoiceHandler(invoiceService)
 
+	// Background jobs
+	scheduler := services.NewScheduler()
+	scheduler.Every("expire-holds", time.Minute, holdService.ExpireHolds)
+	scheduler.Every("expire-card-topups", time.Minute, topUpService.ExpireStale)
+	scheduler.Every("run-scheduled-transfers", time.Minute, scheduledTransferService.RunDue)
+	scheduler.Every("expire-payment-requests", time.Minute, paymentRequestService.ExpireDue)
+	scheduler.Every("refund-expired-claims", time.Minute, claimService.RefundExpired)
+	scheduler.Every("purge-idempotency-keys", time.Hour, func() error {
+		_, err := idempotencyService.PurgeExpired()
+		return err
+	})
+	achInterval, err := time.ParseDuration(cfg.ACHBatchInterval)
+	if err != nil {
+		log.Fatal("Invalid ACH_BATCH_INTERVAL:", err)
+	}
+	scheduler.Every("ach-batch", achInterval, withdrawalService.RunBatch)
+	reconcileAt, err := time.Parse("15:04", cfg.ReconciliationTime)
+	if err != nil {
+		log.Fatal("Invalid RECONCILIATION_TIME:", err)
+	}
+	scheduler.DailyAt("accrue-interest", 0, 30, interestService.RunDaily)
+	scheduler.DailyAt("issue-monthly-statements", 3, 0, statementArchiveService.RunDue)
+	scheduler.DailyAt("reconcile-balances", reconcileAt.Hour(), reconcileAt.Minute(), reconciliationService.RunScheduled)
+	scheduler.Start()
+	defer scheduler.Stop()
+
 	// Setup Gin router
 	router := gin.Default()
 
@@ -83,8 +219,8 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     corsOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
@@ -94,7 +230,11 @@ func main() {
 	// Setup routes
 	routes.Setup(router, authHandler, walletHandler, transferHandler, billHandler, rewardHandler, tokenService, loanHandler, cardHandler, qrHandler, statementHandler,
 		// Sprint 4 handlers
-		insightHandler, budgetHandler, subscriptionHandler, fraudHandler, notificationHandler, socialHandler, adminHandler, invoiceHandler)
+		insightHandler, budgetHandler, subscriptionHandler, fraudHandler, notificationHandler, socialHandler, adminHandler, invoiceHandler,
+		ledgerHandler, idempotencyService, fxHandler, holdHandler, refundHandler,
+		reconciliationHandler, scheduledTransferHandler, limitHandler, sharedWalletHandler, annotationHandler,
+		linkedAccountHandler, withdrawalHandler, topUpHandler, interestHandler,
+		paymentRequestHandler, expenseGroupHandler, claimHandler, bulkPayoutHandler, adminService)
 
 	// Start server
 	log.Printf("🚀 GatorPay Backend running on port %s", cfg.Port)
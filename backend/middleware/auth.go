@@ -44,3 +44,19 @@ func AuthMiddleware(tokenService *services.TokenService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware only lets users with the admin role through. It runs after
+// AuthMiddleware and checks the role on every request, so taking it away
+// works at once.
+func AdminMiddleware(adminService *services.AdminService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		id, _ := userID.(string)
+		if id == "" || !adminService.IsAdmin(id) {
+			utils.ErrorResponse(c, http.StatusForbidden, "Admin access required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
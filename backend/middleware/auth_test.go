@@ -7,9 +7,12 @@ import (
 	"testing"
 
 	"gatorpay-backend/config"
+	"gatorpay-backend/models"
 	"gatorpay-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func init() {
@@ -141,3 +144,40 @@ func TestAuthMiddlewareBearerOnly(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
 	}
 }
+
+func TestAdminMiddlewareRequiresAdminRole(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.AutoMigrate(&models.User{})
+	admin := models.User{Email: "Root@Test.com", Username: "root", Phone: "1", FirstName: "R", LastName: "R"}
+	user := models.User{Email: "u@test.com", Username: "user", Phone: "2", FirstName: "U", LastName: "U"}
+	db.Create(&admin)
+	db.Create(&user)
+	adminService := services.NewAdminService(db)
+	if n, err := adminService.GrantAdmins([]string{" root@test.com", ""}); err != nil || n != 1 {
+		t.Fatalf("expected 1 admin granted, got %d (%v)", n, err)
+	}
+
+	tokenService := services.NewTokenService(&config.Config{JWTSecret: "test-secret"})
+	router := gin.New()
+	router.Use(AuthMiddleware(tokenService))
+	router.GET("/admin", AdminMiddleware(adminService), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+
+	for _, tc := range []struct {
+		userID string
+		status int
+	}{{admin.ID, http.StatusOK}, {user.ID, http.StatusForbidden}, {"missing", http.StatusForbidden}} {
+		token, _ := tokenService.GenerateToken(tc.userID)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("user %s: expected status %d, got %d", tc.userID, tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+	"gatorpay-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a POST safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// responseRecorder captures the response body while still writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the stored response when a request is retried
+// with the same Idempotency-Key, and rejects the key if the body changed.
+// Must run after AuthMiddleware; requests without the header pass through.
+func IdempotencyMiddleware(idempotencyService *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Failed to read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		record, replay, err := idempotencyService.Begin(c.GetString("userID"), key, c.Request.Method, c.Request.URL.Path, requestHash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+			c.Abort()
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyInFlight):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+			c.Abort()
+			return
+		case err != nil:
+			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+			c.Abort()
+			return
+		}
+
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		// A panicking handler never reached a final outcome, so free the key
+		// for a retry before passing the panic on to the recovery middleware
+		defer func() {
+			if r := recover(); r != nil {
+				releaseIdempotencyKey(idempotencyService, record)
+				panic(r)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not final, so the client may retry with the same key
+		if recorder.Status() >= http.StatusInternalServerError {
+			releaseIdempotencyKey(idempotencyService, record)
+			return
+		}
+		if err := idempotencyService.Complete(record, recorder.Status(), recorder.body.String()); err != nil {
+			// A key left processing would refuse every retry until it expires
+			log.Printf("⚠️  Failed to store the response for idempotency key %s: %v", record.Key, err)
+			releaseIdempotencyKey(idempotencyService, record)
+		}
+	}
+}
+
+// releaseIdempotencyKey frees a claimed key, logging when it cannot
+func releaseIdempotencyKey(idempotencyService *services.IdempotencyService, record *models.IdempotencyKey) {
+	if err := idempotencyService.Release(record); err != nil {
+		log.Printf("⚠️  Failed to release idempotency key %s: %v", record.Key, err)
+	}
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupIdempotencyRouter(t *testing.T, calls *int, status int) *gin.Engine {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.IdempotencyKey{})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		c.Next()
+	})
+	router.POST("/pay", IdempotencyMiddleware(services.NewIdempotencyService(db)), func(c *gin.Context) {
+		*calls++
+		c.JSON(status, gin.H{"call": *calls})
+	})
+	return router
+}
+
+func postWithKey(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/pay", bytes.NewBufferString(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysOriginalResponse(t *testing.T) {
+	calls := 0
+	router := setupIdempotencyRouter(t, &calls, http.StatusOK)
+
+	first := postWithKey(router, "key-1", `{"amount": 10}`)
+	second := postWithKey(router, "key-1", `{"amount": 10}`)
+
+	if calls != 1 {
+		t.Errorf("expected handler to run once, ran %d times", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("expected replayed response %d %s, got %d %s", first.Code, first.Body.String(), second.Code, second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected Idempotent-Replayed header on replay")
+	}
+}
+
+func TestIdempotencyRejectsDifferentBody(t *testing.T) {
+	calls := 0
+	router := setupIdempotencyRouter(t, &calls, http.StatusOK)
+
+	postWithKey(router, "key-1", `{"amount": 10}`)
+	w := postWithKey(router, "key-1", `{"amount": 99}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("expected handler to run once, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyWithoutKeyPassesThrough(t *testing.T) {
+	calls := 0
+	router := setupIdempotencyRouter(t, &calls, http.StatusOK)
+
+	postWithKey(router, "", `{"amount": 10}`)
+	postWithKey(router, "", `{"amount": 10}`)
+
+	if calls != 2 {
+		t.Errorf("expected handler to run twice, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	calls := 0
+	router := setupIdempotencyRouter(t, &calls, http.StatusInternalServerError)
+
+	postWithKey(router, "key-1", `{"amount": 10}`)
+	postWithKey(router, "key-1", `{"amount": 10}`)
+
+	if calls != 2 {
+		t.Errorf("expected a retry after a server error to run the handler again, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.IdempotencyKey{})
+
+	calls := 0
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		c.Next()
+	})
+	router.POST("/pay", IdempotencyMiddleware(services.NewIdempotencyService(db)), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("handler crashed")
+		}
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+
+	first := postWithKey(router, "key-1", `{"amount": 10}`)
+	second := postWithKey(router, "key-1", `{"amount": 10}`)
+
+	if first.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d from the panic, got %d", http.StatusInternalServerError, first.Code)
+	}
+	if second.Code != http.StatusOK || calls != 2 {
+		t.Errorf("expected the retry to run the handler again, got status %d after %d calls", second.Code, calls)
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TransactionAnnotation is what a user has added to one of their own
+// transactions. An empty Category leaves categorisation to the description.
+type TransactionAnnotation struct {
+	ID            string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	TransactionID string    `gorm:"type:varchar(36);uniqueIndex;not null" json:"transaction_id"`
+	UserID        string    `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Category      string    `gorm:"type:varchar(50)" json:"category,omitempty"` // overrides the guessed spending category
+	Tags          []string  `gorm:"type:text;serializer:json" json:"tags"`
+	Note          string    `gorm:"type:text" json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Receipts      []Receipt `gorm:"foreignKey:TransactionID;references:TransactionID" json:"receipts,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (a *TransactionAnnotation) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Receipt is an image or PDF attached to a transaction. The file itself
+// lives in the blob store under BlobKey.
+type Receipt struct {
+	ID            string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	TransactionID string    `gorm:"type:varchar(36);index;not null" json:"transaction_id"`
+	UserID        string    `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	FileName      string    `gorm:"not null" json:"file_name"`
+	ContentType   string    `gorm:"type:varchar(100);not null" json:"content_type"`
+	Size          int64     `gorm:"not null" json:"size"`
+	BlobKey       string    `gorm:"not null" json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *Receipt) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
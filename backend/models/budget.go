@@ -23,6 +23,7 @@ type BudgetGoal struct {
 	CreatedAt     time.Time       `json:"created_at"`
 	UpdatedAt     time.Time       `json:"updated_at"`
 	DeletedAt     gorm.DeletedAt  `gorm:"index" json:"-"`
+	Pocket        *Pocket         `gorm:"foreignKey:GoalID" json:"pocket,omitempty"`
 }
 
 func (b *BudgetGoal) BeforeCreate(tx *gorm.DB) error {
@@ -32,6 +33,27 @@ func (b *BudgetGoal) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Pocket is a sub-balance of a user's wallet that holds the money saved
+// towards a goal. Money in a pocket has left the wallet and cannot be spent
+// until it is moved back. The balance is kept in step with the ledger.
+type Pocket struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID    string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	GoalID    string          `gorm:"type:varchar(36);uniqueIndex;not null" json:"goal_id"`
+	WalletID  string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"` // wallet money moves in from and out to
+	Balance   decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"balance"`
+	Currency  string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (p *Pocket) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
 // AutoSaveRule represents an auto-save rule (round-up or auto-transfer)
 type AutoSaveRule struct {
 	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
@@ -41,6 +63,7 @@ type AutoSaveRule struct {
 	Amount    decimal.Decimal `gorm:"type:decimal(12,2)" json:"amount"`      // for auto_transfer
 	Frequency string          `gorm:"type:varchar(20)" json:"frequency"`     // "daily", "weekly", "monthly"
 	IsActive  bool            `gorm:"default:true" json:"is_active"`
+	LastRunAt *time.Time      `json:"last_run_at,omitempty"` // round-ups cover transactions after this
 	CreatedAt time.Time       `json:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at"`
 	DeletedAt gorm.DeletedAt  `gorm:"index" json:"-"`
@@ -70,3 +93,23 @@ type CreateAutoSaveRequest struct {
 	Amount    float64 `json:"amount"`
 	Frequency string  `json:"frequency"`
 }
+
+// PocketMoveRequest is the request body for moving money into or out of a goal's pocket
+type PocketMoveRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// CategorySpend is what a user spent in one category over a month
+type CategorySpend struct {
+	Category string          `json:"category"`
+	Amount   decimal.Decimal `json:"amount"`
+	Count    int             `json:"count"`
+}
+
+// SpendingBreakdown groups a month's spending by category, honouring the
+// user's category overrides
+type SpendingBreakdown struct {
+	Month      string          `json:"month"` // YYYY-MM
+	Total      decimal.Decimal `json:"total"`
+	Categories []CategorySpend `json:"categories"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Bulk payout status enum values
+const (
+	BulkPayoutValidated  = "validated"  // dry-run done, waiting to be executed
+	BulkPayoutProcessing = "processing" // being executed
+	BulkPayoutCompleted  = "completed"  // every row was sent
+	BulkPayoutPartial    = "partially_completed"
+	BulkPayoutFailed     = "failed" // nothing was sent
+)
+
+// Bulk payout mode enum values
+const (
+	BulkPayoutAllOrNothing = "all_or_nothing" // one failed row cancels the whole batch
+	BulkPayoutBestEffort   = "best_effort"    // failed rows are skipped, the rest are sent
+)
+
+// Bulk payout row status enum values
+const (
+	BulkRowReady   = "ready"   // passed the dry-run
+	BulkRowInvalid = "invalid" // failed the dry-run
+	BulkRowSent    = "sent"
+	BulkRowFailed  = "failed"
+	BulkRowSkipped = "skipped" // would have been sent, but another row failed an all-or-nothing batch
+)
+
+// BulkPayout is a batch of transfers uploaded as a CSV file. It is checked
+// with a dry-run when uploaded and only moves money once executed.
+type BulkPayout struct {
+	ID                   string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	SenderID             string          `gorm:"type:varchar(36);index;not null" json:"sender_id"`
+	FileName             string          `json:"file_name"`
+	Currency             string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Status               string          `gorm:"type:varchar(20);index;default:validated" json:"status"`
+	Mode                 string          `gorm:"type:varchar(20)" json:"mode,omitempty"` // set when executed
+	RowCount             int             `json:"row_count"`
+	InvalidCount         int             `json:"invalid_count"` // rows that failed the dry-run
+	SentCount            int             `json:"sent_count"`
+	FailedCount          int             `json:"failed_count"`
+	TotalAmount          decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"total_amount"`
+	SentAmount           decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"sent_amount"`
+	VerificationRequired bool            `json:"verification_required"` // executing needs a transfer code
+	ExecutedAt           *time.Time      `json:"executed_at,omitempty"`
+	CreatedAt            time.Time       `json:"created_at"`
+	UpdatedAt            time.Time       `json:"updated_at"`
+	Rows                 []BulkPayoutRow `gorm:"foreignKey:PayoutID" json:"rows,omitempty"`
+}
+
+// BulkPayoutRow is one line of a bulk payout file and what became of it
+type BulkPayoutRow struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	PayoutID      string          `gorm:"type:varchar(36);index;not null" json:"payout_id"`
+	Line          int             `json:"line"`      // line number in the uploaded file
+	Recipient     string          `json:"recipient"` // username, email, or phone as entered
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2)" json:"amount"`
+	Note          string          `json:"note"`
+	Status        string          `gorm:"type:varchar(20);default:ready" json:"status"`
+	Error         string          `json:"error,omitempty"`
+	TransactionID *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (b *BulkPayout) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == "" {
+		b.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *BulkPayoutRow) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Claim link status enum values
+const (
+	ClaimStatusPending   = "pending"   // held in escrow for the recipient
+	ClaimStatusClaimed   = "claimed"   // paid into the recipient's wallet
+	ClaimStatusCancelled = "cancelled" // withdrawn by the sender and refunded
+	ClaimStatusRefunded  = "refunded"  // expired unclaimed and refunded
+)
+
+// Claim link contact type enum values
+const (
+	ClaimContactEmail = "email"
+	ClaimContactPhone = "phone"
+)
+
+// ClaimLink is money sent to an email or phone number with no account behind
+// it. The money sits in escrow until the owner of that email or number signs
+// up, verifies it and claims it with the link's token, or it expires and
+// goes back.
+type ClaimLink struct {
+	ID          string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	SenderID    string          `gorm:"type:varchar(36);index;not null" json:"sender_id"`
+	Contact     string          `gorm:"index;not null" json:"contact"`                 // lower-cased email, or 10-digit phone number
+	ContactType string          `gorm:"type:varchar(10);not null" json:"contact_type"` // email, phone
+	Amount      decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency    string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Note        string          `json:"note"`
+	TokenHash   string          `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"` // SHA-256 of the token in the link
+	Status      string          `gorm:"type:varchar(20);index;default:pending" json:"status"`
+	ExpiresAt   time.Time       `gorm:"index;not null" json:"expires_at"`
+	ClaimedBy   *string         `gorm:"type:varchar(36)" json:"claimed_by,omitempty"`
+	ResolvedAt  *time.Time      `json:"resolved_at,omitempty"` // when it stopped being pending
+
+	SendTransactionID   string  `gorm:"type:varchar(36);not null" json:"send_transaction_id"`
+	ClaimTransactionID  *string `gorm:"type:varchar(36)" json:"claim_transaction_id,omitempty"`
+	RefundTransactionID *string `gorm:"type:varchar(36)" json:"refund_transaction_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Sender    *User     `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (c *ClaimLink) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Deposit status enum values
+const (
+	DepositPending   = "pending"   // waiting for the next ACH file
+	DepositSubmitted = "submitted" // debit sent to the bank, not yet in the wallet
+	DepositSettled   = "settled"   // the return window passed; the money is in the wallet
+	DepositReturned  = "returned"  // the user's bank refused the debit
+)
+
+// Deposit tracks money pulled from a linked bank account with an ACH debit.
+// Its deposit transaction stays pending, and the wallet is only credited,
+// once the return window passes. A return before then fails the
+// transaction; a later one takes the money back out of the wallet.
+type Deposit struct {
+	ID              string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID          string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	WalletID        string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	TransactionID   string          `gorm:"type:varchar(36);index;not null" json:"transaction_id"` // the deposit transaction
+	LinkedAccountID string          `gorm:"type:varchar(36);index;not null" json:"linked_account_id"`
+	AccountLabel    string          `json:"account_label"` // e.g. "JPMorgan Chase ••••6789"
+	Amount          decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency        string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Status          string          `gorm:"type:varchar(20);index;default:pending" json:"status"` // pending, submitted, settled, returned
+
+	// Set when the debit is put in an ACH file
+	ACHFileID   *string    `gorm:"type:varchar(36);index" json:"ach_file_id,omitempty"`
+	TraceNumber string     `gorm:"type:varchar(15);index" json:"trace_number,omitempty"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	SettledAt   *time.Time `json:"settled_at,omitempty"`
+
+	// Set when the bank returns the debit
+	ReturnCode          string     `gorm:"type:varchar(3)" json:"return_code,omitempty"` // e.g. R01
+	ReturnReason        string     `json:"return_reason,omitempty"`
+	ReturnTransactionID *string    `gorm:"type:varchar(36)" json:"return_transaction_id,omitempty"` // the charge-back, for returns after settlement
+	ReturnedAt          *time.Time `json:"returned_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (d *Deposit) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
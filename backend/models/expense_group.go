@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Group expense split type enum values
+const (
+	ExpenseSplitEqual  = "equal"  // the amount is divided evenly between participants
+	ExpenseSplitShares = "shares" // each participant carries a weighted number of shares
+	ExpenseSplitExact  = "exact"  // each participant's amount is given outright
+)
+
+// ExpenseGroup is a set of users who share costs such as dinners or rent and
+// settle up between themselves. It holds no money of its own.
+type ExpenseGroup struct {
+	ID        string               `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Name      string               `gorm:"not null" json:"name"`
+	Currency  string               `gorm:"type:varchar(3);default:USD" json:"currency"`
+	CreatedBy string               `gorm:"type:varchar(36);not null" json:"created_by"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Members   []ExpenseGroupMember `gorm:"foreignKey:GroupID" json:"members,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (g *ExpenseGroup) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ExpenseGroupMember is a user's place in an expense group
+type ExpenseGroupMember struct {
+	ID        string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	GroupID   string    `gorm:"type:varchar(36);uniqueIndex:idx_expense_group_member;not null" json:"group_id"`
+	UserID    string    `gorm:"type:varchar(36);uniqueIndex:idx_expense_group_member;index;not null" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (m *ExpenseGroupMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// GroupExpense is a cost one member paid on behalf of others in the group
+type GroupExpense struct {
+	ID          string              `gorm:"type:varchar(36);primaryKey" json:"id"`
+	GroupID     string              `gorm:"type:varchar(36);index;not null" json:"group_id"`
+	PaidBy      string              `gorm:"type:varchar(36);not null" json:"paid_by"`
+	CreatedBy   string              `gorm:"type:varchar(36);not null" json:"created_by"`
+	Description string              `gorm:"not null" json:"description"`
+	Amount      decimal.Decimal     `gorm:"type:decimal(20,2);not null" json:"amount"`
+	SplitType   string              `gorm:"type:varchar(10);not null" json:"split_type"` // equal, shares, exact
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt      `gorm:"index" json:"-"`
+	Payer       *User               `gorm:"foreignKey:PaidBy" json:"payer,omitempty"`
+	Shares      []GroupExpenseShare `gorm:"foreignKey:ExpenseID" json:"shares,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (e *GroupExpense) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// GroupExpenseShare is one participant's part of an expense. The shares
+// always add up to the expense amount, the payer's own part included.
+type GroupExpenseShare struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	ExpenseID string          `gorm:"type:varchar(36);index;not null" json:"expense_id"`
+	UserID    string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Weight    int             `gorm:"default:0" json:"weight,omitempty"` // for split by shares
+	Amount    decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (s *GroupExpenseShare) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// GroupSettlement is a P2P transfer one member made to another to pay down
+// what they owed in the group
+type GroupSettlement struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	GroupID       string          `gorm:"type:varchar(36);index;not null" json:"group_id"`
+	FromUserID    string          `gorm:"type:varchar(36);not null" json:"from_user_id"`
+	ToUserID      string          `gorm:"type:varchar(36);not null" json:"to_user_id"`
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	TransactionID string          `gorm:"type:varchar(36);not null" json:"transaction_id"` // the payer's p2p_send
+	CreatedAt     time.Time       `json:"created_at"`
+	From          *User           `gorm:"foreignKey:FromUserID" json:"from,omitempty"`
+	To            *User           `gorm:"foreignKey:ToUserID" json:"to,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (s *GroupSettlement) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// FXQuote is a priced currency conversion a user can execute until it expires
+type FXQuote struct {
+	ID           string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID       string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	FromCurrency string          `gorm:"type:varchar(3);not null" json:"from_currency"`
+	ToCurrency   string          `gorm:"type:varchar(3);not null" json:"to_currency"`
+	MidRate      decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"mid_rate"`
+	Spread       decimal.Decimal `gorm:"type:decimal(10,6);not null" json:"spread"`
+	Rate         decimal.Decimal `gorm:"type:decimal(20,8);not null" json:"rate"` // mid rate less the spread
+	SourceAmount decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"source_amount"`
+	TargetAmount decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"target_amount"`
+	ExpiresAt    time.Time       `gorm:"not null" json:"expires_at"`
+	UsedAt       *time.Time      `json:"used_at,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (q *FXQuote) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == "" {
+		q.ID = uuid.New().String()
+	}
+	return nil
+}
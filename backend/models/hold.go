@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Hold status enum values
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold type enum values
+const (
+	HoldTypeCard        = "card"
+	HoldTypeWithdrawal  = "withdrawal"   // a bank payout waiting to settle
+	HoldTypeQR          = "qr"           // a QR payment waiting for the merchant to capture it
+	HoldTypeTopUpRefund = "topup_refund" // a card top-up being refunded by the processor
+)
+
+// Hold reserves part of a wallet's balance for a payment that has been
+// authorized but not yet settled. Reserved funds stay in the ledger balance
+// but are excluded from the available balance until captured or released.
+type Hold struct {
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	WalletID       string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	UserID         string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Type           string          `gorm:"type:varchar(20);not null" json:"type"`
+	Reference      string          `gorm:"type:varchar(36);index" json:"reference"` // the card, bank account or merchant being paid
+	Description    string          `json:"description"`
+	Amount         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	CapturedAmount decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"captured_amount"`
+	Status         string          `gorm:"type:varchar(20);index;default:active" json:"status"`
+	ExpiresAt      *time.Time      `gorm:"index" json:"expires_at,omitempty"` // nil holds never expire
+	SettledAt      *time.Time      `json:"settled_at,omitempty"`              // captured, released or expired
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (h *Hold) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Remaining is the part of the hold still reserved
+func (h *Hold) Remaining() decimal.Decimal {
+	return h.Amount.Sub(h.CapturedAmount)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Idempotency key status enum values
+const (
+	IdempotencyStatusProcessing = "processing"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+// IdempotencyKey stores the request fingerprint and response of a
+// money-moving request so a retried request can be answered from the store
+type IdempotencyKey struct {
+	ID           string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID       string    `gorm:"type:varchar(36);uniqueIndex:idx_idempotency_user_key;not null" json:"user_id"`
+	Key          string    `gorm:"column:idempotency_key;type:varchar(255);uniqueIndex:idx_idempotency_user_key;not null" json:"key"`
+	Method       string    `gorm:"type:varchar(10);not null" json:"method"`
+	Path         string    `gorm:"not null" json:"path"`
+	RequestHash  string    `gorm:"type:varchar(64);not null" json:"-"`
+	Status       string    `gorm:"type:varchar(20);default:processing" json:"status"` // processing, completed
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `gorm:"type:text" json:"-"`
+	ExpiresAt    time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.New().String()
+	}
+	return nil
+}
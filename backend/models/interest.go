@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// InterestRate is one entry of the savings APY history. A rate applies to
+// every day from its effective date until the next rate takes over.
+type InterestRate struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	APY           decimal.Decimal `gorm:"type:decimal(7,4);not null" json:"apy"`                       // annual percentage yield, e.g. 4.25
+	EffectiveFrom string          `gorm:"type:varchar(10);uniqueIndex;not null" json:"effective_from"` // YYYY-MM-DD
+	SetBy         string          `gorm:"type:varchar(36)" json:"set_by,omitempty"`                    // admin who set it; empty for the configured default
+	Note          string          `json:"note,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *InterestRate) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// InterestAccrual is one day of interest earned by a savings pocket. Amounts
+// keep ten decimal places; they are only rounded to cents when paid out.
+type InterestAccrual struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	PocketID  string          `gorm:"type:varchar(36);uniqueIndex:idx_interest_accrual_day;not null" json:"pocket_id"`
+	Date      string          `gorm:"type:varchar(10);uniqueIndex:idx_interest_accrual_day;index;not null" json:"date"` // YYYY-MM-DD
+	UserID    string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Balance   decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"balance"` // pocket balance at the end of the day
+	APY       decimal.Decimal `gorm:"type:decimal(7,4);not null" json:"apy"`
+	Amount    decimal.Decimal `gorm:"type:decimal(24,10);not null" json:"amount"`
+	PayoutID  *string         `gorm:"type:varchar(36);index" json:"payout_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (a *InterestAccrual) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// InterestPayout pays one month of a pocket's accrued interest into it. The
+// fraction of a cent that cannot be paid is carried into the next month.
+type InterestPayout struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	PocketID      string          `gorm:"type:varchar(36);uniqueIndex:idx_interest_payout_month;not null" json:"pocket_id"`
+	Month         string          `gorm:"type:varchar(7);uniqueIndex:idx_interest_payout_month;not null" json:"month"` // YYYY-MM
+	UserID        string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Accrued       decimal.Decimal `gorm:"type:decimal(24,10);not null" json:"accrued"`            // the month's daily accruals
+	CarriedIn     decimal.Decimal `gorm:"type:decimal(24,10);not null" json:"carried_in"`         // left over from the previous payout
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`              // paid, rounded down to the cent
+	Remainder     decimal.Decimal `gorm:"type:decimal(24,10);not null" json:"remainder"`          // carried into the next payout
+	TransactionID *string         `gorm:"type:varchar(36);index" json:"transaction_id,omitempty"` // the interest transaction; nil when nothing was paid
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (p *InterestPayout) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// SetInterestRateRequest is the request body for changing the savings APY
+type SetInterestRateRequest struct {
+	APY           *float64 `json:"apy" binding:"required,gte=0,lte=20"`
+	EffectiveFrom string   `json:"effective_from"` // YYYY-MM-DD, today when empty
+	Note          string   `json:"note"`
+}
+
+// AccrueInterestRequest is the request body for accruing one day's interest again
+type AccrueInterestRequest struct {
+	Date string `json:"date" binding:"required"` // YYYY-MM-DD
+}
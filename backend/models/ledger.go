@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Ledger account type enum values
+const (
+	LedgerAccountAsset     = "asset"
+	LedgerAccountLiability = "liability"
+	LedgerAccountEquity    = "equity"
+	LedgerAccountRevenue   = "revenue"
+	LedgerAccountExpense   = "expense"
+)
+
+// Platform ledger account codes
+const (
+	LedgerPlatformCash         = "platform:cash"          // settlement bank funds backing deposits and withdrawals
+	LedgerPlatformBillers      = "platform:billers"       // bill payments owed to billers
+	LedgerPlatformFees         = "platform:fees"          // merchant fee revenue
+	LedgerPlatformCashback     = "platform:cashback"      // cashback paid out to users
+	LedgerPlatformLoans        = "platform:loans"         // loan principal receivable
+	LedgerPlatformLoanInterest = "platform:loan_interest" // interest earned on loans
+	LedgerPlatformOpening      = "platform:opening"       // balances that existed before the ledger
+	LedgerPlatformFX           = "platform:fx"            // currency position taken on conversions
+	LedgerPlatformCardNetwork  = "platform:card_network"  // captured card spends owed to the card network
+	LedgerPlatformProcessor    = "platform:processor"     // card top-ups the payment processor owes us
+	LedgerPlatformInterest     = "platform:interest"      // interest paid on savings pockets
+	LedgerPlatformClaims       = "platform:claims"        // money sent by claim link that nobody has claimed yet
+)
+
+// Posting direction enum values
+const (
+	PostingDebit  = "debit"
+	PostingCredit = "credit"
+)
+
+// Journal entry type enum values
+const (
+	JournalTypeDeposit          = "deposit"
+	JournalTypeWithdraw         = "withdraw"
+	JournalTypeP2P              = "p2p"
+	JournalTypeBillPay          = "bill_pay"
+	JournalTypeQRPayment        = "qr_payment"
+	JournalTypeCashback         = "cashback"
+	JournalTypeLoanDisbursement = "loan_disbursement"
+	JournalTypeLoanPayment      = "loan_emi_payment"
+	JournalTypeLoanReversal     = "loan_reversal"
+	JournalTypeOpeningBalance   = "opening_balance"
+	JournalTypeFXConversion     = "fx_conversion"
+	JournalTypeCardSpend        = "card_spend"
+	JournalTypeRefund           = "refund"
+	JournalTypePocketTransfer   = "pocket_transfer"
+	JournalTypeSharedDeposit    = "shared_deposit"
+	JournalTypeSharedPayout     = "shared_payout"
+	JournalTypeACHSettlement    = "ach_settlement"
+	JournalTypeACHReturn        = "ach_return"
+	JournalTypeCardTopUp        = "card_topup"
+	JournalTypeTopUpRefund      = "topup_refund"
+	JournalTypeInterest         = "interest"
+	JournalTypeClaim            = "claim"
+)
+
+// LedgerAccount is a double-entry account. Every wallet and savings pocket is
+// mirrored by a liability account; platform accounts hold the other side of
+// each entry.
+type LedgerAccount struct {
+	ID        string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Code      string    `gorm:"type:varchar(80);uniqueIndex;not null" json:"code"`
+	Name      string    `gorm:"not null" json:"name"`
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"` // asset, liability, equity, revenue, expense
+	WalletID  *string   `gorm:"type:varchar(36);index" json:"wallet_id,omitempty"`
+	PocketID  *string   `gorm:"type:varchar(36);index" json:"pocket_id,omitempty"`
+	Currency  string    `gorm:"type:varchar(3);default:USD" json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (a *LedgerAccount) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// JournalEntry groups the postings of a single balanced money movement
+type JournalEntry struct {
+	ID          string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Type        string    `gorm:"type:varchar(40);index;not null" json:"type"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Postings    []Posting `gorm:"foreignKey:JournalEntryID" json:"postings,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (j *JournalEntry) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == "" {
+		j.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Posting is one debit or credit line of a journal entry
+type Posting struct {
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	JournalEntryID string          `gorm:"type:varchar(36);index;not null" json:"journal_entry_id"`
+	AccountID      string          `gorm:"type:varchar(36);index;not null" json:"account_id"`
+	Direction      string          `gorm:"type:varchar(6);not null" json:"direction"` // debit, credit
+	Amount         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Account        *LedgerAccount  `gorm:"foreignKey:AccountID" json:"account,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (p *Posting) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
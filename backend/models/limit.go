@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Limit category enum values: the kinds of outgoing payment that are limited
+const (
+	LimitCategoryP2P        = "p2p"
+	LimitCategoryWithdrawal = "withdrawal"
+	LimitCategoryBill       = "bill"
+	LimitCategoryQR         = "qr"
+)
+
+// Limit period enum values. Periods are rolling windows ending now.
+const (
+	LimitPeriodDaily   = "daily"   // last 24 hours
+	LimitPeriodWeekly  = "weekly"  // last 7 days
+	LimitPeriodMonthly = "monthly" // last 30 days
+)
+
+// SpendingLimit caps how much a user at a KYC tier may send in one category
+// over one period. Amounts are in the default currency.
+type SpendingLimit struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	KYCStatus string          `gorm:"type:varchar(20);uniqueIndex:idx_spending_limit;not null" json:"kyc_status"`
+	Category  string          `gorm:"type:varchar(20);uniqueIndex:idx_spending_limit;not null" json:"category"`
+	Period    string          `gorm:"type:varchar(20);uniqueIndex:idx_spending_limit;not null" json:"period"`
+	Amount    decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (l *SpendingLimit) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// LimitUsage records one outgoing payment counted against a user's limits,
+// valued in the default currency at the time it was made. Money that comes
+// back, through a refund, a return or a released hold, is recorded as a
+// negative usage under the same reference, dated like the payment.
+type LimitUsage struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID    string          `gorm:"type:varchar(36);index:idx_limit_usage_user;not null" json:"user_id"`
+	Category  string          `gorm:"type:varchar(20);index:idx_limit_usage_user;not null" json:"category"`
+	Reference string          `gorm:"type:varchar(36);index" json:"reference"` // the hold or transaction counted
+	Amount    decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	CreatedAt time.Time       `gorm:"index:idx_limit_usage_user" json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (u *LimitUsage) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Linked bank account status enum values
+const (
+	LinkedAccountPending  = "pending"  // micro-deposits sent, waiting for the user to confirm them
+	LinkedAccountVerified = "verified" // can be used for deposits and withdrawals
+	LinkedAccountFailed   = "failed"   // too many wrong micro-deposit guesses
+)
+
+// Linked bank account type enum values
+const (
+	BankAccountChecking = "checking"
+	BankAccountSavings  = "savings"
+)
+
+// LinkedBankAccount is an external US bank account a user moves money to
+// and from. The account number is kept encrypted for ACH files; everything
+// shown to the user uses the mask.
+type LinkedBankAccount struct {
+	ID                 string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID             string `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Nickname           string `json:"nickname"`
+	HolderName         string `gorm:"not null" json:"holder_name"`
+	BankName           string `json:"bank_name"`
+	RoutingNumber      string `gorm:"type:varchar(9);not null" json:"routing_number"`
+	AccountType        string `gorm:"type:varchar(10);not null" json:"account_type"` // checking, savings
+	AccountMask        string `gorm:"type:varchar(8);not null" json:"account_mask"`  // last four digits, e.g. ••••6789
+	AccountNumberEnc   string `gorm:"type:text;not null" json:"-"`                   // AES-GCM sealed account number
+	AccountFingerprint string `gorm:"type:varchar(64);index;not null" json:"-"`      // keyed hash to spot duplicates
+	Status             string `gorm:"type:varchar(10);index;not null" json:"status"` // pending, verified, failed
+
+	// Micro-deposit amounts in cents, and the user's attempts at confirming them
+	MicroDeposit1        int64      `json:"-"`
+	MicroDeposit2        int64      `json:"-"`
+	VerificationAttempts int        `gorm:"default:0" json:"verification_attempts"`
+	MicroDepositsSentAt  *time.Time `json:"micro_deposits_sent_at,omitempty"`
+	VerifiedAt           *time.Time `json:"verified_at,omitempty"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (a *LinkedBankAccount) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Label is how the account is named in transaction descriptions
+func (a *LinkedBankAccount) Label() string {
+	name := a.Nickname
+	if name == "" {
+		name = a.BankName
+	}
+	if name == "" {
+		name = "Bank account"
+	}
+	return name + " " + a.AccountMask
+}
+
+// LinkAccountRequest is the DTO for linking a bank account
+type LinkAccountRequest struct {
+	RoutingNumber string `json:"routing_number" binding:"required"`
+	AccountNumber string `json:"account_number" binding:"required"`
+	AccountType   string `json:"account_type"` // defaults to checking
+	HolderName    string `json:"holder_name" binding:"required"`
+	Nickname      string `json:"nickname"`
+}
+
+// VerifyAccountRequest is the DTO for confirming micro-deposit amounts, in dollars
+type VerifyAccountRequest struct {
+	Amounts []float64 `json:"amounts" binding:"required,len=2"`
+}
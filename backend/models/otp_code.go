@@ -12,6 +12,7 @@ const (
 	OTPPurposeRegister = "register"
 	OTPPurposeLogin    = "login"
 	OTPPurposeTransfer = "transfer"
+	OTPPurposePhone    = "phone" // verifying the account's phone number
 )
 
 // OTPCode stores verification codes for 2-step authentication
@@ -19,7 +20,7 @@ type OTPCode struct {
 	ID        string    `gorm:"type:varchar(36);primaryKey" json:"id"`
 	UserID    string    `gorm:"type:varchar(36);index;not null" json:"user_id"`
 	Code      string    `gorm:"type:varchar(6);not null" json:"-"`
-	Purpose   string    `gorm:"type:varchar(20);not null" json:"purpose"` // register, login, transfer
+	Purpose   string    `gorm:"type:varchar(20);not null" json:"purpose"` // register, login, transfer, phone
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
 	Attempts  int       `gorm:"default:0" json:"attempts"`
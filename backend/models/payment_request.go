@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Payment request status enum values
+const (
+	PaymentRequestPending   = "pending"
+	PaymentRequestPaid      = "paid"
+	PaymentRequestDeclined  = "declined"
+	PaymentRequestExpired   = "expired"
+	PaymentRequestCancelled = "cancelled" // withdrawn by the requester
+)
+
+// PaymentRequest is one user asking another for money. The payer can pay it
+// in one step, decline it or let it expire.
+type PaymentRequest struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	RequesterID   string          `gorm:"type:varchar(36);index;not null" json:"requester_id"` // who gets paid
+	PayerID       string          `gorm:"type:varchar(36);index;not null" json:"payer_id"`
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency      string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Note          string          `json:"note"`
+	Status        string          `gorm:"type:varchar(20);index;default:pending" json:"status"` // pending, paid, declined, expired, cancelled
+	ExpiresAt     time.Time       `gorm:"index;not null" json:"expires_at"`
+	TransactionID *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"` // the payer's p2p_send
+	DeclineReason string          `json:"decline_reason,omitempty"`
+	Reminders     int             `gorm:"default:0" json:"reminders"`
+	RemindedAt    *time.Time      `json:"reminded_at,omitempty"`
+	RespondedAt   *time.Time      `json:"responded_at,omitempty"` // when it stopped being pending
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+
+	Requester *User `gorm:"foreignKey:RequesterID" json:"requester,omitempty"`
+	Payer     *User `gorm:"foreignKey:PayerID" json:"payer,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *PaymentRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
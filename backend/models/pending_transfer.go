@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Pending transfer status enum values
+const (
+	PendingTransferVerification = "pending_verification" // waiting for the sender's code
+	PendingTransferCompleted    = "completed"
+	PendingTransferFailed       = "failed"  // confirmed, but the transfer itself was refused
+	PendingTransferExpired      = "expired" // not confirmed in time, or replaced by a newer one
+)
+
+// Step-up reason enum values
+const (
+	StepUpReasonAmount = "amount" // over the verification threshold
+	StepUpReasonRisk   = "risk"   // flagged by the risk engine
+)
+
+// PendingTransfer is a transfer held until the sender proves it is them with
+// a one-time code. Nothing moves until it is confirmed.
+type PendingTransfer struct {
+	ID            string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	SenderID      string          `gorm:"type:varchar(36);index;not null" json:"sender_id"`
+	Recipient     string          `gorm:"not null" json:"recipient"` // username, email, or phone as entered
+	Amount        decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency      string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Note          string          `json:"note"`
+	Reason        string          `gorm:"type:varchar(10);not null" json:"reason"` // amount, risk
+	RiskScore     float64         `json:"risk_score"`
+	Status        string          `gorm:"type:varchar(20);index;default:pending_verification" json:"status"`
+	ExpiresAt     time.Time       `gorm:"not null" json:"expires_at"`
+	TransactionID *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"` // the sender's record once sent
+	FailureReason string          `json:"failure_reason,omitempty"`
+	ConfirmedAt   *time.Time      `json:"confirmed_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (p *PendingTransfer) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Reconciliation run trigger enum values
+const (
+	ReconciliationTriggerScheduled = "scheduled"
+	ReconciliationTriggerManual    = "manual"
+)
+
+// Reconciliation run status enum values
+const (
+	ReconciliationStatusRunning   = "running"
+	ReconciliationStatusCompleted = "completed"
+	ReconciliationStatusFailed    = "failed"
+)
+
+// Reconciliation discrepancy issue enum values
+const (
+	DiscrepancyUnposted   = "unposted"   // transaction with no journal entry behind it
+	DiscrepancyAmount     = "amount"     // transaction amount differs from what its journal entry posted
+	DiscrepancyUnrecorded = "unrecorded" // journal entry moved the wallet without a transaction row
+)
+
+// ReconciliationRun is one pass of the balance reconciliation engine over every wallet
+type ReconciliationRun struct {
+	ID             string                   `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Trigger        string                   `gorm:"type:varchar(20);not null" json:"trigger"`             // scheduled, manual
+	Status         string                   `gorm:"type:varchar(20);index;default:running" json:"status"` // running, completed, failed
+	WalletsChecked int                      `json:"wallets_checked"`
+	MismatchCount  int                      `json:"mismatch_count"`
+	Error          string                   `json:"error,omitempty"`
+	StartedAt      time.Time                `gorm:"index" json:"started_at"`
+	FinishedAt     *time.Time               `json:"finished_at,omitempty"`
+	Mismatches     []ReconciliationMismatch `gorm:"foreignKey:RunID" json:"mismatches,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *ReconciliationRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ReconciliationMismatch is a wallet whose stored balances disagree with
+// what its transactions, ledger postings or holds add up to
+type ReconciliationMismatch struct {
+	ID                 string                      `gorm:"type:varchar(36);primaryKey" json:"id"`
+	RunID              string                      `gorm:"type:varchar(36);index;not null" json:"run_id"`
+	WalletID           string                      `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	UserID             string                      `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	Currency           string                      `gorm:"type:varchar(3)" json:"currency"`
+	StoredBalance      decimal.Decimal             `gorm:"type:decimal(20,2)" json:"stored_balance"`
+	TransactionBalance decimal.Decimal             `gorm:"type:decimal(20,2)" json:"transaction_balance"` // net of successful transactions
+	LedgerBalance      decimal.Decimal             `gorm:"type:decimal(20,2)" json:"ledger_balance"`      // net of ledger postings
+	HeldBalance        decimal.Decimal             `gorm:"type:decimal(20,2)" json:"held_balance"`
+	ActiveHolds        decimal.Decimal             `gorm:"type:decimal(20,2)" json:"active_holds"` // remaining amount of active holds
+	Difference         decimal.Decimal             `gorm:"type:decimal(20,2)" json:"difference"`   // stored minus transaction balance
+	Discrepancies      []ReconciliationDiscrepancy `gorm:"foreignKey:MismatchID" json:"discrepancies"`
+	CreatedAt          time.Time                   `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (m *ReconciliationMismatch) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ReconciliationDiscrepancy points at a transaction or journal entry that
+// explains part of a wallet mismatch
+type ReconciliationDiscrepancy struct {
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	MismatchID     string          `gorm:"type:varchar(36);index;not null" json:"mismatch_id"`
+	TransactionID  *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"`
+	JournalEntryID *string         `gorm:"type:varchar(36)" json:"journal_entry_id,omitempty"`
+	Issue          string          `gorm:"type:varchar(20);not null" json:"issue"` // unposted, amount, unrecorded
+	Recorded       decimal.Decimal `gorm:"type:decimal(20,2)" json:"recorded"`     // what the transactions say moved
+	Posted         decimal.Decimal `gorm:"type:decimal(20,2)" json:"posted"`       // what the ledger moved
+}
+
+// BeforeCreate hook auto-generates UUID
+func (d *ReconciliationDiscrepancy) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Scheduled transfer frequency enum values
+const (
+	TransferFrequencyOnce     = "once"
+	TransferFrequencyDaily    = "daily"
+	TransferFrequencyWeekly   = "weekly"
+	TransferFrequencyBiweekly = "biweekly"
+	TransferFrequencyMonthly  = "monthly"
+)
+
+// Scheduled transfer status enum values
+const (
+	ScheduledTransferStatusActive    = "active"
+	ScheduledTransferStatusPaused    = "paused"
+	ScheduledTransferStatusCompleted = "completed"
+	ScheduledTransferStatusCancelled = "cancelled"
+	ScheduledTransferStatusFailed    = "failed" // a one-off transfer that could not be sent
+)
+
+// Scheduled transfer run status enum values
+const (
+	ScheduledRunStatusSuccess = "success"
+	ScheduledRunStatusFailed  = "failed"
+)
+
+// ScheduledTransfer is a P2P transfer set up to run later, once or on a
+// recurring schedule, until its end date or occurrence count is reached
+type ScheduledTransfer struct {
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID         string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	RecipientID    string          `gorm:"type:varchar(36);index;not null" json:"recipient_id"`
+	Amount         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency       string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Note           string          `json:"note"`
+	Frequency      string          `gorm:"type:varchar(20);not null" json:"frequency"` // once, daily, weekly, biweekly, monthly
+	StartAt        time.Time       `gorm:"not null" json:"start_at"`                   // first occurrence; anchors the day of month
+	EndAt          *time.Time      `json:"end_at,omitempty"`                           // no occurrence runs after this
+	MaxOccurrences int             `gorm:"default:0" json:"max_occurrences"`           // 0 means no limit
+	Occurrences    int             `gorm:"default:0" json:"occurrences"`               // runs so far, successful or not
+	NextRunAt      *time.Time      `gorm:"index" json:"next_run_at,omitempty"`         // nil once finished
+	Status         string          `gorm:"type:varchar(20);index;default:active" json:"status"`
+	LastRunAt      *time.Time      `json:"last_run_at,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	FailureCount   int             `gorm:"default:0" json:"failure_count"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	Recipient *User                  `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+	Runs      []ScheduledTransferRun `gorm:"foreignKey:ScheduledTransferID" json:"runs,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (t *ScheduledTransfer) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ScheduledTransferRun records one occurrence of a scheduled transfer. The
+// unique (transfer, due time) pair stops an occurrence from running twice.
+type ScheduledTransferRun struct {
+	ID                  string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	ScheduledTransferID string    `gorm:"type:varchar(36);uniqueIndex:idx_scheduled_run_due;not null" json:"scheduled_transfer_id"`
+	DueAt               time.Time `gorm:"uniqueIndex:idx_scheduled_run_due;not null" json:"due_at"`
+	Status              string    `gorm:"type:varchar(20);not null" json:"status"` // success, failed
+	TransactionID       *string   `gorm:"type:varchar(36)" json:"transaction_id,omitempty"`
+	Error               string    `json:"error,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (r *ScheduledTransferRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Shared wallet member role enum values
+const (
+	SharedRoleOwner  = "owner"  // manages members and settings, can fund and spend
+	SharedRoleMember = "member" // can fund and spend, and approve others' payouts
+	SharedRoleViewer = "viewer" // can see the balance and history only
+)
+
+// Shared wallet payout status enum values
+const (
+	SharedPayoutPending  = "pending"  // waiting for another member to approve
+	SharedPayoutRejected = "rejected" // declined by another member
+	SharedPayoutExecuted = "executed" // money has left the shared wallet
+)
+
+// SharedWallet is a joint wallet that several users fund and spend from.
+// Its money sits in a regular Wallet whose UserID is the shared wallet's ID,
+// so it never clashes with a member's own wallet in the same currency.
+type SharedWallet struct {
+	ID        string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Name      string `gorm:"not null" json:"name"`
+	WalletID  string `gorm:"type:varchar(36);uniqueIndex;not null" json:"wallet_id"`
+	Currency  string `gorm:"type:varchar(3);default:USD" json:"currency"`
+	CreatedBy string `gorm:"type:varchar(36);not null" json:"created_by"`
+
+	// Payouts above this amount need another member's approval; nil means never
+	ApprovalThreshold *decimal.Decimal `gorm:"type:decimal(20,2)" json:"approval_threshold,omitempty"`
+
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Wallet    *Wallet              `gorm:"foreignKey:WalletID" json:"wallet,omitempty"`
+	Members   []SharedWalletMember `gorm:"foreignKey:SharedWalletID" json:"members,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (w *SharedWallet) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// SharedWalletMember is a user's role in a shared wallet
+type SharedWalletMember struct {
+	ID             string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	SharedWalletID string `gorm:"type:varchar(36);uniqueIndex:idx_shared_member;not null" json:"shared_wallet_id"`
+	UserID         string `gorm:"type:varchar(36);uniqueIndex:idx_shared_member;index;not null" json:"user_id"`
+	Role           string `gorm:"type:varchar(10);not null" json:"role"` // owner, member, viewer
+
+	// Most the member may pay out over the last 30 days; nil means no cap
+	SpendingCap *decimal.Decimal `gorm:"type:decimal(20,2)" json:"spending_cap,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (m *SharedWalletMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// SharedWalletPayout is a payment out of a shared wallet, kept from request
+// through approval to execution
+type SharedWalletPayout struct {
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	SharedWalletID string          `gorm:"type:varchar(36);index;not null" json:"shared_wallet_id"`
+	RequestedBy    string          `gorm:"type:varchar(36);index;not null" json:"requested_by"`
+	RecipientID    string          `gorm:"type:varchar(36);not null" json:"recipient_id"`
+	Amount         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Note           string          `json:"note"`
+	Status         string          `gorm:"type:varchar(10);index;not null" json:"status"`
+	DecidedBy      *string         `gorm:"type:varchar(36)" json:"decided_by,omitempty"` // member who approved or rejected
+	DecidedAt      *time.Time      `json:"decided_at,omitempty"`
+	TransactionID  *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"` // debit on the shared wallet
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Requester      *User           `gorm:"foreignKey:RequestedBy" json:"requester,omitempty"`
+	Recipient      *User           `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (p *SharedWalletPayout) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ArchivedStatement is a monthly statement issued and stored by GatorPay.
+// The file's SHA-256 digest is signed with the server's statement key when
+// it is issued, so any later change to the file or its record is detectable.
+type ArchivedStatement struct {
+	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID    string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	WalletID  string          `gorm:"type:varchar(36);uniqueIndex:idx_statement_wallet_period;not null" json:"wallet_id"`
+	Currency  string          `gorm:"type:varchar(3);not null" json:"currency"`
+	Period    string          `gorm:"type:varchar(7);uniqueIndex:idx_statement_wallet_period;not null" json:"period"` // YYYY-MM
+	Opening   decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"opening_balance"`
+	Closing   decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"closing_balance"`
+	FileName  string          `gorm:"not null" json:"file_name"`
+	Size      int64           `json:"size"`
+	BlobKey   string          `gorm:"not null" json:"-"`
+	SHA256    string          `gorm:"column:sha256;type:varchar(64);index;not null" json:"sha256"` // hex digest of the file
+	Signature string          `gorm:"type:text;not null" json:"signature"`                         // base64 Ed25519 signature
+	KeyID     string          `gorm:"type:varchar(16);not null" json:"key_id"`                     // which signing key was used
+	IssuedAt  time.Time       `gorm:"not null" json:"issued_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (s *ArchivedStatement) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Card top-up status enum values
+const (
+	TopUpPending        = "pending"         // created, not yet answered by the processor
+	TopUpRequiresAction = "requires_action" // waiting for the cardholder's 3-D Secure challenge
+	TopUpProcessing     = "processing"      // authorized and captured, waiting for the capture to complete
+	TopUpSucceeded      = "succeeded"       // captured and credited to the wallet
+	TopUpFailed         = "failed"          // declined, failed the challenge or the capture
+	TopUpRefunding      = "refunding"       // held on the wallet while the processor refunds the card
+	TopUpRefunded       = "refunded"        // taken back out of the wallet and refunded to the card
+)
+
+// CardTopUp is money added to a wallet by charging a card through the
+// payment processor. The wallet is only credited once the charge is captured.
+type CardTopUp struct {
+	ID                 string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID             string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	WalletID           string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	Amount             decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency           string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	PaymentMethod      string          `json:"payment_method"`                                                     // the processor's card token
+	ProcessorPaymentID *string         `gorm:"type:varchar(64);uniqueIndex" json:"processor_payment_id,omitempty"` // unique once set
+	CardBrand          string          `json:"card_brand,omitempty"`
+	CardLast4          string          `gorm:"type:varchar(4)" json:"card_last4,omitempty"`
+	Status             string          `gorm:"type:varchar(20);index;default:pending" json:"status"`
+	FailureCode        string          `json:"failure_code,omitempty"`
+	FailureMessage     string          `json:"failure_message,omitempty"`
+	ActionURL          string          `json:"action_url,omitempty"`                             // where to send the cardholder for 3-D Secure
+	TransactionID      *string         `gorm:"type:varchar(36)" json:"transaction_id,omitempty"` // the wallet credit
+	CompletedAt        *time.Time      `json:"completed_at,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (t *CardTopUp) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -16,27 +16,68 @@ const (
 	TransactionTypeP2PReceive = "p2p_receive"
 	TransactionTypeBillPay    = "bill_pay"
 	TransactionTypeCashback   = "cashback"
+
+	TransactionTypeQRPayment        = "qr_payment"
+	TransactionTypeQRReceived       = "qr_received"
+	TransactionTypeLoanDisbursement = "loan_disbursement"
+	TransactionTypeLoanPayment      = "loan_emi_payment"
+	TransactionTypeLoanReversal     = "loan_reversal"
+	TransactionTypeFXConversion     = "fx_conversion"
+	TransactionTypeCardSpend        = "card_spend"
+	TransactionTypeRefund           = "refund"            // money returned to the original payer
+	TransactionTypeRefundSent       = "refund_sent"       // money returned by the original payee
+	TransactionTypePocketDeposit    = "pocket_deposit"    // moved from the wallet into a savings pocket
+	TransactionTypePocketWithdraw   = "pocket_withdraw"   // moved from a savings pocket back to the wallet
+	TransactionTypeWithdrawReturn   = "withdraw_return"   // a withdrawal the receiving bank sent back
+	TransactionTypeDepositReturn    = "deposit_return"    // a settled deposit the user's bank sent back, taken out again
+	TransactionTypeCardTopUp        = "card_topup"        // money added by charging a card
+	TransactionTypeTopUpRefund      = "topup_refund"      // a card top-up refunded to the card
+	TransactionTypeInterest         = "interest"          // savings interest, swept straight into its pocket
+	TransactionTypeClaimSend        = "claim_send"        // sent to someone without an account, held until they claim it
+	TransactionTypeClaimReceive     = "claim_receive"     // money claimed from a claim link
+	TransactionTypeClaimRefund      = "claim_refund"      // a claim link's money returned to its sender
+	TransactionTypeCashbackReversal = "cashback_reversal" // cashback taken back when its payment is refunded
+
+	// Shared wallets: FromUserID is always the member who acted
+	TransactionTypeSharedContribution = "shared_contribution" // member's own wallet funding a shared wallet
+	TransactionTypeSharedDeposit      = "shared_deposit"      // shared wallet side of a contribution
+	TransactionTypeSharedPayout       = "shared_payout"       // money paid out of a shared wallet
 )
 
 // Transaction status enum values
 const (
+	TransactionStatusPending = "pending" // funds are held until it settles
 	TransactionStatusSuccess = "success"
 	TransactionStatusFailed  = "failed"
 )
 
 // Transaction represents a wallet transaction record
 type Transaction struct {
-	ID          string          `gorm:"type:varchar(36);primaryKey" json:"id"`
-	WalletID    string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
-	FromUserID  *string         `gorm:"type:varchar(36);index" json:"from_user_id"`
-	ToUserID    *string         `gorm:"type:varchar(36);index" json:"to_user_id"`
-	Type        string          `gorm:"not null" json:"type"`
-	Amount      decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
-	Description string          `json:"description"`
-	Status      string          `gorm:"default:success" json:"status"`
-	CreatedAt   time.Time       `json:"created_at"`
-	FromUser    *User           `gorm:"foreignKey:FromUserID" json:"from_user,omitempty"`
-	ToUser      *User           `gorm:"foreignKey:ToUserID" json:"to_user,omitempty"`
+	ID             string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	WalletID       string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	FromUserID     *string         `gorm:"type:varchar(36);index" json:"from_user_id"`
+	ToUserID       *string         `gorm:"type:varchar(36);index" json:"to_user_id"`
+	Type           string          `gorm:"not null" json:"type"`
+	Amount         decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency       string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Description    string          `json:"description"`
+	Status         string          `gorm:"default:success" json:"status"`
+	JournalEntryID *string         `gorm:"type:varchar(36);index" json:"journal_entry_id,omitempty"` // ledger entry that moved the money
+	CreatedAt      time.Time       `json:"created_at"`
+	FromUser       *User           `gorm:"foreignKey:FromUserID" json:"from_user,omitempty"`
+	ToUser         *User           `gorm:"foreignKey:ToUserID" json:"to_user,omitempty"`
+
+	// Set only on refunds: the payment being reversed
+	ParentTransactionID *string `gorm:"type:varchar(36);index" json:"parent_transaction_id,omitempty"`
+
+	// Set only when the money changed currency on the way
+	FXRate          *decimal.Decimal `gorm:"type:decimal(20,8)" json:"fx_rate,omitempty"`   // units of counter currency per unit sent
+	FXSpread        *decimal.Decimal `gorm:"type:decimal(10,6)" json:"fx_spread,omitempty"` // fraction taken off the mid-market rate
+	CounterAmount   *decimal.Decimal `gorm:"type:decimal(20,2)" json:"counter_amount,omitempty"`
+	CounterCurrency string           `gorm:"type:varchar(3)" json:"counter_currency,omitempty"`
+
+	// The owner's category override, tags and note, if any
+	Annotation *TransactionAnnotation `gorm:"foreignKey:TransactionID" json:"annotation,omitempty"`
 }
 
 // BeforeCreate hook auto-generates UUID before inserting
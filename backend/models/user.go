@@ -14,6 +14,12 @@ const (
 	KYCRejected = "rejected"
 )
 
+// Role enum values
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin" // may use the /admin endpoints
+)
+
 // Auth provider enum values
 const (
 	AuthProviderLocal  = "local"
@@ -33,7 +39,9 @@ type User struct {
 	AuthProvider  string         `gorm:"default:local" json:"auth_provider"`
 	GoogleID      string         `gorm:"index" json:"google_id,omitempty"`
 	EmailVerified bool           `gorm:"default:false" json:"email_verified"`
+	PhoneVerified bool           `gorm:"default:false" json:"phone_verified"`
 	KYCStatus     string         `gorm:"default:pending" json:"kyc_status"`
+	Role          string         `gorm:"type:varchar(10);default:user" json:"role"`
 	CreditScore   int            `gorm:"default:650" json:"credit_score"`
 	CreatedAt     time.Time      `json:"created_at"`
 	UpdatedAt     time.Time      `json:"updated_at"`
@@ -60,6 +68,7 @@ type UserResponse struct {
 	AvatarURL     string    `json:"avatar_url"`
 	AuthProvider  string    `json:"auth_provider"`
 	EmailVerified bool      `json:"email_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
 	KYCStatus     string    `json:"kyc_status"`
 	CreditScore   int       `json:"credit_score"`
 	CreatedAt     time.Time `json:"created_at"`
@@ -78,6 +87,7 @@ func (u *User) ToResponse() UserResponse {
 		AvatarURL:     u.AvatarURL,
 		AuthProvider:  u.AuthProvider,
 		EmailVerified: u.EmailVerified,
+		PhoneVerified: u.PhoneVerified,
 		KYCStatus:     u.KYCStatus,
 		CreditScore:   u.CreditScore,
 		CreatedAt:     u.CreatedAt,
@@ -8,15 +8,47 @@ import (
 	"gorm.io/gorm"
 )
 
-// Wallet represents a user's financial wallet
+// DefaultCurrency is the currency of every user's primary wallet. Bills, QR
+// payments, loans and rewards settle in it.
+const DefaultCurrency = "USD"
+
+// SupportedCurrencies lists the currencies a wallet can be opened in
+var SupportedCurrencies = []string{"USD", "EUR", "GBP", "CAD", "INR", "MXN"}
+
+// IsSupportedCurrency reports whether wallets can hold the given currency
+func IsSupportedCurrency(code string) bool {
+	for _, c := range SupportedCurrencies {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Wallet represents a user's balance in one currency. A user has one
+// wallet per currency they hold.
 type Wallet struct {
 	ID        string          `gorm:"type:varchar(36);primaryKey" json:"id"`
-	UserID    string          `gorm:"type:varchar(36);uniqueIndex;not null" json:"user_id"`
-	Balance   decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"balance"`
-	Currency  string          `gorm:"default:USD" json:"currency"`
+	UserID    string          `gorm:"type:varchar(36);uniqueIndex:idx_wallets_user_currency;not null" json:"user_id"`
+	Balance   decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"balance"` // ledger balance, including held funds
+	Currency  string          `gorm:"type:varchar(3);uniqueIndex:idx_wallets_user_currency;default:USD" json:"currency"`
 	IsActive  bool            `gorm:"default:true" json:"is_active"`
 	CreatedAt time.Time       `json:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at"`
+
+	HeldBalance      decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"held_balance"` // reserved by active holds
+	AvailableBalance decimal.Decimal `gorm:"-" json:"available_balance"`                       // balance less held funds
+}
+
+// Available returns the balance that can be spent right now
+func (w *Wallet) Available() decimal.Decimal {
+	return w.Balance.Sub(w.HeldBalance)
+}
+
+// AfterFind fills in the computed available balance
+func (w *Wallet) AfterFind(tx *gorm.DB) error {
+	w.AvailableBalance = w.Available()
+	return nil
 }
 
 // BeforeCreate hook auto-generates UUID before inserting
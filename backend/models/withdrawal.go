@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Withdrawal status enum values
+const (
+	WithdrawalPending   = "pending"   // held on the wallet, waiting for the next ACH file
+	WithdrawalSubmitted = "submitted" // sent to the bank in an ACH file, still held on the wallet
+	WithdrawalSettled   = "settled"   // the return window passed; the held funds left the wallet
+	WithdrawalReturned  = "returned"  // the receiving bank sent it back; the funds are available again
+)
+
+// ACH file direction enum values
+const (
+	ACHFileOutbound = "outbound" // payouts and deposit debits GatorPay sent
+	ACHFileReturn   = "return"   // returns the bank sent back
+)
+
+// Withdrawal tracks a payout to a linked bank account through ACH. Its amount
+// is held on the wallet and its withdraw transaction stays pending until the
+// return window passes, when the hold is captured and the transaction
+// succeeds. A return before then releases the hold and fails the transaction;
+// a later one re-credits the wallet.
+type Withdrawal struct {
+	ID              string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	UserID          string          `gorm:"type:varchar(36);index;not null" json:"user_id"`
+	WalletID        string          `gorm:"type:varchar(36);index;not null" json:"wallet_id"`
+	TransactionID   string          `gorm:"type:varchar(36);index;not null" json:"transaction_id"` // the withdraw transaction
+	HoldID          string          `gorm:"type:varchar(36);index" json:"hold_id"`                 // the hold on the wallet until settled
+	LinkedAccountID string          `gorm:"type:varchar(36);index;not null" json:"linked_account_id"`
+	AccountLabel    string          `json:"account_label"` // e.g. "JPMorgan Chase ••••6789"
+	Amount          decimal.Decimal `gorm:"type:decimal(20,2);not null" json:"amount"`
+	Currency        string          `gorm:"type:varchar(3);default:USD" json:"currency"`
+	Status          string          `gorm:"type:varchar(20);index;default:pending" json:"status"` // pending, submitted, settled, returned
+
+	// Set when the withdrawal is put in an ACH file
+	ACHFileID   *string    `gorm:"type:varchar(36);index" json:"ach_file_id,omitempty"`
+	TraceNumber string     `gorm:"type:varchar(15);index" json:"trace_number,omitempty"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	SettledAt   *time.Time `json:"settled_at,omitempty"`
+
+	// Set when the bank returns the payout
+	ReturnCode          string     `gorm:"type:varchar(3)" json:"return_code,omitempty"` // e.g. R03
+	ReturnReason        string     `json:"return_reason,omitempty"`
+	ReturnTransactionID *string    `gorm:"type:varchar(36)" json:"return_transaction_id,omitempty"` // the re-credit, for returns after settlement
+	ReturnedAt          *time.Time `json:"returned_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (w *Withdrawal) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ACHFile is a NACHA file GatorPay wrote for its bank or read back from it
+type ACHFile struct {
+	ID          string          `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Direction   string          `gorm:"type:varchar(10);index;not null" json:"direction"` // outbound, return
+	FileName    string          `gorm:"not null" json:"file_name"`
+	SHA256      string          `gorm:"column:sha256;type:varchar(64);uniqueIndex;not null" json:"sha256"`
+	EntryCount  int             `json:"entry_count"`
+	TotalAmount decimal.Decimal `gorm:"type:decimal(20,2);default:0" json:"total_amount"`
+	Applied     int             `json:"applied"` // return files: entries matched to a withdrawal or deposit
+	CreatedAt   time.Time       `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook auto-generates UUID
+func (f *ACHFile) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -30,9 +30,31 @@ func Setup(
 	socialHandler *handlers.SocialHandler,
 	adminHandler *handlers.AdminHandler,
 	invoiceHandler *handlers.InvoiceHandler,
+	ledgerHandler *handlers.LedgerHandler,
+	idempotencyService *services.IdempotencyService,
+	fxHandler *handlers.FXHandler,
+	holdHandler *handlers.HoldHandler,
+	refundHandler *handlers.RefundHandler,
+	reconciliationHandler *handlers.ReconciliationHandler,
+	scheduledTransferHandler *handlers.ScheduledTransferHandler,
+	limitHandler *handlers.LimitHandler,
+	sharedWalletHandler *handlers.SharedWalletHandler,
+	annotationHandler *handlers.AnnotationHandler,
+	linkedAccountHandler *handlers.LinkedAccountHandler,
+	withdrawalHandler *handlers.WithdrawalHandler,
+	topUpHandler *handlers.TopUpHandler,
+	interestHandler *handlers.InterestHandler,
+	paymentRequestHandler *handlers.PaymentRequestHandler,
+	expenseGroupHandler *handlers.ExpenseGroupHandler,
+	claimHandler *handlers.ClaimHandler,
+	bulkPayoutHandler *handlers.BulkPayoutHandler,
+	adminService *services.AdminService,
 ) {
 	api := router.Group("/api/v1")
 
+	// Money-moving endpoints honour the Idempotency-Key header
+	idempotent := middleware.IdempotencyMiddleware(idempotencyService)
+
 	// Auth routes (public)
 	auth := api.Group("/auth")
 	{
@@ -42,27 +64,134 @@ func Setup(
 		auth.POST("/resend-otp", authHandler.ResendOTP)
 		auth.POST("/google", authHandler.GoogleAuth)
 
-		// Protected auth route
+		// Protected auth routes
 		auth.GET("/me", middleware.AuthMiddleware(tokenService), authHandler.GetMe)
+		auth.POST("/phone/send-code", middleware.AuthMiddleware(tokenService), authHandler.SendPhoneCode)
+		auth.POST("/phone/verify", middleware.AuthMiddleware(tokenService), authHandler.VerifyPhone)
 	}
 
 	// Wallet routes (protected)
 	wallet := api.Group("/wallet")
 	wallet.Use(middleware.AuthMiddleware(tokenService))
 	{
-		wallet.POST("/add", walletHandler.AddMoney)
-		wallet.POST("/withdraw", walletHandler.Withdraw)
+		wallet.POST("/add", idempotent, walletHandler.AddMoney)
+		wallet.POST("/withdraw", idempotent, walletHandler.Withdraw)
+		wallet.GET("/withdrawals", withdrawalHandler.GetWithdrawals)
+		wallet.GET("/deposits", withdrawalHandler.GetDeposits)
+		wallet.GET("/topups", topUpHandler.GetTopUps)
+		wallet.GET("/topups/:id", topUpHandler.GetTopUp)
+		wallet.POST("/topups/:id/simulate", topUpHandler.CompleteSimulated) // fake processor only
+		wallet.GET("/balances", walletHandler.GetWallets)
+		wallet.GET("/holds", holdHandler.GetHolds)
+		wallet.GET("/limits", limitHandler.GetRemaining)
 		wallet.GET("/transactions", walletHandler.GetTransactions)
+		wallet.GET("/transactions/:id/annotation", annotationHandler.GetAnnotation)
+		wallet.PUT("/transactions/:id/annotation", annotationHandler.Annotate)
+		wallet.POST("/transactions/:id/receipts", annotationHandler.UploadReceipt)
+		wallet.GET("/receipts/:id", annotationHandler.DownloadReceipt)
+		wallet.DELETE("/receipts/:id", annotationHandler.DeleteReceipt)
 		wallet.GET("/statement", statementHandler.GetStatement)
+		wallet.GET("/statements", statementHandler.GetArchivedStatements)
+		wallet.GET("/statements/:id", statementHandler.DownloadArchivedStatement)
+		wallet.GET("/statements/:id/verify", statementHandler.VerifyArchivedStatement)
+	}
+
+	// Payment processor webhooks (public, signed by the processor)
+	api.POST("/webhooks/processor", topUpHandler.Webhook)
+
+	// Linked bank accounts (protected)
+	bankAccounts := api.Group("/bank-accounts")
+	bankAccounts.Use(middleware.AuthMiddleware(tokenService))
+	{
+		bankAccounts.GET("", linkedAccountHandler.GetAccounts)
+		bankAccounts.POST("", linkedAccountHandler.LinkAccount)
+		bankAccounts.POST("/:id/verify", linkedAccountHandler.VerifyAccount)
+		bankAccounts.DELETE("/:id", linkedAccountHandler.RemoveAccount)
 	}
 
 	// Transfer routes (protected)
 	transfer := api.Group("/transfer")
 	transfer.Use(middleware.AuthMiddleware(tokenService))
 	{
-		transfer.POST("/send", transferHandler.SendMoney)
+		transfer.POST("/send", idempotent, transferHandler.SendMoney)
+		transfer.POST("/confirm", idempotent, transferHandler.ConfirmTransfer)
 		transfer.GET("/contacts", transferHandler.GetRecentContacts)
 		transfer.GET("/search", transferHandler.SearchUsers)
+		transfer.POST("/scheduled", idempotent, scheduledTransferHandler.Create)
+		transfer.GET("/scheduled", scheduledTransferHandler.List)
+		transfer.GET("/scheduled/:id", scheduledTransferHandler.Get)
+		transfer.PUT("/scheduled/:id", scheduledTransferHandler.Update)
+		transfer.POST("/scheduled/:id/pause", scheduledTransferHandler.Pause)
+		transfer.POST("/scheduled/:id/resume", scheduledTransferHandler.Resume)
+		transfer.POST("/scheduled/:id/cancel", scheduledTransferHandler.Cancel)
+		transfer.POST("/requests", paymentRequestHandler.Create)
+		transfer.GET("/requests", paymentRequestHandler.List)
+		transfer.GET("/requests/:id", paymentRequestHandler.Get)
+		transfer.POST("/requests/:id/pay", idempotent, paymentRequestHandler.Pay)
+		transfer.POST("/requests/:id/decline", paymentRequestHandler.Decline)
+		transfer.POST("/requests/:id/remind", paymentRequestHandler.Remind)
+		transfer.POST("/requests/:id/cancel", paymentRequestHandler.Cancel)
+		transfer.GET("/claims", claimHandler.List)
+		transfer.POST("/claims/:id/cancel", claimHandler.Cancel)
+		transfer.POST("/claim", idempotent, claimHandler.Claim)
+		transfer.POST("/bulk", bulkPayoutHandler.Upload)
+		transfer.GET("/bulk", bulkPayoutHandler.List)
+		transfer.GET("/bulk/:id", bulkPayoutHandler.Get)
+		transfer.GET("/bulk/:id/download", bulkPayoutHandler.Download)
+		transfer.POST("/bulk/:id/execute", idempotent, bulkPayoutHandler.Execute)
+	}
+
+	// Shared wallets (protected)
+	shared := api.Group("/shared-wallets")
+	shared.Use(middleware.AuthMiddleware(tokenService))
+	{
+		shared.POST("", sharedWalletHandler.Create)
+		shared.GET("", sharedWalletHandler.List)
+		shared.GET("/:id", sharedWalletHandler.Get)
+		shared.PUT("/:id", sharedWalletHandler.Update)
+		shared.POST("/:id/members", sharedWalletHandler.AddMember)
+		shared.PUT("/:id/members/:userId", sharedWalletHandler.UpdateMember)
+		shared.DELETE("/:id/members/:userId", sharedWalletHandler.RemoveMember)
+		shared.POST("/:id/contribute", idempotent, sharedWalletHandler.Contribute)
+		shared.POST("/:id/payouts", idempotent, sharedWalletHandler.RequestPayout)
+		shared.GET("/:id/payouts", sharedWalletHandler.GetPayouts)
+		shared.POST("/:id/payouts/:payoutId/approve", idempotent, sharedWalletHandler.ApprovePayout)
+		shared.POST("/:id/payouts/:payoutId/reject", sharedWalletHandler.RejectPayout)
+		shared.GET("/:id/transactions", sharedWalletHandler.GetTransactions)
+	}
+
+	// Expense groups (protected)
+	groups := api.Group("/groups")
+	groups.Use(middleware.AuthMiddleware(tokenService))
+	{
+		groups.POST("", expenseGroupHandler.Create)
+		groups.GET("", expenseGroupHandler.List)
+		groups.GET("/:id", expenseGroupHandler.Get)
+		groups.POST("/:id/members", expenseGroupHandler.AddMember)
+		groups.DELETE("/:id/members/:userId", expenseGroupHandler.RemoveMember)
+		groups.POST("/:id/expenses", expenseGroupHandler.AddExpense)
+		groups.GET("/:id/expenses", expenseGroupHandler.GetExpenses)
+		groups.DELETE("/:id/expenses/:expenseId", expenseGroupHandler.DeleteExpense)
+		groups.GET("/:id/balances", expenseGroupHandler.GetBalances)
+		groups.GET("/:id/settlements", expenseGroupHandler.GetSettlements)
+		groups.POST("/:id/settle", idempotent, expenseGroupHandler.SettleUp)
+	}
+
+	// Transaction refund routes (protected)
+	transactions := api.Group("/transactions")
+	transactions.Use(middleware.AuthMiddleware(tokenService))
+	{
+		transactions.POST("/:id/refund", idempotent, refundHandler.Refund)
+		transactions.GET("/:id/refunds", refundHandler.GetRefunds)
+	}
+
+	// FX routes (protected)
+	fx := api.Group("/fx")
+	fx.Use(middleware.AuthMiddleware(tokenService))
+	{
+		fx.GET("/rates", fxHandler.GetRates)
+		fx.POST("/quote", fxHandler.CreateQuote)
+		fx.POST("/convert", idempotent, fxHandler.Convert)
 	}
 
 	// Bills routes (protected)
@@ -71,7 +200,7 @@ func Setup(
 	{
 		bills.GET("/categories", billHandler.GetCategories)
 		bills.GET("/billers", billHandler.GetBillers)
-		bills.POST("/pay", billHandler.PayBill)
+		bills.POST("/pay", idempotent, billHandler.PayBill)
 		bills.GET("/saved", billHandler.GetSavedBillers)
 		bills.DELETE("/saved/:id", billHandler.RemoveSavedBiller)
 	}
@@ -91,11 +220,11 @@ func Setup(
 	{
 		loans.GET("/offers", loanHandler.GetOffers)
 		loans.GET("/eligibility", loanHandler.CheckEligibility)
-		loans.POST("/apply", loanHandler.ApplyForLoan)
+		loans.POST("/apply", idempotent, loanHandler.ApplyForLoan)
 		loans.GET("", loanHandler.GetUserLoans)
 		loans.GET("/:id", loanHandler.GetLoan)
-		loans.POST("/:id/pay", loanHandler.PayEMI)
-		loans.POST("/:id/cancel", loanHandler.CancelLoan)
+		loans.POST("/:id/pay", idempotent, loanHandler.PayEMI)
+		loans.POST("/:id/cancel", idempotent, loanHandler.CancelLoan)
 	}
 
 	// Cards routes (protected)
@@ -108,6 +237,7 @@ func Setup(
 		cards.POST("/:id/otp", cardHandler.RequestOTP)
 		cards.POST("/:id/details", cardHandler.GetCardDetails)
 		cards.POST("/:id/freeze", cardHandler.FreezeCard)
+		cards.POST("/:id/authorize", idempotent, cardHandler.Authorize)
 	}
 
 	// Merchant & QR routes (protected)
@@ -127,7 +257,11 @@ func Setup(
 	{
 		qr.POST("/generate", qrHandler.GenerateQR)
 		qr.POST("/lookup", qrHandler.LookupQR)
-		qr.POST("/pay", qrHandler.PayViaQR)
+		qr.POST("/pay", idempotent, qrHandler.PayViaQR)
+		qr.POST("/authorize", idempotent, qrHandler.AuthorizeQR)
+		qr.GET("/payments", qrHandler.GetPendingPayments)
+		qr.POST("/payments/:id/capture", idempotent, qrHandler.CapturePayment)
+		qr.POST("/payments/:id/release", idempotent, qrHandler.ReleasePayment)
 	}
 
 	// ═══════════════════════════════════════════
@@ -147,13 +281,18 @@ func Setup(
 	{
 		budget.POST("/goals", budgetHandler.CreateGoal)
 		budget.GET("/goals", budgetHandler.GetGoals)
+		budget.GET("/spending", budgetHandler.GetSpending)
+		budget.POST("/goals/:id/pocket/deposit", idempotent, budgetHandler.MoveToPocket)
+		budget.POST("/goals/:id/pocket/withdraw", idempotent, budgetHandler.MoveFromPocket)
+		budget.GET("/interest", interestHandler.GetSummary)
+		budget.GET("/interest/rates", interestHandler.GetRates)
 	}
 
 	autosave := api.Group("/autosave")
 	autosave.Use(middleware.AuthMiddleware(tokenService))
 	{
 		autosave.POST("/rules", budgetHandler.CreateAutoSaveRule)
-		autosave.POST("/roundup/execute", budgetHandler.ExecuteRoundup)
+		autosave.POST("/roundup/execute", idempotent, budgetHandler.ExecuteRoundup)
 	}
 
 	// Subscription routes (protected)
@@ -194,12 +333,31 @@ func Setup(
 		social.POST("/friends/add", socialHandler.AddFriend)
 	}
 
-	// Admin Analytics routes (protected)
+	// Admin Analytics routes (protected, admins only)
 	admin := api.Group("/admin")
 	admin.Use(middleware.AuthMiddleware(tokenService))
+	adminOnly := middleware.AdminMiddleware(adminService)
 	{
-		admin.GET("/metrics", adminHandler.GetMetrics)
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.GET("/fraud/review", adminHandler.GetFraudReview)
+		admin.GET("/metrics", adminOnly, adminHandler.GetMetrics)
+		admin.GET("/users", adminOnly, adminHandler.GetUsers)
+		admin.GET("/fraud/review", adminOnly, adminHandler.GetFraudReview)
+		admin.GET("/ledger/trial-balance", adminOnly, ledgerHandler.GetTrialBalance)
+		admin.GET("/ledger/wallet-check", adminOnly, ledgerHandler.CheckWallets)
+		admin.POST("/holds/:id/capture", adminOnly, idempotent, holdHandler.Capture)
+		admin.POST("/holds/:id/release", adminOnly, idempotent, holdHandler.Release)
+		admin.POST("/transactions/:id/reverse", adminOnly, idempotent, refundHandler.Reverse)
+		admin.POST("/reconciliation/runs", adminOnly, reconciliationHandler.Run)
+		admin.GET("/reconciliation/runs", adminOnly, reconciliationHandler.GetRuns)
+		admin.GET("/reconciliation/runs/:id", adminOnly, reconciliationHandler.GetRun)
+		admin.GET("/limits", adminOnly, limitHandler.GetLimits)
+		admin.PUT("/limits", adminOnly, limitHandler.SetLimit)
+		admin.POST("/statements/issue", adminOnly, statementHandler.IssueStatements)
+		admin.POST("/statements/verify", adminOnly, statementHandler.VerifyStatementFile)
+		admin.GET("/statements/signing-key", adminOnly, statementHandler.GetSigningKey)
+		admin.POST("/ach/run", adminOnly, withdrawalHandler.RunBatch)
+		admin.GET("/ach/files", adminOnly, withdrawalHandler.GetFiles)
+		admin.POST("/topups/:id/refund", adminOnly, idempotent, topUpHandler.Refund)
+		admin.POST("/interest/rates", adminOnly, interestHandler.SetRate)
+		admin.POST("/interest/accrue", adminOnly, interestHandler.Accrue)
 	}
 }
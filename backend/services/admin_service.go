@@ -1,6 +1,8 @@
 package services
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"gatorpay-backend/models"
@@ -18,6 +20,33 @@ func NewAdminService(db *gorm.DB) *AdminService {
 	return &AdminService{db: db}
 }
 
+// IsAdmin reports whether the user has the admin role
+func (s *AdminService) IsAdmin(userID string) bool {
+	var count int64
+	s.db.Model(&models.User{}).Where("id = ? AND role = ?", userID, models.RoleAdmin).Count(&count)
+	return count > 0
+}
+
+// GrantAdmins gives the admin role to the users with the given emails and
+// returns how many were changed
+func (s *AdminService) GrantAdmins(emails []string) (int64, error) {
+	var list []string
+	for _, e := range emails {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			list = append(list, e)
+		}
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	result := s.db.Model(&models.User{}).Where("LOWER(email) IN ? AND role <> ?", list, models.RoleAdmin).
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		return 0, errors.New("failed to grant admin role")
+	}
+	return result.RowsAffected, nil
+}
+
 // GetMetrics returns platform-wide metrics
 func (s *AdminService) GetMetrics() map[string]interface{} {
 	var totalUsers int64
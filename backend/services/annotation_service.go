@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gatorpay-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxReceiptSize        = 10 << 20 // 10 MB
+	maxReceiptsPerPayment = 10
+	maxTags               = 10
+	maxTagLength          = 30
+)
+
+// receiptTypes are the content types accepted for receipts, detected from
+// the file itself rather than trusted from the upload
+var receiptTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9 _-]*$`)
+
+// AnnotationService lets users categorise, tag and note their transactions
+// and attach receipts, which are kept in a BlobStore
+type AnnotationService struct {
+	db       *gorm.DB
+	store    BlobStore
+	insights *InsightService
+}
+
+// NewAnnotationService creates a new AnnotationService. insights, when set,
+// has its cached summaries dropped whenever a category changes.
+func NewAnnotationService(db *gorm.DB, store BlobStore, insights *InsightService) *AnnotationService {
+	return &AnnotationService{db: db, store: store, insights: insights}
+}
+
+// AnnotateInput is the DTO for annotating a transaction. Omitted fields are
+// left unchanged; an empty category goes back to the guessed one.
+type AnnotateInput struct {
+	Category *string   `json:"category"`
+	Tags     *[]string `json:"tags"`
+	Note     *string   `json:"note"`
+}
+
+// GetAnnotation returns a transaction's annotation and receipts. Transactions
+// that were never annotated get an empty one.
+func (s *AnnotationService) GetAnnotation(userID, transactionID string) (*models.TransactionAnnotation, error) {
+	if err := s.ownTransaction(userID, transactionID); err != nil {
+		return nil, err
+	}
+	var annotation models.TransactionAnnotation
+	err := s.db.Preload("Receipts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).Where("transaction_id = ?", transactionID).First(&annotation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		annotation = models.TransactionAnnotation{TransactionID: transactionID, UserID: userID, Tags: []string{}}
+		if err := s.db.Where("transaction_id = ?", transactionID).Order("created_at ASC").Find(&annotation.Receipts).Error; err != nil {
+			return nil, errors.New("failed to fetch receipts")
+		}
+		return &annotation, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to fetch annotation")
+	}
+	return &annotation, nil
+}
+
+// Annotate sets a transaction's category override, tags or note
+func (s *AnnotationService) Annotate(userID, transactionID string, input AnnotateInput) (*models.TransactionAnnotation, error) {
+	if err := s.ownTransaction(userID, transactionID); err != nil {
+		return nil, err
+	}
+
+	var category string
+	if input.Category != nil {
+		category = strings.TrimSpace(*input.Category)
+		if category != "" && !contains(spendingCategories, category) {
+			return nil, errors.New("unknown category " + category)
+		}
+	}
+	var tags []string
+	if input.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*input.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var annotation models.TransactionAnnotation
+		err := tx.Where("transaction_id = ?", transactionID).First(&annotation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			annotation = models.TransactionAnnotation{TransactionID: transactionID, UserID: userID, Tags: []string{}}
+		} else if err != nil {
+			return errors.New("failed to fetch annotation")
+		}
+
+		if input.Category != nil {
+			annotation.Category = category
+		}
+		if input.Tags != nil {
+			annotation.Tags = tags
+		}
+		if input.Note != nil {
+			annotation.Note = strings.TrimSpace(*input.Note)
+		}
+		if err := tx.Save(&annotation).Error; err != nil {
+			return errors.New("failed to save annotation")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Category != nil && s.insights != nil {
+		s.insights.Invalidate(userID)
+	}
+	return s.GetAnnotation(userID, transactionID)
+}
+
+// AddReceipt stores an image or PDF and attaches it to a transaction
+func (s *AnnotationService) AddReceipt(userID, transactionID, fileName string, r io.Reader) (*models.Receipt, error) {
+	if err := s.ownTransaction(userID, transactionID); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&models.Receipt{}).Where("transaction_id = ?", transactionID).Count(&count).Error; err != nil {
+		return nil, errors.New("failed to count receipts")
+	}
+	if count >= maxReceiptsPerPayment {
+		return nil, errors.New("a transaction can have at most 10 receipts")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxReceiptSize+1))
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("receipt is empty")
+	}
+	if len(data) > maxReceiptSize {
+		return nil, errors.New("receipt must be 10 MB or smaller")
+	}
+	contentType := http.DetectContentType(data)
+	if !receiptTypes[contentType] {
+		return nil, errors.New("receipt must be an image or a PDF")
+	}
+
+	receipt := models.Receipt{
+		ID:            uuid.New().String(),
+		TransactionID: transactionID,
+		UserID:        userID,
+		FileName:      filepath.Base(fileName),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+	}
+	receipt.BlobKey = "receipts/" + userID + "/" + receipt.ID
+	if err := s.store.Put(receipt.BlobKey, bytes.NewReader(data)); err != nil {
+		return nil, errors.New("failed to store receipt")
+	}
+	if err := s.db.Create(&receipt).Error; err != nil {
+		s.store.Delete(receipt.BlobKey)
+		return nil, errors.New("failed to save receipt")
+	}
+	return &receipt, nil
+}
+
+// OpenReceipt returns a receipt and its contents. The caller must close the reader.
+func (s *AnnotationService) OpenReceipt(userID, receiptID string) (*models.Receipt, io.ReadCloser, error) {
+	var receipt models.Receipt
+	if err := s.db.Where("id = ? AND user_id = ?", receiptID, userID).First(&receipt).Error; err != nil {
+		return nil, nil, errors.New("receipt not found")
+	}
+	body, err := s.store.Get(receipt.BlobKey)
+	if err != nil {
+		return nil, nil, errors.New("receipt file is missing")
+	}
+	return &receipt, body, nil
+}
+
+// DeleteReceipt removes a receipt and its file
+func (s *AnnotationService) DeleteReceipt(userID, receiptID string) error {
+	var receipt models.Receipt
+	if err := s.db.Where("id = ? AND user_id = ?", receiptID, userID).First(&receipt).Error; err != nil {
+		return errors.New("receipt not found")
+	}
+	if err := s.db.Delete(&receipt).Error; err != nil {
+		return errors.New("failed to delete receipt")
+	}
+	// An orphaned file is harmless; the record is what the user sees
+	s.store.Delete(receipt.BlobKey)
+	return nil
+}
+
+// ownTransaction checks the transaction was recorded on one of the user's wallets
+func (s *AnnotationService) ownTransaction(userID, transactionID string) error {
+	var count int64
+	s.db.Model(&models.Transaction{}).
+		Where("id = ? AND wallet_id IN (?)", transactionID,
+			s.db.Model(&models.Wallet{}).Select("id").Where("user_id = ?", userID)).
+		Count(&count)
+	if count == 0 {
+		return errors.New("transaction not found")
+	}
+	return nil
+}
+
+// normalizeTags lower-cases, trims and de-duplicates tags
+func normalizeTags(raw []string) ([]string, error) {
+	tags := []string{}
+	for _, t := range raw {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || contains(tags, t) {
+			continue
+		}
+		if len(t) > maxTagLength || !tagPattern.MatchString(t) {
+			return nil, errors.New("tags may only contain letters, digits, spaces, - and _, up to 30 characters")
+		}
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTags {
+		return nil, errors.New("a transaction can have at most 10 tags")
+	}
+	return tags, nil
+}
@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBAnnotation() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Hold{}, &models.LimitUsage{}, &models.InsightReport{},
+		&models.TransactionAnnotation{}, &models.Receipt{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+// pngBytes is the start of a PNG file, enough for content sniffing
+var pngBytes = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+func TestCategoryOverrideFeedsInsightsAndBudget(t *testing.T) {
+	db := setupTestDBAnnotation()
+	alice, bob := seedRefundUsers(t, db)
+	ws := services.NewWalletService(db, nil)
+	insights := services.NewInsightService(db)
+	as := services.NewAnnotationService(db, services.NewLocalBlobStore(t.TempDir()), insights)
+
+	_, err := ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 30, LinkedAccountID: bankAccount(t, db, alice.ID)})
+	assert.NoError(t, err)
+	_, err = ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 20, LinkedAccountID: bankAccount(t, db, alice.ID)})
+	assert.NoError(t, err)
+	// Insights look at the user on the transaction, which withdrawals leave
+	// blank, and budgets only count withdrawals once they settle
+	db.Model(&models.Transaction{}).Where("type = ?", models.TransactionTypeWithdraw).
+		Updates(map[string]interface{}{"from_user_id": alice.ID, "status": models.TransactionStatusSuccess})
+	var lunch models.Transaction
+	db.Where("type = ? AND amount = ?", models.TransactionTypeWithdraw, 30).First(&lunch)
+
+	summary, _ := insights.GetSummary(alice.ID)
+	assert.Equal(t, "Other", summary.Categories[0].Category)
+
+	category, note := "Food & Dining", "  team lunch "
+	tags := []string{"Work", "work", " reimbursable "}
+	annotation, err := as.Annotate(alice.ID, lunch.ID, services.AnnotateInput{Category: &category, Tags: &tags, Note: &note})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"work", "reimbursable"}, annotation.Tags)
+	assert.Equal(t, "team lunch", annotation.Note)
+
+	bad := "Crypto"
+	_, err = as.Annotate(alice.ID, lunch.ID, services.AnnotateInput{Category: &bad})
+	assert.EqualError(t, err, "unknown category Crypto")
+	_, err = as.Annotate(bob.ID, lunch.ID, services.AnnotateInput{Note: &note})
+	assert.EqualError(t, err, "transaction not found")
+
+	// The cached summary was dropped, so the override shows at once
+	summary, _ = insights.GetSummary(alice.ID)
+	found := map[string]float64{}
+	for _, c := range summary.Categories {
+		found[c.Category] = c.Amount
+	}
+	assert.Equal(t, map[string]float64{"Food & Dining": 30, "Other": 20}, found)
+
+	breakdown, err := services.NewBudgetService(db).GetSpendingByCategory(alice.ID, "")
+	assert.NoError(t, err)
+	assert.True(t, breakdown.Total.Equal(decimal.NewFromInt(50)))
+	assert.Len(t, breakdown.Categories, 2)
+	assert.Equal(t, "Food & Dining", breakdown.Categories[0].Category)
+	assert.True(t, breakdown.Categories[0].Amount.Equal(decimal.NewFromInt(30)))
+
+	// History carries the annotation and can be filtered by tag
+	history, err := ws.GetTransactions(alice.ID, services.TransactionQuery{Tag: "Reimbursable"})
+	assert.NoError(t, err)
+	assert.Len(t, history.Transactions, 1)
+	assert.Equal(t, "Food & Dining", history.Transactions[0].Annotation.Category)
+}
+
+func TestReceiptsAreStoredInTheBlobStore(t *testing.T) {
+	db := setupTestDBAnnotation()
+	alice, bob := seedRefundUsers(t, db)
+	dir := t.TempDir()
+	as := services.NewAnnotationService(db, services.NewLocalBlobStore(dir), nil)
+
+	var deposit models.Transaction
+	db.Where("type = ?", models.TransactionTypeDeposit).First(&deposit)
+
+	receipt, err := as.AddReceipt(alice.ID, deposit.ID, "../scan.png", bytes.NewReader(pngBytes))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", receipt.ContentType)
+	assert.Equal(t, "scan.png", receipt.FileName)
+	assert.FileExists(t, filepath.Join(dir, "receipts", alice.ID, receipt.ID))
+
+	_, err = as.AddReceipt(alice.ID, deposit.ID, "notes.txt", strings.NewReader("not a receipt"))
+	assert.EqualError(t, err, "receipt must be an image or a PDF")
+
+	annotation, err := as.GetAnnotation(alice.ID, deposit.ID)
+	assert.NoError(t, err)
+	assert.Len(t, annotation.Receipts, 1)
+
+	_, _, err = as.OpenReceipt(bob.ID, receipt.ID)
+	assert.EqualError(t, err, "receipt not found")
+	_, body, err := as.OpenReceipt(alice.ID, receipt.ID)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, pngBytes, data)
+
+	assert.NoError(t, as.DeleteReceipt(alice.ID, receipt.ID))
+	_, err = os.Stat(filepath.Join(dir, "receipts", alice.ID, receipt.ID))
+	assert.True(t, os.IsNotExist(err))
+
+	store := services.NewLocalBlobStore(dir)
+	assert.EqualError(t, store.Put("../escape", strings.NewReader("x")), "invalid blob key")
+	_, err = store.Get("receipts/missing")
+	assert.ErrorIs(t, err, services.ErrBlobNotFound)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"log"
 	"regexp"
 	"strings"
 	"unicode"
@@ -18,11 +19,12 @@ type AuthService struct {
 	db           *gorm.DB
 	tokenService *TokenService
 	otpService   *OTPService
+	smsService   *SMSService
 }
 
 // NewAuthService creates a new AuthService
-func NewAuthService(db *gorm.DB, tokenService *TokenService, otpService *OTPService) *AuthService {
-	return &AuthService{db: db, tokenService: tokenService, otpService: otpService}
+func NewAuthService(db *gorm.DB, tokenService *TokenService, otpService *OTPService, smsService *SMSService) *AuthService {
+	return &AuthService{db: db, tokenService: tokenService, otpService: otpService, smsService: smsService}
 }
 
 // --- DTOs ---
@@ -56,6 +58,11 @@ type ResendOTPInput struct {
 	Purpose string `json:"purpose" binding:"required"`
 }
 
+// VerifyPhoneInput is the DTO for verifying the account's phone number
+type VerifyPhoneInput struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
 // GoogleAuthInput is the DTO for Google OAuth
 type GoogleAuthInput struct {
 	GoogleID string `json:"google_id" binding:"required"`
@@ -68,9 +75,10 @@ type GoogleAuthInput struct {
 
 // AuthResponse is the full auth response (after OTP verified)
 type AuthResponse struct {
-	Token  string              `json:"token"`
-	User   models.UserResponse `json:"user"`
-	Wallet *models.Wallet      `json:"wallet"`
+	Token   string              `json:"token"`
+	User    models.UserResponse `json:"user"`
+	Wallet  *models.Wallet      `json:"wallet"`            // primary USD wallet
+	Wallets []models.Wallet     `json:"wallets,omitempty"` // every currency held
 }
 
 // OTPSentResponse is returned when OTP is sent (step 1)
@@ -167,7 +175,7 @@ func (s *AuthService) Register(input RegisterInput) (*OTPSentResponse, error) {
 		wallet := models.Wallet{
 			UserID:   user.ID,
 			Balance:  decimal.NewFromInt(0),
-			Currency: "USD",
+			Currency: models.DefaultCurrency,
 			IsActive: true,
 		}
 		return tx.Create(&wallet).Error
@@ -222,6 +230,10 @@ func (s *AuthService) Login(input LoginInput) (*OTPSentResponse, error) {
 
 // VerifyOTP verifies the OTP code and completes authentication
 func (s *AuthService) VerifyOTP(input VerifyOTPInput) (*AuthResponse, error) {
+	if input.Purpose == models.OTPPurposePhone {
+		return nil, errors.New("invalid verification code")
+	}
+
 	// Verify OTP
 	if err := s.otpService.Verify(input.UserID, input.Code, input.Purpose); err != nil {
 		return nil, err
@@ -229,7 +241,7 @@ func (s *AuthService) VerifyOTP(input VerifyOTPInput) (*AuthResponse, error) {
 
 	// Load user with wallet
 	var user models.User
-	if err := s.db.Preload("Wallet").Where("id = ?", input.UserID).First(&user).Error; err != nil {
+	if err := s.db.Preload("Wallet", "currency = ?", models.DefaultCurrency).Where("id = ?", input.UserID).First(&user).Error; err != nil {
 		return nil, errors.New("user not found")
 	}
 
@@ -237,6 +249,9 @@ func (s *AuthService) VerifyOTP(input VerifyOTPInput) (*AuthResponse, error) {
 	if input.Purpose == models.OTPPurposeRegister {
 		user.EmailVerified = true
 		s.db.Save(&user)
+		if err := notifyPendingClaims(s.db, &user, models.ClaimContactEmail); err != nil {
+			log.Printf("⚠️  Failed to tell %s about pending transfers: %v", user.ID, err)
+		}
 	}
 
 	// Generate JWT
@@ -258,6 +273,10 @@ func (s *AuthService) ResendOTP(input ResendOTPInput) (*OTPSentResponse, error)
 	if err := s.db.Where("id = ?", input.UserID).First(&user).Error; err != nil {
 		return nil, errors.New("user not found")
 	}
+	// Phone codes prove the number, so they are only ever texted
+	if input.Purpose == models.OTPPurposePhone {
+		return nil, errors.New("phone verification codes are sent by text")
+	}
 
 	if err := s.otpService.GenerateAndSend(user.ID, user.Email, input.Purpose); err != nil {
 		return nil, errors.New("failed to send verification code")
@@ -275,7 +294,7 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 	var user models.User
 
 	// Check if GoogleID already exists → login
-	if err := s.db.Preload("Wallet").Where("google_id = ?", input.GoogleID).First(&user).Error; err == nil {
+	if err := s.db.Preload("Wallet", "currency = ?", models.DefaultCurrency).Where("google_id = ?", input.GoogleID).First(&user).Error; err == nil {
 		token, err := s.tokenService.GenerateToken(user.ID)
 		if err != nil {
 			return nil, errors.New("failed to generate token")
@@ -288,7 +307,8 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 	}
 
 	// Check if email exists → link account
-	if err := s.db.Preload("Wallet").Where("email = ?", input.Email).First(&user).Error; err == nil {
+	if err := s.db.Preload("Wallet", "currency = ?", models.DefaultCurrency).Where("email = ?", input.Email).First(&user).Error; err == nil {
+		newlyVerified := !user.EmailVerified
 		user.GoogleID = input.GoogleID
 		user.AuthProvider = models.AuthProviderGoogle
 		user.EmailVerified = true
@@ -296,6 +316,11 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 			user.AvatarURL = input.Avatar
 		}
 		s.db.Save(&user)
+		if newlyVerified {
+			if err := notifyPendingClaims(s.db, &user, models.ClaimContactEmail); err != nil {
+				log.Printf("⚠️  Failed to tell %s about pending transfers: %v", user.ID, err)
+			}
+		}
 
 		token, err := s.tokenService.GenerateToken(user.ID)
 		if err != nil {
@@ -338,7 +363,7 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 		wallet = models.Wallet{
 			UserID:   user.ID,
 			Balance:  decimal.NewFromInt(0),
-			Currency: "USD",
+			Currency: models.DefaultCurrency,
 			IsActive: true,
 		}
 		return tx.Create(&wallet).Error
@@ -347,6 +372,11 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 		return nil, errors.New("failed to create user")
 	}
 
+	// Google has verified the email, so money sent there can be claimed
+	if err := notifyPendingClaims(s.db, &user, models.ClaimContactEmail); err != nil {
+		log.Printf("⚠️  Failed to tell %s about pending transfers: %v", user.ID, err)
+	}
+
 	token, err := s.tokenService.GenerateToken(user.ID)
 	if err != nil {
 		return nil, errors.New("failed to generate token")
@@ -359,16 +389,62 @@ func (s *AuthService) GoogleAuth(input GoogleAuthInput) (*AuthResponse, error) {
 	}, nil
 }
 
+// SendPhoneCode texts a code to the user's phone number to verify it
+func (s *AuthService) SendPhoneCode(userID string) error {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return errors.New("user not found")
+	}
+	if user.Phone == "" {
+		return errors.New("add a phone number to your account first")
+	}
+	if user.PhoneVerified {
+		return errors.New("phone number is already verified")
+	}
+
+	code, err := s.otpService.GenerateOTP(user.ID, models.OTPPurposePhone)
+	if err != nil {
+		return err
+	}
+	return s.smsService.SendOTP(user.Phone, code, models.OTPPurposePhone)
+}
+
+// VerifyPhone checks the code texted by SendPhoneCode and marks the phone
+// number verified, which lets the user claim money sent to it
+func (s *AuthService) VerifyPhone(userID string, input VerifyPhoneInput) (*models.UserResponse, error) {
+	if err := s.otpService.Verify(userID, input.Code, models.OTPPurposePhone); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if err := s.db.Model(&user).Update("phone_verified", true).Error; err != nil {
+		return nil, errors.New("failed to verify phone number")
+	}
+	if err := notifyPendingClaims(s.db, &user, models.ClaimContactPhone); err != nil {
+		log.Printf("⚠️  Failed to tell %s about pending transfers: %v", user.ID, err)
+	}
+
+	response := user.ToResponse()
+	return &response, nil
+}
+
 // GetMe returns the current user with their wallet
 func (s *AuthService) GetMe(userID string) (*AuthResponse, error) {
 	var user models.User
-	if err := s.db.Preload("Wallet").Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := s.db.Preload("Wallet", "currency = ?", models.DefaultCurrency).Where("id = ?", userID).First(&user).Error; err != nil {
 		return nil, errors.New("user not found")
 	}
 
+	var wallets []models.Wallet
+	s.db.Where("user_id = ?", userID).Order("created_at").Find(&wallets)
+
 	return &AuthResponse{
-		User:   user.ToResponse(),
-		Wallet: user.Wallet,
+		User:    user.ToResponse(),
+		Wallet:  user.Wallet,
+		Wallets: wallets,
 	}, nil
 }
 
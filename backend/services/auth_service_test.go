@@ -114,7 +114,7 @@ func TestMaskEmailEmptyName(t *testing.T) {
 func TestNewAuthService(t *testing.T) {
 	// Just verifying constructor doesn't panic with nil args
 	// In real usage, db/token/otp would be non-nil
-	service := NewAuthService(nil, nil, nil)
+	service := NewAuthService(nil, nil, nil, nil)
 	if service == nil {
 		t.Error("expected non-nil AuthService")
 	}
@@ -5,6 +5,7 @@ import (
 
 	"gatorpay-backend/models"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
@@ -13,11 +14,12 @@ import (
 type BillService struct {
 	db            *gorm.DB
 	rewardService *RewardService
+	limitService  *LimitService
 }
 
 // NewBillService creates a new BillService
-func NewBillService(db *gorm.DB, rewardService *RewardService) *BillService {
-	return &BillService{db: db, rewardService: rewardService}
+func NewBillService(db *gorm.DB, rewardService *RewardService, limitService *LimitService) *BillService {
+	return &BillService{db: db, rewardService: rewardService, limitService: limitService}
 }
 
 // BillPayInput is the DTO for paying a bill
@@ -76,36 +78,52 @@ func (s *BillService) PayBill(userID string, input BillPayInput) (*BillPayRespon
 	}
 
 	var response BillPayResponse
+	var paymentID string
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// Get user wallet
-		var wallet models.Wallet
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
-			return errors.New("wallet not found")
+		// Get user wallet, locked until the payment commits
+		locked, err := lockWalletByUser(tx, userID, models.DefaultCurrency)
+		if err != nil {
+			return err
 		}
+		wallet := *locked
 
 		if !wallet.IsActive {
 			return errors.New("wallet is not active")
 		}
 
 		// Check balance
-		if wallet.Balance.LessThan(amount) {
+		if wallet.Available().LessThan(amount) {
 			return errors.New("insufficient balance")
 		}
+		paymentID = uuid.New().String()
+		if err := s.limitService.reserve(tx, userID, models.LimitCategoryBill, amount, models.DefaultCurrency, paymentID); err != nil {
+			return err
+		}
+
+		description := "Bill payment to " + biller.Name + " (Acct: " + input.AccountNumber + ")"
 
-		// Debit wallet
-		wallet.Balance = wallet.Balance.Sub(amount)
-		if err := tx.Save(&wallet).Error; err != nil {
-			return errors.New("failed to debit wallet")
+		// Debit wallet, credit the amount owed to the biller
+		entry, err := postJournal(tx, models.JournalTypeBillPay, description,
+			debit(walletAccountCode(wallet.ID), amount),
+			credit(models.LedgerPlatformBillers, amount),
+		)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", wallet.ID).First(&wallet).Error; err != nil {
+			return errors.New("wallet not found")
 		}
 
 		// Create bill_pay transaction
 		transaction := models.Transaction{
-			WalletID:    wallet.ID,
-			FromUserID:  &userID,
-			Type:        models.TransactionTypeBillPay,
-			Amount:      amount,
-			Description: "Bill payment to " + biller.Name + " (Acct: " + input.AccountNumber + ")",
-			Status:      models.TransactionStatusSuccess,
+			ID:             paymentID,
+			WalletID:       wallet.ID,
+			FromUserID:     &userID,
+			Type:           models.TransactionTypeBillPay,
+			Amount:         amount,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
 		}
 		if err := tx.Create(&transaction).Error; err != nil {
 			return errors.New("failed to create transaction")
@@ -155,7 +173,7 @@ func (s *BillService) PayBill(userID string, input BillPayInput) (*BillPayRespon
 	}
 
 	// Award 2% cashback asynchronously
-	go s.rewardService.AwardCashback(userID, amount, 0.02, "Cashback for bill payment to "+biller.Name)
+	go s.rewardService.AwardCashback(userID, paymentID, amount, 0.02, "Cashback for bill payment to "+biller.Name)
 
 	return &response, nil
 }
@@ -1,12 +1,14 @@
 package services
 
 import (
+	"errors"
 	"time"
 
 	"gatorpay-backend/models"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BudgetService handles budgeting goals and auto-save rules
@@ -68,7 +70,7 @@ func (s *BudgetService) CreateGoal(userID string, req models.CreateGoalRequest)
 // GetGoals returns all budget goals for a user
 func (s *BudgetService) GetGoals(userID string) ([]models.BudgetGoal, error) {
 	var goals []models.BudgetGoal
-	err := s.db.Where("user_id = ?", userID).Order("created_at desc").Find(&goals).Error
+	err := s.db.Preload("Pocket").Where("user_id = ?", userID).Order("created_at desc").Find(&goals).Error
 	return goals, err
 }
 
@@ -89,7 +91,173 @@ func (s *BudgetService) CreateAutoSaveRule(userID string, req models.CreateAutoS
 	return &rule, nil
 }
 
-// ExecuteRoundup simulates a round-up savings execution
+// MoveToPocket moves money from the user's wallet into a goal's pocket. The
+// goal completes once its pocket reaches the target.
+func (s *BudgetService) MoveToPocket(userID, goalID string, req models.PocketMoveRequest) (*models.BudgetGoal, error) {
+	return s.movePocket(userID, goalID, decimal.NewFromFloat(req.Amount), true)
+}
+
+// MoveFromPocket moves money from a goal's pocket back to the user's wallet
+func (s *BudgetService) MoveFromPocket(userID, goalID string, req models.PocketMoveRequest) (*models.BudgetGoal, error) {
+	return s.movePocket(userID, goalID, decimal.NewFromFloat(req.Amount), false)
+}
+
+func (s *BudgetService) movePocket(userID, goalID string, amount decimal.Decimal, in bool) (*models.BudgetGoal, error) {
+	var goal *models.BudgetGoal
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		goal, err = movePocketFunds(tx, userID, goalID, amount, in, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+// movePocketFunds moves amount between the user's wallet and a goal's pocket
+// inside tx, recording a transaction on the wallet. The goal row is locked
+// first, then the wallet and the pocket. An empty description gets a default.
+func movePocketFunds(tx *gorm.DB, userID, goalID string, amount decimal.Decimal, in bool, description string) (*models.BudgetGoal, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+
+	var goal models.BudgetGoal
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", goalID, userID).First(&goal).Error; err != nil {
+		return nil, errors.New("goal not found")
+	}
+	if in && goal.Status != "active" {
+		return nil, errors.New("only active goals can receive money")
+	}
+
+	pocket, err := ensurePocket(tx, &goal)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := lockWalletByUser(tx, userID, pocket.Currency)
+	if err != nil {
+		return nil, err
+	}
+	wallet := *locked
+	if !wallet.IsActive {
+		return nil, errors.New("wallet is not active")
+	}
+
+	var txnType string
+	var lines []journalLine
+	if in {
+		if wallet.Available().LessThan(amount) {
+			return nil, errors.New("insufficient balance")
+		}
+		txnType = models.TransactionTypePocketDeposit
+		lines = []journalLine{
+			debit(walletAccountCode(wallet.ID), amount),
+			credit(pocketAccountCode(pocket.ID), amount),
+		}
+		if description == "" {
+			description = "Moved to " + goal.Name + " pocket"
+		}
+	} else {
+		if pocket.Balance.LessThan(amount) {
+			return nil, errors.New("insufficient pocket balance")
+		}
+		txnType = models.TransactionTypePocketWithdraw
+		lines = []journalLine{
+			debit(pocketAccountCode(pocket.ID), amount),
+			credit(walletAccountCode(wallet.ID), amount),
+		}
+		if description == "" {
+			description = "Moved from " + goal.Name + " pocket"
+		}
+	}
+
+	entry, err := postJournal(tx, models.JournalTypePocketTransfer, description, lines...)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := models.Transaction{
+		WalletID:       wallet.ID,
+		Type:           txnType,
+		Amount:         amount,
+		Currency:       pocket.Currency,
+		Description:    description,
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if in {
+		transaction.FromUserID = &userID
+	} else {
+		transaction.ToUserID = &userID
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return nil, errors.New("failed to record transaction")
+	}
+
+	if err := tx.Where("id = ?", pocket.ID).First(pocket).Error; err != nil {
+		return nil, errors.New("failed to reload pocket")
+	}
+	if err := updateGoalProgress(tx, &goal, pocket, in); err != nil {
+		return nil, err
+	}
+
+	goal.Pocket = pocket
+	return &goal, nil
+}
+
+// updateGoalProgress copies a pocket's balance onto its goal. When money
+// coming in takes an active goal to its target, the goal completes and the
+// user is told.
+func updateGoalProgress(tx *gorm.DB, goal *models.BudgetGoal, pocket *models.Pocket, grew bool) error {
+	updates := map[string]interface{}{"current_amount": pocket.Balance}
+	reached := grew && goal.Status == "active" && pocket.Balance.GreaterThanOrEqual(goal.TargetAmount)
+	if reached {
+		updates["status"] = "completed"
+	}
+	if err := tx.Model(goal).Updates(updates).Error; err != nil {
+		return errors.New("failed to update goal")
+	}
+	if reached {
+		body := "Your " + goal.Name + " pocket reached its target of $" + goal.TargetAmount.StringFixed(2) + "."
+		if _, err := createNotification(tx, goal.UserID, "system", "Goal reached", body, goal.Icon, ""); err != nil {
+			return errors.New("failed to notify user")
+		}
+	}
+	return nil
+}
+
+// ensurePocket returns a goal's pocket, opening it the first time money moves
+func ensurePocket(tx *gorm.DB, goal *models.BudgetGoal) (*models.Pocket, error) {
+	var pocket models.Pocket
+	if err := tx.Where("goal_id = ?", goal.ID).First(&pocket).Error; err == nil {
+		return &pocket, nil
+	}
+	walletID, err := walletIDForUser(tx, goal.UserID, models.DefaultCurrency)
+	if err != nil {
+		return nil, err
+	}
+	pocket = models.Pocket{UserID: goal.UserID, GoalID: goal.ID, WalletID: walletID, Currency: models.DefaultCurrency, Balance: decimal.Zero}
+	if err := tx.Create(&pocket).Error; err != nil {
+		return nil, errors.New("failed to open pocket")
+	}
+	return &pocket, nil
+}
+
+// roundupTypes are the outgoing payments that round-up rules round up
+var roundupTypes = []string{
+	models.TransactionTypeP2PSend,
+	models.TransactionTypeBillPay,
+	models.TransactionTypeQRPayment,
+	models.TransactionTypeCardSpend,
+	models.TransactionTypeWithdraw,
+}
+
+// ExecuteRoundup rounds each recent outgoing payment up to the next dollar and
+// moves the spare change into the goal pocket of every active round-up rule.
+// A rule only rounds up payments made since it last ran.
 func (s *BudgetService) ExecuteRoundup(userID string) (map[string]interface{}, error) {
 	// Get active round-up rules
 	var rules []models.AutoSaveRule
@@ -97,36 +265,96 @@ func (s *BudgetService) ExecuteRoundup(userID string) (map[string]interface{}, e
 
 	totalSaved := decimal.NewFromInt(0)
 	transactionsRounded := 0
+	rulesApplied := 0
+	now := time.Now()
 
-	// Get recent transactions and apply round-up
-	var transactions []models.Transaction
-	oneWeekAgo := time.Now().AddDate(0, 0, -7)
-	s.db.Where("from_user_id = ? AND created_at >= ?", userID, oneWeekAgo).Find(&transactions)
+	for _, rule := range rules {
+		if rule.GoalID == "" {
+			continue
+		}
 
-	for range transactions {
-		// Simulate round-up: each transaction rounds up to nearest dollar
-		roundup := decimal.NewFromFloat(0.50) // Average round-up
-		totalSaved = totalSaved.Add(roundup)
-		transactionsRounded++
-	}
+		since := now.AddDate(0, 0, -7)
+		if rule.LastRunAt != nil && rule.LastRunAt.After(since) {
+			since = *rule.LastRunAt
+		}
+		var transactions []models.Transaction
+		s.db.Where("from_user_id = ? AND type IN ? AND status = ? AND created_at > ? AND created_at <= ?",
+			userID, roundupTypes, models.TransactionStatusSuccess, since, now).Find(&transactions)
 
-	// If no transactions, simulate
-	if transactionsRounded == 0 {
-		totalSaved = decimal.NewFromFloat(3.75)
-		transactionsRounded = 5
-	}
+		saved := decimal.Zero
+		rounded := 0
+		for _, t := range transactions {
+			roundup := t.Amount.Ceil().Sub(t.Amount)
+			if roundup.IsPositive() {
+				saved = saved.Add(roundup)
+				rounded++
+			}
+		}
 
-	// Update goal progress if rule is associated with a goal
-	for _, rule := range rules {
-		if rule.GoalID != "" {
-			s.db.Model(&models.BudgetGoal{}).Where("id = ?", rule.GoalID).
-				Update("current_amount", gorm.Expr("current_amount + ?", totalSaved))
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if saved.IsPositive() {
+				if _, err := movePocketFunds(tx, userID, rule.GoalID, saved, true, "Round-up savings"); err != nil {
+					return err
+				}
+			}
+			return tx.Model(&rule).Update("last_run_at", now).Error
+		})
+		if err != nil {
+			// Leave the rule for the next run, e.g. once the wallet is topped up
+			continue
 		}
+		totalSaved = totalSaved.Add(saved)
+		transactionsRounded += rounded
+		rulesApplied++
 	}
 
 	return map[string]interface{}{
 		"total_saved":          totalSaved.StringFixed(2),
 		"transactions_rounded": transactionsRounded,
-		"rules_applied":        len(rules),
+		"rules_applied":        rulesApplied,
 	}, nil
 }
+
+// GetSpendingByCategory totals a month's spending per category. month is
+// YYYY-MM and defaults to the current month. Categories the user set on a
+// transaction take precedence over the guessed ones.
+func (s *BudgetService) GetSpendingByCategory(userID, month string) (*models.SpendingBreakdown, error) {
+	start := time.Now()
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	if month != "" {
+		parsed, err := time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return nil, errors.New("month must be YYYY-MM")
+		}
+		start = parsed
+	}
+
+	var transactions []models.Transaction
+	if err := s.db.Preload("Annotation").
+		Where("wallet_id IN (?)", s.db.Model(&models.Wallet{}).Select("id").Where("user_id = ?", userID)).
+		Where("type IN ? AND status = ? AND created_at >= ? AND created_at < ?",
+			spendingTypes, models.TransactionStatusSuccess, start, start.AddDate(0, 1, 0)).
+		Find(&transactions).Error; err != nil {
+		return nil, errors.New("failed to fetch transactions")
+	}
+
+	byCategory := make(map[string]*models.CategorySpend)
+	breakdown := models.SpendingBreakdown{Month: start.Format("2006-01"), Total: decimal.Zero, Categories: []models.CategorySpend{}}
+	for _, t := range transactions {
+		category := categorizeTransaction(t)
+		spend, ok := byCategory[category]
+		if !ok {
+			spend = &models.CategorySpend{Category: category, Amount: decimal.Zero}
+			byCategory[category] = spend
+		}
+		spend.Amount = spend.Amount.Add(t.Amount)
+		spend.Count++
+		breakdown.Total = breakdown.Total.Add(t.Amount)
+	}
+	for _, category := range spendingCategories {
+		if spend, ok := byCategory[category]; ok {
+			breakdown.Categories = append(breakdown.Categories, *spend)
+		}
+	}
+	return &breakdown, nil
+}
@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBBudget() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{}, &models.Hold{}, &models.LimitUsage{},
+		&models.BudgetGoal{}, &models.AutoSaveRule{}, &models.Pocket{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ReconciliationRun{}, &models.ReconciliationMismatch{}, &models.ReconciliationDiscrepancy{})
+	return db
+}
+
+func TestPocketHoldsGoalMoney(t *testing.T) {
+	db := setupTestDBBudget()
+	alice, _ := seedRefundUsers(t, db)
+	bs := services.NewBudgetService(db)
+	ws := services.NewWalletService(db, nil)
+
+	goal, err := bs.CreateGoal(alice.ID, models.CreateGoalRequest{Name: "Vacation", Category: "vacation", TargetAmount: 150})
+	assert.NoError(t, err)
+
+	goal, err = bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 120})
+	assert.NoError(t, err)
+	assert.True(t, goal.Pocket.Balance.Equal(decimal.NewFromInt(120)))
+	assert.True(t, goal.CurrentAmount.Equal(decimal.NewFromInt(120)))
+	assert.Equal(t, "active", goal.Status)
+
+	// Pocket money has left the wallet and cannot be spent
+	wallet, _ := ws.GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(80)))
+	_, err = bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 90})
+	assert.EqualError(t, err, "insufficient balance")
+
+	goal, err = bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", goal.Status)
+	var notifications int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title = ?", alice.ID, "Goal reached").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	_, err = bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 10})
+	assert.EqualError(t, err, "only active goals can receive money")
+	_, err = bs.MoveFromPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 200})
+	assert.EqualError(t, err, "insufficient pocket balance")
+	goal, err = bs.MoveFromPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 50})
+	assert.NoError(t, err)
+	assert.True(t, goal.CurrentAmount.Equal(decimal.NewFromInt(100)))
+
+	_, err = bs.MoveFromPocket("someone-else", goal.ID, models.PocketMoveRequest{Amount: 1})
+	assert.EqualError(t, err, "goal not found")
+
+	wallet, _ = ws.GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)))
+	var moves int64
+	db.Model(&models.Transaction{}).Where("type IN ?", []string{models.TransactionTypePocketDeposit, models.TransactionTypePocketWithdraw}).Count(&moves)
+	assert.Equal(t, int64(3), moves)
+
+	// Wallet balances still agree with transactions and the ledger
+	run, err := services.NewReconciliationService(db).Run(models.ReconciliationTriggerManual)
+	assert.NoError(t, err)
+	assert.Zero(t, run.MismatchCount)
+	trial, err := services.NewLedgerService(db).GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, trial.Balanced)
+}
+
+func TestRoundupMovesSpareChangeOnce(t *testing.T) {
+	db := setupTestDBBudget()
+	alice, _ := seedRefundUsers(t, db)
+	bs := services.NewBudgetService(db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+
+	goal, err := bs.CreateGoal(alice.ID, models.CreateGoalRequest{Name: "Emergency", Category: "emergency", TargetAmount: 1000})
+	assert.NoError(t, err)
+	_, err = bs.CreateAutoSaveRule(alice.ID, models.CreateAutoSaveRequest{GoalID: goal.ID, Type: "roundup"})
+	assert.NoError(t, err)
+
+	for _, amount := range []float64{10.25, 4.60, 7} {
+		_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: amount})
+		assert.NoError(t, err)
+	}
+	cashback := settledCashback(t, db, 3)
+
+	result, err := bs.ExecuteRoundup(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.15", result["total_saved"])
+	assert.Equal(t, 2, result["transactions_rounded"])
+
+	// The same payments are not rounded up twice
+	result, err = bs.ExecuteRoundup(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.00", result["total_saved"])
+
+	goals, _ := bs.GetGoals(alice.ID)
+	assert.True(t, goals[0].Pocket.Balance.Equal(decimal.NewFromFloat(1.15)))
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(177).Add(cashback)))
+}
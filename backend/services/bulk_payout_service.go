@@ -0,0 +1,406 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBulkPayoutRows  = 500
+	maxBulkPayoutBytes = 1 << 20
+)
+
+var (
+	// errDryRun rolls back a dry-run once every row has been tried
+	errDryRun = errors.New("dry run")
+	// errBatchFailed rolls back an all-or-nothing batch when a row fails
+	errBatchFailed = errors.New("a row in the batch failed")
+)
+
+// BulkPayoutService pays many people at once from a CSV file of recipient,
+// amount and note. Every row is an ordinary transfer with the same checks,
+// so only people with an account can be paid this way.
+type BulkPayoutService struct {
+	db        *gorm.DB
+	transfers *TransferService
+}
+
+// NewBulkPayoutService creates a new BulkPayoutService
+func NewBulkPayoutService(db *gorm.DB, transfers *TransferService) *BulkPayoutService {
+	return &BulkPayoutService{db: db, transfers: transfers}
+}
+
+// ExecuteBulkPayoutInput is the DTO for executing a checked batch
+type ExecuteBulkPayoutInput struct {
+	Mode string `json:"mode" binding:"required,oneof=all_or_nothing best_effort"`
+	Code string `json:"code" binding:"omitempty,len=6"` // needed when the batch requires verification
+}
+
+// Upload reads a payout file and checks every row with a dry-run that is
+// rolled back, so nothing moves until the batch is executed
+func (s *BulkPayoutService) Upload(senderID, fileName, currency string, file io.Reader) (*models.BulkPayout, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := parseBulkPayout(file)
+	if err != nil {
+		return nil, err
+	}
+
+	payout := models.BulkPayout{
+		SenderID:    senderID,
+		FileName:    fileName,
+		Currency:    currency,
+		Status:      models.BulkPayoutValidated,
+		RowCount:    len(rows),
+		TotalAmount: decimal.Zero,
+		SentAmount:  decimal.Zero,
+	}
+	for _, row := range rows {
+		if row.Status == models.BulkRowReady {
+			payout.TotalAmount = payout.TotalAmount.Add(row.Amount)
+		}
+	}
+	v := s.transfers.verification
+	if v == nil {
+		return nil, errTransfersUnavailable
+	}
+	value, err := v.usdValue(payout.TotalAmount, currency)
+	if err != nil {
+		return nil, err
+	}
+	payout.VerificationRequired = value.GreaterThan(v.threshold)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		s.run(tx, senderID, currency, rows, models.BulkRowReady, models.BulkRowInvalid)
+		return errDryRun
+	})
+	if err != errDryRun {
+		return nil, errors.New("failed to check payout file")
+	}
+	for _, row := range rows {
+		if row.Status == models.BulkRowInvalid {
+			payout.InvalidCount++
+		}
+	}
+
+	payout.Rows = rows
+	if err := s.db.Create(&payout).Error; err != nil {
+		return nil, errors.New("failed to save payout")
+	}
+	return &payout, nil
+}
+
+// Execute sends a checked batch. In all-or-nothing mode one failed row
+// cancels the whole batch; in best-effort mode failed rows are skipped. A
+// batch that needs verification first emails the sender a code and is
+// returned still validated, as is one the risk engine flags; one it blocks
+// is refused.
+func (s *BulkPayoutService) Execute(senderID, id string, input ExecuteBulkPayoutInput) (*models.BulkPayout, error) {
+	payout, err := s.GetPayout(senderID, id)
+	if err != nil {
+		return nil, err
+	}
+	if payout.Status != models.BulkPayoutValidated {
+		return nil, errors.New("this payout was already " + strings.ReplaceAll(payout.Status, "_", " "))
+	}
+	if input.Mode != models.BulkPayoutAllOrNothing && input.Mode != models.BulkPayoutBestEffort {
+		return nil, errors.New("mode must be all_or_nothing or best_effort")
+	}
+	if input.Mode == models.BulkPayoutAllOrNothing && payout.InvalidCount > 0 {
+		return nil, fmt.Errorf("%d rows failed the dry-run; fix the file or send the rest with best_effort", payout.InvalidCount)
+	}
+	v := s.transfers.verification
+	if v == nil {
+		return nil, errTransfersUnavailable
+	}
+	value, err := v.usdValue(payout.TotalAmount, payout.Currency)
+	if err != nil {
+		return nil, err
+	}
+	_, flagged, err := v.screen(senderID, "bulk_payout", value)
+	if err != nil {
+		return nil, err
+	}
+	if flagged {
+		payout.VerificationRequired = true
+	}
+	if payout.VerificationRequired {
+		if input.Code == "" {
+			if err := v.sendCode(senderID); err != nil {
+				return nil, err
+			}
+			return payout, nil
+		}
+		if err := v.otp.Verify(senderID, input.Code, models.OTPPurposeTransfer); err != nil {
+			return nil, err
+		}
+	}
+
+	// Take the batch out of validated first, so it can only be sent once
+	claimed := s.db.Model(&models.BulkPayout{}).
+		Where("id = ? AND status = ?", payout.ID, models.BulkPayoutValidated).
+		Updates(map[string]interface{}{"status": models.BulkPayoutProcessing, "mode": input.Mode})
+	if claimed.Error != nil {
+		return nil, errors.New("failed to update payout")
+	}
+	if claimed.RowsAffected == 0 {
+		return nil, errors.New("this payout is already being sent")
+	}
+	payout.Mode = input.Mode
+
+	var sent []*TransferResponse
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		sent = s.run(tx, senderID, payout.Currency, payout.Rows, models.BulkRowSent, models.BulkRowFailed)
+		if payout.Mode == models.BulkPayoutAllOrNothing && len(sent) < len(payout.Rows) {
+			return errBatchFailed
+		}
+		return s.finish(tx, payout)
+	})
+	if err == errBatchFailed {
+		// Nothing was sent, including rows that went through before the rollback
+		sent = nil
+		for i := range payout.Rows {
+			if payout.Rows[i].Status == models.BulkRowSent {
+				payout.Rows[i].Status = models.BulkRowSkipped
+				payout.Rows[i].Error = "not sent because another row failed"
+				payout.Rows[i].TransactionID = nil
+			}
+		}
+		err = s.finish(s.db, payout)
+	}
+	if err != nil {
+		s.db.Model(&models.BulkPayout{}).Where("id = ?", payout.ID).Update("status", models.BulkPayoutValidated)
+		return nil, errors.New("failed to send payout")
+	}
+
+	for _, response := range sent {
+		s.transfers.awardCashback(senderID, response)
+	}
+	body := fmt.Sprintf("%d of %d payments in %s were sent.", payout.SentCount, payout.RowCount, payout.FileName)
+	createNotification(s.db, senderID, "payment", "Bulk payout finished", body, "📤", "/transfer/bulk/"+payout.ID)
+	return payout, nil
+}
+
+// GetPayouts returns the user's batches, newest first, without their rows
+func (s *BulkPayoutService) GetPayouts(senderID string) ([]models.BulkPayout, error) {
+	var payouts []models.BulkPayout
+	if err := s.db.Where("sender_id = ?", senderID).Order("created_at DESC").Find(&payouts).Error; err != nil {
+		return nil, errors.New("failed to fetch payouts")
+	}
+	return payouts, nil
+}
+
+// GetPayout returns one of the user's batches with every row
+func (s *BulkPayoutService) GetPayout(senderID, id string) (*models.BulkPayout, error) {
+	var payout models.BulkPayout
+	if err := s.db.Where("id = ? AND sender_id = ?", id, senderID).
+		Preload("Rows", func(db *gorm.DB) *gorm.DB { return db.Order("line") }).
+		First(&payout).Error; err != nil {
+		return nil, errors.New("payout not found")
+	}
+	return &payout, nil
+}
+
+// ResultFile renders a batch and what became of each row as CSV, in the
+// order of the uploaded file
+func (s *BulkPayoutService) ResultFile(senderID, id string) (string, []byte, error) {
+	payout, err := s.GetPayout(senderID, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"Line", "Recipient", "Amount", "Currency", "Note", "Status", "Error", "Transaction ID"})
+	for _, row := range payout.Rows {
+		transactionID := ""
+		if row.TransactionID != nil {
+			transactionID = *row.TransactionID
+		}
+		w.Write([]string{
+			strconv.Itoa(row.Line), csvSafe(row.Recipient), row.Amount.StringFixed(2), payout.Currency,
+			csvSafe(row.Note), row.Status, row.Error, transactionID,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", nil, errors.New("failed to write payout results")
+	}
+	return fmt.Sprintf("payout-%s-results.csv", payout.ID[:8]), buf.Bytes(), nil
+}
+
+// run tries every ready row inside tx, each in its own savepoint so a failed
+// row leaves the others alone. Rows are marked ok or failed, and the
+// responses of the rows that went through are returned.
+func (s *BulkPayoutService) run(tx *gorm.DB, senderID, currency string, rows []models.BulkPayoutRow, ok, failed string) []*TransferResponse {
+	var sent []*TransferResponse
+	for i := range rows {
+		row := &rows[i]
+		if row.Status != models.BulkRowReady {
+			continue
+		}
+		var response *TransferResponse
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			recipient, err := findRecipient(tx, row.Recipient)
+			if err != nil {
+				return err
+			}
+			response, err = s.transfers.transfer(tx, senderID, recipient, row.Amount, currency, row.Note)
+			return err
+		})
+		if err != nil {
+			row.Status, row.Error = failed, err.Error()
+			continue
+		}
+		row.Status = ok
+		if ok == models.BulkRowSent {
+			row.TransactionID = &response.TransactionID
+		}
+		sent = append(sent, response)
+	}
+	return sent
+}
+
+// finish saves the rows' results and the batch's totals
+func (s *BulkPayoutService) finish(db *gorm.DB, payout *models.BulkPayout) error {
+	payout.SentCount, payout.FailedCount, payout.SentAmount = 0, 0, decimal.Zero
+	for i := range payout.Rows {
+		row := &payout.Rows[i]
+		switch row.Status {
+		case models.BulkRowSent:
+			payout.SentCount++
+			payout.SentAmount = payout.SentAmount.Add(row.Amount)
+		case models.BulkRowFailed, models.BulkRowInvalid:
+			payout.FailedCount++
+		}
+		if err := db.Model(row).Select("status", "error", "transaction_id").Updates(row).Error; err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case payout.SentCount == payout.RowCount:
+		payout.Status = models.BulkPayoutCompleted
+	case payout.SentCount == 0:
+		payout.Status = models.BulkPayoutFailed
+	default:
+		payout.Status = models.BulkPayoutPartial
+	}
+	now := time.Now()
+	payout.ExecutedAt = &now
+	return db.Model(payout).Select("status", "sent_count", "failed_count", "sent_amount", "executed_at").Updates(payout).Error
+}
+
+// parseBulkPayout reads recipient, amount and note columns from a CSV file.
+// A header row naming the columns is optional; without one the columns are
+// taken in that order. Rows that cannot be read are returned invalid.
+func parseBulkPayout(file io.Reader) ([]models.BulkPayoutRow, error) {
+	data, err := io.ReadAll(io.LimitReader(file, maxBulkPayoutBytes+1))
+	if err != nil {
+		return nil, errors.New("failed to read payout file")
+	}
+	if len(data) > maxBulkPayoutBytes {
+		return nil, errors.New("payout file must be at most 1 MB")
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	recipientCol, amountCol, noteCol := 0, 1, 2
+	var rows []models.BulkPayoutRow
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("payout file is not valid CSV: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+		if first && bulkPayoutHeader(record) {
+			recipientCol, amountCol, noteCol = -1, -1, -1
+			for i, name := range record {
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "recipient":
+					recipientCol = i
+				case "amount":
+					amountCol = i
+				case "note":
+					noteCol = i
+				}
+			}
+			if recipientCol < 0 || amountCol < 0 {
+				return nil, errors.New("payout file header must have recipient and amount columns")
+			}
+			continue
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := models.BulkPayoutRow{
+			Line:      line,
+			Recipient: strings.TrimSpace(field(record, recipientCol)),
+			Note:      strings.TrimSpace(field(record, noteCol)),
+			Amount:    decimal.Zero,
+			Status:    models.BulkRowReady,
+		}
+		amount, err := decimal.NewFromString(strings.TrimSpace(field(record, amountCol)))
+		switch {
+		case row.Recipient == "":
+			row.Error = "recipient is missing"
+		case err != nil:
+			row.Error = "amount must be a number"
+		case amount.LessThanOrEqual(decimal.Zero):
+			row.Error = "amount must be greater than 0"
+		case !amount.Equal(amount.Round(2)):
+			row.Error = "amount must have at most 2 decimal places"
+		}
+		if err == nil {
+			row.Amount = amount
+		}
+		if row.Error != "" {
+			row.Status = models.BulkRowInvalid
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("payout file has no payments")
+	}
+	if len(rows) > maxBulkPayoutRows {
+		return nil, fmt.Errorf("payout file can have at most %d payments", maxBulkPayoutRows)
+	}
+	return rows, nil
+}
+
+// bulkPayoutHeader reports whether a record is a header naming the columns
+func bulkPayoutHeader(record []string) bool {
+	for _, name := range record {
+		if strings.EqualFold(strings.TrimSpace(name), "recipient") {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns column i of a record, or "" if the record is shorter
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
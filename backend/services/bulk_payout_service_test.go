@@ -0,0 +1,222 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"gatorpay-backend/config"
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBBulkPayout() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.BulkPayout{}, &models.BulkPayoutRow{})
+	return db
+}
+
+// seedBulkPayoutUsers adds carol, with an empty wallet, to alice and bob
+func seedBulkPayoutUsers(t *testing.T, db *gorm.DB) (alice, bob, carol models.User) {
+	alice, bob = seedRefundUsers(t, db)
+	carol = models.User{Email: "c@test.com", Username: "carol", Phone: "3", FirstName: "C", LastName: "C"}
+	db.Create(&carol)
+	db.Create(&models.Wallet{UserID: carol.ID, IsActive: true})
+	return alice, bob, carol
+}
+
+func balanceOf(t *testing.T, db *gorm.DB, userID string) decimal.Decimal {
+	wallet, err := services.NewWalletService(db, nil).GetWallet(userID)
+	assert.NoError(t, err)
+	return wallet.Balance
+}
+
+func TestBulkPayoutBestEffort(t *testing.T) {
+	db := setupTestDBBulkPayout()
+	alice, bob, carol := seedBulkPayoutUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	bs := services.NewBulkPayoutService(db, ts)
+
+	file := "\ufeffAmount,Recipient,Note\n" +
+		"50,bob,March dues\n" +
+		"25.5, c@test.com ,\"Snacks, drinks\"\n" +
+		"\n" +
+		"10,nobody,\n" +
+		"ten,bob,\n" +
+		"5,alice,\n" +
+		"200,carol,=1+1\n"
+	payout, err := bs.Upload(alice.ID, "march.csv", "", strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, models.BulkPayoutValidated, payout.Status)
+	assert.Equal(t, 6, payout.RowCount)
+	assert.Equal(t, 4, payout.InvalidCount)
+	assert.False(t, payout.VerificationRequired)
+	report := map[int]string{}
+	for _, row := range payout.Rows {
+		report[row.Line] = row.Status + " " + row.Error
+	}
+	assert.Equal(t, map[int]string{
+		2: "ready ",
+		3: "ready ",
+		5: "invalid recipient not found",
+		6: "invalid amount must be a number",
+		7: "invalid cannot send money to yourself",
+		8: "invalid insufficient balance",
+	}, report, "rows are checked in order against the balance left")
+	assert.True(t, balanceOf(t, db, alice.ID).Equal(decimal.NewFromInt(200)), "the dry-run moves nothing")
+
+	_, err = bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing})
+	assert.EqualError(t, err, "4 rows failed the dry-run; fix the file or send the rest with best_effort")
+	_, err = bs.Execute(bob.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutBestEffort})
+	assert.EqualError(t, err, "payout not found")
+
+	done, err := bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutBestEffort})
+	assert.NoError(t, err)
+	assert.Equal(t, models.BulkPayoutPartial, done.Status)
+	assert.Equal(t, 2, done.SentCount)
+	assert.Equal(t, 4, done.FailedCount)
+	assert.True(t, done.SentAmount.Equal(decimal.RequireFromString("75.5")))
+	settledCashback(t, db, 2)
+	assert.True(t, balanceOf(t, db, bob.ID).Equal(decimal.NewFromInt(50)))
+	assert.True(t, balanceOf(t, db, carol.ID).Equal(decimal.RequireFromString("25.5")))
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Bulk payout finished"))
+
+	_, err = bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutBestEffort})
+	assert.EqualError(t, err, "this payout was already partially completed")
+
+	name, data, err := bs.ResultFile(alice.ID, payout.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "payout-"+payout.ID[:8]+"-results.csv", name)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, "Line,Recipient,Amount,Currency,Note,Status,Error,Transaction ID", lines[0])
+	assert.True(t, strings.HasPrefix(lines[2], "3,c@test.com,25.50,USD,\"Snacks, drinks\",sent,,"), lines[2])
+	assert.Equal(t, "6,bob,0.00,USD,,invalid,amount must be a number,", lines[4])
+	assert.True(t, strings.HasPrefix(lines[6], "8,carol,200.00,USD,'=1+1,invalid"), "notes cannot run as formulas")
+
+	payouts, _ := bs.GetPayouts(alice.ID)
+	assert.Len(t, payouts, 1)
+	assert.Empty(t, payouts[0].Rows)
+}
+
+func TestBulkPayoutAllOrNothing(t *testing.T) {
+	db := setupTestDBBulkPayout()
+	alice, bob, carol := seedBulkPayoutUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	bs := services.NewBulkPayoutService(db, ts)
+
+	// Without a header the columns are recipient, amount, note
+	payout, err := bs.Upload(alice.ID, "dues.csv", "usd", strings.NewReader("bob,100,dues\ncarol,80\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, payout.InvalidCount)
+	assert.Equal(t, "carol", payout.Rows[1].Recipient)
+	assert.True(t, payout.TotalAmount.Equal(decimal.NewFromInt(180)))
+
+	// Alice spends money before the batch runs, so carol's row no longer fits
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 50})
+	assert.NoError(t, err)
+	settledCashback(t, db, 1)
+
+	failed, err := bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing})
+	assert.NoError(t, err)
+	assert.Equal(t, models.BulkPayoutFailed, failed.Status)
+	assert.Equal(t, 0, failed.SentCount)
+	assert.Equal(t, models.BulkRowSkipped, failed.Rows[0].Status)
+	assert.Nil(t, failed.Rows[0].TransactionID)
+	assert.Equal(t, models.BulkRowFailed, failed.Rows[1].Status)
+	assert.Equal(t, "insufficient balance", failed.Rows[1].Error)
+
+	assert.True(t, balanceOf(t, db, alice.ID).Equal(decimal.RequireFromString("150.5")), "nothing was sent, only the earlier transfer and its cashback")
+	assert.True(t, balanceOf(t, db, bob.ID).Equal(decimal.NewFromInt(50)))
+	assert.True(t, balanceOf(t, db, carol.ID).IsZero())
+	var count int64
+	db.Model(&models.Transaction{}).Where("type = ?", models.TransactionTypeP2PSend).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	stored, _ := bs.GetPayout(alice.ID, payout.ID)
+	assert.Equal(t, models.BulkRowSkipped, stored.Rows[0].Status)
+	assert.Equal(t, "not sent because another row failed", stored.Rows[0].Error)
+}
+
+func TestBulkPayoutNeedsCodeAboveThreshold(t *testing.T) {
+	db := setupTestDBBulkPayout()
+	alice, bob, carol := seedBulkPayoutUsers(t, db)
+	ts := services.NewTransferService(db, services.NewRewardService(db), nil, nil)
+	otp := services.NewOTPService(db, services.NewEmailService(&config.Config{}))
+	ts.SetVerification(services.NewTransferVerificationService(db, ts, otp, nil, decimal.NewFromInt(100)))
+	bs := services.NewBulkPayoutService(db, ts)
+
+	// Splitting a large payment across rows still needs a code
+	payout, err := bs.Upload(alice.ID, "big.csv", "", strings.NewReader("recipient,amount\nbob,60\ncarol,60\n"))
+	assert.NoError(t, err)
+	assert.True(t, payout.VerificationRequired)
+
+	waiting, err := bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing})
+	assert.NoError(t, err)
+	assert.Equal(t, models.BulkPayoutValidated, waiting.Status, "a code is emailed first")
+	assert.True(t, balanceOf(t, db, bob.ID).IsZero())
+
+	code := transferCode(db, alice.ID)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	_, err = bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing, Code: wrong})
+	assert.EqualError(t, err, "invalid verification code")
+
+	done, err := bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing, Code: code})
+	assert.NoError(t, err)
+	assert.Equal(t, models.BulkPayoutCompleted, done.Status)
+	settledCashback(t, db, 2)
+	assert.True(t, balanceOf(t, db, carol.ID).Equal(decimal.NewFromInt(60)))
+}
+
+func TestBulkPayoutRejectsBadFiles(t *testing.T) {
+	db := setupTestDBBulkPayout()
+	alice, _, _ := seedBulkPayoutUsers(t, db)
+	bs := services.NewBulkPayoutService(db, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+
+	_, err := bs.Upload(alice.ID, "empty.csv", "", strings.NewReader("recipient,amount,note\n"))
+	assert.EqualError(t, err, "payout file has no payments")
+	_, err = bs.Upload(alice.ID, "header.csv", "", strings.NewReader("recipient,value\nbob,5\n"))
+	assert.EqualError(t, err, "payout file header must have recipient and amount columns")
+	_, err = bs.Upload(alice.ID, "quotes.csv", "", strings.NewReader("bob,\"5\n"))
+	assert.ErrorContains(t, err, "payout file is not valid CSV")
+	_, err = bs.Upload(alice.ID, "huge.csv", "", strings.NewReader(strings.Repeat("bob,1\n", 501)))
+	assert.EqualError(t, err, "payout file can have at most 500 payments")
+	_, err = bs.Upload(alice.ID, "fx.csv", "XYZ", strings.NewReader("bob,1\n"))
+	assert.Error(t, err)
+
+	payout, err := bs.Upload(alice.ID, "odd.csv", "", strings.NewReader(",5\nbob,-1\nbob,1.234\n"))
+	assert.NoError(t, err)
+	var errs []string
+	for _, row := range payout.Rows {
+		errs = append(errs, row.Error)
+	}
+	assert.Equal(t, []string{"recipient is missing", "amount must be greater than 0", "amount must have at most 2 decimal places"}, errs)
+}
+
+func TestBlockedBulkPayoutIsRefused(t *testing.T) {
+	db := setupTestDBBulkPayout()
+	alice, bob, _ := seedBulkPayoutUsers(t, db)
+	deposit(t, db, alice.ID, 2000)
+	bs := services.NewBulkPayoutService(db, newTransferVerification(db, 1000))
+
+	payout, err := bs.Upload(alice.ID, "bonus.csv", "", strings.NewReader("bob,1500\n"))
+	assert.NoError(t, err)
+
+	sendBurst(db, alice, bob)
+	_, err = bs.Execute(alice.ID, payout.ID, services.ExecuteBulkPayoutInput{Mode: models.BulkPayoutAllOrNothing})
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+	payout, _ = bs.GetPayout(alice.ID, payout.ID)
+	assert.Equal(t, models.BulkPayoutValidated, payout.Status)
+	assert.True(t, balanceOf(t, db, bob.ID).IsZero())
+}
@@ -8,9 +8,13 @@ import (
 
 	"gatorpay-backend/models"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// cardHoldTTL is how long a card authorization reserves funds before it lapses
+const cardHoldTTL = 7 * 24 * time.Hour
+
 type CardService struct {
 	db *gorm.DB
 }
@@ -88,3 +92,36 @@ func (s *CardService) ToggleFreeze(cardID string, userID string) (*models.Virtua
 	s.db.Save(&card)
 	return &card, nil
 }
+
+// CardAuthorizeInput is the DTO for authorizing a card spend
+type CardAuthorizeInput struct {
+	Amount   float64 `json:"amount" binding:"required"`
+	Merchant string  `json:"merchant" binding:"required"`
+}
+
+// Authorize reserves funds for a card spend. The hold is captured when the
+// merchant settles, or released automatically after cardHoldTTL.
+func (s *CardService) Authorize(cardID string, userID string, input CardAuthorizeInput) (*models.Hold, error) {
+	var card models.VirtualCard
+	if err := s.db.Where("id = ? AND user_id = ?", cardID, userID).First(&card).Error; err != nil {
+		return nil, errors.New("card not found")
+	}
+	if card.IsFrozen {
+		return nil, errors.New("card is frozen")
+	}
+
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		walletID, err := walletIDForUser(tx, userID, models.DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		description := fmt.Sprintf("Card spend at %s (card ending %s)", input.Merchant, card.CardNumber[12:])
+		hold, err = placeHold(tx, walletID, models.HoldTypeCard, card.ID, description, decimal.NewFromFloat(input.Amount), cardHoldTTL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
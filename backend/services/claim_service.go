@@ -0,0 +1,502 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPendingClaims is how many unclaimed links a sender may have open at once
+const maxPendingClaims = 10
+
+// errClaimExpired is returned for a pending claim link found past its expiry
+var errClaimExpired = errors.New("this claim link has expired")
+
+// ClaimService holds money sent to people without an account in escrow
+// until they sign up and claim it, and refunds it when nobody does
+type ClaimService struct {
+	db        *gorm.DB
+	transfers *TransferService
+	email     *EmailService
+	sms       *SMSService
+	linkBase  string        // frontend URL claim links point at
+	expiry    time.Duration // how long a link stays claimable
+}
+
+// NewClaimService creates a new ClaimService. Pass it to
+// TransferService.SetClaims to send by claim link.
+func NewClaimService(db *gorm.DB, transfers *TransferService, email *EmailService, sms *SMSService, frontendURL string, expiry time.Duration) *ClaimService {
+	return &ClaimService{db: db, transfers: transfers, email: email, sms: sms, linkBase: strings.TrimRight(frontendURL, "/"), expiry: expiry}
+}
+
+// ClaimInput is the DTO for claiming money
+type ClaimInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// claimContact reads a transfer recipient as an email or phone number
+func claimContact(identifier string) (contact, contactType string, ok bool) {
+	identifier = strings.TrimSpace(identifier)
+	if validateEmail(identifier) == nil {
+		return strings.ToLower(identifier), models.ClaimContactEmail, true
+	}
+	if phone, ok := phoneNumber(identifier); ok {
+		return phone, models.ClaimContactPhone, true
+	}
+	return "", "", false
+}
+
+// phoneNumber reads identifier as a phone number written with digits and
+// the usual punctuation, e.g. (352) 555-0100, and returns its 10 digits
+func phoneNumber(identifier string) (string, bool) {
+	if strings.Trim(identifier, "0123456789 ()-.+") != "" {
+		return "", false
+	}
+	phone, err := validatePhone(strings.TrimPrefix(identifier, "+1"))
+	return phone, err == nil
+}
+
+// send moves amount from the sender's wallet into escrow and sends the
+// recipient a link to claim it
+func (s *ClaimService) send(senderID, contact, contactType string, amount decimal.Decimal, currency, note string) (*TransferResponse, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	token, err := newClaimToken()
+	if err != nil {
+		return nil, errors.New("failed to create claim link")
+	}
+
+	var sender models.User
+	var claim models.ClaimLink
+	var response *TransferResponse
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", senderID).First(&sender).Error; err != nil {
+			return errors.New("user not found")
+		}
+		var open int64
+		if err := tx.Model(&models.ClaimLink{}).Where("sender_id = ? AND status = ?", senderID, models.ClaimStatusPending).
+			Count(&open).Error; err != nil {
+			return errors.New("failed to check open claim links")
+		}
+		if open >= maxPendingClaims {
+			return fmt.Errorf("you already have %d unclaimed transfers", open)
+		}
+
+		walletID, err := walletIDForUser(tx, senderID, currency)
+		if err != nil {
+			return errors.New("sender wallet not found")
+		}
+		wallets, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[walletID]
+		if !wallet.IsActive {
+			return errors.New("sender wallet is not active")
+		}
+		if wallet.Available().LessThan(amount) {
+			return errors.New("insufficient balance")
+		}
+		sendTxID := uuid.New().String()
+		if err := s.transfers.limitService.reserve(tx, senderID, models.LimitCategoryP2P, amount, currency, sendTxID); err != nil {
+			return err
+		}
+
+		description := "Transfer to " + contact
+		if note != "" {
+			description += " - " + note
+		}
+		entry, err := postJournal(tx, models.JournalTypeClaim, description,
+			debit(walletAccountCode(walletID), amount),
+			credit(platformCode(models.LedgerPlatformClaims, currency), amount),
+		)
+		if err != nil {
+			return err
+		}
+		sendTx := models.Transaction{
+			ID:             sendTxID,
+			WalletID:       walletID,
+			FromUserID:     &senderID,
+			Type:           models.TransactionTypeClaimSend,
+			Amount:         amount,
+			Currency:       currency,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
+		}
+		if err := tx.Create(&sendTx).Error; err != nil {
+			return errors.New("failed to create send transaction")
+		}
+
+		claim = models.ClaimLink{
+			SenderID:          senderID,
+			Contact:           contact,
+			ContactType:       contactType,
+			Amount:            amount,
+			Currency:          currency,
+			Note:              note,
+			TokenHash:         hashClaimToken(token),
+			Status:            models.ClaimStatusPending,
+			ExpiresAt:         time.Now().Add(s.expiry),
+			SendTransactionID: sendTx.ID,
+		}
+		if err := tx.Create(&claim).Error; err != nil {
+			return errors.New("failed to create claim link")
+		}
+		if err := tx.Where("id = ?", walletID).First(wallet).Error; err != nil {
+			return errors.New("sender wallet not found")
+		}
+
+		response = &TransferResponse{
+			TransactionID:     sendTx.ID,
+			Amount:            amount,
+			Currency:          currency,
+			Note:              note,
+			NewBalance:        wallet.Balance,
+			RecipientAmount:   amount,
+			RecipientCurrency: currency,
+			Claim:             &claim,
+			ClaimURL:          s.claimURL(token),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.deliver(&claim, sender.Username, response.ClaimURL)
+	return response, nil
+}
+
+// deliver sends the claim link to the recipient. Delivery failures are only
+// logged; the sender has the link too and can pass it on.
+func (s *ClaimService) deliver(claim *models.ClaimLink, senderName, link string) {
+	amount := claim.Amount.StringFixed(2) + " " + claim.Currency
+	var err error
+	switch {
+	case claim.ContactType == models.ClaimContactPhone && s.sms != nil:
+		err = s.sms.SendClaimLink(claim.Contact, senderName, amount, link)
+	case claim.ContactType == models.ClaimContactEmail && s.email != nil:
+		err = s.email.SendClaimLink(claim.Contact, senderName, amount, link)
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to send claim link %s: %v", claim.ID, err)
+	}
+}
+
+// GetClaims lists the claim links a user sent, or with role "received" the
+// ones sent to their email or verified phone number, optionally filtered by
+// status
+func (s *ClaimService) GetClaims(userID, role, status string) ([]models.ClaimLink, error) {
+	query := s.db.Preload("Sender")
+	switch role {
+	case "", "sent":
+		query = query.Where("sender_id = ?", userID)
+	case "received":
+		var user models.User
+		if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+			return nil, errors.New("user not found")
+		}
+		received := "(contact_type = ? AND contact = ?) OR claimed_by = ?"
+		args := []interface{}{models.ClaimContactEmail, strings.ToLower(user.Email), userID}
+		if user.PhoneVerified {
+			received += " OR (contact_type = ? AND contact = ?)"
+			args = append(args, models.ClaimContactPhone, user.Phone)
+		}
+		query = query.Where(received, args...)
+	default:
+		return nil, errors.New("role must be sent or received")
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var claims []models.ClaimLink
+	if err := query.Order("created_at DESC").Find(&claims).Error; err != nil {
+		return nil, errors.New("failed to fetch claim links")
+	}
+	return claims, nil
+}
+
+// Claim pays a claim link's money into the user's wallet. The user must have
+// verified the email or phone number the money was sent to.
+func (s *ClaimService) Claim(userID string, input ClaimInput) (*models.ClaimLink, error) {
+	var claim models.ClaimLink
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return errors.New("user not found")
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashClaimToken(input.Token)).First(&claim).Error; err != nil {
+			return errors.New("claim link not found")
+		}
+		if err := checkClaimable(&claim); err != nil {
+			return err
+		}
+		if claim.SenderID == userID {
+			return errors.New("cannot claim your own transfer; cancel it instead")
+		}
+		if !user.EmailVerified {
+			return errors.New("verify your account before claiming money")
+		}
+		if !claimMatches(&claim, &user) {
+			return errors.New("this transfer was sent to someone else")
+		}
+		if claim.ContactType == models.ClaimContactPhone && !user.PhoneVerified {
+			return errors.New("verify your phone number before claiming money sent to it")
+		}
+
+		walletID, err := ensureWallet(tx, userID, claim.Currency)
+		if err != nil {
+			return err
+		}
+		wallets, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+		if !wallets[walletID].IsActive {
+			return errors.New("your wallet is not active")
+		}
+
+		var sender models.User
+		tx.Where("id = ?", claim.SenderID).First(&sender)
+		description := "Received from " + sender.Username
+		if claim.Note != "" {
+			description += " - " + claim.Note
+		}
+		entry, err := postJournal(tx, models.JournalTypeClaim, description,
+			debit(platformCode(models.LedgerPlatformClaims, claim.Currency), claim.Amount),
+			credit(walletAccountCode(walletID), claim.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		receiveTx := models.Transaction{
+			WalletID:       walletID,
+			FromUserID:     &claim.SenderID,
+			ToUserID:       &userID,
+			Type:           models.TransactionTypeClaimReceive,
+			Amount:         claim.Amount,
+			Currency:       claim.Currency,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
+		}
+		if err := tx.Create(&receiveTx).Error; err != nil {
+			return errors.New("failed to create receive transaction")
+		}
+		// The sender's record now has someone to point at
+		if err := tx.Model(&models.Transaction{}).Where("id = ?", claim.SendTransactionID).
+			Update("to_user_id", userID).Error; err != nil {
+			return errors.New("failed to update send transaction")
+		}
+
+		now := time.Now()
+		claim.Status = models.ClaimStatusClaimed
+		claim.ClaimedBy = &userID
+		claim.ClaimTransactionID = &receiveTx.ID
+		claim.ResolvedAt = &now
+		if err := tx.Save(&claim).Error; err != nil {
+			return errors.New("failed to update claim link")
+		}
+
+		body := fmt.Sprintf("%s claimed the %s %s you sent to %s.", user.Username, claim.Amount.StringFixed(2), claim.Currency, claim.Contact)
+		_, err = createNotification(tx, claim.SenderID, "payment", "Transfer claimed", body, "🎉", "/transfer/claims")
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errClaimExpired) {
+			if refundErr := s.refund(claim.ID, models.ClaimStatusRefunded); refundErr != nil {
+				log.Printf("⚠️  Failed to refund claim link %s: %v", claim.ID, refundErr)
+			}
+		}
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// Cancel takes back money the recipient has not claimed yet
+func (s *ClaimService) Cancel(senderID, id string) (*models.ClaimLink, error) {
+	var claim models.ClaimLink
+	if err := s.db.Where("id = ? AND sender_id = ?", id, senderID).First(&claim).Error; err != nil {
+		return nil, errors.New("claim link not found")
+	}
+	if err := s.refund(id, models.ClaimStatusCancelled); err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("id = ?", id).First(&claim).Error; err != nil {
+		return nil, errors.New("claim link not found")
+	}
+	return &claim, nil
+}
+
+// RefundExpired returns the money of every claim link past its expiry to
+// the sender. It is run by the scheduler.
+func (s *ClaimService) RefundExpired() error {
+	var ids []string
+	if err := s.db.Model(&models.ClaimLink{}).
+		Where("status = ? AND expires_at <= ?", models.ClaimStatusPending, time.Now()).
+		Limit(500).Pluck("id", &ids).Error; err != nil {
+		return errors.New("failed to find expired claim links")
+	}
+
+	for _, id := range ids {
+		if err := s.refund(id, models.ClaimStatusRefunded); err != nil {
+			log.Printf("⚠️  Failed to refund claim link %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// refund moves a pending claim link's money from escrow back to the sender
+// and closes it with status
+func (s *ClaimService) refund(id, status string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var claim models.ClaimLink
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&claim).Error; err != nil {
+			return errors.New("claim link not found")
+		}
+		if claim.Status != models.ClaimStatusPending {
+			return errors.New("this transfer was already " + claim.Status)
+		}
+		if status == models.ClaimStatusRefunded && claim.ExpiresAt.After(time.Now()) {
+			return nil
+		}
+
+		walletID, err := ensureWallet(tx, claim.SenderID, claim.Currency)
+		if err != nil {
+			return err
+		}
+		if _, err := lockWallets(tx, walletID); err != nil {
+			return err
+		}
+		description := "Returned: transfer to " + claim.Contact
+		if status == models.ClaimStatusRefunded {
+			description = "Unclaimed: transfer to " + claim.Contact
+		}
+		entry, err := postJournal(tx, models.JournalTypeClaim, description,
+			debit(platformCode(models.LedgerPlatformClaims, claim.Currency), claim.Amount),
+			credit(walletAccountCode(walletID), claim.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		refundTx := models.Transaction{
+			WalletID:            walletID,
+			ToUserID:            &claim.SenderID,
+			Type:                models.TransactionTypeClaimRefund,
+			Amount:              claim.Amount,
+			Currency:            claim.Currency,
+			Description:         description,
+			Status:              models.TransactionStatusSuccess,
+			JournalEntryID:      &entry.ID,
+			ParentTransactionID: &claim.SendTransactionID,
+		}
+		if err := tx.Create(&refundTx).Error; err != nil {
+			return errors.New("failed to create refund transaction")
+		}
+		if err := releaseUsage(tx, claim.SendTransactionID, claim.Amount, claim.Amount); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		claim.Status = status
+		claim.RefundTransactionID = &refundTx.ID
+		claim.ResolvedAt = &now
+		if err := tx.Save(&claim).Error; err != nil {
+			return errors.New("failed to update claim link")
+		}
+		if status != models.ClaimStatusRefunded {
+			return nil
+		}
+		body := fmt.Sprintf("Nobody claimed the %s %s you sent to %s, so it is back in your wallet.", claim.Amount.StringFixed(2), claim.Currency, claim.Contact)
+		_, err = createNotification(tx, claim.SenderID, "payment", "Transfer returned", body, "↩️", "/transfer/claims")
+		return err
+	})
+}
+
+// notifyPendingClaims tells a user who just verified their email or phone
+// number, as contactType says, about money waiting for them under it
+func notifyPendingClaims(db *gorm.DB, user *models.User, contactType string) error {
+	contact := strings.ToLower(user.Email)
+	if contactType == models.ClaimContactPhone {
+		contact = user.Phone
+	}
+	var claims []models.ClaimLink
+	if err := db.Preload("Sender").
+		Where("status = ? AND expires_at > ? AND contact_type = ? AND contact = ?",
+			models.ClaimStatusPending, time.Now(), contactType, contact).
+		Find(&claims).Error; err != nil {
+		return errors.New("failed to find pending claim links")
+	}
+	for _, claim := range claims {
+		sender := "Someone"
+		if claim.Sender != nil {
+			sender = claim.Sender.Username
+		}
+		body := fmt.Sprintf("%s sent you %s %s. Open the link they sent you to claim it.", sender, claim.Amount.StringFixed(2), claim.Currency)
+		if _, err := createNotification(db, user.ID, "payment", "Money waiting for you", body, "💰", "/transfer/claims"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkClaimable checks a locked claim link can still be claimed
+func checkClaimable(claim *models.ClaimLink) error {
+	if claim.Status == models.ClaimStatusPending && !claim.ExpiresAt.After(time.Now()) {
+		return errClaimExpired
+	}
+	if claim.Status != models.ClaimStatusPending {
+		return errors.New("this transfer was already " + claim.Status)
+	}
+	return nil
+}
+
+// claimMatches reports whether a claim link was sent to the user
+func claimMatches(claim *models.ClaimLink, user *models.User) bool {
+	switch claim.ContactType {
+	case models.ClaimContactEmail:
+		return strings.EqualFold(claim.Contact, user.Email)
+	case models.ClaimContactPhone:
+		return user.Phone != "" && claim.Contact == user.Phone
+	}
+	return false
+}
+
+func (s *ClaimService) claimURL(token string) string {
+	return s.linkBase + "/claim?token=" + token
+}
+
+// newClaimToken returns a random URL-safe token for a claim link
+func newClaimToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashClaimToken is how a claim token is stored, so a database leak cannot
+// be used to claim money
+func hashClaimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,248 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gatorpay-backend/config"
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBClaim() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ClaimLink{}, &models.LimitUsage{})
+	return db
+}
+
+// claimToken pulls the token out of a claim URL
+func claimToken(url string) string {
+	return url[strings.Index(url, "token=")+len("token="):]
+}
+
+func TestClaimLinkIsClaimedAfterSignUp(t *testing.T) {
+	db := setupTestDBClaim()
+	alice, bob := seedRefundUsers(t, db)
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	cs := services.NewClaimService(db, ts, nil, nil, "https://app.test/", 14*24*time.Hour)
+	ts.SetClaims(cs)
+	ws := services.NewWalletService(db, nil)
+	ls := services.NewLedgerService(db)
+
+	_, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "nobody", Amount: 25})
+	assert.EqualError(t, err, "recipient not found", "usernames cannot get claim links")
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "dana@example.com", Amount: 500})
+	assert.EqualError(t, err, "insufficient balance")
+
+	sent, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "Dana@Example.com", Amount: 25, Note: "welcome"})
+	assert.NoError(t, err)
+	assert.NotNil(t, sent.Claim)
+	assert.Equal(t, "dana@example.com", sent.Claim.Contact)
+	assert.Equal(t, models.ClaimStatusPending, sent.Claim.Status)
+	assert.True(t, strings.HasPrefix(sent.ClaimURL, "https://app.test/claim?token="), sent.ClaimURL)
+	assert.True(t, sent.NewBalance.Equal(decimal.NewFromInt(175)))
+	tb, _ := ls.GetTrialBalance()
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformClaims {
+			assert.True(t, a.Balance.Equal(decimal.NewFromInt(25)), "held in escrow")
+		}
+	}
+
+	// Dana signs up and is told about the money once she verifies her email
+	auth := services.NewAuthService(db, services.NewTokenService(cfg), services.NewOTPService(db, services.NewEmailService(cfg)), services.NewSMSService(cfg))
+	otp, err := auth.Register(services.RegisterInput{Email: "dana@example.com", Password: "password123", Username: "dana",
+		Phone: "555-010-0199", FirstName: "Dana", LastName: "D"})
+	assert.NoError(t, err)
+	_, err = cs.Claim(otp.UserID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.EqualError(t, err, "verify your account before claiming money")
+
+	var code models.OTPCode
+	db.Where("user_id = ?", otp.UserID).First(&code)
+	_, err = auth.VerifyOTP(services.VerifyOTPInput{UserID: otp.UserID, Code: code.Code, Purpose: models.OTPPurposeRegister})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), notificationCount(db, otp.UserID, "Money waiting for you"))
+	waiting, _ := cs.GetClaims(otp.UserID, "received", models.ClaimStatusPending)
+	assert.Len(t, waiting, 1)
+
+	// Only the owner of the email can claim, and only once
+	_, err = cs.Claim(bob.ID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.EqualError(t, err, "verify your account before claiming money")
+	db.Model(&models.User{}).Where("id = ?", bob.ID).Update("email_verified", true)
+	_, err = cs.Claim(bob.ID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.EqualError(t, err, "this transfer was sent to someone else")
+	_, err = cs.Claim(otp.UserID, services.ClaimInput{Token: "forged"})
+	assert.EqualError(t, err, "claim link not found")
+
+	claimed, err := cs.Claim(otp.UserID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimStatusClaimed, claimed.Status)
+	assert.Equal(t, otp.UserID, *claimed.ClaimedBy)
+	_, err = cs.Claim(otp.UserID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.EqualError(t, err, "this transfer was already claimed")
+
+	wallet, _ := ws.GetWallet(otp.UserID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(25)))
+	var send models.Transaction
+	db.Where("id = ?", sent.TransactionID).First(&send)
+	assert.Equal(t, otp.UserID, *send.ToUserID, "the sender's record points at who claimed it")
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Transfer claimed"))
+
+	tb, _ = ls.GetTrialBalance()
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformClaims {
+			assert.True(t, a.Balance.IsZero())
+		}
+	}
+	checks, _ := ls.CheckWallets()
+	for _, c := range checks {
+		assert.True(t, c.Matches)
+	}
+}
+
+func TestClaimLinkIsClaimedAfterGoogleSignUp(t *testing.T) {
+	db := setupTestDBClaim()
+	alice, _ := seedRefundUsers(t, db)
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	cs := services.NewClaimService(db, ts, nil, nil, "https://app.test", time.Hour)
+	ts.SetClaims(cs)
+
+	sent, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "hana@example.com", Amount: 15})
+	assert.NoError(t, err)
+
+	// Google vouches for the email, so there is no code to wait for
+	auth := services.NewAuthService(db, services.NewTokenService(cfg), services.NewOTPService(db, services.NewEmailService(cfg)), services.NewSMSService(cfg))
+	resp, err := auth.GoogleAuth(services.GoogleAuthInput{GoogleID: "g-hana", Email: "hana@example.com", Name: "Hana H"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), notificationCount(db, resp.User.ID, "Money waiting for you"))
+
+	claimed, err := cs.Claim(resp.User.ID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimStatusClaimed, claimed.Status)
+
+	// Signing in again does not repeat the notification
+	_, err = auth.GoogleAuth(services.GoogleAuthInput{GoogleID: "g-hana", Email: "hana@example.com", Name: "Hana H"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), notificationCount(db, resp.User.ID, "Money waiting for you"))
+}
+
+func TestClaimLinksAreRefundedWhenUnclaimed(t *testing.T) {
+	db := setupTestDBClaim()
+	alice, _ := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	cs := services.NewClaimService(db, ts, nil, nil, "https://app.test", time.Hour)
+	ts.SetClaims(cs)
+	ws := services.NewWalletService(db, nil)
+
+	cancel, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "gus@example.com", Amount: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimContactEmail, cancel.Claim.ContactType)
+	expired, _ := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "erin@example.com", Amount: 20})
+	open, _ := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "finn@example.com", Amount: 10})
+
+	// The sender can take money back before it is claimed
+	cancelled, err := cs.Cancel(alice.ID, cancel.Claim.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimStatusCancelled, cancelled.Status)
+	_, err = cs.Cancel(alice.ID, cancel.Claim.ID)
+	assert.EqualError(t, err, "this transfer was already cancelled")
+
+	// Unclaimed links are refunded once they expire
+	db.Model(&models.ClaimLink{}).Where("id = ?", expired.Claim.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	assert.NoError(t, cs.RefundExpired())
+	assert.NoError(t, cs.RefundExpired(), "refunding twice is harmless")
+	links, _ := cs.GetClaims(alice.ID, "sent", "")
+	statuses := map[string]string{}
+	for _, l := range links {
+		statuses[l.Contact] = l.Status
+		if l.Status == models.ClaimStatusRefunded {
+			assert.NotNil(t, l.RefundTransactionID)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"gus@example.com":  models.ClaimStatusCancelled,
+		"erin@example.com": models.ClaimStatusRefunded,
+		"finn@example.com": models.ClaimStatusPending,
+	}, statuses)
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Transfer returned"))
+
+	wallet, _ := ws.GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(190)), "only the open link's 10 is still out")
+	assert.True(t, open.Claim.ExpiresAt.After(time.Now()))
+	_, err = cs.GetClaims(alice.ID, "everyone", "")
+	assert.EqualError(t, err, "role must be sent or received")
+}
+
+func TestClaimLinkSentToPhoneNeedsVerifiedPhone(t *testing.T) {
+	db := setupTestDBClaim()
+	alice, bob := seedRefundUsers(t, db)
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	cs := services.NewClaimService(db, ts, nil, services.NewSMSService(cfg), "https://app.test", time.Hour)
+	ts.SetClaims(cs)
+	ws := services.NewWalletService(db, nil)
+	auth := services.NewAuthService(db, services.NewTokenService(cfg), services.NewOTPService(db, services.NewEmailService(cfg)), services.NewSMSService(cfg))
+
+	// Numbers with an account behind them are paid directly, however written
+	db.Model(&models.User{}).Where("id = ?", bob.ID).Update("phone", "3525550100")
+	direct, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "+1 (352) 555-0100", Amount: 5})
+	assert.NoError(t, err)
+	assert.Nil(t, direct.Claim)
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "352555O123", Amount: 5})
+	assert.EqualError(t, err, "recipient not found", "only digits and punctuation read as a phone number")
+
+	sent, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "(352) 555-0123", Amount: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimContactPhone, sent.Claim.ContactType)
+	assert.Equal(t, "3525550123", sent.Claim.Contact)
+
+	// Cara signs up with that number; her email alone does not prove it
+	otp, err := auth.Register(services.RegisterInput{Email: "cara@example.com", Password: "password123", Username: "cara",
+		Phone: "352.555.0123", FirstName: "Cara", LastName: "C"})
+	assert.NoError(t, err)
+	var code models.OTPCode
+	db.Where("user_id = ? AND purpose = ?", otp.UserID, models.OTPPurposeRegister).First(&code)
+	_, err = auth.VerifyOTP(services.VerifyOTPInput{UserID: otp.UserID, Code: code.Code, Purpose: models.OTPPurposeRegister})
+	assert.NoError(t, err)
+	assert.Zero(t, notificationCount(db, otp.UserID, "Money waiting for you"))
+	waiting, _ := cs.GetClaims(otp.UserID, "received", models.ClaimStatusPending)
+	assert.Empty(t, waiting)
+	_, err = cs.Claim(otp.UserID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.EqualError(t, err, "verify your phone number before claiming money sent to it")
+
+	// Phone codes are only ever texted
+	_, err = auth.ResendOTP(services.ResendOTPInput{UserID: otp.UserID, Purpose: models.OTPPurposePhone})
+	assert.EqualError(t, err, "phone verification codes are sent by text")
+	assert.NoError(t, auth.SendPhoneCode(otp.UserID))
+	_, err = auth.VerifyPhone(otp.UserID, services.VerifyPhoneInput{Code: "000000"})
+	assert.Error(t, err)
+	var phoneCode models.OTPCode
+	db.Where("user_id = ? AND purpose = ?", otp.UserID, models.OTPPurposePhone).First(&phoneCode)
+	_, err = auth.VerifyOTP(services.VerifyOTPInput{UserID: otp.UserID, Code: phoneCode.Code, Purpose: models.OTPPurposePhone})
+	assert.EqualError(t, err, "invalid verification code")
+	user, err := auth.VerifyPhone(otp.UserID, services.VerifyPhoneInput{Code: phoneCode.Code})
+	assert.NoError(t, err)
+	assert.True(t, user.PhoneVerified)
+	assert.EqualError(t, auth.SendPhoneCode(otp.UserID), "phone number is already verified")
+	assert.Equal(t, int64(1), notificationCount(db, otp.UserID, "Money waiting for you"))
+	waiting, _ = cs.GetClaims(otp.UserID, "received", models.ClaimStatusPending)
+	assert.Len(t, waiting, 1)
+
+	claimed, err := cs.Claim(otp.UserID, services.ClaimInput{Token: claimToken(sent.ClaimURL)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ClaimStatusClaimed, claimed.Status)
+	wallet, _ := ws.GetWallet(otp.UserID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(20)))
+}
@@ -51,15 +51,7 @@ func (s *EmailService) SendOTP(toEmail, code, purpose string) error {
 </body>
 </html>`, code)
 
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
-		s.cfg.SMTPFrom, toEmail, subject, body)
-
-	port, _ := strconv.Atoi(s.cfg.SMTPPort)
-	addr := fmt.Sprintf("%s:%d", s.cfg.SMTPHost, port)
-	auth := smtp.PlainAuth("", s.cfg.SMTPUser, s.cfg.SMTPPass, s.cfg.SMTPHost)
-
-	err := smtp.SendMail(addr, auth, s.cfg.SMTPFrom, []string{toEmail}, []byte(msg))
-	if err != nil {
+	if err := s.send(toEmail, subject, body); err != nil {
 		log.Printf("❌ Failed to send email to %s: %v", toEmail, err)
 		// Fallback to console in case of SMTP failure
 		log.Printf("📧 [FALLBACK] OTP for %s (%s): %s", toEmail, purpose, code)
@@ -69,3 +61,46 @@ func (s *EmailService) SendOTP(toEmail, code, purpose string) error {
 	log.Printf("📧 OTP sent to %s for %s", toEmail, purpose)
 	return nil
 }
+
+// SendClaimLink tells someone without an account that money is waiting for
+// them, or prints the link to console if SMTP is not configured
+func (s *EmailService) SendClaimLink(toEmail, senderName, amount, link string) error {
+	if !s.IsConfigured() {
+		log.Printf("📧 [DEV] Claim link for %s (%s from %s): %s", toEmail, amount, senderName, link)
+		return nil
+	}
+
+	subject := fmt.Sprintf("GatorPay - %s sent you %s", senderName, amount)
+	body := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; background-color: #0f172a; color: #f1f5f9; padding: 40px;">
+  <div style="max-width: 480px; margin: 0 auto; background: #1e293b; border-radius: 16px; padding: 40px; text-align: center;">
+    <h1 style="color: #818cf8; margin-bottom: 8px;">🐊 GatorPay</h1>
+    <p style="color: #94a3b8; margin-bottom: 32px;">%s sent you %s</p>
+    <a href="%s" style="display: inline-block; background: #818cf8; color: #0f172a; border-radius: 12px; padding: 16px 32px; font-weight: bold; text-decoration: none; margin-bottom: 24px;">Claim your money</a>
+    <p style="color: #94a3b8; font-size: 14px;">Sign up with this email address to claim it.<br>If you do not claim it in time, it goes back to the sender.</p>
+  </div>
+</body>
+</html>`, senderName, amount, link)
+
+	if err := s.send(toEmail, subject, body); err != nil {
+		log.Printf("❌ Failed to send email to %s: %v", toEmail, err)
+		log.Printf("📧 [FALLBACK] Claim link for %s: %s", toEmail, link)
+		return nil
+	}
+
+	log.Printf("📧 Claim link sent to %s", toEmail)
+	return nil
+}
+
+// send delivers an HTML email over SMTP
+func (s *EmailService) send(toEmail, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
+		s.cfg.SMTPFrom, toEmail, subject, body)
+
+	port, _ := strconv.Atoi(s.cfg.SMTPPort)
+	addr := fmt.Sprintf("%s:%d", s.cfg.SMTPHost, port)
+	auth := smtp.PlainAuth("", s.cfg.SMTPUser, s.cfg.SMTPPass, s.cfg.SMTPHost)
+
+	return smtp.SendMail(addr, auth, s.cfg.SMTPFrom, []string{toEmail}, []byte(msg))
+}
@@ -0,0 +1,763 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExpenseGroupService tracks costs a group of users share, the running
+// balances between them, and settling up with ordinary P2P transfers
+type ExpenseGroupService struct {
+	db        *gorm.DB
+	transfers *TransferService
+}
+
+// NewExpenseGroupService creates a new ExpenseGroupService
+func NewExpenseGroupService(db *gorm.DB, transfers *TransferService) *ExpenseGroupService {
+	return &ExpenseGroupService{db: db, transfers: transfers}
+}
+
+// CreateExpenseGroupInput is the DTO for starting an expense group
+type CreateExpenseGroupInput struct {
+	Name     string   `json:"name" binding:"required"`
+	Currency string   `json:"currency"` // defaults to USD
+	Members  []string `json:"members"`  // usernames, emails, or phones besides the caller
+}
+
+// ExpenseGroupMemberInput is the DTO for adding someone to a group
+type ExpenseGroupMemberInput struct {
+	User string `json:"user" binding:"required"` // username, email, or phone
+}
+
+// GroupExpenseInput is the DTO for logging an expense. With the equal split
+// the splits only name the participants and may be left out to include the
+// whole group.
+type GroupExpenseInput struct {
+	Description string              `json:"description" binding:"required"`
+	Amount      float64             `json:"amount" binding:"required"`
+	PaidBy      string              `json:"paid_by"`    // member user ID, defaults to the caller
+	SplitType   string              `json:"split_type"` // equal (default), shares, or exact
+	Splits      []ExpenseSplitInput `json:"splits"`
+}
+
+// ExpenseSplitInput is one participant in an expense
+type ExpenseSplitInput struct {
+	UserID string  `json:"user_id" binding:"required"`
+	Shares int     `json:"shares"` // for split by shares
+	Amount float64 `json:"amount"` // for split by exact amounts
+}
+
+// GroupDebt is an amount one member owes another
+type GroupDebt struct {
+	FromUserID   string          `json:"from_user_id"`
+	FromUsername string          `json:"from_username"`
+	ToUserID     string          `json:"to_user_id"`
+	ToUsername   string          `json:"to_username"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+// GroupMemberBalance is where a member stands with the group as a whole.
+// A positive net means the group owes them.
+type GroupMemberBalance struct {
+	UserID   string          `json:"user_id"`
+	Username string          `json:"username"`
+	Paid     decimal.Decimal `json:"paid"`  // expenses they paid for
+	Share    decimal.Decimal `json:"share"` // their part of all expenses
+	Net      decimal.Decimal `json:"net"`
+}
+
+// GroupBalances is the state of a group's debts: what each pair of members
+// owes each other, and the fewest payments that would settle everyone
+type GroupBalances struct {
+	GroupID  string               `json:"group_id"`
+	Currency string               `json:"currency"`
+	Members  []GroupMemberBalance `json:"members"`
+	Debts    []GroupDebt          `json:"debts"`
+	Payments []GroupDebt          `json:"payments"`
+}
+
+// Create starts an expense group with the caller and any listed members
+func (s *ExpenseGroupService) Create(userID string, input CreateExpenseGroupInput) (*models.ExpenseGroup, error) {
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs := []string{userID}
+	for _, identifier := range input.Members {
+		user, err := findRecipient(s.db, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("user %s not found", identifier)
+		}
+		if !contains(memberIDs, user.ID) {
+			memberIDs = append(memberIDs, user.ID)
+		}
+	}
+
+	group := models.ExpenseGroup{Name: input.Name, Currency: currency, CreatedBy: userID}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return errors.New("failed to create expense group")
+		}
+		for _, id := range memberIDs {
+			if err := tx.Create(&models.ExpenseGroupMember{GroupID: group.ID, UserID: id}).Error; err != nil {
+				return errors.New("failed to add group member")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetGroup(userID, group.ID)
+}
+
+// GetGroups lists the expense groups the user belongs to
+func (s *ExpenseGroupService) GetGroups(userID string) ([]models.ExpenseGroup, error) {
+	var groups []models.ExpenseGroup
+	if err := s.db.Preload("Members.User").
+		Where("id IN (?)", s.db.Model(&models.ExpenseGroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("created_at DESC").Find(&groups).Error; err != nil {
+		return nil, errors.New("failed to fetch expense groups")
+	}
+	return groups, nil
+}
+
+// GetGroup returns an expense group with its members
+func (s *ExpenseGroupService) GetGroup(userID, id string) (*models.ExpenseGroup, error) {
+	if err := requireGroupMember(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var group models.ExpenseGroup
+	if err := s.db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at, id")
+	}).Preload("Members.User").Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, errors.New("expense group not found")
+	}
+	return &group, nil
+}
+
+// AddMember adds a user to a group. Any member may add people.
+func (s *ExpenseGroupService) AddMember(userID, id string, input ExpenseGroupMemberInput) (*models.ExpenseGroupMember, error) {
+	if err := requireGroupMember(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	user, err := findRecipient(s.db, input.User)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	member := models.ExpenseGroupMember{GroupID: id, UserID: user.ID}
+	if err := s.db.Create(&member).Error; err != nil {
+		return nil, errors.New("user is already a member")
+	}
+	member.User = user
+	return &member, nil
+}
+
+// RemoveMember takes a member out of a group once they are settled up. Any
+// member may remove another or leave.
+func (s *ExpenseGroupService) RemoveMember(userID, id, memberUserID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		group, err := lockGroup(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		var member models.ExpenseGroupMember
+		if err := tx.Where("group_id = ? AND user_id = ?", id, memberUserID).First(&member).Error; err != nil {
+			return errors.New("member not found")
+		}
+		balances, err := groupBalances(tx, group)
+		if err != nil {
+			return err
+		}
+		for _, b := range balances.Members {
+			if b.UserID == memberUserID && !b.Net.IsZero() {
+				return errors.New("members must settle up before leaving the group")
+			}
+		}
+		if err := tx.Delete(&member).Error; err != nil {
+			return errors.New("failed to remove member")
+		}
+		return nil
+	})
+}
+
+// AddExpense logs a cost a member paid and splits it between participants,
+// telling each of them their share
+func (s *ExpenseGroupService) AddExpense(userID, id string, input GroupExpenseInput) (*models.GroupExpense, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	splitType := input.SplitType
+	if splitType == "" {
+		splitType = models.ExpenseSplitEqual
+	}
+	paidBy := input.PaidBy
+	if paidBy == "" {
+		paidBy = userID
+	}
+
+	var expense models.GroupExpense
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		group, err := lockGroup(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		var memberIDs []string
+		if err := tx.Model(&models.ExpenseGroupMember{}).Where("group_id = ?", id).
+			Order("created_at, id").Pluck("user_id", &memberIDs).Error; err != nil {
+			return errors.New("failed to load members")
+		}
+		if !contains(memberIDs, paidBy) {
+			return errors.New("the payer must be a group member")
+		}
+		shares, err := splitExpense(amount, splitType, input.Splits, memberIDs)
+		if err != nil {
+			return err
+		}
+
+		expense = models.GroupExpense{
+			GroupID:     id,
+			PaidBy:      paidBy,
+			CreatedBy:   userID,
+			Description: input.Description,
+			Amount:      amount,
+			SplitType:   splitType,
+			Shares:      shares,
+		}
+		if err := tx.Create(&expense).Error; err != nil {
+			return errors.New("failed to create expense")
+		}
+
+		var creator models.User
+		tx.Where("id = ?", userID).First(&creator)
+		for _, share := range shares {
+			if share.UserID == userID || share.Amount.IsZero() {
+				continue
+			}
+			body := fmt.Sprintf("%s added %s (%s %s) in %s. Your share is %s %s.", creator.Username, expense.Description,
+				amount.StringFixed(2), group.Currency, group.Name, share.Amount.StringFixed(2), group.Currency)
+			if _, err := createNotification(tx, share.UserID, "payment", "New group expense", body, "🧾", "/groups/"+id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getExpense(id, expense.ID)
+}
+
+// GetExpenses lists a group's expenses, newest first
+func (s *ExpenseGroupService) GetExpenses(userID, id string) ([]models.GroupExpense, error) {
+	if err := requireGroupMember(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var expenses []models.GroupExpense
+	if err := s.db.Preload("Payer").Preload("Shares").
+		Where("group_id = ?", id).Order("created_at DESC").Find(&expenses).Error; err != nil {
+		return nil, errors.New("failed to fetch expenses")
+	}
+	return expenses, nil
+}
+
+// DeleteExpense removes an expense from the balances. Only whoever logged it
+// or paid it may delete it.
+func (s *ExpenseGroupService) DeleteExpense(userID, id, expenseID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, id, userID); err != nil {
+			return err
+		}
+		var expense models.GroupExpense
+		if err := tx.Where("id = ? AND group_id = ?", expenseID, id).First(&expense).Error; err != nil {
+			return errors.New("expense not found")
+		}
+		if expense.CreatedBy != userID && expense.PaidBy != userID {
+			return errors.New("only whoever added or paid an expense can delete it")
+		}
+		if err := tx.Delete(&expense).Error; err != nil {
+			return errors.New("failed to delete expense")
+		}
+		return nil
+	})
+}
+
+// GetBalances returns what the group's members owe each other
+func (s *ExpenseGroupService) GetBalances(userID, id string) (*GroupBalances, error) {
+	if err := requireGroupMember(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var group models.ExpenseGroup
+	if err := s.db.Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, errors.New("expense group not found")
+	}
+	return groupBalances(s.db, &group)
+}
+
+// GetSettlements lists the payments made to settle up in a group, newest first
+func (s *ExpenseGroupService) GetSettlements(userID, id string) ([]models.GroupSettlement, error) {
+	if err := requireGroupMember(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var settlements []models.GroupSettlement
+	if err := s.db.Preload("From").Preload("To").
+		Where("group_id = ?", id).Order("created_at DESC").Find(&settlements).Error; err != nil {
+		return nil, errors.New("failed to fetch settlements")
+	}
+	return settlements, nil
+}
+
+// SettleUpInput is the DTO for settling up. Code is the emailed one-time
+// code, needed for large or flagged settlements.
+type SettleUpInput struct {
+	Code string `json:"code" binding:"omitempty,len=6"`
+}
+
+// SettleUp pays everything the user owes in the group in one step. Each of
+// the user's payments in the simplified plan becomes a P2P transfer from
+// their wallet; if any of them fails, none are made. The total goes through
+// the same checks as SendMoney first.
+func (s *ExpenseGroupService) SettleUp(userID, id string, input SettleUpInput) ([]models.GroupSettlement, error) {
+	owed, err := s.GetBalances(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	verified := decimal.Zero
+	for _, payment := range owed.Payments {
+		if payment.FromUserID == userID {
+			verified = verified.Add(payment.Amount)
+		}
+	}
+	if verified.IsPositive() {
+		if err := s.transfers.verify(userID, "group_settlement", verified, owed.Currency, input.Code); err != nil {
+			return nil, err
+		}
+	}
+
+	var settlements []models.GroupSettlement
+	var paid []*TransferResponse
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		group, err := lockGroup(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		balances, err := groupBalances(tx, group)
+		if err != nil {
+			return err
+		}
+
+		total := decimal.Zero
+		for _, payment := range balances.Payments {
+			if payment.FromUserID == userID {
+				total = total.Add(payment.Amount)
+			}
+		}
+		if total.GreaterThan(verified) {
+			return errors.New("the group's balances changed, please try again")
+		}
+
+		for _, payment := range balances.Payments {
+			if payment.FromUserID != userID {
+				continue
+			}
+			var recipient models.User
+			if err := tx.Where("id = ?", payment.ToUserID).First(&recipient).Error; err != nil {
+				return errors.New("recipient not found")
+			}
+			sent, err := s.transfers.transfer(tx, userID, &recipient, payment.Amount, group.Currency, "Settle up in "+group.Name)
+			if err != nil {
+				return err
+			}
+			settlement := models.GroupSettlement{
+				GroupID:       id,
+				FromUserID:    userID,
+				ToUserID:      recipient.ID,
+				Amount:        payment.Amount,
+				TransactionID: sent.TransactionID,
+			}
+			if err := tx.Create(&settlement).Error; err != nil {
+				return errors.New("failed to record settlement")
+			}
+			body := fmt.Sprintf("%s paid you %s %s to settle up in %s.", payment.FromUsername, payment.Amount.StringFixed(2), group.Currency, group.Name)
+			if _, err := createNotification(tx, recipient.ID, "payment", "Group settled", body, "🤝", "/groups/"+id); err != nil {
+				return err
+			}
+			settlements = append(settlements, settlement)
+			paid = append(paid, sent)
+		}
+		if len(settlements) == 0 {
+			return errors.New("you have nothing to settle in this group")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sent := range paid {
+		s.transfers.awardCashback(userID, sent)
+	}
+	return settlements, nil
+}
+
+func (s *ExpenseGroupService) getExpense(id, expenseID string) (*models.GroupExpense, error) {
+	var expense models.GroupExpense
+	if err := s.db.Preload("Payer").Preload("Shares").
+		Where("id = ? AND group_id = ?", expenseID, id).First(&expense).Error; err != nil {
+		return nil, errors.New("expense not found")
+	}
+	return &expense, nil
+}
+
+// requireGroupMember checks the user belongs to a group. Non-members are told
+// the group does not exist.
+func requireGroupMember(db *gorm.DB, id, userID string) error {
+	var count int64
+	if err := db.Model(&models.ExpenseGroupMember{}).Where("group_id = ? AND user_id = ?", id, userID).Count(&count).Error; err != nil || count == 0 {
+		return errors.New("expense group not found")
+	}
+	return nil
+}
+
+// lockGroup locks a group the user belongs to, so expenses and settlements
+// are applied one at a time
+func lockGroup(tx *gorm.DB, id, userID string) (*models.ExpenseGroup, error) {
+	if err := requireGroupMember(tx, id, userID); err != nil {
+		return nil, err
+	}
+	var group models.ExpenseGroup
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, errors.New("expense group not found")
+	}
+	return &group, nil
+}
+
+// splitExpense divides amount between participants. Cents that do not
+// divide evenly go to the participants with the largest remainders, earliest
+// listed first, so the shares always add up to the amount.
+func splitExpense(amount decimal.Decimal, splitType string, splits []ExpenseSplitInput, memberIDs []string) ([]models.GroupExpenseShare, error) {
+	if splitType != models.ExpenseSplitEqual && len(splits) == 0 {
+		return nil, errors.New("splits are required for this split type")
+	}
+	if splitType == models.ExpenseSplitEqual && len(splits) == 0 {
+		for _, id := range memberIDs {
+			splits = append(splits, ExpenseSplitInput{UserID: id})
+		}
+	}
+	var seen []string
+	for _, split := range splits {
+		if !contains(memberIDs, split.UserID) {
+			return nil, errors.New("every participant must be a group member")
+		}
+		if contains(seen, split.UserID) {
+			return nil, errors.New("each participant can only be listed once")
+		}
+		seen = append(seen, split.UserID)
+	}
+
+	shares := make([]models.GroupExpenseShare, len(splits))
+	switch splitType {
+	case models.ExpenseSplitEqual, models.ExpenseSplitShares:
+		weights := make([]int64, len(splits))
+		for i, split := range splits {
+			weights[i] = 1
+			if splitType == models.ExpenseSplitShares {
+				if split.Shares <= 0 {
+					return nil, errors.New("shares must be greater than 0")
+				}
+				weights[i] = int64(split.Shares)
+				shares[i].Weight = split.Shares
+			}
+		}
+		for i, cents := range allocateCents(amount.Shift(2).IntPart(), weights) {
+			shares[i].UserID = splits[i].UserID
+			shares[i].Amount = decimal.New(cents, -2)
+		}
+	case models.ExpenseSplitExact:
+		total := decimal.Zero
+		for i, split := range splits {
+			part := decimal.NewFromFloat(split.Amount)
+			if part.IsNegative() {
+				return nil, errors.New("amounts cannot be negative")
+			}
+			if !part.Equal(part.Round(2)) {
+				return nil, errors.New("amounts must have at most 2 decimal places")
+			}
+			shares[i].UserID = split.UserID
+			shares[i].Amount = part
+			total = total.Add(part)
+		}
+		if !total.Equal(amount) {
+			return nil, fmt.Errorf("exact amounts add up to %s, not %s", total.StringFixed(2), amount.StringFixed(2))
+		}
+	default:
+		return nil, errors.New("split type must be equal, shares, or exact")
+	}
+	return shares, nil
+}
+
+// allocateCents divides cents in proportion to weights by the largest
+// remainder method
+func allocateCents(cents int64, weights []int64) []int64 {
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	parts := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	order := make([]int, len(weights))
+	left := cents
+	for i, w := range weights {
+		parts[i] = cents * w / total
+		remainders[i] = cents * w % total
+		order[i] = i
+		left -= parts[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := int64(0); i < left; i++ {
+		parts[order[i]]++
+	}
+	return parts
+}
+
+// groupBalances works out a group's debts from its expenses and settlements
+func groupBalances(db *gorm.DB, group *models.ExpenseGroup) (*GroupBalances, error) {
+	var expenses []models.GroupExpense
+	if err := db.Preload("Shares").Where("group_id = ?", group.ID).Find(&expenses).Error; err != nil {
+		return nil, errors.New("failed to load expenses")
+	}
+	var settlements []models.GroupSettlement
+	if err := db.Where("group_id = ?", group.ID).Find(&settlements).Error; err != nil {
+		return nil, errors.New("failed to load settlements")
+	}
+	var memberIDs []string
+	if err := db.Model(&models.ExpenseGroupMember{}).Where("group_id = ?", group.ID).
+		Order("created_at, id").Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, errors.New("failed to load members")
+	}
+
+	// owed[debtor][creditor] before netting each pair off
+	owed := map[string]map[string]decimal.Decimal{}
+	owe := func(debtor, creditor string, amount decimal.Decimal) {
+		if owed[debtor] == nil {
+			owed[debtor] = map[string]decimal.Decimal{}
+		}
+		owed[debtor][creditor] = owed[debtor][creditor].Add(amount)
+	}
+	paid := map[string]decimal.Decimal{}
+	share := map[string]decimal.Decimal{}
+	userIDs := append([]string{}, memberIDs...)
+	track := func(id string) {
+		if !contains(userIDs, id) {
+			userIDs = append(userIDs, id) // a former member still in the history
+		}
+	}
+	for _, e := range expenses {
+		track(e.PaidBy)
+		paid[e.PaidBy] = paid[e.PaidBy].Add(e.Amount)
+		for _, sh := range e.Shares {
+			track(sh.UserID)
+			share[sh.UserID] = share[sh.UserID].Add(sh.Amount)
+			if sh.UserID != e.PaidBy {
+				owe(sh.UserID, e.PaidBy, sh.Amount)
+			}
+		}
+	}
+	// Paying someone back is the same as them owing you
+	for _, st := range settlements {
+		track(st.FromUserID)
+		track(st.ToUserID)
+		owe(st.ToUserID, st.FromUserID, st.Amount)
+	}
+
+	var users []models.User
+	if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, errors.New("failed to load members")
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+	debt := func(from, to string, amount decimal.Decimal) GroupDebt {
+		return GroupDebt{FromUserID: from, FromUsername: usernames[from], ToUserID: to, ToUsername: usernames[to], Amount: amount}
+	}
+
+	// Net each pair off, then cancel debts that run round a loop so a group
+	// that has settled up shows no debts at all
+	pairs := map[string]map[string]decimal.Decimal{}
+	net := map[string]decimal.Decimal{}
+	for i, a := range userIDs {
+		for _, b := range userIDs[i+1:] {
+			d := owed[a][b].Sub(owed[b][a])
+			switch {
+			case d.IsPositive():
+				setDebt(pairs, a, b, d)
+			case d.IsNegative():
+				setDebt(pairs, b, a, d.Neg())
+			}
+			net[a] = net[a].Sub(d)
+			net[b] = net[b].Add(d)
+		}
+	}
+	cancelDebtCycles(userIDs, pairs)
+
+	balances := GroupBalances{GroupID: group.ID, Currency: group.Currency, Debts: []GroupDebt{}}
+	for _, from := range userIDs {
+		for _, to := range userIDs {
+			if amount, ok := pairs[from][to]; ok {
+				balances.Debts = append(balances.Debts, debt(from, to, amount))
+			}
+		}
+	}
+	for _, id := range userIDs {
+		if !contains(memberIDs, id) && net[id].IsZero() {
+			continue
+		}
+		balances.Members = append(balances.Members, GroupMemberBalance{
+			UserID: id, Username: usernames[id], Paid: paid[id], Share: share[id], Net: net[id],
+		})
+	}
+	for _, p := range simplifyDebts(userIDs, net) {
+		balances.Payments = append(balances.Payments, debt(p.FromUserID, p.ToUserID, p.Amount))
+	}
+	if balances.Payments == nil {
+		balances.Payments = []GroupDebt{}
+	}
+	return &balances, nil
+}
+
+func setDebt(debts map[string]map[string]decimal.Decimal, from, to string, amount decimal.Decimal) {
+	if amount.IsZero() {
+		delete(debts[from], to)
+		return
+	}
+	if debts[from] == nil {
+		debts[from] = map[string]decimal.Decimal{}
+	}
+	debts[from][to] = amount
+}
+
+// cancelDebtCycles removes loops such as A owes B, B owes C and C owes A by
+// taking the smallest debt in the loop off every debt in it. Nobody's net
+// balance changes, and once every net balance is zero no debts are left.
+func cancelDebtCycles(userIDs []string, debts map[string]map[string]decimal.Decimal) {
+	for {
+		cycle := findDebtCycle(userIDs, debts)
+		if cycle == nil {
+			return
+		}
+		least := debts[cycle[0]][cycle[1]]
+		for i, from := range cycle {
+			least = decimal.Min(least, debts[from][cycle[(i+1)%len(cycle)]])
+		}
+		for i, from := range cycle {
+			to := cycle[(i+1)%len(cycle)]
+			setDebt(debts, from, to, debts[from][to].Sub(least))
+		}
+	}
+}
+
+// findDebtCycle returns the users round a loop of debts, or nil if there is none
+func findDebtCycle(userIDs []string, debts map[string]map[string]decimal.Decimal) []string {
+	const visiting, done = 1, 2
+	state := map[string]int{}
+	var path []string
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = visiting
+		path = append(path, id)
+		for _, next := range userIDs {
+			if _, ok := debts[id][next]; !ok {
+				continue
+			}
+			switch state[next] {
+			case visiting:
+				for i, p := range path {
+					if p == next {
+						return append([]string{}, path[i:]...)
+					}
+				}
+			case 0:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		state[id] = done
+		path = path[:len(path)-1]
+		return nil
+	}
+	for _, id := range userIDs {
+		if state[id] == 0 {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// simplifyDebts turns net balances into as few payments as it can, never
+// more than one fewer than the people involved. Exact opposite balances are
+// paired off first since each saves a payment; the rest are settled by
+// repeatedly paying the largest creditor from the largest debtor.
+func simplifyDebts(userIDs []string, net map[string]decimal.Decimal) []GroupDebt {
+	type party struct {
+		id     string
+		amount decimal.Decimal // always positive
+	}
+	var debtors, creditors []*party
+	for _, id := range userIDs {
+		switch {
+		case net[id].IsNegative():
+			debtors = append(debtors, &party{id, net[id].Neg()})
+		case net[id].IsPositive():
+			creditors = append(creditors, &party{id, net[id]})
+		}
+	}
+
+	var payments []GroupDebt
+	pay := func(from, to *party, amount decimal.Decimal) {
+		payments = append(payments, GroupDebt{FromUserID: from.id, ToUserID: to.id, Amount: amount})
+		from.amount = from.amount.Sub(amount)
+		to.amount = to.amount.Sub(amount)
+	}
+	for _, d := range debtors {
+		for _, c := range creditors {
+			if c.amount.IsPositive() && c.amount.Equal(d.amount) {
+				pay(d, c, d.amount)
+				break
+			}
+		}
+	}
+
+	largest := func(parties []*party) *party {
+		var top *party
+		for _, p := range parties {
+			if p.amount.IsPositive() && (top == nil || p.amount.GreaterThan(top.amount)) {
+				top = p
+			}
+		}
+		return top
+	}
+	for {
+		d, c := largest(debtors), largest(creditors)
+		if d == nil || c == nil {
+			break
+		}
+		pay(d, c, decimal.Min(d.amount, c.amount))
+	}
+	return payments
+}
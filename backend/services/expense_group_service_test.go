@@ -0,0 +1,182 @@
+package services_test
+
+import (
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBExpenseGroup() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ExpenseGroup{}, &models.ExpenseGroupMember{}, &models.GroupExpense{}, &models.GroupExpenseShare{}, &models.GroupSettlement{})
+	return db
+}
+
+func TestExpenseGroupSplitsAndSettlesUp(t *testing.T) {
+	db := setupTestDBExpenseGroup()
+	alice, bob := seedRefundUsers(t, db)
+	carol := models.User{Email: "c@test.com", Username: "carol", Phone: "3", FirstName: "C", LastName: "C"}
+	db.Create(&carol)
+	db.Create(&models.Wallet{UserID: carol.ID, IsActive: true})
+	ws := services.NewWalletService(db, nil)
+	deposit(t, db, carol.ID, 100)
+	gs := services.NewExpenseGroupService(db, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+
+	group, err := gs.Create(alice.ID, services.CreateExpenseGroupInput{Name: "Lake trip", Members: []string{"bob", "c@test.com"}})
+	assert.NoError(t, err)
+	assert.Len(t, group.Members, 3)
+	_, err = gs.GetGroup("stranger", group.ID)
+	assert.EqualError(t, err, "expense group not found")
+
+	// Rent split equally, groceries by shares, a taxi by exact amounts
+	_, err = gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{Description: "Cabin", Amount: 90})
+	assert.NoError(t, err)
+	groceries, err := gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{
+		Description: "Groceries", Amount: 60, PaidBy: bob.ID, SplitType: models.ExpenseSplitShares,
+		Splits: []services.ExpenseSplitInput{{UserID: alice.ID, Shares: 1}, {UserID: bob.ID, Shares: 1}, {UserID: carol.ID, Shares: 2}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, groceries.Shares[2].Amount.Equal(decimal.NewFromInt(30)))
+	_, err = gs.AddExpense(carol.ID, group.ID, services.GroupExpenseInput{
+		Description: "Taxi", Amount: 10, SplitType: models.ExpenseSplitExact,
+		Splits: []services.ExpenseSplitInput{{UserID: alice.ID, Amount: 4}, {UserID: bob.ID, Amount: 5}},
+	})
+	assert.EqualError(t, err, "exact amounts add up to 9.00, not 10.00")
+	_, err = gs.AddExpense(carol.ID, group.ID, services.GroupExpenseInput{
+		Description: "Taxi", Amount: 10, SplitType: models.ExpenseSplitExact,
+		Splits: []services.ExpenseSplitInput{{UserID: alice.ID, Amount: 4}, {UserID: bob.ID, Amount: 6}},
+	})
+	assert.NoError(t, err)
+	_, err = gs.AddExpense(carol.ID, group.ID, services.GroupExpenseInput{Description: "Fuel", Amount: 20, PaidBy: "stranger"})
+	assert.EqualError(t, err, "the payer must be a group member")
+	assert.Equal(t, int64(3), notificationCount(db, bob.ID, "New group expense"))
+
+	// Three pairwise debts simplify to two payments, both from Carol
+	balances, err := gs.GetBalances(bob.ID, group.ID)
+	assert.NoError(t, err)
+	assert.Len(t, balances.Debts, 3)
+	nets := map[string]string{}
+	for _, m := range balances.Members {
+		nets[m.Username] = m.Net.StringFixed(2)
+	}
+	assert.Equal(t, map[string]string{"alice": "41.00", "bob": "9.00", "carol": "-50.00"}, nets)
+	assert.Len(t, balances.Payments, 2)
+	for _, p := range balances.Payments {
+		assert.Equal(t, "carol", p.FromUsername)
+	}
+
+	_, err = gs.SettleUp(bob.ID, group.ID, services.SettleUpInput{})
+	assert.EqualError(t, err, "you have nothing to settle in this group")
+	assert.EqualError(t, gs.RemoveMember(bob.ID, group.ID, carol.ID), "members must settle up before leaving the group")
+
+	settlements, err := gs.SettleUp(carol.ID, group.ID, services.SettleUpInput{})
+	assert.NoError(t, err)
+	assert.Len(t, settlements, 2)
+	settledCashback(t, db, 2)
+	for user, want := range map[string]string{alice.ID: "241", bob.ID: "9", carol.ID: "50.5"} {
+		wallet, _ := ws.GetWallet(user)
+		assert.True(t, wallet.Balance.Equal(decimal.RequireFromString(want)), "%s has %s, plus 1%% cashback for carol", user, wallet.Balance)
+	}
+	var send models.Transaction
+	db.Where("id = ?", settlements[0].TransactionID).First(&send)
+	assert.Equal(t, models.TransactionTypeP2PSend, send.Type)
+	assert.Contains(t, send.Description, "Settle up in Lake trip")
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Group settled"))
+
+	// Settled up, nobody owes anybody, even pairwise
+	balances, _ = gs.GetBalances(alice.ID, group.ID)
+	assert.Empty(t, balances.Debts)
+	assert.Empty(t, balances.Payments)
+	history, _ := gs.GetSettlements(alice.ID, group.ID)
+	assert.Len(t, history, 2)
+	assert.NoError(t, gs.RemoveMember(carol.ID, group.ID, carol.ID))
+	_, err = gs.GetBalances(carol.ID, group.ID)
+	assert.EqualError(t, err, "expense group not found")
+}
+
+func TestExpenseGroupSplitRoundingAndDeletes(t *testing.T) {
+	db := setupTestDBExpenseGroup()
+	alice, bob := seedRefundUsers(t, db)
+	carol := models.User{Email: "c@test.com", Username: "carol", Phone: "3", FirstName: "C", LastName: "C"}
+	db.Create(&carol)
+	gs := services.NewExpenseGroupService(db, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+	group, _ := gs.Create(alice.ID, services.CreateExpenseGroupInput{Name: "Flat", Members: []string{"bob"}})
+	_, err := gs.AddMember(bob.ID, group.ID, services.ExpenseGroupMemberInput{User: "carol"})
+	assert.NoError(t, err)
+
+	// Odd cents go to the earliest listed participants
+	coffee, err := gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{
+		Description: "Coffee", Amount: 10,
+		Splits: []services.ExpenseSplitInput{{UserID: bob.ID}, {UserID: carol.ID}, {UserID: alice.ID}},
+	})
+	assert.NoError(t, err)
+	var parts []string
+	for _, s := range coffee.Shares {
+		parts = append(parts, s.Amount.StringFixed(2))
+	}
+	assert.Equal(t, []string{"3.34", "3.33", "3.33"}, parts)
+
+	// By shares, the largest remainders take the spare cents
+	bills, err := gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{
+		Description: "Utilities", Amount: 100, SplitType: models.ExpenseSplitShares,
+		Splits: []services.ExpenseSplitInput{{UserID: alice.ID, Shares: 1}, {UserID: bob.ID, Shares: 2}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, bills.Shares[0].Amount.Equal(decimal.RequireFromString("33.33")))
+	assert.True(t, bills.Shares[1].Amount.Equal(decimal.RequireFromString("66.67")))
+
+	_, err = gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{
+		Description: "Oops", Amount: 5, SplitType: models.ExpenseSplitShares,
+		Splits: []services.ExpenseSplitInput{{UserID: alice.ID, Shares: 1}, {UserID: alice.ID, Shares: 1}},
+	})
+	assert.EqualError(t, err, "each participant can only be listed once")
+	_, err = gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{Description: "Oops", Amount: 5, SplitType: "percent"})
+	assert.EqualError(t, err, "splits are required for this split type")
+
+	// Deleting an expense takes it out of the balances
+	assert.EqualError(t, gs.DeleteExpense(carol.ID, group.ID, bills.ID), "only whoever added or paid an expense can delete it")
+	assert.NoError(t, gs.DeleteExpense(alice.ID, group.ID, bills.ID))
+	expenses, _ := gs.GetExpenses(bob.ID, group.ID)
+	assert.Len(t, expenses, 1)
+	balances, _ := gs.GetBalances(bob.ID, group.ID)
+	for _, m := range balances.Members {
+		if m.UserID == alice.ID {
+			assert.True(t, m.Net.Equal(decimal.RequireFromString("6.67")), m.Net.String())
+		}
+	}
+
+	// Bob has nothing in his wallet, so settling up fails and changes nothing
+	_, err = gs.SettleUp(bob.ID, group.ID, services.SettleUpInput{})
+	assert.EqualError(t, err, "insufficient balance")
+	settlements, _ := gs.GetSettlements(bob.ID, group.ID)
+	assert.Empty(t, settlements)
+}
+
+func TestBlockedSettlementIsRefused(t *testing.T) {
+	db := setupTestDBExpenseGroup()
+	alice, bob := seedRefundUsers(t, db)
+	gs := services.NewExpenseGroupService(db, newTransferVerification(db, 1000))
+
+	group, err := gs.Create(alice.ID, services.CreateExpenseGroupInput{Name: "Lease", Members: []string{"bob"}})
+	assert.NoError(t, err)
+	_, err = gs.AddExpense(alice.ID, group.ID, services.GroupExpenseInput{Description: "Security deposit", Amount: 3000})
+	assert.NoError(t, err)
+
+	// Bob owes 1500 and settles up right after a burst of transfers
+	sendBurst(db, bob, alice)
+	_, err = gs.SettleUp(bob.ID, group.ID, services.SettleUpInput{})
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+	settlements, err := gs.GetSettlements(bob.ID, group.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, settlements)
+}
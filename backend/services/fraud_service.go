@@ -41,8 +41,16 @@ func (s *FraudService) ReviewAlert(alertID string, reviewerID string, action str
 	}).Error
 }
 
-// AssessTransactionRisk evaluates the risk of a transaction
+// AssessTransactionRisk evaluates the risk of a transaction and logs it
 func (s *FraudService) AssessTransactionRisk(userID string, amount float64, txType string) (float64, string) {
+	riskScore, action, factors := s.scoreTransaction(userID, amount)
+	s.recordRisk(userID, txType, riskScore, action, factors)
+	return riskScore, action
+}
+
+// scoreTransaction rates a transaction without logging anything and returns
+// its score, the action to take and the factors behind the score
+func (s *FraudService) scoreTransaction(userID string, amount float64) (float64, string, map[string]float64) {
 	riskScore := 0.0
 	factors := make(map[string]float64)
 
@@ -97,8 +105,11 @@ func (s *FraudService) AssessTransactionRisk(userID string, amount float64, txTy
 	} else if riskScore >= 40 {
 		action = "flag"
 	}
+	return riskScore, action, factors
+}
 
-	// Log risk event
+// recordRisk logs a risk event, and a fraud alert unless it was allowed
+func (s *FraudService) recordRisk(userID, txType string, riskScore float64, action string, factors map[string]float64) {
 	factorsJSON, _ := json.Marshal(factors)
 	riskEvent := models.RiskEvent{
 		UserID:    userID,
@@ -121,8 +132,6 @@ func (s *FraudService) AssessTransactionRisk(userID string, amount float64, txTy
 		}
 		s.db.Create(&alert)
 	}
-
-	return riskScore, action
 }
 
 func determineAlertType(factors map[string]float64) string {
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fxQuoteTTL is how long a quoted rate can be executed
+const fxQuoteTTL = 60 * time.Second
+
+// RateTable holds mid-market rates as units of each currency per one unit of Base
+type RateTable struct {
+	Base  string                     `json:"base"`
+	AsOf  time.Time                  `json:"as_of"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+// RateProvider is the source of mid-market FX rates. Production deployments
+// plug in a market data feed; FileRateProvider serves rates from disk.
+type RateProvider interface {
+	LatestRates() (*RateTable, error)
+}
+
+// FileRateProvider reads a RateTable from a JSON file on every call, so
+// rates can be updated without restarting the server
+type FileRateProvider struct {
+	path string
+}
+
+// NewFileRateProvider creates a FileRateProvider reading from path
+func NewFileRateProvider(path string) *FileRateProvider {
+	return &FileRateProvider{path: path}
+}
+
+// LatestRates loads the rate file
+func (p *FileRateProvider) LatestRates() (*RateTable, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+	var table RateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid rates file: %w", err)
+	}
+	if table.Base == "" {
+		table.Base = models.DefaultCurrency
+	}
+	if table.Rates == nil {
+		table.Rates = map[string]decimal.Decimal{}
+	}
+	table.Rates[table.Base] = decimal.NewFromInt(1)
+	return &table, nil
+}
+
+// FXService prices currency conversions and executes them between a user's wallets
+type FXService struct {
+	db       *gorm.DB
+	provider RateProvider
+	spread   decimal.Decimal
+}
+
+// NewFXService creates a new FXService. spread is the fraction taken off the
+// mid-market rate on every conversion, e.g. 0.005 for 0.5%.
+func NewFXService(db *gorm.DB, provider RateProvider, spread decimal.Decimal) *FXService {
+	return &FXService{db: db, provider: provider, spread: spread}
+}
+
+// FXQuoteInput is the DTO for requesting a conversion quote
+type FXQuoteInput struct {
+	FromCurrency string  `json:"from_currency" binding:"required"`
+	ToCurrency   string  `json:"to_currency" binding:"required"`
+	Amount       float64 `json:"amount" binding:"required"`
+}
+
+// FXConvertInput is the DTO for executing a quote
+type FXConvertInput struct {
+	QuoteID string `json:"quote_id" binding:"required"`
+}
+
+// ConversionResult is the response after a successful conversion
+type ConversionResult struct {
+	Quote      models.FXQuote `json:"quote"`
+	FromWallet models.Wallet  `json:"from_wallet"`
+	ToWallet   models.Wallet  `json:"to_wallet"`
+}
+
+// fxPrice is a priced conversion of a source amount
+type fxPrice struct {
+	MidRate decimal.Decimal
+	Rate    decimal.Decimal
+	Spread  decimal.Decimal
+	Target  decimal.Decimal
+}
+
+// GetRates returns the provider's current mid-market rates for supported currencies
+func (s *FXService) GetRates() (*RateTable, error) {
+	table, err := s.provider.LatestRates()
+	if err != nil {
+		return nil, errors.New("fx rates unavailable")
+	}
+	rates := make(map[string]decimal.Decimal)
+	for _, c := range models.SupportedCurrencies {
+		if r, ok := table.Rates[c]; ok {
+			rates[c] = r
+		}
+	}
+	table.Rates = rates
+	return table, nil
+}
+
+// MidRate returns units of to per one unit of from, crossing through the table's base
+func (s *FXService) MidRate(from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+	table, err := s.provider.LatestRates()
+	if err != nil {
+		return decimal.Zero, errors.New("fx rates unavailable")
+	}
+	fromRate, ok := table.Rates[from]
+	if !ok || !fromRate.IsPositive() {
+		return decimal.Zero, errors.New("no fx rate for " + from)
+	}
+	toRate, ok := table.Rates[to]
+	if !ok || !toRate.IsPositive() {
+		return decimal.Zero, errors.New("no fx rate for " + to)
+	}
+	return toRate.DivRound(fromRate, 8), nil
+}
+
+// price converts amount of from into to at the mid rate less the spread.
+// The target is rounded down to the cent so the platform never pays out more
+// than the quoted rate.
+func (s *FXService) price(from, to string, amount decimal.Decimal) (*fxPrice, error) {
+	mid, err := s.MidRate(from, to)
+	if err != nil {
+		return nil, err
+	}
+	rate := mid.Mul(decimal.NewFromInt(1).Sub(s.spread)).Round(8)
+	target := amount.Mul(rate).RoundDown(2)
+	if !target.IsPositive() {
+		return nil, errors.New("amount is too small to convert")
+	}
+	return &fxPrice{MidRate: mid, Rate: rate, Spread: s.spread, Target: target}, nil
+}
+
+// CreateQuote prices a conversion and stores it so it can be executed at
+// that rate until it expires
+func (s *FXService) CreateQuote(userID string, input FXQuoteInput) (*models.FXQuote, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	from, err := normalizeCurrency(input.FromCurrency)
+	if err != nil {
+		return nil, err
+	}
+	to, err := normalizeCurrency(input.ToCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, errors.New("cannot convert a currency into itself")
+	}
+
+	p, err := s.price(from, to, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := models.FXQuote{
+		UserID:       userID,
+		FromCurrency: from,
+		ToCurrency:   to,
+		MidRate:      p.MidRate,
+		Spread:       p.Spread,
+		Rate:         p.Rate,
+		SourceAmount: amount,
+		TargetAmount: p.Target,
+		ExpiresAt:    time.Now().Add(fxQuoteTTL),
+	}
+	if err := s.db.Create(&quote).Error; err != nil {
+		return nil, errors.New("failed to create quote")
+	}
+	return &quote, nil
+}
+
+// Convert executes a quote, moving money between the user's two currency
+// wallets at the quoted rate. A quote can be used once.
+func (s *FXService) Convert(userID, quoteID string) (*ConversionResult, error) {
+	var result ConversionResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var quote models.FXQuote
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", quoteID, userID).First(&quote).Error; err != nil {
+			return errors.New("quote not found")
+		}
+		if quote.UsedAt != nil {
+			return errors.New("quote has already been used")
+		}
+		if time.Now().After(quote.ExpiresAt) {
+			return errors.New("quote has expired")
+		}
+
+		fromWalletID, err := walletIDForUser(tx, userID, quote.FromCurrency)
+		if err != nil {
+			return errors.New("no " + quote.FromCurrency + " wallet to convert from")
+		}
+		toWalletID, err := ensureWallet(tx, userID, quote.ToCurrency)
+		if err != nil {
+			return err
+		}
+
+		wallets, err := lockWallets(tx, fromWalletID, toWalletID)
+		if err != nil {
+			return err
+		}
+		if wallets[fromWalletID].Available().LessThan(quote.SourceAmount) {
+			return errors.New("insufficient balance")
+		}
+
+		description := fmt.Sprintf("Converted %s %s to %s %s",
+			quote.SourceAmount.StringFixed(2), quote.FromCurrency, quote.TargetAmount.StringFixed(2), quote.ToCurrency)
+		entry, err := postJournal(tx, models.JournalTypeFXConversion, description,
+			fxLines(fromWalletID, quote.FromCurrency, quote.SourceAmount, toWalletID, quote.ToCurrency, quote.TargetAmount)...)
+		if err != nil {
+			return err
+		}
+
+		rate, spread := quote.Rate, quote.Spread
+		source, target := quote.SourceAmount, quote.TargetAmount
+		txns := []models.Transaction{
+			{
+				WalletID:        fromWalletID,
+				FromUserID:      &userID,
+				Type:            models.TransactionTypeFXConversion,
+				Amount:          source,
+				Currency:        quote.FromCurrency,
+				Description:     description,
+				Status:          models.TransactionStatusSuccess,
+				JournalEntryID:  &entry.ID,
+				FXRate:          &rate,
+				FXSpread:        &spread,
+				CounterAmount:   &target,
+				CounterCurrency: quote.ToCurrency,
+			},
+			{
+				WalletID:        toWalletID,
+				ToUserID:        &userID,
+				Type:            models.TransactionTypeFXConversion,
+				Amount:          target,
+				Currency:        quote.ToCurrency,
+				Description:     description,
+				Status:          models.TransactionStatusSuccess,
+				JournalEntryID:  &entry.ID,
+				FXRate:          &rate,
+				FXSpread:        &spread,
+				CounterAmount:   &source,
+				CounterCurrency: quote.FromCurrency,
+			},
+		}
+		if err := tx.Create(&txns).Error; err != nil {
+			return errors.New("failed to create transaction record")
+		}
+
+		now := time.Now()
+		if err := tx.Model(&quote).Update("used_at", now).Error; err != nil {
+			return errors.New("failed to mark quote used")
+		}
+		quote.UsedAt = &now
+
+		result.Quote = quote
+		if err := tx.Where("id = ?", fromWalletID).First(&result.FromWallet).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", toWalletID).First(&result.ToWallet).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// fxLines moves source out of one wallet and target into another. Each
+// currency balances through its own FX position account; the spread stays
+// behind as the platform's position.
+func fxLines(fromWalletID, fromCurrency string, source decimal.Decimal, toWalletID, toCurrency string, target decimal.Decimal) []journalLine {
+	return []journalLine{
+		debit(walletAccountCode(fromWalletID), source),
+		credit(platformCode(models.LedgerPlatformFX, fromCurrency), source),
+		debit(platformCode(models.LedgerPlatformFX, toCurrency), target),
+		credit(walletAccountCode(toWalletID), target),
+	}
+}
@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBFX(t *testing.T) (*gorm.DB, *services.FXService) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Reward{}, &models.FXQuote{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	os.WriteFile(path, []byte(`{"base":"USD","rates":{"EUR":"0.9","GBP":"0.8"}}`), 0o644)
+	fx := services.NewFXService(db, services.NewFileRateProvider(path), decimal.NewFromFloat(0.01))
+	return db, fx
+}
+
+func TestFileRateProviderCrossRates(t *testing.T) {
+	_, fx := setupTestDBFX(t)
+
+	rate, err := fx.MidRate("EUR", "GBP")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.88888889", rate.String())
+
+	_, err = fx.MidRate("USD", "CAD")
+	assert.Error(t, err)
+}
+
+func TestFXQuoteAndConvert(t *testing.T) {
+	db, fx := setupTestDBFX(t)
+	ls := services.NewLedgerService(db)
+
+	db.Create(&models.Wallet{UserID: "u1", Currency: "USD", IsActive: true})
+	deposit(t, db, "u1", 200)
+
+	quote, err := fx.CreateQuote("u1", services.FXQuoteInput{FromCurrency: "usd", ToCurrency: "EUR", Amount: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, "0.891", quote.Rate.String()) // 0.9 less 1% spread
+	assert.True(t, quote.TargetAmount.Equal(decimal.NewFromFloat(89.1)))
+
+	result, err := fx.Convert("u1", quote.ID)
+	assert.NoError(t, err)
+	assert.True(t, result.FromWallet.Balance.Equal(decimal.NewFromInt(100)))
+	assert.Equal(t, "EUR", result.ToWallet.Currency)
+	assert.True(t, result.ToWallet.Balance.Equal(decimal.NewFromFloat(89.1)))
+
+	// A quote executes once
+	_, err = fx.Convert("u1", quote.ID)
+	assert.EqualError(t, err, "quote has already been used")
+
+	var txn models.Transaction
+	db.Where("wallet_id = ? AND type = ?", result.ToWallet.ID, models.TransactionTypeFXConversion).First(&txn)
+	assert.Equal(t, "EUR", txn.Currency)
+	assert.Equal(t, "0.891", txn.FXRate.String())
+	assert.Equal(t, "USD", txn.CounterCurrency)
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	checks, _ := ls.CheckWallets()
+	for _, c := range checks {
+		assert.True(t, c.Matches)
+	}
+}
+
+func TestFXConvertRejectsExpiredQuote(t *testing.T) {
+	db, fx := setupTestDBFX(t)
+
+	db.Create(&models.Wallet{UserID: "u1", Currency: "USD", IsActive: true})
+	deposit(t, db, "u1", 50)
+
+	quote, err := fx.CreateQuote("u1", services.FXQuoteInput{FromCurrency: "USD", ToCurrency: "GBP", Amount: 10})
+	assert.NoError(t, err)
+	db.Model(quote).Update("expires_at", time.Now().Add(-time.Second))
+
+	_, err = fx.Convert("u1", quote.ID)
+	assert.EqualError(t, err, "quote has expired")
+
+	_, err = fx.Convert("u2", quote.ID)
+	assert.EqualError(t, err, "quote not found")
+}
+
+func TestCrossCurrencyTransferRecordsRate(t *testing.T) {
+	db, fx := setupTestDBFX(t)
+	ws := services.NewWalletService(db, nil)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), fx, nil))
+	ls := services.NewLedgerService(db)
+
+	alice := models.User{Email: "a@test.com", Username: "alice", Phone: "1", FirstName: "A", LastName: "A"}
+	bob := models.User{Email: "b@test.com", Username: "bob", Phone: "2", FirstName: "B", LastName: "B"}
+	db.Create(&alice)
+	db.Create(&bob)
+	db.Create(&models.Wallet{UserID: alice.ID, Currency: "USD", IsActive: true})
+	db.Create(&models.Wallet{UserID: bob.ID, Currency: "USD", IsActive: true})
+
+	// Alice already holds EUR; Bob only holds USD
+	db.Create(&models.Wallet{UserID: alice.ID, Currency: "EUR", Balance: decimal.NewFromInt(90), IsActive: true})
+	_, err := ls.BackfillOpeningBalances()
+	assert.NoError(t, err)
+
+	resp, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 45, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", resp.RecipientCurrency)
+	assert.True(t, resp.RecipientAmount.Equal(decimal.NewFromFloat(49.5))) // 45 / 0.9 less 1%
+	assert.True(t, resp.NewBalance.Equal(decimal.NewFromInt(45)))
+
+	var recv models.Transaction
+	db.Where("type = ?", models.TransactionTypeP2PReceive).First(&recv)
+	assert.Equal(t, "USD", recv.Currency)
+	assert.True(t, recv.Amount.Equal(decimal.NewFromFloat(49.5)))
+	assert.Equal(t, "0.01", recv.FXSpread.String())
+	assert.Equal(t, "EUR", recv.CounterCurrency)
+	assert.True(t, recv.CounterAmount.Equal(decimal.NewFromInt(45)))
+
+	bobWallet, _ := ws.GetWallet(bob.ID)
+	assert.True(t, bobWallet.Balance.Equal(decimal.NewFromFloat(49.5)))
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+}
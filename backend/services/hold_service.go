@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HoldService captures, releases and expires authorization holds.
+// Holds are placed by the feature that authorizes a payment via placeHold.
+type HoldService struct {
+	db *gorm.DB
+}
+
+// NewHoldService creates a new HoldService
+func NewHoldService(db *gorm.DB) *HoldService {
+	return &HoldService{db: db}
+}
+
+// CaptureHoldInput is the DTO for settling a hold. A zero amount captures
+// everything still held; Final releases whatever is left after this capture.
+type CaptureHoldInput struct {
+	Amount float64 `json:"amount"`
+	Final  bool    `json:"final"`
+}
+
+// holdSettlement describes how a captured hold of a given type is booked
+type holdSettlement struct {
+	account         string // platform account credited with the captured funds
+	journalType     string
+	transactionType string
+}
+
+// holdSettlements lists the holds captured through the hold API. Other holds
+// are settled by the payment that placed them, which books the captured
+// funds itself.
+var holdSettlements = map[string]holdSettlement{
+	models.HoldTypeCard: {models.LedgerPlatformCardNetwork, models.JournalTypeCardSpend, models.TransactionTypeCardSpend},
+}
+
+var holdTypes = []string{models.HoldTypeCard, models.HoldTypeWithdrawal, models.HoldTypeQR, models.HoldTypeTopUpRefund}
+
+// placeHold reserves amount on a wallet inside tx. The wallet is locked so
+// the available-balance check and the reservation happen atomically. A zero
+// ttl places a hold that never expires.
+func placeHold(tx *gorm.DB, walletID, holdType, reference, description string, amount decimal.Decimal, ttl time.Duration) (*models.Hold, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	if !contains(holdTypes, holdType) {
+		return nil, errors.New("unknown hold type " + holdType)
+	}
+
+	wallets, err := lockWallets(tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	wallet := wallets[walletID]
+	if !wallet.IsActive {
+		return nil, errors.New("wallet is not active")
+	}
+	if wallet.Available().LessThan(amount) {
+		return nil, errors.New("insufficient balance")
+	}
+
+	hold := models.Hold{
+		WalletID:       wallet.ID,
+		UserID:         wallet.UserID,
+		Type:           holdType,
+		Reference:      reference,
+		Description:    description,
+		Amount:         amount,
+		CapturedAmount: decimal.Zero,
+		Status:         models.HoldStatusActive,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		hold.ExpiresAt = &expiresAt
+	}
+	if err := tx.Create(&hold).Error; err != nil {
+		return nil, errors.New("failed to place hold")
+	}
+	if err := adjustHeldBalance(tx, wallet.ID, amount); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// adjustHeldBalance moves a locked wallet's held balance by delta
+func adjustHeldBalance(tx *gorm.DB, walletID string, delta decimal.Decimal) error {
+	if err := tx.Model(&models.Wallet{}).Where("id = ?", walletID).
+		Update("held_balance", gorm.Expr("held_balance + ?", delta)).Error; err != nil {
+		return errors.New("failed to update held balance")
+	}
+	return nil
+}
+
+// lockHold loads a hold with SELECT ... FOR UPDATE and its wallet locked too
+func lockHold(tx *gorm.DB, holdID string) (*models.Hold, *models.Wallet, error) {
+	var hold models.Hold
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", holdID).First(&hold).Error; err != nil {
+		return nil, nil, errors.New("hold not found")
+	}
+	wallets, err := lockWallets(tx, hold.WalletID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &hold, wallets[hold.WalletID], nil
+}
+
+// settleHold takes amount off a locked hold inside tx and returns what was
+// captured; a zero amount captures everything still held, and final releases
+// whatever is left. The caller books where the captured funds go.
+func settleHold(tx *gorm.DB, hold *models.Hold, wallet *models.Wallet, amount decimal.Decimal, final bool) (decimal.Decimal, error) {
+	if hold.Status != models.HoldStatusActive {
+		return decimal.Zero, errors.New("hold is not active")
+	}
+	if hold.ExpiresAt != nil && time.Now().After(*hold.ExpiresAt) {
+		return decimal.Zero, errors.New("hold has expired")
+	}
+
+	remaining := hold.Remaining()
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if amount.IsNegative() {
+		return decimal.Zero, errors.New("amount must be greater than 0")
+	}
+	if amount.GreaterThan(remaining) {
+		return decimal.Zero, errors.New("capture exceeds the amount held")
+	}
+
+	// Unreserve before the caller posts, since postJournal will not debit held funds
+	released := amount
+	done := final || amount.Equal(remaining)
+	if done {
+		released = remaining
+	}
+	if err := adjustHeldBalance(tx, wallet.ID, released.Neg()); err != nil {
+		return decimal.Zero, err
+	}
+	if err := releaseUsage(tx, hold.ID, released.Sub(amount), hold.Amount); err != nil {
+		return decimal.Zero, err
+	}
+
+	updates := map[string]interface{}{"captured_amount": hold.CapturedAmount.Add(amount)}
+	if done {
+		now := time.Now()
+		updates["status"] = models.HoldStatusCaptured
+		updates["settled_at"] = now
+	}
+	if err := tx.Model(hold).Updates(updates).Error; err != nil {
+		return decimal.Zero, errors.New("failed to update hold")
+	}
+	if err := tx.Where("id = ?", hold.ID).First(hold).Error; err != nil {
+		return decimal.Zero, err
+	}
+	return amount, nil
+}
+
+// captureHold settles part or all of a hold inside tx, moving the captured
+// funds out of the wallet, and returns the transaction it recorded
+func captureHold(tx *gorm.DB, holdID string, amount decimal.Decimal, final bool) (*models.Hold, *models.Transaction, error) {
+	hold, wallet, err := lockHold(tx, holdID)
+	if err != nil {
+		return nil, nil, err
+	}
+	settlement, ok := holdSettlements[hold.Type]
+	if !ok {
+		return nil, nil, errors.New(hold.Type + " holds are settled by the payment that placed them")
+	}
+	amount, err = settleHold(tx, hold, wallet, amount, final)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, err := postJournal(tx, settlement.journalType, hold.Description,
+		debit(walletAccountCode(wallet.ID), amount),
+		credit(platformCode(settlement.account, wallet.Currency), amount),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	txn := models.Transaction{
+		WalletID:       wallet.ID,
+		FromUserID:     &hold.UserID,
+		Type:           settlement.transactionType,
+		Amount:         amount,
+		Currency:       wallet.Currency,
+		Description:    hold.Description,
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if err := tx.Create(&txn).Error; err != nil {
+		return nil, nil, errors.New("failed to create transaction record")
+	}
+	return hold, &txn, nil
+}
+
+// releaseHold gives a hold's remaining funds back to the available balance
+func releaseHold(tx *gorm.DB, holdID, status string) (*models.Hold, error) {
+	hold, wallet, err := lockHold(tx, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != models.HoldStatusActive {
+		return nil, errors.New("hold is not active")
+	}
+
+	if err := adjustHeldBalance(tx, wallet.ID, hold.Remaining().Neg()); err != nil {
+		return nil, err
+	}
+	if err := releaseUsage(tx, hold.ID, hold.Remaining(), hold.Amount); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := tx.Model(hold).Updates(map[string]interface{}{"status": status, "settled_at": now}).Error; err != nil {
+		return nil, errors.New("failed to update hold")
+	}
+	hold.Status = status
+	hold.SettledAt = &now
+	return hold, nil
+}
+
+// GetHolds returns a user's holds, newest first, optionally filtered by status
+func (s *HoldService) GetHolds(userID, status string) ([]models.Hold, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var holds []models.Hold
+	if err := query.Order("created_at DESC").Find(&holds).Error; err != nil {
+		return nil, errors.New("failed to fetch holds")
+	}
+	return holds, nil
+}
+
+// Capture settles a hold in full or in part
+func (s *HoldService) Capture(holdID string, input CaptureHoldInput) (*models.Hold, error) {
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		hold, _, err = captureHold(tx, holdID, decimal.NewFromFloat(input.Amount), input.Final)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Release cancels a hold and frees whatever it still reserves
+func (s *HoldService) Release(holdID string) (*models.Hold, error) {
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var held models.Hold
+		if err := tx.Where("id = ?", holdID).First(&held).Error; err != nil {
+			return errors.New("hold not found")
+		}
+		if _, ok := holdSettlements[held.Type]; !ok {
+			return errors.New(held.Type + " holds are settled by the payment that placed them")
+		}
+		var err error
+		hold, err = releaseHold(tx, holdID, models.HoldStatusReleased)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireHolds releases every active hold past its expiry. It is run by the scheduler.
+func (s *HoldService) ExpireHolds() error {
+	var ids []string
+	if err := s.db.Model(&models.Hold{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", models.HoldStatusActive, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return errors.New("failed to find expired holds")
+	}
+
+	for _, id := range ids {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			_, err := releaseHold(tx, id, models.HoldStatusExpired)
+			return err
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to expire hold %s: %v", id, err)
+			continue
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("⏱️  Expired %d holds", len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBHold() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.VirtualCard{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func seedHoldWallet(t *testing.T, db *gorm.DB) *models.VirtualCard {
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+	deposit(t, db, "u1", 100)
+
+	card := models.VirtualCard{UserID: "u1", CardNumber: "4000000000001234", Name: "Main"}
+	db.Create(&card)
+	return &card
+}
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	db := setupTestDBHold()
+	card := seedHoldWallet(t, db)
+	cs := services.NewCardService(db)
+	ws := services.NewWalletService(db, nil)
+
+	hold, err := cs.Authorize(card.ID, "u1", services.CardAuthorizeInput{Amount: 70, Merchant: "Bookstore"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusActive, hold.Status)
+
+	wallet, _ := ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)))
+	assert.True(t, wallet.HeldBalance.Equal(decimal.NewFromInt(70)))
+	assert.True(t, wallet.AvailableBalance.Equal(decimal.NewFromInt(30)))
+
+	// Held funds cannot be withdrawn or authorized twice
+	_, err = ws.Withdraw("u1", services.WithdrawInput{Amount: 40, LinkedAccountID: bankAccount(t, db, "u1")})
+	assert.EqualError(t, err, "insufficient balance")
+	_, err = cs.Authorize(card.ID, "u1", services.CardAuthorizeInput{Amount: 40, Merchant: "Cafe"})
+	assert.EqualError(t, err, "insufficient balance")
+}
+
+func TestHoldPartialCaptureThenRelease(t *testing.T) {
+	db := setupTestDBHold()
+	card := seedHoldWallet(t, db)
+	cs := services.NewCardService(db)
+	hs := services.NewHoldService(db)
+	ws := services.NewWalletService(db, nil)
+	ls := services.NewLedgerService(db)
+
+	hold, _ := cs.Authorize(card.ID, "u1", services.CardAuthorizeInput{Amount: 60, Merchant: "Hotel"})
+
+	hold, err := hs.Capture(hold.ID, services.CaptureHoldInput{Amount: 25})
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusActive, hold.Status)
+	assert.True(t, hold.CapturedAmount.Equal(decimal.NewFromInt(25)))
+
+	wallet, _ := ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(75)))
+	assert.True(t, wallet.HeldBalance.Equal(decimal.NewFromInt(35)))
+
+	_, err = hs.Capture(hold.ID, services.CaptureHoldInput{Amount: 50})
+	assert.EqualError(t, err, "capture exceeds the amount held")
+
+	hold, err = hs.Release(hold.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusReleased, hold.Status)
+
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(75)))
+	assert.True(t, wallet.HeldBalance.IsZero())
+
+	var spend models.Transaction
+	db.Where("type = ?", models.TransactionTypeCardSpend).First(&spend)
+	assert.True(t, spend.Amount.Equal(decimal.NewFromInt(25)))
+
+	checks, _ := ls.CheckWallets()
+	assert.True(t, checks[0].Matches)
+}
+
+func TestHoldFinalCaptureReleasesRemainder(t *testing.T) {
+	db := setupTestDBHold()
+	card := seedHoldWallet(t, db)
+	cs := services.NewCardService(db)
+	hs := services.NewHoldService(db)
+
+	hold, _ := cs.Authorize(card.ID, "u1", services.CardAuthorizeInput{Amount: 50, Merchant: "Gas"})
+	hold, err := hs.Capture(hold.ID, services.CaptureHoldInput{Amount: 42.5, Final: true})
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusCaptured, hold.Status)
+
+	wallet, _ := services.NewWalletService(db, nil).GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromFloat(57.5)))
+	assert.True(t, wallet.AvailableBalance.Equal(decimal.NewFromFloat(57.5)))
+
+	_, err = hs.Release(hold.ID)
+	assert.EqualError(t, err, "hold is not active")
+}
+
+func TestExpireHolds(t *testing.T) {
+	db := setupTestDBHold()
+	card := seedHoldWallet(t, db)
+	cs := services.NewCardService(db)
+	hs := services.NewHoldService(db)
+
+	hold, _ := cs.Authorize(card.ID, "u1", services.CardAuthorizeInput{Amount: 30, Merchant: "Taxi"})
+	db.Model(hold).Update("expires_at", time.Now().Add(-time.Minute))
+
+	assert.NoError(t, hs.ExpireHolds())
+
+	var expired models.Hold
+	db.First(&expired, "id = ?", hold.ID)
+	assert.Equal(t, models.HoldStatusExpired, expired.Status)
+
+	wallet, _ := services.NewWalletService(db, nil).GetWallet("u1")
+	assert.True(t, wallet.HeldBalance.IsZero())
+	assert.True(t, wallet.AvailableBalance.Equal(decimal.NewFromInt(100)))
+
+	_, err := hs.Capture(hold.ID, services.CaptureHoldInput{})
+	assert.EqualError(t, err, "hold is not active")
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// idempotencyKeyTTL is how long a stored response can be replayed
+const idempotencyKeyTTL = 24 * time.Hour
+
+// Idempotency errors surfaced to the middleware
+var (
+	ErrIdempotencyKeyReused    = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInFlight  = errors.New("a request with this idempotency key is still being processed")
+	ErrIdempotencyStoreFailure = errors.New("failed to record idempotency key")
+)
+
+// IdempotencyService persists Idempotency-Key requests and their responses
+type IdempotencyService struct {
+	db *gorm.DB
+}
+
+// NewIdempotencyService creates a new IdempotencyService
+func NewIdempotencyService(db *gorm.DB) *IdempotencyService {
+	return &IdempotencyService{db: db}
+}
+
+// Begin claims a key for a request. If the key was already completed with
+// the same request, the stored record is returned with replay set to true.
+func (s *IdempotencyService) Begin(userID, key, method, path, requestHash string) (record *models.IdempotencyKey, replay bool, err error) {
+	now := time.Now()
+
+	// Expired keys are forgotten so the client may reuse them
+	s.db.Where("user_id = ? AND idempotency_key = ? AND expires_at < ?", userID, key, now).
+		Delete(&models.IdempotencyKey{})
+
+	claim := models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Method:      method,
+		Path:        path,
+		RequestHash: requestHash,
+		Status:      models.IdempotencyStatusProcessing,
+		ExpiresAt:   now.Add(idempotencyKeyTTL),
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&claim)
+	if result.Error != nil {
+		return nil, false, ErrIdempotencyStoreFailure
+	}
+	if result.RowsAffected == 1 {
+		return &claim, false, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := s.db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&existing).Error; err != nil {
+		return nil, false, ErrIdempotencyStoreFailure
+	}
+	if existing.RequestHash != requestHash || existing.Method != method || existing.Path != path {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if existing.Status != models.IdempotencyStatusCompleted {
+		return nil, false, ErrIdempotencyKeyInFlight
+	}
+	return &existing, true, nil
+}
+
+// Complete stores the response for a claimed key
+func (s *IdempotencyService) Complete(record *models.IdempotencyKey, statusCode int, body string) error {
+	return s.db.Model(record).Updates(map[string]interface{}{
+		"status":        models.IdempotencyStatusCompleted,
+		"status_code":   statusCode,
+		"response_body": body,
+	}).Error
+}
+
+// Release forgets a claimed key so the request can be retried, used when
+// the request failed before reaching a final outcome
+func (s *IdempotencyService) Release(record *models.IdempotencyKey) error {
+	return s.db.Delete(record).Error
+}
+
+// PurgeExpired deletes keys whose replay window has passed
+func (s *IdempotencyService) PurgeExpired() (int64, error) {
+	result := s.db.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -42,7 +42,8 @@ func (s *InsightService) GetSummary(userID string) (*models.InsightSummaryRespon
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
 
 	var transactions []models.Transaction
-	s.db.Where("(from_user_id = ? OR to_user_id = ?) AND created_at >= ?", userID, userID, thirtyDaysAgo).
+	s.db.Preload("Annotation").
+		Where("(from_user_id = ? OR to_user_id = ?) AND created_at >= ?", userID, userID, thirtyDaysAgo).
 		Find(&transactions)
 
 	// Calculate totals
@@ -52,10 +53,10 @@ func (s *InsightService) GetSummary(userID string) (*models.InsightSummaryRespon
 
 	for _, tx := range transactions {
 		amount, _ := tx.Amount.Float64()
-		switch tx.Type {
-		case "deposit", "p2p_receive", "cashback":
+		switch {
+		case contains(incomeTypes, tx.Type):
 			totalIncome += amount
-		case "withdraw", "p2p_send", "bill_pay":
+		case contains(spendingTypes, tx.Type):
 			totalSpending += amount
 			cat := categorizeTransaction(tx)
 			categorySpending[cat] += amount
@@ -122,7 +123,32 @@ func (s *InsightService) GetSummary(userID string) (*models.InsightSummaryRespon
 	return response, nil
 }
 
+// Invalidate drops a user's cached summary so the next request recomputes it
+func (s *InsightService) Invalidate(userID string) {
+	s.mu.Lock()
+	delete(s.cache, userID+":monthly")
+	s.mu.Unlock()
+}
+
+// incomeTypes and spendingTypes are the transaction types counted as money
+// coming in and going out
+var (
+	incomeTypes   = []string{"deposit", "p2p_receive", "cashback", "refund"}
+	spendingTypes = []string{"withdraw", "p2p_send", "bill_pay", "refund_sent"}
+)
+
+// spendingCategories are the categories transactions are grouped into and
+// that users may pick as an override
+var spendingCategories = []string{
+	"Food & Dining", "Shopping", "Entertainment", "Transportation", "Bills & Utilities", "Transfers", "Other",
+}
+
+// categorizeTransaction returns the user's category override, if any, or
+// guesses one from the description. Annotation must be preloaded.
 func categorizeTransaction(tx models.Transaction) string {
+	if tx.Annotation != nil && tx.Annotation.Category != "" {
+		return tx.Annotation.Category
+	}
 	desc := strings.ToLower(tx.Description)
 	categories := map[string][]string{
 		"Food & Dining":     {"food", "restaurant", "pizza", "burger", "coffee", "cafe"},
@@ -0,0 +1,477 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	interestDateLayout  = "2006-01-02"
+	interestMonthLayout = "2006-01"
+
+	// interestCatchUpDays is how far back RunDaily fills in days it missed
+	interestCatchUpDays = 45
+)
+
+var (
+	maxInterestAPY = decimal.NewFromInt(20) // percent
+	// interestReportable is the yearly interest that is reported on Form 1099-INT
+	interestReportable = decimal.NewFromInt(10)
+)
+
+// InterestService pays interest on savings pockets. Interest accrues daily
+// on each pocket's end-of-day balance at the APY in force that day, and is
+// paid into the pocket once the month is over. Every step is keyed by pocket
+// and day or month, so rerunning a day never pays twice.
+type InterestService struct {
+	db *gorm.DB
+}
+
+// NewInterestService creates a new InterestService
+func NewInterestService(db *gorm.DB) *InterestService {
+	return &InterestService{db: db}
+}
+
+// InterestMonth is the interest paid for one month
+type InterestMonth struct {
+	Month  string          `json:"month"` // YYYY-MM
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// PocketInterest is the interest one pocket earned in a year
+type PocketInterest struct {
+	PocketID string          `json:"pocket_id"`
+	GoalID   string          `json:"goal_id"`
+	GoalName string          `json:"goal_name"`
+	Balance  decimal.Decimal `json:"balance"`
+	Paid     decimal.Decimal `json:"paid"`
+	Accrued  decimal.Decimal `json:"accrued"` // earned but not paid yet, to the cent
+}
+
+// InterestSummary is a user's savings interest for a year, for tax summaries
+type InterestSummary struct {
+	Year       int              `json:"year"`
+	APY        decimal.Decimal  `json:"apy"`      // the rate in force today
+	PaidYTD    decimal.Decimal  `json:"paid_ytd"` // interest paid for the year's months so far
+	Accrued    decimal.Decimal  `json:"accrued"`  // earned but not paid yet, to the cent
+	Reportable bool             `json:"reportable"`
+	Months     []InterestMonth  `json:"months"`
+	Pockets    []PocketInterest `json:"pockets"`
+}
+
+// EnsureRate starts the rate history at the configured APY. It does nothing
+// once any rate exists, so rates set by admins are never overwritten.
+func (s *InterestService) EnsureRate(apy string) error {
+	if apy == "" {
+		return nil
+	}
+	rate, err := decimal.NewFromString(apy)
+	if err != nil || rate.IsNegative() || rate.GreaterThan(maxInterestAPY) {
+		return errors.New("savings APY must be a percentage between 0 and 20")
+	}
+	var count int64
+	if err := s.db.Model(&models.InterestRate{}).Count(&count).Error; err != nil {
+		return errors.New("failed to fetch interest rates")
+	}
+	if count > 0 {
+		return nil
+	}
+	initial := models.InterestRate{APY: rate.Round(4), EffectiveFrom: time.Now().Format(interestDateLayout), Note: "Configured default"}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&initial).Error; err != nil {
+		return errors.New("failed to seed interest rate")
+	}
+	return nil
+}
+
+// SetRate schedules a new APY from a date, today by default. Days that have
+// already started keep the rate they had.
+func (s *InterestService) SetRate(adminID string, req models.SetInterestRateRequest) (*models.InterestRate, error) {
+	apy := decimal.NewFromFloat(*req.APY).Round(4)
+	if apy.IsNegative() || apy.GreaterThan(maxInterestAPY) {
+		return nil, errors.New("apy must be between 0 and 20 percent")
+	}
+	today := startOfDay(time.Now())
+	effective := today
+	if req.EffectiveFrom != "" {
+		parsed, err := time.ParseInLocation(interestDateLayout, req.EffectiveFrom, time.Local)
+		if err != nil {
+			return nil, errors.New("effective_from must be a date like 2006-01-02")
+		}
+		effective = parsed
+	}
+	if effective.Before(today) {
+		return nil, errors.New("a rate change cannot take effect in the past")
+	}
+
+	rate := models.InterestRate{APY: apy, EffectiveFrom: effective.Format(interestDateLayout), SetBy: adminID, Note: req.Note}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "effective_from"}},
+		DoUpdates: clause.AssignmentColumns([]string{"apy", "set_by", "note", "updated_at"}),
+	}).Create(&rate).Error; err != nil {
+		return nil, errors.New("failed to save interest rate")
+	}
+	// On conflict the existing row keeps its ID, so read it back
+	var saved models.InterestRate
+	if err := s.db.Where("effective_from = ?", rate.EffectiveFrom).First(&saved).Error; err != nil {
+		return nil, errors.New("failed to load interest rate")
+	}
+	return &saved, nil
+}
+
+// GetRates returns the rate history, newest first
+func (s *InterestService) GetRates() ([]models.InterestRate, error) {
+	var rates []models.InterestRate
+	if err := s.db.Order("effective_from DESC").Find(&rates).Error; err != nil {
+		return nil, errors.New("failed to fetch interest rates")
+	}
+	return rates, nil
+}
+
+// AccrueDay records a day's interest for every pocket with money in it at
+// the end of that day. Pockets that already have the day, or whose month has
+// been paid out, are skipped. It returns how many accruals were recorded.
+func (s *InterestService) AccrueDay(day time.Time) (int, error) {
+	start := startOfDay(day)
+	end := start.AddDate(0, 0, 1)
+	if end.After(time.Now()) {
+		return 0, errors.New("interest can only be accrued for days that have ended")
+	}
+	date := start.Format(interestDateLayout)
+
+	apy, err := rateOn(s.db, date)
+	if err != nil {
+		return 0, err
+	}
+	if apy.IsZero() {
+		return 0, nil
+	}
+	rate, err := dailyRate(apy, time.Date(start.Year(), 12, 31, 0, 0, 0, 0, time.Local).YearDay())
+	if err != nil {
+		return 0, err
+	}
+	balances, err := pocketBalancesAt(s.db, end)
+	if err != nil {
+		return 0, err
+	}
+	var closed []string
+	if err := s.db.Model(&models.InterestPayout{}).Where("month = ?", start.Format(interestMonthLayout)).
+		Pluck("pocket_id", &closed).Error; err != nil {
+		return 0, errors.New("failed to fetch interest payouts")
+	}
+
+	recorded := 0
+	for _, b := range balances {
+		if !b.Balance.IsPositive() || contains(closed, b.PocketID) {
+			continue
+		}
+		accrual := models.InterestAccrual{
+			PocketID: b.PocketID,
+			Date:     date,
+			UserID:   b.UserID,
+			Balance:  b.Balance,
+			APY:      apy,
+			Amount:   b.Balance.Mul(rate).Round(10),
+		}
+		result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&accrual)
+		if result.Error != nil {
+			return recorded, errors.New("failed to record interest accrual")
+		}
+		recorded += int(result.RowsAffected)
+	}
+	return recorded, nil
+}
+
+// PayDue pays out every month before now's that still has unpaid accruals.
+// A pocket that cannot be paid is logged and retried on the next run.
+func (s *InterestService) PayDue(now time.Time) (int, error) {
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).Format(interestDateLayout)
+	var accruals []models.InterestAccrual
+	if err := s.db.Where("payout_id IS NULL AND date < ?", cutoff).Order("pocket_id, date").Find(&accruals).Error; err != nil {
+		return 0, errors.New("failed to fetch interest accruals")
+	}
+
+	paid := 0
+	var firstErr error
+	for i := 0; i < len(accruals); {
+		// Accruals are sorted, so each pocket's month is one run
+		j := i + 1
+		for j < len(accruals) && accruals[j].PocketID == accruals[i].PocketID && accruals[j].Date[:7] == accruals[i].Date[:7] {
+			j++
+		}
+		if err := s.payMonth(accruals[i:j]); err != nil {
+			log.Printf("⚠️  Interest for pocket %s in %s not paid: %v", accruals[i].PocketID, accruals[i].Date[:7], err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			paid++
+		}
+		i = j
+	}
+	return paid, firstErr
+}
+
+// payMonth pays one pocket's accruals for one month into the pocket. The
+// interest is credited to the wallet and swept into the pocket in the same
+// journal entry, so both show on the wallet's history.
+func (s *InterestService) payMonth(accruals []models.InterestAccrual) error {
+	pocketID, month := accruals[0].PocketID, accruals[0].Date[:7]
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var pocket models.Pocket
+		if err := tx.Where("id = ?", pocketID).First(&pocket).Error; err != nil {
+			return errors.New("pocket not found")
+		}
+		var goal models.BudgetGoal
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", pocket.GoalID).First(&goal).Error; err != nil {
+			return errors.New("goal not found")
+		}
+
+		carried := decimal.Zero
+		var previous models.InterestPayout
+		if err := tx.Where("pocket_id = ?", pocketID).Order("month DESC").First(&previous).Error; err == nil {
+			carried = previous.Remainder
+		}
+		accrued := decimal.Zero
+		ids := make([]string, len(accruals))
+		for i, a := range accruals {
+			accrued = accrued.Add(a.Amount)
+			ids[i] = a.ID
+		}
+		total := accrued.Add(carried)
+		payout := models.InterestPayout{
+			PocketID:  pocketID,
+			Month:     month,
+			UserID:    pocket.UserID,
+			Accrued:   accrued,
+			CarriedIn: carried,
+			Amount:    total.RoundDown(2),
+		}
+		payout.Remainder = total.Sub(payout.Amount)
+		// The unique pocket and month stops a second payout
+		if err := tx.Create(&payout).Error; err != nil {
+			return errors.New("failed to record interest payout")
+		}
+		result := tx.Model(&models.InterestAccrual{}).Where("id IN ? AND payout_id IS NULL", ids).Update("payout_id", payout.ID)
+		if result.Error != nil || int(result.RowsAffected) != len(ids) {
+			return errors.New("interest accruals changed while being paid")
+		}
+		if !payout.Amount.IsPositive() {
+			return nil
+		}
+
+		monthStart, _ := time.ParseInLocation(interestMonthLayout, month, time.Local)
+		description := "Interest on " + goal.Name + " pocket for " + monthStart.Format("January 2006")
+		walletCode := walletAccountCode(pocket.WalletID)
+		entry, err := postJournal(tx, models.JournalTypeInterest, description,
+			debit(platformCode(models.LedgerPlatformInterest, pocket.Currency), payout.Amount),
+			credit(walletCode, payout.Amount),
+			debit(walletCode, payout.Amount),
+			credit(pocketAccountCode(pocket.ID), payout.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		interest := models.Transaction{
+			WalletID:       pocket.WalletID,
+			ToUserID:       &pocket.UserID,
+			Type:           models.TransactionTypeInterest,
+			Amount:         payout.Amount,
+			Currency:       pocket.Currency,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
+		}
+		sweep := models.Transaction{
+			WalletID:       pocket.WalletID,
+			FromUserID:     &pocket.UserID,
+			Type:           models.TransactionTypePocketDeposit,
+			Amount:         payout.Amount,
+			Currency:       pocket.Currency,
+			Description:    "Interest added to " + goal.Name + " pocket",
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
+		}
+		if err := tx.Create(&interest).Error; err != nil {
+			return errors.New("failed to record transaction")
+		}
+		if err := tx.Create(&sweep).Error; err != nil {
+			return errors.New("failed to record transaction")
+		}
+		if err := tx.Model(&payout).Update("transaction_id", interest.ID).Error; err != nil {
+			return errors.New("failed to update interest payout")
+		}
+
+		if err := tx.Where("id = ?", pocket.ID).First(&pocket).Error; err != nil {
+			return errors.New("failed to reload pocket")
+		}
+		if err := updateGoalProgress(tx, &goal, &pocket, true); err != nil {
+			return err
+		}
+		body := "You earned " + payout.Amount.StringFixed(2) + " " + pocket.Currency + " interest on your " + goal.Name + " pocket in " + monthStart.Format("January") + "."
+		if _, err := createNotification(tx, pocket.UserID, "payment", "Interest paid", body, "💰", ""); err != nil {
+			return errors.New("failed to notify user")
+		}
+		return nil
+	})
+}
+
+// RunDaily accrues every day that has ended since the last accrual, going
+// back at most interestCatchUpDays, then pays out finished months. Days
+// missed before that are logged, to be accrued by an admin. It is safe to
+// run any number of times.
+func (s *InterestService) RunDaily() error {
+	now := time.Now()
+	today := startOfDay(now)
+	from := today.AddDate(0, 0, -1)
+	var latest models.InterestAccrual
+	if err := s.db.Order("date DESC").First(&latest).Error; err == nil {
+		if last, err := time.ParseInLocation(interestDateLayout, latest.Date, time.Local); err == nil {
+			if next := last.AddDate(0, 0, 1); next.Before(from) {
+				from = next
+			}
+		}
+	}
+	if oldest := today.AddDate(0, 0, -interestCatchUpDays); from.Before(oldest) {
+		log.Printf("⚠️  Interest was not accrued from %s to %s; accrue those days by hand",
+			from.Format(interestDateLayout), oldest.AddDate(0, 0, -1).Format(interestDateLayout))
+		from = oldest
+	}
+
+	for day := from; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if _, err := s.AccrueDay(day); err != nil {
+			return err
+		}
+	}
+	_, err := s.PayDue(now)
+	return err
+}
+
+// GetSummary reports a user's savings interest for a year
+func (s *InterestService) GetSummary(userID string, year int) (*InterestSummary, error) {
+	apy, err := rateOn(s.db, time.Now().Format(interestDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	summary := &InterestSummary{Year: year, APY: apy, PaidYTD: decimal.Zero, Accrued: decimal.Zero, Months: []InterestMonth{}, Pockets: []PocketInterest{}}
+
+	var pockets []models.Pocket
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&pockets).Error; err != nil {
+		return nil, errors.New("failed to fetch pockets")
+	}
+	var payouts []models.InterestPayout
+	if err := s.db.Where("user_id = ? AND month LIKE ?", userID, strconv.Itoa(year)+"-%").
+		Order("month ASC").Find(&payouts).Error; err != nil {
+		return nil, errors.New("failed to fetch interest payouts")
+	}
+	var unpaid []models.InterestAccrual
+	if err := s.db.Where("user_id = ? AND payout_id IS NULL", userID).Find(&unpaid).Error; err != nil {
+		return nil, errors.New("failed to fetch interest accruals")
+	}
+
+	byPocket := make(map[string]*PocketInterest)
+	for _, p := range pockets {
+		var goal models.BudgetGoal
+		s.db.Unscoped().Where("id = ?", p.GoalID).First(&goal)
+		// Unpaid interest starts from whatever the last payout carried over
+		accrued := decimal.Zero
+		var last models.InterestPayout
+		if err := s.db.Where("pocket_id = ?", p.ID).Order("month DESC").First(&last).Error; err == nil {
+			accrued = last.Remainder
+		}
+		summary.Pockets = append(summary.Pockets, PocketInterest{
+			PocketID: p.ID, GoalID: p.GoalID, GoalName: goal.Name, Balance: p.Balance, Paid: decimal.Zero, Accrued: accrued,
+		})
+	}
+	for i := range summary.Pockets {
+		byPocket[summary.Pockets[i].PocketID] = &summary.Pockets[i]
+	}
+
+	for _, p := range payouts {
+		summary.PaidYTD = summary.PaidYTD.Add(p.Amount)
+		if n := len(summary.Months); n > 0 && summary.Months[n-1].Month == p.Month {
+			summary.Months[n-1].Amount = summary.Months[n-1].Amount.Add(p.Amount)
+		} else {
+			summary.Months = append(summary.Months, InterestMonth{Month: p.Month, Amount: p.Amount})
+		}
+		if pocket, ok := byPocket[p.PocketID]; ok {
+			pocket.Paid = pocket.Paid.Add(p.Amount)
+		}
+	}
+	for _, a := range unpaid {
+		if pocket, ok := byPocket[a.PocketID]; ok {
+			pocket.Accrued = pocket.Accrued.Add(a.Amount)
+		}
+	}
+	for i := range summary.Pockets {
+		summary.Pockets[i].Accrued = summary.Pockets[i].Accrued.RoundDown(2)
+		summary.Accrued = summary.Accrued.Add(summary.Pockets[i].Accrued)
+	}
+	summary.Reportable = summary.PaidYTD.GreaterThanOrEqual(interestReportable)
+	return summary, nil
+}
+
+// rateOn returns the APY in force on a date, or zero before the first rate
+func rateOn(db *gorm.DB, date string) (decimal.Decimal, error) {
+	var rate models.InterestRate
+	err := db.Where("effective_from <= ?", date).Order("effective_from DESC").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, errors.New("failed to fetch interest rate")
+	}
+	return rate.APY, nil
+}
+
+// dailyRate is the rate that, compounded daily over a year of days, grows a
+// balance by apy percent
+func dailyRate(apy decimal.Decimal, days int) (decimal.Decimal, error) {
+	if apy.IsZero() {
+		return decimal.Zero, nil
+	}
+	one := decimal.NewFromInt(1)
+	growth := one.Add(apy.Shift(-2))
+	root, err := growth.PowWithPrecision(one.DivRound(decimal.NewFromInt(int64(days)), 30), 24)
+	if err != nil {
+		return decimal.Zero, errors.New("failed to compute daily interest rate")
+	}
+	return root.Sub(one).Round(20), nil
+}
+
+// pocketBalance is a pocket's balance at a point in time
+type pocketBalance struct {
+	PocketID string
+	UserID   string
+	Balance  decimal.Decimal
+}
+
+// pocketBalancesAt replays the ledger to find every pocket's balance just
+// before at. Pockets of deleted goals are left out.
+func pocketBalancesAt(db *gorm.DB, at time.Time) ([]pocketBalance, error) {
+	var balances []pocketBalance
+	err := db.Table("pockets").
+		Select("pockets.id AS pocket_id, pockets.user_id AS user_id, "+
+			"SUM(CASE WHEN postings.direction = ? THEN postings.amount ELSE -postings.amount END) AS balance", models.PostingCredit).
+		Joins("JOIN budget_goals ON budget_goals.id = pockets.goal_id AND budget_goals.deleted_at IS NULL").
+		Joins("JOIN ledger_accounts ON ledger_accounts.pocket_id = pockets.id").
+		Joins("JOIN postings ON postings.account_id = ledger_accounts.id AND postings.created_at < ?", at).
+		Group("pockets.id, pockets.user_id").
+		Scan(&balances).Error
+	if err != nil {
+		return nil, errors.New("failed to compute pocket balances")
+	}
+	return balances, nil
+}
+
+// startOfDay is midnight at the start of t's day, server local time
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
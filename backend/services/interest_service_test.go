@@ -0,0 +1,209 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBInterest() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{},
+		&models.BudgetGoal{}, &models.Pocket{},
+		&models.InterestRate{}, &models.InterestAccrual{}, &models.InterestPayout{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func localDay(date string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+	return t
+}
+
+func TestInterestAccruesDailyAndPaysMonthly(t *testing.T) {
+	db := setupTestDBInterest()
+	alice, _ := seedRefundUsers(t, db)
+	bs := services.NewBudgetService(db)
+	is := services.NewInterestService(db)
+	ls := services.NewLedgerService(db)
+
+	db.Create(&models.InterestRate{APY: decimal.NewFromInt(5), EffectiveFrom: "2025-01-01"})
+	db.Create(&models.InterestRate{APY: decimal.RequireFromString("3.65"), EffectiveFrom: "2025-03-16"})
+
+	goal, err := bs.CreateGoal(alice.ID, models.CreateGoalRequest{Name: "Vacation", Category: "vacation", TargetAmount: 1000})
+	assert.NoError(t, err)
+	_, err = bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 100})
+	assert.NoError(t, err)
+	// The money went in on the 27th of February
+	db.Model(&models.Posting{}).Where("1 = 1").Update("created_at", localDay("2025-02-27").Add(12*time.Hour))
+
+	n, err := is.AccrueDay(localDay("2025-02-26"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "the pocket was empty that day")
+	for _, d := range []string{"2025-02-27", "2025-02-28", "2025-03-01"} {
+		n, err = is.AccrueDay(localDay(d))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	n, err = is.AccrueDay(localDay("2025-02-28"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "rerunning a day records nothing")
+	_, err = is.AccrueDay(time.Now())
+	assert.EqualError(t, err, "interest can only be accrued for days that have ended")
+
+	// Daily accruals compound to exactly the APY over the year
+	var first models.InterestAccrual
+	db.Where("date = ?", "2025-02-27").First(&first)
+	assert.True(t, first.Balance.Equal(decimal.NewFromInt(100)))
+	daily := first.Amount.Div(first.Balance)
+	yearly, _ := decimal.NewFromInt(1).Add(daily).PowInt32(365)
+	assert.True(t, yearly.Sub(decimal.RequireFromString("1.05")).Abs().LessThan(decimal.RequireFromString("0.000001")), yearly.String())
+
+	// February is paid in March; March's first day waits for April
+	paid, err := is.PayDue(localDay("2025-03-05"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, paid)
+	paid, err = is.PayDue(localDay("2025-03-05"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, paid, "paying again does nothing")
+
+	var feb models.InterestPayout
+	assert.NoError(t, db.Where("month = ?", "2025-02").First(&feb).Error)
+	assert.True(t, feb.Amount.Equal(decimal.RequireFromString("0.02")), feb.Amount.String())
+	assert.True(t, feb.Amount.Add(feb.Remainder).Equal(feb.Accrued))
+	assert.NotNil(t, feb.TransactionID)
+
+	var interest models.Transaction
+	db.Where("id = ?", *feb.TransactionID).First(&interest)
+	assert.Equal(t, models.TransactionTypeInterest, interest.Type)
+	assert.Equal(t, "Interest on Vacation pocket for February 2025", interest.Description)
+	var pocket models.Pocket
+	db.Where("goal_id = ?", goal.ID).First(&pocket)
+	assert.True(t, pocket.Balance.Equal(decimal.RequireFromString("100.02")))
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(100)), "interest is swept into the pocket")
+
+	// A paid month is closed to late accruals
+	db.Where("date = ?", "2025-02-28").Delete(&models.InterestAccrual{})
+	n, err = is.AccrueDay(localDay("2025-02-28"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// March uses the old rate until the 15th and the new one after
+	for d := localDay("2025-03-02"); d.Month() == time.March; d = d.AddDate(0, 0, 1) {
+		_, err = is.AccrueDay(d)
+		assert.NoError(t, err)
+	}
+	var mid, late models.InterestAccrual
+	db.Where("date = ?", "2025-03-15").First(&mid)
+	db.Where("date = ?", "2025-03-16").First(&late)
+	assert.True(t, mid.APY.Equal(decimal.NewFromInt(5)))
+	assert.True(t, late.APY.Equal(decimal.RequireFromString("3.65")))
+	assert.True(t, late.Amount.LessThan(mid.Amount))
+
+	paid, err = is.PayDue(localDay("2025-04-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, paid)
+	var mar models.InterestPayout
+	db.Where("month = ?", "2025-03").First(&mar)
+	assert.True(t, mar.CarriedIn.Equal(feb.Remainder), "fractions of a cent carry over")
+	assert.True(t, mar.Amount.Add(mar.Remainder).Equal(mar.Accrued.Add(mar.CarriedIn)))
+	var marchDays int64
+	db.Model(&models.InterestAccrual{}).Where("payout_id = ?", mar.ID).Count(&marchDays)
+	assert.Equal(t, int64(31), marchDays)
+
+	summary, err := is.GetSummary(alice.ID, 2025)
+	assert.NoError(t, err)
+	assert.True(t, summary.PaidYTD.Equal(feb.Amount.Add(mar.Amount)))
+	assert.Len(t, summary.Months, 2)
+	assert.Len(t, summary.Pockets, 1)
+	assert.Equal(t, "Vacation", summary.Pockets[0].GoalName)
+	assert.True(t, summary.Pockets[0].Accrued.Equal(mar.Remainder.RoundDown(2)))
+	assert.False(t, summary.Reportable)
+	empty, _ := is.GetSummary(alice.ID, 2024)
+	assert.True(t, empty.PaidYTD.IsZero())
+
+	var notifications int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title = ?", alice.ID, "Interest paid").Count(&notifications)
+	assert.Equal(t, int64(2), notifications)
+	var notice models.Notification
+	db.Where("user_id = ? AND title = ?", alice.ID, "Interest paid").Order("created_at").First(&notice)
+	assert.Equal(t, "You earned 0.02 USD interest on your Vacation pocket in February.", notice.Body)
+
+	tb, _ := ls.GetTrialBalance()
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformInterest {
+			assert.True(t, a.Balance.Equal(summary.PaidYTD), a.Balance.String())
+		}
+	}
+	checks, _ := ls.CheckWallets()
+	for _, c := range checks {
+		assert.True(t, c.Matches)
+	}
+}
+
+func TestInterestRateHistory(t *testing.T) {
+	db := setupTestDBInterest()
+	is := services.NewInterestService(db)
+
+	assert.NoError(t, is.EnsureRate("4.1"))
+	assert.NoError(t, is.EnsureRate("9"), "an existing history is kept")
+	rates, _ := is.GetRates()
+	assert.Len(t, rates, 1)
+	assert.True(t, rates[0].APY.Equal(decimal.RequireFromString("4.1")))
+
+	apy := 4.5
+	_, err := is.SetRate("admin", models.SetInterestRateRequest{APY: &apy, EffectiveFrom: "2025-01-01"})
+	assert.EqualError(t, err, "a rate change cannot take effect in the past")
+	next := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+	rate, err := is.SetRate("admin", models.SetInterestRateRequest{APY: &apy, EffectiveFrom: next, Note: "Fed hike"})
+	assert.NoError(t, err)
+	apy = 4.75
+	changed, err := is.SetRate("admin", models.SetInterestRateRequest{APY: &apy, EffectiveFrom: next})
+	assert.NoError(t, err)
+	assert.Equal(t, rate.ID, changed.ID, "a pending change can be revised")
+	assert.True(t, changed.APY.Equal(decimal.RequireFromString("4.75")))
+
+	rates, _ = is.GetRates()
+	assert.Len(t, rates, 2)
+	assert.Equal(t, next, rates[0].EffectiveFrom)
+	summary, _ := is.GetSummary("nobody", time.Now().Year())
+	assert.True(t, summary.APY.Equal(decimal.RequireFromString("4.1")), "the new rate is not in force yet")
+}
+
+func TestInterestCatchUpIsBounded(t *testing.T) {
+	db := setupTestDBInterest()
+	alice, _ := seedRefundUsers(t, db)
+	bs := services.NewBudgetService(db)
+	is := services.NewInterestService(db)
+
+	db.Create(&models.InterestRate{APY: decimal.NewFromInt(5), EffectiveFrom: "2000-01-01"})
+	goal, _ := bs.CreateGoal(alice.ID, models.CreateGoalRequest{Name: "Vacation", Category: "vacation", TargetAmount: 1000})
+	_, err := bs.MoveToPocket(alice.ID, goal.ID, models.PocketMoveRequest{Amount: 100})
+	assert.NoError(t, err)
+	today := localDay(time.Now().Format("2006-01-02"))
+	db.Model(&models.Posting{}).Where("1 = 1").Update("created_at", today.AddDate(0, 0, -90))
+
+	// The job last ran 60 days ago: only the last 45 days are filled in
+	n, err := is.AccrueDay(today.AddDate(0, 0, -60))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, is.RunDaily())
+
+	var missed, caughtUp int64
+	db.Model(&models.InterestAccrual{}).Where("date > ? AND date < ?",
+		today.AddDate(0, 0, -60).Format("2006-01-02"), today.AddDate(0, 0, -45).Format("2006-01-02")).Count(&missed)
+	db.Model(&models.InterestAccrual{}).Where("date >= ?", today.AddDate(0, 0, -45).Format("2006-01-02")).Count(&caughtUp)
+	assert.Zero(t, missed)
+	assert.Equal(t, int64(45), caughtUp)
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerService exposes the double-entry ledger for reporting and checks.
+// Money-moving services post through postJournal inside their own DB transaction.
+type LedgerService struct {
+	db *gorm.DB
+}
+
+// NewLedgerService creates a new LedgerService
+func NewLedgerService(db *gorm.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// platformAccount describes a platform ledger account created on first use
+type platformAccount struct {
+	name        string
+	accountType string
+}
+
+var platformAccounts = map[string]platformAccount{
+	models.LedgerPlatformCash:         {"Settlement Bank Cash", models.LedgerAccountAsset},
+	models.LedgerPlatformBillers:      {"Biller Payables", models.LedgerAccountLiability},
+	models.LedgerPlatformFees:         {"Merchant Fee Revenue", models.LedgerAccountRevenue},
+	models.LedgerPlatformCashback:     {"Cashback Expense", models.LedgerAccountExpense},
+	models.LedgerPlatformLoans:        {"Loans Receivable", models.LedgerAccountAsset},
+	models.LedgerPlatformLoanInterest: {"Loan Interest Revenue", models.LedgerAccountRevenue},
+	models.LedgerPlatformOpening:      {"Opening Balance Equity", models.LedgerAccountEquity},
+	models.LedgerPlatformFX:           {"FX Position", models.LedgerAccountEquity},
+	models.LedgerPlatformCardNetwork:  {"Card Network Payables", models.LedgerAccountLiability},
+	models.LedgerPlatformProcessor:    {"Card Processor Receivable", models.LedgerAccountAsset},
+	models.LedgerPlatformInterest:     {"Savings Interest Expense", models.LedgerAccountExpense},
+	models.LedgerPlatformClaims:       {"Unclaimed Transfers Escrow", models.LedgerAccountLiability},
+}
+
+// platformCode returns the code of a platform account in a currency. Default
+// currency accounts keep their bare code; others are suffixed, e.g.
+// "platform:cash:EUR", so every currency balances on its own.
+func platformCode(code, currency string) string {
+	if currency == "" || currency == models.DefaultCurrency {
+		return code
+	}
+	return code + ":" + currency
+}
+
+// lookupPlatformAccount resolves a possibly currency-suffixed platform code
+func lookupPlatformAccount(code string) (platformAccount, string, bool) {
+	if def, ok := platformAccounts[code]; ok {
+		return def, models.DefaultCurrency, true
+	}
+	i := strings.LastIndex(code, ":")
+	if i < 0 {
+		return platformAccount{}, "", false
+	}
+	def, ok := platformAccounts[code[:i]]
+	if !ok || !models.IsSupportedCurrency(code[i+1:]) {
+		return platformAccount{}, "", false
+	}
+	return def, code[i+1:], true
+}
+
+// journalLine is a single debit or credit against a ledger account code
+type journalLine struct {
+	code      string
+	direction string
+	amount    decimal.Decimal
+}
+
+func debit(code string, amount decimal.Decimal) journalLine {
+	return journalLine{code: code, direction: models.PostingDebit, amount: amount}
+}
+
+func credit(code string, amount decimal.Decimal) journalLine {
+	return journalLine{code: code, direction: models.PostingCredit, amount: amount}
+}
+
+// walletAccountCode returns the ledger account code mirroring a wallet
+func walletAccountCode(walletID string) string {
+	return "wallet:" + walletID
+}
+
+// pocketAccountCode returns the ledger account code mirroring a savings pocket
+func pocketAccountCode(pocketID string) string {
+	return "pocket:" + pocketID
+}
+
+// postJournal writes a balanced journal entry inside tx and applies every
+// wallet and pocket posting to the cached balance. Callers must reload any
+// wallet or pocket they hold in memory afterwards.
+func postJournal(tx *gorm.DB, entryType, description string, lines ...journalLine) (*models.JournalEntry, error) {
+	if len(lines) < 2 {
+		return nil, errors.New("journal entry needs at least two postings")
+	}
+
+	accounts := make(map[string]*models.LedgerAccount)
+	totals := make(map[string]decimal.Decimal) // currency -> debits minus credits
+	for _, line := range lines {
+		if line.amount.LessThanOrEqual(decimal.Zero) {
+			return nil, errors.New("posting amount must be greater than 0")
+		}
+		if !line.amount.Equal(line.amount.Round(2)) {
+			return nil, errors.New("amount must have at most 2 decimal places")
+		}
+
+		account, ok := accounts[line.code]
+		if !ok {
+			var err error
+			if account, err = ensureLedgerAccount(tx, line.code); err != nil {
+				return nil, err
+			}
+			accounts[line.code] = account
+		}
+
+		if line.direction == models.PostingDebit {
+			totals[account.Currency] = totals[account.Currency].Add(line.amount)
+		} else {
+			totals[account.Currency] = totals[account.Currency].Sub(line.amount)
+		}
+	}
+	for currency, net := range totals {
+		if !net.IsZero() {
+			return nil, fmt.Errorf("unbalanced journal entry: %s debits and credits differ by %s", currency, net.String())
+		}
+	}
+
+	entry := models.JournalEntry{Type: entryType, Description: description}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, errors.New("failed to create journal entry")
+	}
+
+	walletDeltas := make(map[string]decimal.Decimal)
+	pocketDeltas := make(map[string]decimal.Decimal)
+	for _, line := range lines {
+		account := accounts[line.code]
+		posting := models.Posting{
+			JournalEntryID: entry.ID,
+			AccountID:      account.ID,
+			Direction:      line.direction,
+			Amount:         line.amount,
+		}
+		if err := tx.Create(&posting).Error; err != nil {
+			return nil, errors.New("failed to create posting")
+		}
+		entry.Postings = append(entry.Postings, posting)
+
+		if account.WalletID != nil {
+			// Wallet accounts are liabilities: credits raise the balance
+			delta := line.amount
+			if line.direction == models.PostingDebit {
+				delta = delta.Neg()
+			}
+			walletDeltas[*account.WalletID] = walletDeltas[*account.WalletID].Add(delta)
+		}
+		if account.PocketID != nil {
+			delta := line.amount
+			if line.direction == models.PostingDebit {
+				delta = delta.Neg()
+			}
+			pocketDeltas[*account.PocketID] = pocketDeltas[*account.PocketID].Add(delta)
+		}
+	}
+
+	walletIDs := make([]string, 0, len(walletDeltas))
+	for id := range walletDeltas {
+		walletIDs = append(walletIDs, id)
+	}
+	sort.Strings(walletIDs)
+
+	for _, id := range walletIDs {
+		var wallet models.Wallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&wallet).Error; err != nil {
+			return nil, errors.New("wallet not found")
+		}
+		newBalance := wallet.Balance.Add(walletDeltas[id])
+		// Debits may not dip into funds reserved by holds
+		if newBalance.IsNegative() || (walletDeltas[id].IsNegative() && newBalance.LessThan(wallet.HeldBalance)) {
+			return nil, errors.New("insufficient balance")
+		}
+		if err := tx.Model(&wallet).Update("balance", newBalance).Error; err != nil {
+			return nil, errors.New("failed to update balance")
+		}
+	}
+
+	// Pockets are locked after wallets, keeping one lock order
+	pocketIDs := make([]string, 0, len(pocketDeltas))
+	for id := range pocketDeltas {
+		pocketIDs = append(pocketIDs, id)
+	}
+	sort.Strings(pocketIDs)
+
+	for _, id := range pocketIDs {
+		var pocket models.Pocket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&pocket).Error; err != nil {
+			return nil, errors.New("pocket not found")
+		}
+		newBalance := pocket.Balance.Add(pocketDeltas[id])
+		if newBalance.IsNegative() {
+			return nil, errors.New("insufficient pocket balance")
+		}
+		if err := tx.Model(&pocket).Update("balance", newBalance).Error; err != nil {
+			return nil, errors.New("failed to update pocket balance")
+		}
+	}
+
+	return &entry, nil
+}
+
+// ensureLedgerAccount returns the account for a code, creating wallet and
+// platform accounts the first time they are used
+func ensureLedgerAccount(tx *gorm.DB, code string) (*models.LedgerAccount, error) {
+	var account models.LedgerAccount
+	if err := tx.Where("code = ?", code).First(&account).Error; err == nil {
+		return &account, nil
+	}
+
+	account = models.LedgerAccount{Code: code, Currency: models.DefaultCurrency}
+	if walletID, ok := strings.CutPrefix(code, "wallet:"); ok {
+		var wallet models.Wallet
+		if err := tx.Where("id = ?", walletID).First(&wallet).Error; err != nil {
+			return nil, errors.New("wallet not found")
+		}
+		account.Name = "Wallet " + wallet.ID
+		account.Type = models.LedgerAccountLiability
+		account.WalletID = &wallet.ID
+		if wallet.Currency != "" {
+			account.Currency = wallet.Currency
+		}
+	} else if pocketID, ok := strings.CutPrefix(code, "pocket:"); ok {
+		var pocket models.Pocket
+		if err := tx.Where("id = ?", pocketID).First(&pocket).Error; err != nil {
+			return nil, errors.New("pocket not found")
+		}
+		account.Name = "Pocket " + pocket.ID
+		account.Type = models.LedgerAccountLiability
+		account.PocketID = &pocket.ID
+		if pocket.Currency != "" {
+			account.Currency = pocket.Currency
+		}
+	} else if def, currency, ok := lookupPlatformAccount(code); ok {
+		account.Name = def.name
+		account.Type = def.accountType
+		account.Currency = currency
+		if currency != models.DefaultCurrency {
+			account.Name += " (" + currency + ")"
+		}
+	} else {
+		return nil, fmt.Errorf("unknown ledger account %s", code)
+	}
+
+	// Another transaction may create the same account concurrently
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, errors.New("failed to create ledger account")
+	}
+	if err := tx.Where("code = ?", code).First(&account).Error; err != nil {
+		return nil, errors.New("failed to load ledger account")
+	}
+	return &account, nil
+}
+
+// AccountBalance is one line of the trial balance
+type AccountBalance struct {
+	AccountID string          `json:"account_id"`
+	Code      string          `json:"code"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Currency  string          `json:"currency"`
+	Debits    decimal.Decimal `json:"debits"`
+	Credits   decimal.Decimal `json:"credits"`
+	Balance   decimal.Decimal `json:"balance"` // on the account's normal side
+}
+
+// TrialBalance is the ledger-wide sum of debits and credits
+type TrialBalance struct {
+	Accounts     []AccountBalance `json:"accounts"`
+	TotalDebits  decimal.Decimal  `json:"total_debits"`
+	TotalCredits decimal.Decimal  `json:"total_credits"`
+	Balanced     bool             `json:"balanced"`
+}
+
+// WalletLedgerCheck compares a wallet's cached balance with its postings
+type WalletLedgerCheck struct {
+	WalletID      string          `json:"wallet_id"`
+	UserID        string          `json:"user_id"`
+	StoredBalance decimal.Decimal `json:"stored_balance"`
+	LedgerBalance decimal.Decimal `json:"ledger_balance"`
+	Matches       bool            `json:"matches"`
+}
+
+type postingTotals struct {
+	AccountID string
+	Debits    decimal.Decimal
+	Credits   decimal.Decimal
+}
+
+func (s *LedgerService) postingTotals() (map[string]postingTotals, error) {
+	var rows []postingTotals
+	err := s.db.Model(&models.Posting{}).
+		Select("account_id, " +
+			"COALESCE(SUM(CASE WHEN direction = 'debit' THEN amount ELSE 0 END), 0) AS debits, " +
+			"COALESCE(SUM(CASE WHEN direction = 'credit' THEN amount ELSE 0 END), 0) AS credits").
+		Group("account_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, errors.New("failed to sum postings")
+	}
+
+	// Some databases sum decimals as floats; postings are whole cents
+	totals := make(map[string]postingTotals, len(rows))
+	for _, r := range rows {
+		r.Debits = r.Debits.Round(2)
+		r.Credits = r.Credits.Round(2)
+		totals[r.AccountID] = r
+	}
+	return totals, nil
+}
+
+// GetTrialBalance returns every ledger account with its debit and credit totals
+func (s *LedgerService) GetTrialBalance() (*TrialBalance, error) {
+	var accounts []models.LedgerAccount
+	if err := s.db.Order("code").Find(&accounts).Error; err != nil {
+		return nil, errors.New("failed to fetch ledger accounts")
+	}
+
+	totals, err := s.postingTotals()
+	if err != nil {
+		return nil, err
+	}
+
+	result := TrialBalance{Accounts: []AccountBalance{}}
+	for _, a := range accounts {
+		t := totals[a.ID]
+		balance := t.Debits.Sub(t.Credits)
+		if a.Type == models.LedgerAccountLiability || a.Type == models.LedgerAccountEquity || a.Type == models.LedgerAccountRevenue {
+			balance = balance.Neg()
+		}
+		result.Accounts = append(result.Accounts, AccountBalance{
+			AccountID: a.ID,
+			Code:      a.Code,
+			Name:      a.Name,
+			Type:      a.Type,
+			Currency:  a.Currency,
+			Debits:    t.Debits,
+			Credits:   t.Credits,
+			Balance:   balance,
+		})
+		result.TotalDebits = result.TotalDebits.Add(t.Debits)
+		result.TotalCredits = result.TotalCredits.Add(t.Credits)
+	}
+	result.Balanced = result.TotalDebits.Equal(result.TotalCredits)
+
+	return &result, nil
+}
+
+// CheckWallets compares every wallet's stored balance against its ledger postings
+func (s *LedgerService) CheckWallets() ([]WalletLedgerCheck, error) {
+	var wallets []models.Wallet
+	if err := s.db.Order("created_at").Find(&wallets).Error; err != nil {
+		return nil, errors.New("failed to fetch wallets")
+	}
+
+	var accounts []models.LedgerAccount
+	if err := s.db.Where("wallet_id IS NOT NULL").Find(&accounts).Error; err != nil {
+		return nil, errors.New("failed to fetch ledger accounts")
+	}
+	accountByWallet := make(map[string]string, len(accounts))
+	for _, a := range accounts {
+		accountByWallet[*a.WalletID] = a.ID
+	}
+
+	totals, err := s.postingTotals()
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []WalletLedgerCheck{}
+	for _, w := range wallets {
+		t := totals[accountByWallet[w.ID]]
+		ledgerBalance := t.Credits.Sub(t.Debits)
+		checks = append(checks, WalletLedgerCheck{
+			WalletID:      w.ID,
+			UserID:        w.UserID,
+			StoredBalance: w.Balance,
+			LedgerBalance: ledgerBalance,
+			Matches:       w.Balance.Equal(ledgerBalance),
+		})
+	}
+	return checks, nil
+}
+
+// BackfillOpeningBalances posts an opening entry for wallets that held money
+// before the ledger existed, so their postings add up to the stored balance
+func (s *LedgerService) BackfillOpeningBalances() (int, error) {
+	checks, err := s.CheckWallets()
+	if err != nil {
+		return 0, err
+	}
+
+	backfilled := 0
+	for _, c := range checks {
+		diff := c.StoredBalance.Sub(c.LedgerBalance)
+		if c.Matches || !c.LedgerBalance.IsZero() || !diff.IsPositive() {
+			// Only untouched wallets are backfilled; anything else is a real mismatch
+			continue
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			walletAccount, err := ensureLedgerAccount(tx, walletAccountCode(c.WalletID))
+			if err != nil {
+				return err
+			}
+			openingAccount, err := ensureLedgerAccount(tx, platformCode(models.LedgerPlatformOpening, walletAccount.Currency))
+			if err != nil {
+				return err
+			}
+
+			// Postings are written directly: the wallet already holds this balance
+			entry := models.JournalEntry{
+				Type:        models.JournalTypeOpeningBalance,
+				Description: "Opening balance for wallet " + c.WalletID,
+			}
+			if err := tx.Create(&entry).Error; err != nil {
+				return err
+			}
+			postings := []models.Posting{
+				{JournalEntryID: entry.ID, AccountID: openingAccount.ID, Direction: models.PostingDebit, Amount: diff},
+				{JournalEntryID: entry.ID, AccountID: walletAccount.ID, Direction: models.PostingCredit, Amount: diff},
+			}
+			return tx.Create(&postings).Error
+		})
+		if err != nil {
+			return backfilled, errors.New("failed to backfill opening balance")
+		}
+		backfilled++
+	}
+	return backfilled, nil
+}
@@ -0,0 +1,119 @@
+package services_test
+
+import (
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBLedger() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Hold{}, &models.LimitUsage{}, &models.Biller{}, &models.BillPayment{},
+		&models.SavedBiller{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func TestLedgerPostsDepositsAndWithdrawals(t *testing.T) {
+	db := setupTestDBLedger()
+	ws := services.NewWalletService(db, nil)
+	ls := services.NewLedgerService(db)
+
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+
+	wallet := deposit(t, db, "u1", 120)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(120)))
+
+	wallet, err := ws.Withdraw("u1", services.WithdrawInput{Amount: 20.5, LinkedAccountID: bankAccount(t, db, "u1")})
+	assert.NoError(t, err)
+	assert.True(t, wallet.Available().Equal(decimal.NewFromFloat(99.5)))
+
+	var txn models.Transaction
+	db.Where("wallet_id = ? AND type = ?", wallet.ID, models.TransactionTypeDeposit).First(&txn)
+	assert.NotNil(t, txn.JournalEntryID)
+
+	checks, err := ls.CheckWallets()
+	assert.NoError(t, err)
+	assert.Len(t, checks, 1)
+	assert.True(t, checks[0].Matches)
+	assert.True(t, checks[0].LedgerBalance.Equal(decimal.NewFromInt(120)), "held until the payout settles")
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		// The withdrawal is only held, so the cash has not left yet
+		if a.Code == models.LedgerPlatformCash {
+			assert.True(t, a.Balance.Equal(decimal.NewFromInt(120)))
+		}
+	}
+}
+
+func TestLedgerRejectsOverdraft(t *testing.T) {
+	db := setupTestDBLedger()
+	ws := services.NewWalletService(db, nil)
+
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+
+	_, err := ws.Withdraw("u1", services.WithdrawInput{Amount: 10, LinkedAccountID: bankAccount(t, db, "u1")})
+	assert.Error(t, err)
+
+	var postings int64
+	db.Model(&models.Posting{}).Count(&postings)
+	assert.Equal(t, int64(0), postings)
+}
+
+func TestLedgerBillPaymentCreditsBillerPayables(t *testing.T) {
+	db := setupTestDBLedger()
+	bs := services.NewBillService(db, services.NewRewardService(db), nil)
+	ls := services.NewLedgerService(db)
+
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+	biller := models.Biller{Name: "Gainesville Water", Category: "water", IsActive: true}
+	db.Create(&biller)
+
+	deposit(t, db, "u1", 50)
+
+	resp, err := bs.PayBill("u1", services.BillPayInput{BillerID: biller.ID, AccountNumber: "A-1", Amount: 30})
+	assert.NoError(t, err)
+	assert.True(t, resp.NewBalance.Equal(decimal.NewFromInt(20)))
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformBillers {
+			assert.True(t, a.Balance.Equal(decimal.NewFromInt(30)))
+		}
+	}
+}
+
+func TestLedgerBackfillOpeningBalances(t *testing.T) {
+	db := setupTestDBLedger()
+	ls := services.NewLedgerService(db)
+
+	db.Create(&models.Wallet{UserID: "u1", Balance: decimal.NewFromInt(75), IsActive: true})
+	db.Create(&models.Wallet{UserID: "u2", IsActive: true})
+
+	n, err := ls.BackfillOpeningBalances()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	checks, err := ls.CheckWallets()
+	assert.NoError(t, err)
+	for _, c := range checks {
+		assert.True(t, c.Matches)
+	}
+
+	// Running again is a no-op
+	n, err = ls.BackfillOpeningBalances()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LimitService enforces the daily, weekly and monthly spending limits of
+// each KYC tier and reports how much of them a user has left. Payments are
+// valued in USD; other currencies are converted at the mid-market rate.
+type LimitService struct {
+	db *gorm.DB
+	fx *FXService
+}
+
+// NewLimitService creates a new LimitService
+func NewLimitService(db *gorm.DB, fx *FXService) *LimitService {
+	return &LimitService{db: db, fx: fx}
+}
+
+// limitPeriods maps each period to the rolling window it covers
+var limitPeriods = []struct {
+	name   string
+	window time.Duration
+}{
+	{models.LimitPeriodDaily, 24 * time.Hour},
+	{models.LimitPeriodWeekly, 7 * 24 * time.Hour},
+	{models.LimitPeriodMonthly, 30 * 24 * time.Hour},
+}
+
+var limitCategories = []string{
+	models.LimitCategoryP2P,
+	models.LimitCategoryWithdrawal,
+	models.LimitCategoryBill,
+	models.LimitCategoryQR,
+}
+
+// defaultLimits are seeded for any tier, category and period without a
+// configured limit. Rejected users cannot send money at all.
+var defaultLimits = map[string]map[string][3]int64{
+	models.KYCPending: {
+		models.LimitCategoryP2P:        {500, 1000, 2000},
+		models.LimitCategoryWithdrawal: {200, 1000, 2000},
+		models.LimitCategoryBill:       {500, 1500, 3000},
+		models.LimitCategoryQR:         {300, 1000, 2000},
+	},
+	models.KYCVerified: {
+		models.LimitCategoryP2P:        {5000, 20000, 50000},
+		models.LimitCategoryWithdrawal: {5000, 20000, 50000},
+		models.LimitCategoryBill:       {5000, 15000, 30000},
+		models.LimitCategoryQR:         {2000, 10000, 25000},
+	},
+	models.KYCRejected: {
+		models.LimitCategoryP2P:        {0, 0, 0},
+		models.LimitCategoryWithdrawal: {0, 0, 0},
+		models.LimitCategoryBill:       {0, 0, 0},
+		models.LimitCategoryQR:         {0, 0, 0},
+	},
+}
+
+// SetLimitInput is the DTO for configuring one limit
+type SetLimitInput struct {
+	KYCStatus string   `json:"kyc_status" binding:"required"`
+	Category  string   `json:"category" binding:"required"`
+	Period    string   `json:"period" binding:"required"`
+	Amount    *float64 `json:"amount" binding:"required"`
+}
+
+// RemainingLimit is how much of one limit a user has used and has left
+type RemainingLimit struct {
+	Category  string          `json:"category"`
+	Period    string          `json:"period"`
+	Limit     decimal.Decimal `json:"limit"`
+	Used      decimal.Decimal `json:"used"`
+	Remaining decimal.Decimal `json:"remaining"`
+}
+
+// LimitSummary lists every limit that applies to a user
+type LimitSummary struct {
+	KYCStatus string           `json:"kyc_status"`
+	Currency  string           `json:"currency"`
+	Limits    []RemainingLimit `json:"limits"`
+}
+
+// EnsureDefaults seeds the default limits without overwriting configured ones
+func (s *LimitService) EnsureDefaults() error {
+	var limits []models.SpendingLimit
+	for status, categories := range defaultLimits {
+		for category, amounts := range categories {
+			for i, p := range limitPeriods {
+				limits = append(limits, models.SpendingLimit{
+					KYCStatus: status,
+					Category:  category,
+					Period:    p.name,
+					Amount:    decimal.NewFromInt(amounts[i]),
+				})
+			}
+		}
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&limits).Error; err != nil {
+		return errors.New("failed to seed spending limits")
+	}
+	return nil
+}
+
+// GetLimits returns every configured limit
+func (s *LimitService) GetLimits() ([]models.SpendingLimit, error) {
+	var limits []models.SpendingLimit
+	if err := s.db.Order("kyc_status, category, period").Find(&limits).Error; err != nil {
+		return nil, errors.New("failed to fetch spending limits")
+	}
+	return limits, nil
+}
+
+// SetLimit creates or changes the limit for a tier, category and period
+func (s *LimitService) SetLimit(input SetLimitInput) (*models.SpendingLimit, error) {
+	if _, ok := defaultLimits[input.KYCStatus]; !ok {
+		return nil, errors.New("unknown kyc status " + input.KYCStatus)
+	}
+	if !contains(limitCategories, input.Category) {
+		return nil, errors.New("unknown limit category " + input.Category)
+	}
+	if _, ok := periodWindow(input.Period); !ok {
+		return nil, errors.New("unknown limit period " + input.Period)
+	}
+	amount := decimal.NewFromFloat(*input.Amount)
+	if amount.IsNegative() {
+		return nil, errors.New("limit cannot be negative")
+	}
+
+	limit := models.SpendingLimit{KYCStatus: input.KYCStatus, Category: input.Category, Period: input.Period, Amount: amount}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kyc_status"}, {Name: "category"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "updated_at"}),
+	}).Create(&limit).Error; err != nil {
+		return nil, errors.New("failed to save spending limit")
+	}
+	// On conflict the existing row keeps its ID, so read it back
+	var saved models.SpendingLimit
+	if err := s.db.Where("kyc_status = ? AND category = ? AND period = ?", input.KYCStatus, input.Category, input.Period).
+		First(&saved).Error; err != nil {
+		return nil, errors.New("failed to load spending limit")
+	}
+	return &saved, nil
+}
+
+// GetRemaining reports each of a user's limits with what is used and what is left
+func (s *LimitService) GetRemaining(userID string) (*LimitSummary, error) {
+	var user models.User
+	if err := s.db.Select("id", "kyc_status").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	limits, err := s.limitsFor(s.db, user.KYCStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := LimitSummary{KYCStatus: user.KYCStatus, Currency: models.DefaultCurrency, Limits: []RemainingLimit{}}
+	for _, category := range limitCategories {
+		for _, p := range limitPeriods {
+			limit, ok := limits[category+":"+p.name]
+			if !ok {
+				continue
+			}
+			used, err := usageSince(s.db, userID, category, time.Now().Add(-p.window))
+			if err != nil {
+				return nil, err
+			}
+			remaining := limit.Sub(used)
+			if remaining.IsNegative() {
+				remaining = decimal.Zero
+			}
+			summary.Limits = append(summary.Limits, RemainingLimit{
+				Category:  category,
+				Period:    p.name,
+				Limit:     limit,
+				Used:      used,
+				Remaining: remaining,
+			})
+		}
+	}
+	return &summary, nil
+}
+
+// reserve checks an outgoing payment against the sender's limits and counts
+// it towards them inside tx under reference, the hold or transaction that
+// releaseUsage later gives it back by. The user row is locked so concurrent
+// payments by the same user, from any of their wallets, are checked one at a
+// time; callers reserve after locking the wallets involved, keeping a single
+// lock order. A nil LimitService enforces nothing.
+func (s *LimitService) reserve(tx *gorm.DB, userID, category string, amount decimal.Decimal, currency, reference string) error {
+	if s == nil {
+		return nil
+	}
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "kyc_status").
+		Where("id = ?", userID).First(&user).Error; err != nil {
+		return errors.New("user not found")
+	}
+
+	value := amount
+	if currency != "" && currency != models.DefaultCurrency {
+		mid, err := s.fx.MidRate(currency, models.DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		value = amount.Mul(mid).Round(2)
+	}
+
+	limits, err := s.limitsFor(tx, user.KYCStatus)
+	if err != nil {
+		return err
+	}
+	for _, p := range limitPeriods {
+		limit, ok := limits[category+":"+p.name]
+		if !ok {
+			continue
+		}
+		used, err := usageSince(tx, userID, category, time.Now().Add(-p.window))
+		if err != nil {
+			return err
+		}
+		if used.Add(value).GreaterThan(limit) {
+			remaining := limit.Sub(used)
+			if remaining.IsNegative() {
+				remaining = decimal.Zero
+			}
+			return fmt.Errorf("%s %s limit exceeded: %s %s remaining",
+				p.name, category, remaining.StringFixed(2), models.DefaultCurrency)
+		}
+	}
+
+	if err := tx.Create(&models.LimitUsage{UserID: userID, Category: category, Reference: reference, Amount: value}).Error; err != nil {
+		return errors.New("failed to record limit usage")
+	}
+	return nil
+}
+
+// releaseUsage gives back the share of the usage still counted under
+// reference that amount stands for out of outstanding, the part of the
+// payment that had not come back yet, when a payment is refunded or
+// returned or a hold is released without being captured. The release is
+// dated like the usage so it leaves every window with it. Nothing happens
+// when no usage was counted.
+func releaseUsage(tx *gorm.DB, reference string, amount, outstanding decimal.Decimal) error {
+	if reference == "" || !amount.IsPositive() || !outstanding.IsPositive() {
+		return nil
+	}
+	var usages []models.LimitUsage
+	if err := tx.Where("reference = ?", reference).Order("created_at").Find(&usages).Error; err != nil {
+		return errors.New("failed to load limit usage")
+	}
+	if len(usages) == 0 {
+		return nil
+	}
+	left := decimal.Zero
+	for _, u := range usages {
+		left = left.Add(u.Amount)
+	}
+	share := left
+	if amount.LessThan(outstanding) {
+		share = decimal.Min(left, left.Mul(amount).Div(outstanding).Round(2))
+	}
+	if !share.IsPositive() {
+		return nil
+	}
+	release := models.LimitUsage{
+		UserID:    usages[0].UserID,
+		Category:  usages[0].Category,
+		Reference: reference,
+		Amount:    share.Neg(),
+		CreatedAt: usages[0].CreatedAt,
+	}
+	if err := tx.Create(&release).Error; err != nil {
+		return errors.New("failed to release limit usage")
+	}
+	return nil
+}
+
+// moveUsage counts the usage under reference towards another one, when a
+// captured hold becomes a payment that can be refunded
+func moveUsage(tx *gorm.DB, reference, to string) error {
+	if err := tx.Model(&models.LimitUsage{}).Where("reference = ?", reference).Update("reference", to).Error; err != nil {
+		return errors.New("failed to update limit usage")
+	}
+	return nil
+}
+
+// limitsFor loads a tier's limits keyed by "category:period"
+func (s *LimitService) limitsFor(db *gorm.DB, kycStatus string) (map[string]decimal.Decimal, error) {
+	var rows []models.SpendingLimit
+	if err := db.Where("kyc_status = ?", kycStatus).Find(&rows).Error; err != nil {
+		return nil, errors.New("failed to fetch spending limits")
+	}
+	limits := make(map[string]decimal.Decimal, len(rows))
+	for _, l := range rows {
+		limits[l.Category+":"+l.Period] = l.Amount
+	}
+	return limits, nil
+}
+
+// usageSince sums what a user has sent in a category since a point in time
+func usageSince(db *gorm.DB, userID, category string, since time.Time) (decimal.Decimal, error) {
+	var used decimal.Decimal
+	if err := db.Model(&models.LimitUsage{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND category = ? AND created_at > ?", userID, category, since).
+		Scan(&used).Error; err != nil {
+		return decimal.Zero, errors.New("failed to sum limit usage")
+	}
+	// Some databases sum decimals as floats; amounts are whole cents
+	return used.Round(2), nil
+}
+
+func periodWindow(period string) (time.Duration, bool) {
+	for _, p := range limitPeriods {
+		if p.name == period {
+			return p.window, true
+		}
+	}
+	return 0, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
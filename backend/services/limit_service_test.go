@@ -0,0 +1,187 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBLimit(t *testing.T) (*gorm.DB, *services.LimitService) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Hold{}, &models.Reward{},
+		&models.Biller{}, &models.BillPayment{}, &models.SavedBiller{}, &models.Merchant{}, &models.MerchantQRCode{}, &models.ClaimLink{}, &models.Notification{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.SpendingLimit{}, &models.LimitUsage{})
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	os.WriteFile(path, []byte(`{"base":"USD","rates":{"EUR":"0.8"}}`), 0o644)
+	fx := services.NewFXService(db, services.NewFileRateProvider(path), decimal.NewFromFloat(0.01))
+	ls := services.NewLimitService(db, fx)
+	assert.NoError(t, ls.EnsureDefaults())
+	return db, ls
+}
+
+func findLimit(summary *services.LimitSummary, category, period string) services.RemainingLimit {
+	for _, l := range summary.Limits {
+		if l.Category == category && l.Period == period {
+			return l
+		}
+	}
+	return services.RemainingLimit{}
+}
+
+func TestP2PDailyLimitForPendingKYC(t *testing.T) {
+	db, ls := setupTestDBLimit(t)
+	alice, _ := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, ls))
+	deposit(t, db, alice.ID, 800)
+
+	_, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 300})
+	assert.NoError(t, err)
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 250})
+	assert.EqualError(t, err, "daily p2p limit exceeded: 200.00 USD remaining")
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 200})
+	assert.NoError(t, err)
+
+	summary, err := ls.GetRemaining(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.KYCPending, summary.KYCStatus)
+	assert.Len(t, summary.Limits, 12)
+	daily := findLimit(summary, models.LimitCategoryP2P, models.LimitPeriodDaily)
+	assert.True(t, daily.Used.Equal(decimal.NewFromInt(500)))
+	assert.True(t, daily.Remaining.IsZero())
+	weekly := findLimit(summary, models.LimitCategoryP2P, models.LimitPeriodWeekly)
+	assert.True(t, weekly.Remaining.Equal(decimal.NewFromInt(500)))
+	// Other categories are counted separately
+	bill := findLimit(summary, models.LimitCategoryBill, models.LimitPeriodDaily)
+	assert.True(t, bill.Remaining.Equal(decimal.NewFromInt(500)))
+
+	settledCashback(t, db, 2)
+}
+
+func TestLimitsFollowKYCTierAndAdminChanges(t *testing.T) {
+	db, ls := setupTestDBLimit(t)
+	alice, _ := seedRefundUsers(t, db)
+	ws := services.NewWalletService(db, ls)
+	bs := services.NewBillService(db, services.NewRewardService(db), ls)
+	biller := models.Biller{Name: "Gainesville Water", Category: "water", IsActive: true}
+	db.Create(&biller)
+
+	// Bank withdrawals are paid over ACH, in USD only
+	deposit(t, db, alice.ID, 200)
+	_, err := ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 160, LinkedAccountID: bankAccount(t, db, alice.ID), Currency: "EUR"})
+	assert.EqualError(t, err, "withdrawals to a bank account must be in USD")
+	_, err = ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 200, LinkedAccountID: bankAccount(t, db, alice.ID)})
+	assert.NoError(t, err)
+	_, err = ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 1, LinkedAccountID: bankAccount(t, db, alice.ID)})
+	assert.EqualError(t, err, "daily withdrawal limit exceeded: 0.00 USD remaining")
+
+	// Rejected users cannot pay at all
+	db.Model(&alice).Update("kyc_status", models.KYCRejected)
+	_, err = bs.PayBill(alice.ID, services.BillPayInput{BillerID: biller.ID, AccountNumber: "42", Amount: 10})
+	assert.EqualError(t, err, "daily bill limit exceeded: 0.00 USD remaining")
+
+	// A failed payment is not counted
+	db.Model(&alice).Update("kyc_status", models.KYCVerified)
+	_, err = ws.Withdraw(alice.ID, services.WithdrawInput{Amount: 500, LinkedAccountID: bankAccount(t, db, alice.ID)})
+	assert.EqualError(t, err, "insufficient balance")
+	var usage int64
+	db.Model(&models.LimitUsage{}).Count(&usage)
+	assert.Equal(t, int64(1), usage)
+
+	amount := 50.0
+	_, err = ls.SetLimit(services.SetLimitInput{KYCStatus: models.KYCVerified, Category: models.LimitCategoryBill, Period: models.LimitPeriodDaily, Amount: &amount})
+	assert.NoError(t, err)
+	_, err = ls.SetLimit(services.SetLimitInput{KYCStatus: "gold", Category: models.LimitCategoryBill, Period: models.LimitPeriodDaily, Amount: &amount})
+	assert.EqualError(t, err, "unknown kyc status gold")
+
+	_, err = bs.PayBill(alice.ID, services.BillPayInput{BillerID: biller.ID, AccountNumber: "42", Amount: 60})
+	assert.EqualError(t, err, "daily bill limit exceeded: 50.00 USD remaining")
+	_, err = bs.PayBill(alice.ID, services.BillPayInput{BillerID: biller.ID, AccountNumber: "42", Amount: 50})
+	assert.NoError(t, err)
+
+	// Seeding again keeps the configured value
+	assert.NoError(t, ls.EnsureDefaults())
+	summary, _ := ls.GetRemaining(alice.ID)
+	assert.True(t, findLimit(summary, models.LimitCategoryBill, models.LimitPeriodDaily).Limit.Equal(decimal.NewFromInt(50)))
+	assert.True(t, findLimit(summary, models.LimitCategoryWithdrawal, models.LimitPeriodDaily).Remaining.Equal(decimal.NewFromInt(4800)))
+
+	settledCashback(t, db, 1)
+}
+
+func TestLimitIsGivenBackWhenMoneyComesBack(t *testing.T) {
+	db, ls := setupTestDBLimit(t)
+	alice, bob := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, ls))
+	cs := services.NewClaimService(db, ts, nil, nil, "https://app.test", time.Hour)
+	ts.SetClaims(cs)
+	qs := services.NewQRService(db, ls)
+	rs := services.NewRefundService(db)
+	deposit(t, db, alice.ID, 800)
+	used := func(category string) decimal.Decimal {
+		summary, err := ls.GetRemaining(alice.ID)
+		assert.NoError(t, err)
+		return findLimit(summary, category, models.LimitPeriodDaily).Used
+	}
+
+	// A QR payment counts what is captured, not what was authorized
+	qs.RegisterMerchant(bob.ID, "Bob's Bagels", "Food")
+	qr, _ := qs.GenerateQR(bob.ID, decimal.NewFromInt(200), false)
+	hold, err := qs.AuthorizeQR(alice.ID, qr.CodeString, decimal.Zero)
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryQR).Equal(decimal.NewFromInt(200)))
+	_, err = qs.CapturePayment(bob.ID, hold.ID, decimal.NewFromInt(50))
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryQR).Equal(decimal.NewFromInt(50)))
+	declined, err := qs.AuthorizeQR(alice.ID, qr.CodeString, decimal.Zero)
+	assert.NoError(t, err)
+	_, err = qs.ReleasePayment(bob.ID, declined.ID)
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryQR).Equal(decimal.NewFromInt(50)))
+
+	// ...and a refunded one gives its share back
+	var qrPayment models.Transaction
+	db.Where("type = ?", models.TransactionTypeQRPayment).First(&qrPayment)
+	_, err = rs.Refund(bob.ID, qrPayment.ID, services.RefundInput{Amount: 20})
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryQR).Equal(decimal.NewFromInt(30)))
+
+	// Refunded and reversed transfers
+	sent, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 300})
+	assert.NoError(t, err)
+	_, err = rs.Refund(bob.ID, sent.TransactionID, services.RefundInput{Amount: 100})
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryP2P).Equal(decimal.NewFromInt(200)))
+	_, err = rs.Reverse(sent.TransactionID, services.RefundInput{})
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryP2P).IsZero())
+
+	// Claim links that are cancelled or expire unclaimed
+	cancelled, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "gus@example.com", Amount: 150})
+	assert.NoError(t, err)
+	expired, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "erin@example.com", Amount: 100})
+	assert.NoError(t, err)
+	assert.True(t, used(models.LimitCategoryP2P).Equal(decimal.NewFromInt(250)))
+	_, err = cs.Cancel(alice.ID, cancelled.Claim.ID)
+	assert.NoError(t, err)
+	db.Model(&models.ClaimLink{}).Where("id = ?", expired.Claim.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	assert.NoError(t, cs.RefundExpired())
+	assert.True(t, used(models.LimitCategoryP2P).IsZero())
+
+	// The whole daily limit is available again
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 500})
+	assert.NoError(t, err)
+
+	settledCashback(t, db, 2)
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxLinkedAccounts        = 5
+	maxVerificationAttempts  = 3
+	microDepositValidityDays = 14
+
+	// A failed account can be linked again after relinkCooldown, and a user
+	// gets at most maxFailedLinks unverified links per failedLinkWindowDays
+	relinkCooldown       = 24 * time.Hour
+	maxFailedLinks       = 3
+	failedLinkWindowDays = 30
+)
+
+var (
+	routingNumberPattern = regexp.MustCompile(`^[0-9]{9}$`)
+	accountNumberPattern = regexp.MustCompile(`^[0-9]{4,17}$`)
+)
+
+// LinkedAccountService links users' external bank accounts and verifies
+// them with micro-deposits before they can be used
+type LinkedAccountService struct {
+	db   *gorm.DB
+	bank BankAdapter
+	key  []byte // AES-256 key sealing account numbers
+}
+
+// NewLinkedAccountService creates a new LinkedAccountService. key seals
+// account numbers at rest and must be 32 bytes.
+func NewLinkedAccountService(db *gorm.DB, bank BankAdapter, key []byte) *LinkedAccountService {
+	return &LinkedAccountService{db: db, bank: bank, key: key}
+}
+
+// NewBankAccountKey decodes a base64 32-byte key. Without one, a key is
+// derived from fallbackSecret so development setups still work; production
+// should set a dedicated key.
+func NewBankAccountKey(encoded, fallbackSecret string) ([]byte, error) {
+	if encoded == "" {
+		key := sha256.Sum256([]byte("gatorpay-bank-account-key:" + fallbackSecret))
+		return key[:], nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("bank account key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// ValidRoutingNumber checks an ABA routing number's prefix and its 3-7-1
+// weighted checksum
+func ValidRoutingNumber(routing string) bool {
+	if !routingNumberPattern.MatchString(routing) {
+		return false
+	}
+	// Federal Reserve districts, thrifts and electronic (80) prefixes
+	prefix := int(routing[0]-'0')*10 + int(routing[1]-'0')
+	if !(prefix <= 12 || (prefix >= 21 && prefix <= 32) || (prefix >= 61 && prefix <= 72) || prefix == 80) {
+		return false
+	}
+	weights := [3]int{3, 7, 1}
+	sum := 0
+	for i, c := range routing {
+		sum += int(c-'0') * weights[i%3]
+	}
+	return sum%10 == 0
+}
+
+// maskAccountNumber keeps only the last four digits
+func maskAccountNumber(account string) string {
+	if len(account) < 4 {
+		return "••••"
+	}
+	return "••••" + account[len(account)-4:]
+}
+
+// LinkAccount validates a bank account, stores it sealed and masked, and
+// sends two micro-deposits the user must confirm
+func (s *LinkedAccountService) LinkAccount(userID string, req models.LinkAccountRequest) (*models.LinkedBankAccount, error) {
+	routing := strings.TrimSpace(req.RoutingNumber)
+	account := strings.NewReplacer(" ", "", "-", "").Replace(req.AccountNumber)
+	if !ValidRoutingNumber(routing) {
+		return nil, errors.New("invalid routing number")
+	}
+	if !accountNumberPattern.MatchString(account) {
+		return nil, errors.New("account number must be 4 to 17 digits")
+	}
+	accountType := strings.ToLower(strings.TrimSpace(req.AccountType))
+	if accountType == "" {
+		accountType = models.BankAccountChecking
+	}
+	if accountType != models.BankAccountChecking && accountType != models.BankAccountSavings {
+		return nil, errors.New("account type must be checking or savings")
+	}
+	holder := strings.TrimSpace(req.HolderName)
+	if holder == "" {
+		return nil, errors.New("account holder name is required")
+	}
+
+	fingerprint := s.fingerprint(routing, account)
+	var existing []models.LinkedBankAccount
+	if err := s.db.Where("user_id = ? AND status <> ?", userID, models.LinkedAccountFailed).Find(&existing).Error; err != nil {
+		return nil, errors.New("failed to fetch linked accounts")
+	}
+	for _, a := range existing {
+		if a.AccountFingerprint == fingerprint {
+			return nil, errors.New("this bank account is already linked")
+		}
+	}
+	if len(existing) >= maxLinkedAccounts {
+		return nil, errors.New("you can link at most 5 bank accounts")
+	}
+
+	// Accounts that failed verification or were removed before passing it
+	// count against re-linking, so the attempt limit cannot be reset
+	var failed []models.LinkedBankAccount
+	if err := s.db.Unscoped().
+		Where("user_id = ? AND verified_at IS NULL AND (status = ? OR deleted_at IS NOT NULL) AND created_at > ?",
+			userID, models.LinkedAccountFailed, time.Now().AddDate(0, 0, -failedLinkWindowDays)).
+		Find(&failed).Error; err != nil {
+		return nil, errors.New("failed to fetch linked accounts")
+	}
+	if len(failed) >= maxFailedLinks {
+		return nil, errors.New("too many bank accounts failed verification, try again later")
+	}
+	for _, a := range failed {
+		if a.AccountFingerprint == fingerprint && time.Since(a.UpdatedAt) < relinkCooldown {
+			return nil, errors.New("this bank account failed verification, try again tomorrow")
+		}
+	}
+
+	bankName, err := s.bank.LookupRoutingNumber(routing)
+	if err != nil {
+		return nil, errors.New("routing number is not on the ACH network")
+	}
+	sealed, err := s.seal(account)
+	if err != nil {
+		return nil, errors.New("failed to secure account number")
+	}
+	amounts, err := microDepositAmounts()
+	if err != nil {
+		return nil, errors.New("failed to generate micro-deposits")
+	}
+
+	now := time.Now()
+	linked := models.LinkedBankAccount{
+		UserID:              userID,
+		Nickname:            strings.TrimSpace(req.Nickname),
+		HolderName:          holder,
+		BankName:            bankName,
+		RoutingNumber:       routing,
+		AccountType:         accountType,
+		AccountMask:         maskAccountNumber(account),
+		AccountNumberEnc:    sealed,
+		AccountFingerprint:  fingerprint,
+		Status:              models.LinkedAccountPending,
+		MicroDeposit1:       amounts[0],
+		MicroDeposit2:       amounts[1],
+		MicroDepositsSentAt: &now,
+	}
+	// Send first so a rejected account is never saved
+	if err := s.bank.SendMicroDeposits(routing, account, amounts); err != nil {
+		return nil, errors.New("the bank rejected this account: " + err.Error())
+	}
+	if err := s.db.Create(&linked).Error; err != nil {
+		return nil, errors.New("failed to link bank account")
+	}
+	return &linked, nil
+}
+
+// VerifyAccount checks the micro-deposit amounts the user saw, in either
+// order. Three wrong attempts fail the account.
+func (s *LinkedAccountService) VerifyAccount(userID, accountID string, amounts []float64) (*models.LinkedBankAccount, error) {
+	if len(amounts) != 2 {
+		return nil, errors.New("enter both micro-deposit amounts")
+	}
+	guess := []int64{
+		decimal.NewFromFloat(amounts[0]).Shift(2).Round(0).IntPart(),
+		decimal.NewFromFloat(amounts[1]).Shift(2).Round(0).IntPart(),
+	}
+
+	var linked models.LinkedBankAccount
+	var verifyErr error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", accountID, userID).First(&linked).Error; err != nil {
+			return errors.New("bank account not found")
+		}
+		switch linked.Status {
+		case models.LinkedAccountVerified:
+			return errors.New("bank account is already verified")
+		case models.LinkedAccountFailed:
+			return errors.New("verification failed, link the account again")
+		}
+		if linked.MicroDepositsSentAt != nil && time.Since(*linked.MicroDepositsSentAt) > microDepositValidityDays*24*time.Hour {
+			linked.Status = models.LinkedAccountFailed
+			verifyErr = errors.New("micro-deposits have expired, link the account again")
+			return tx.Save(&linked).Error
+		}
+
+		expected := []int64{linked.MicroDeposit1, linked.MicroDeposit2}
+		sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+		sort.Slice(guess, func(i, j int) bool { return guess[i] < guess[j] })
+		if guess[0] == expected[0] && guess[1] == expected[1] {
+			now := time.Now()
+			linked.Status = models.LinkedAccountVerified
+			linked.VerifiedAt = &now
+			return tx.Save(&linked).Error
+		}
+
+		// A wrong guess still counts, so it must be committed
+		linked.VerificationAttempts++
+		verifyErr = errors.New("micro-deposit amounts do not match")
+		if linked.VerificationAttempts >= maxVerificationAttempts {
+			linked.Status = models.LinkedAccountFailed
+			verifyErr = errors.New("micro-deposit amounts do not match; too many attempts, link the account again")
+		}
+		return tx.Save(&linked).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+	return &linked, nil
+}
+
+// GetAccounts lists a user's linked bank accounts
+func (s *LinkedAccountService) GetAccounts(userID string) ([]models.LinkedBankAccount, error) {
+	var accounts []models.LinkedBankAccount
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&accounts).Error; err != nil {
+		return nil, errors.New("failed to fetch linked accounts")
+	}
+	return accounts, nil
+}
+
+// RemoveAccount unlinks a bank account
+func (s *LinkedAccountService) RemoveAccount(userID, accountID string) error {
+	result := s.db.Where("id = ? AND user_id = ?", accountID, userID).Delete(&models.LinkedBankAccount{})
+	if result.Error != nil {
+		return errors.New("failed to remove bank account")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("bank account not found")
+	}
+	return nil
+}
+
+// AccountNumber unseals a linked account's full number, for ACH files
+func (s *LinkedAccountService) AccountNumber(linked *models.LinkedBankAccount) (string, error) {
+	return s.open(linked.AccountNumberEnc)
+}
+
+// verifiedLinkedAccount loads one of the user's accounts that has passed
+// micro-deposit verification
+func verifiedLinkedAccount(tx *gorm.DB, userID, accountID string) (*models.LinkedBankAccount, error) {
+	var linked models.LinkedBankAccount
+	if accountID == "" || tx.Where("id = ? AND user_id = ?", accountID, userID).First(&linked).Error != nil {
+		return nil, errors.New("bank account not found")
+	}
+	if linked.Status != models.LinkedAccountVerified {
+		return nil, errors.New("bank account is not verified")
+	}
+	return &linked, nil
+}
+
+// microDepositAmounts picks two different amounts between 1 and 99 cents
+func microDepositAmounts() ([2]int64, error) {
+	var amounts [2]int64
+	for i := 0; i < 2; i++ {
+		for {
+			n, err := rand.Int(rand.Reader, big.NewInt(99))
+			if err != nil {
+				return amounts, err
+			}
+			amounts[i] = n.Int64() + 1
+			if i == 0 || amounts[1] != amounts[0] {
+				break
+			}
+		}
+	}
+	return amounts, nil
+}
+
+// fingerprint identifies an account without storing its number in the clear
+func (s *LinkedAccountService) fingerprint(routing, account string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(routing + ":" + account))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts an account number with AES-GCM
+func (s *LinkedAccountService) seal(plain string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil)), nil
+}
+
+// open reverses seal
+func (s *LinkedAccountService) open(sealed string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("corrupt account number")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("corrupt account number")
+	}
+	return string(plain), nil
+}
+
+func (s *LinkedAccountService) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,183 @@
+package services_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBLinkedAccount() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{},
+		&models.Hold{}, &models.LimitUsage{}, &models.Notification{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+// testBankKey seals account numbers in tests
+var testBankKey = bytes.Repeat([]byte{3}, 32)
+
+// testOriginator is the sponsor bank tests send ACH files through
+var testOriginator = services.ACHOriginator{
+	RoutingNumber: "063100277", BankName: "Sponsor Bank", CompanyName: "GatorPay", CompanyID: "1234567890",
+}
+
+// bankAccount returns a verified linked account for the user, creating one
+// if needed, for tests that move money in and out of wallets
+func bankAccount(t *testing.T, db *gorm.DB, userID string) string {
+	var account models.LinkedBankAccount
+	if db.Where(models.LinkedBankAccount{UserID: userID, Status: models.LinkedAccountVerified}).First(&account).Error == nil {
+		return account.ID
+	}
+	las := services.NewLinkedAccountService(db, services.NewSimulatedBankAdapter(), testBankKey)
+	linked, err := las.LinkAccount(userID, models.LinkAccountRequest{RoutingNumber: "021000021", AccountNumber: "000123456789", HolderName: "Test User"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(linked).Updates(map[string]interface{}{
+		"status": models.LinkedAccountVerified, "verified_at": time.Now(),
+	}).Error)
+	return linked.ID
+}
+
+// deposit adds money to the user's USD wallet from their bank account and
+// settles the ACH debit, for tests that need a funded wallet
+func deposit(t *testing.T, db *gorm.DB, userID string, amount float64) *models.Wallet {
+	ws := services.NewWalletService(db, nil)
+	_, err := ws.AddMoney(userID, services.AddMoneyInput{Amount: amount, LinkedAccountID: bankAccount(t, db, userID)})
+	assert.NoError(t, err)
+	settleDeposits(t, db)
+	wallet, err := ws.GetWallet(userID)
+	assert.NoError(t, err)
+	return wallet
+}
+
+// settleDeposits sends pending deposits in an ACH file and settles them as
+// if their return window had passed
+func settleDeposits(t *testing.T, db *gorm.DB) {
+	accounts := services.NewLinkedAccountService(db, services.NewSimulatedBankAdapter(), testBankKey)
+	ach := services.NewWithdrawalService(db, accounts, testOriginator, t.TempDir(), t.TempDir())
+	_, err := ach.SubmitPending()
+	assert.NoError(t, err)
+	db.Model(&models.Deposit{}).Where("status = ?", models.DepositSubmitted).Update("submitted_at", time.Now().AddDate(0, 0, -4))
+	_, err = ach.SettleDue()
+	assert.NoError(t, err)
+}
+
+func TestValidRoutingNumber(t *testing.T) {
+	for _, routing := range []string{"021000021", "026009593", "121000248", "063100277"} {
+		assert.True(t, services.ValidRoutingNumber(routing), routing)
+	}
+	for _, routing := range []string{"021000022", "02100002", "02100002a", "991000021", ""} {
+		assert.False(t, services.ValidRoutingNumber(routing), routing)
+	}
+}
+
+func TestLinkAndVerifyBankAccount(t *testing.T) {
+	db := setupTestDBLinkedAccount()
+	bank := services.NewSimulatedBankAdapter()
+	las := services.NewLinkedAccountService(db, bank, testBankKey)
+	ws := services.NewWalletService(db, nil)
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+
+	req := models.LinkAccountRequest{RoutingNumber: "021000021", AccountNumber: "000123456789", HolderName: "Alice Ng"}
+	_, err := las.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "021000022", AccountNumber: "000123456789", HolderName: "Alice Ng"})
+	assert.EqualError(t, err, "invalid routing number")
+	_, err = las.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "021000021", AccountNumber: "12340000", HolderName: "Alice Ng"})
+	assert.EqualError(t, err, "the bank rejected this account: account is closed")
+
+	account, err := las.LinkAccount("u1", req)
+	assert.NoError(t, err)
+	assert.Equal(t, models.LinkedAccountPending, account.Status)
+	assert.Equal(t, "JPMorgan Chase", account.BankName)
+	assert.Equal(t, "••••6789", account.AccountMask)
+	assert.Equal(t, "JPMorgan Chase ••••6789", account.Label())
+	_, err = las.LinkAccount("u1", req)
+	assert.EqualError(t, err, "this bank account is already linked")
+
+	// Only the mask is stored in the clear
+	var stored models.LinkedBankAccount
+	db.First(&stored, "id = ?", account.ID)
+	assert.NotContains(t, stored.AccountNumberEnc, "123456789")
+	number, err := las.AccountNumber(&stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "000123456789", number)
+
+	// Unverified accounts cannot move money
+	_, err = ws.AddMoney("u1", services.AddMoneyInput{Amount: 50, LinkedAccountID: account.ID})
+	assert.EqualError(t, err, "bank account is not verified")
+
+	sent, err := bank.LastDeposit("000123456789")
+	assert.NoError(t, err)
+	wrong := float64(sent.Amounts[0]%99+1) / 100
+	_, err = las.VerifyAccount("u1", account.ID, []float64{wrong, wrong})
+	assert.EqualError(t, err, "micro-deposit amounts do not match")
+	_, err = las.VerifyAccount("u2", account.ID, []float64{wrong, wrong})
+	assert.EqualError(t, err, "bank account not found")
+
+	// Either order is accepted
+	verified, err := las.VerifyAccount("u1", account.ID, []float64{float64(sent.Amounts[1]) / 100, float64(sent.Amounts[0]) / 100})
+	assert.NoError(t, err)
+	assert.Equal(t, models.LinkedAccountVerified, verified.Status)
+
+	_, err = ws.AddMoney("u1", services.AddMoneyInput{Amount: 50, LinkedAccountID: account.ID})
+	assert.NoError(t, err)
+	settleDeposits(t, db)
+	wallet, err := ws.Withdraw("u1", services.WithdrawInput{Amount: 20, LinkedAccountID: account.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, "30", wallet.Available().String())
+	_, err = ws.Withdraw("u2", services.WithdrawInput{Amount: 1, LinkedAccountID: account.ID})
+	assert.EqualError(t, err, "bank account not found")
+
+	var txn models.Transaction
+	db.Where("type = ?", models.TransactionTypeWithdraw).First(&txn)
+	assert.Equal(t, "Withdrawal to JPMorgan Chase ••••6789", txn.Description)
+
+	// Removed accounts can no longer be used
+	assert.NoError(t, las.RemoveAccount("u1", account.ID))
+	_, err = ws.Withdraw("u1", services.WithdrawInput{Amount: 1, LinkedAccountID: account.ID})
+	assert.EqualError(t, err, "bank account not found")
+}
+
+func TestBankAccountFailsAfterThreeWrongAttempts(t *testing.T) {
+	db := setupTestDBLinkedAccount()
+	bank := services.NewSimulatedBankAdapter()
+	las := services.NewLinkedAccountService(db, bank, testBankKey)
+
+	account, err := las.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "063100277", AccountNumber: "55501234", HolderName: "Alice Ng", AccountType: "Savings"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.BankAccountSavings, account.AccountType)
+
+	sent, _ := bank.LastDeposit("55501234")
+	for i := 0; i < 3; i++ {
+		_, err = las.VerifyAccount("u1", account.ID, []float64{1, 1})
+	}
+	assert.True(t, strings.HasSuffix(err.Error(), "too many attempts, link the account again"))
+	_, err = las.VerifyAccount("u1", account.ID, []float64{float64(sent.Amounts[0]) / 100, float64(sent.Amounts[1]) / 100})
+	assert.EqualError(t, err, "verification failed, link the account again")
+
+	// A failed account can be linked again from scratch, but not straight away
+	relink := models.LinkAccountRequest{RoutingNumber: "063100277", AccountNumber: "55501234", HolderName: "Alice Ng"}
+	_, err = las.LinkAccount("u1", relink)
+	assert.EqualError(t, err, "this bank account failed verification, try again tomorrow")
+	db.Model(&models.LinkedBankAccount{}).Where("id = ?", account.ID).UpdateColumn("updated_at", time.Now().Add(-25*time.Hour))
+	second, err := las.LinkAccount("u1", relink)
+	assert.NoError(t, err)
+
+	// Removing an unverified account does not reset the limit
+	assert.NoError(t, las.RemoveAccount("u1", second.ID))
+	third, err := las.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "063100277", AccountNumber: "55509876", HolderName: "Alice Ng"})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		las.VerifyAccount("u1", third.ID, []float64{1, 1})
+	}
+	_, err = las.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "063100277", AccountNumber: "55504321", HolderName: "Alice Ng"})
+	assert.EqualError(t, err, "too many bank accounts failed verification, try again later")
+}
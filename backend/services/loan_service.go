@@ -10,6 +10,7 @@ import (
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type LoanService struct {
@@ -47,7 +48,7 @@ func (s *LoanService) CheckEligibility(userID string) (map[string]interface{}, e
 	}
 
 	var wallet models.Wallet
-	if err := s.db.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+	if err := s.db.Where("user_id = ? AND currency = ?", userID, models.DefaultCurrency).First(&wallet).Error; err != nil {
 		return nil, errors.New("wallet not found")
 	}
 
@@ -74,9 +75,9 @@ func (s *LoanService) CheckEligibility(userID string) (map[string]interface{}, e
 
 	// Rule 2: Must have wallet balance >= $50
 	minBalance := decimal.NewFromInt(50)
-	if wallet.Balance.LessThan(minBalance) {
+	if wallet.Available().LessThan(minBalance) {
 		eligible = false
-		balStr, _ := wallet.Balance.Float64()
+		balStr, _ := wallet.Available().Float64()
 		reasons = append(reasons, fmt.Sprintf("Wallet balance too low ($%.2f). Minimum required: $50.00.", balStr))
 	}
 
@@ -158,25 +159,40 @@ func (s *LoanService) ApplyForLoan(userID string, offerID string, amount decimal
 		NextPaymentDate: time.Now().AddDate(0, 1, 0),
 	}
 
-	if err := s.db.Create(&loan).Error; err != nil {
-		return nil, err
-	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&loan).Error; err != nil {
+			return err
+		}
 
-	// Disburse: credit loan amount to wallet and create transaction log
-	var wallet models.Wallet
-	if err := s.db.Where("user_id = ?", userID).First(&wallet).Error; err == nil {
-		wallet.Balance = wallet.Balance.Add(amount)
-		s.db.Save(&wallet)
+		// Disburse: credit loan amount to wallet and create transaction log
+		locked, err := lockWalletByUser(tx, userID, models.DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		wallet := *locked
+
+		description := fmt.Sprintf("Loan disbursement: %s (ID: %s)", offer.Name, loan.ID[:8])
+		entry, err := postJournal(tx, models.JournalTypeLoanDisbursement, description,
+			debit(models.LedgerPlatformLoans, amount),
+			credit(walletAccountCode(wallet.ID), amount),
+		)
+		if err != nil {
+			return err
+		}
 
 		// Transaction log for disbursement
 		txn := models.Transaction{
-			WalletID:    wallet.ID,
-			Type:        "loan_disbursement",
-			Amount:      amount,
-			Description: fmt.Sprintf("Loan disbursement: %s (ID: %s)", offer.Name, loan.ID[:8]),
-			Status:      models.TransactionStatusSuccess,
+			WalletID:       wallet.ID,
+			Type:           models.TransactionTypeLoanDisbursement,
+			Amount:         amount,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
 		}
-		s.db.Create(&txn)
+		return tx.Create(&txn).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &loan, nil
@@ -185,8 +201,10 @@ func (s *LoanService) ApplyForLoan(userID string, offerID string, amount decimal
 // CancelLoan cancels a loan if no payments have been made yet
 func (s *LoanService) CancelLoan(loanID string, userID string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the loan so concurrent payments or cancels serialize on it
 		var loan models.Loan
-		if err := tx.Where("id = ? AND user_id = ?", loanID, userID).First(&loan).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", loanID, userID).First(&loan).Error; err != nil {
 			return errors.New("loan not found")
 		}
 
@@ -204,23 +222,33 @@ func (s *LoanService) CancelLoan(loanID string, userID string) error {
 		}
 
 		// Reverse the disbursement: deduct loan amount from wallet
-		var wallet models.Wallet
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err == nil {
-			if wallet.Balance.LessThan(loan.Amount) {
+		if locked, err := lockWalletByUser(tx, userID, models.DefaultCurrency); err == nil {
+			wallet := *locked
+			if wallet.Available().LessThan(loan.Amount) {
 				return errors.New("insufficient wallet balance to reverse disbursement")
 			}
-			wallet.Balance = wallet.Balance.Sub(loan.Amount)
-			tx.Save(&wallet)
+
+			description := fmt.Sprintf("Loan cancelled and reversed (ID: %s)", loan.ID[:8])
+			entry, err := postJournal(tx, models.JournalTypeLoanReversal, description,
+				debit(walletAccountCode(wallet.ID), loan.Amount),
+				credit(models.LedgerPlatformLoans, loan.Amount),
+			)
+			if err != nil {
+				return err
+			}
 
 			// Transaction log for reversal
 			txn := models.Transaction{
-				WalletID:    wallet.ID,
-				Type:        "loan_reversal",
-				Amount:      loan.Amount,
-				Description: fmt.Sprintf("Loan cancelled and reversed (ID: %s)", loan.ID[:8]),
-				Status:      models.TransactionStatusSuccess,
+				WalletID:       wallet.ID,
+				Type:           models.TransactionTypeLoanReversal,
+				Amount:         loan.Amount,
+				Description:    description,
+				Status:         models.TransactionStatusSuccess,
+				JournalEntryID: &entry.ID,
+			}
+			if err := tx.Create(&txn).Error; err != nil {
+				return err
 			}
-			tx.Create(&txn)
 		}
 
 		loan.Status = "cancelled"
@@ -245,8 +273,10 @@ func (s *LoanService) GetLoan(loanID string, userID string) (*models.Loan, error
 
 func (s *LoanService) MakeLoanPayment(loanID string, userID string) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the loan so concurrent payments or cancels serialize on it
 		var loan models.Loan
-		if err := tx.Where("id = ? AND user_id = ?", loanID, userID).First(&loan).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", loanID, userID).First(&loan).Error; err != nil {
 			return errors.New("loan not found")
 		}
 
@@ -259,27 +289,44 @@ func (s *LoanService) MakeLoanPayment(loanID string, userID string) error {
 			paymentAmount = loan.RemainingAmount
 		}
 
-		var wallet models.Wallet
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
-			return errors.New("wallet not found")
+		locked, err := lockWalletByUser(tx, userID, models.DefaultCurrency)
+		if err != nil {
+			return err
 		}
+		wallet := *locked
 
-		if wallet.Balance.LessThan(paymentAmount) {
+		if wallet.Available().LessThan(paymentAmount) {
 			return errors.New("insufficient wallet balance")
 		}
 
-		wallet.Balance = wallet.Balance.Sub(paymentAmount)
-		if err := tx.Save(&wallet).Error; err != nil {
+		// Split the payment between principal and interest in the loan's own ratio
+		principal := paymentAmount
+		if loan.TotalPayable.IsPositive() {
+			principal = paymentAmount.Mul(loan.Amount).Div(loan.TotalPayable).Round(2)
+		}
+		interest := paymentAmount.Sub(principal)
+
+		description := fmt.Sprintf("EMI payment for loan %s", loan.ID[:8])
+		lines := []journalLine{
+			debit(walletAccountCode(wallet.ID), paymentAmount),
+			credit(models.LedgerPlatformLoans, principal),
+		}
+		if interest.IsPositive() {
+			lines = append(lines, credit(models.LedgerPlatformLoanInterest, interest))
+		}
+		entry, err := postJournal(tx, models.JournalTypeLoanPayment, description, lines...)
+		if err != nil {
 			return err
 		}
 
 		// Transaction log for EMI payment
 		txn := models.Transaction{
-			WalletID:    wallet.ID,
-			Type:        "loan_emi_payment",
-			Amount:      paymentAmount,
-			Description: fmt.Sprintf("EMI payment for loan %s", loan.ID[:8]),
-			Status:      models.TransactionStatusSuccess,
+			WalletID:       wallet.ID,
+			Type:           models.TransactionTypeLoanPayment,
+			Amount:         paymentAmount,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
 		}
 		if err := tx.Create(&txn).Error; err != nil {
 			return err
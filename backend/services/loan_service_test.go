@@ -14,7 +14,8 @@ func setupTestDBL() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	sqlDB, _ := db.DB()
 	sqlDB.SetMaxOpenConns(1)
-	db.AutoMigrate(&models.User{}, &models.Loan{}, &models.LoanOffer{}, &models.Wallet{})
+	db.AutoMigrate(&models.User{}, &models.Loan{}, &models.LoanOffer{}, &models.Wallet{},
+		&models.Transaction{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
 	return db
 }
 
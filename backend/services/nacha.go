@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NACHA record layout constants
+const (
+	achRecordSize     = 94
+	achBlockingFactor = 10
+	achServiceMixed   = "200" // batch of credits and debits
+	achServiceCredits = "220" // batch of credits only
+	achServiceDebits  = "225" // batch of debits only
+	achSECCode        = "PPD" // prearranged payment to a consumer account
+)
+
+// ACH transaction codes for credits and debits
+const (
+	achCheckingCredit = "22"
+	achCheckingDebit  = "27"
+	achSavingsCredit  = "32"
+	achSavingsDebit   = "37"
+)
+
+// ACHOriginator identifies GatorPay and its sponsor bank (the ODFI) in the
+// ACH files it writes
+type ACHOriginator struct {
+	RoutingNumber string // the sponsor bank's routing number
+	BankName      string
+	CompanyName   string
+	CompanyID     string // usually "1" followed by the EIN
+}
+
+// achEntry is one credit or debit in an outbound file
+type achEntry struct {
+	TransactionCode string
+	RoutingNumber   string
+	AccountNumber   string
+	Amount          int64 // cents
+	IndividualID    string
+	Name            string
+	TraceNumber     string
+}
+
+// achReturn is one returned entry read from a return file
+type achReturn struct {
+	TraceNumber string // trace number of the original entry
+	Code        string // e.g. R01
+	Amount      int64  // cents
+}
+
+// achReturnReasons describes the common ACH return codes
+var achReturnReasons = map[string]string{
+	"R01": "Insufficient funds",
+	"R02": "Account closed",
+	"R03": "No account or unable to locate account",
+	"R04": "Invalid account number",
+	"R05": "Unauthorized debit to consumer account",
+	"R06": "Returned at the originating bank's request",
+	"R07": "Authorization revoked by customer",
+	"R08": "Payment stopped",
+	"R09": "Uncollected funds",
+	"R10": "Customer advises not authorized",
+	"R11": "Customer advises entry not in accordance with the terms of the authorization",
+	"R12": "Account sold to another bank",
+	"R14": "Account holder deceased",
+	"R15": "Beneficiary deceased",
+	"R16": "Account frozen",
+	"R17": "File record edit criteria",
+	"R20": "Non-transaction account",
+	"R23": "Credit entry refused by receiver",
+	"R24": "Duplicate entry",
+	"R29": "Corporate customer advises not authorized",
+}
+
+// achReturnReason describes a return code, including ones not in the table
+func achReturnReason(code string) string {
+	if reason, ok := achReturnReasons[code]; ok {
+		return reason
+	}
+	return "Returned by the receiving bank (" + code + ")"
+}
+
+// achAlpha left-justifies s in an alphanumeric field, upper-cased and with
+// characters NACHA does not allow replaced by spaces
+func achAlpha(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return ' '
+		}
+		return r
+	}, strings.ToUpper(s))
+	if len(s) > width {
+		return s[:width]
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
+
+// achNum right-justifies n in a zero-filled numeric field, keeping the
+// rightmost digits if it does not fit
+func achNum(n int64, width int) string {
+	s := fmt.Sprintf("%0*d", width, n)
+	return s[len(s)-width:]
+}
+
+// isDebit reports whether the entry pulls money from the account
+func (e achEntry) isDebit() bool {
+	return e.TransactionCode == achCheckingDebit || e.TransactionCode == achSavingsDebit
+}
+
+// writeNACHA renders a NACHA file holding one PPD batch of withdrawal credits
+// and deposit debits. created is when the file was made and effective the
+// day the bank should settle it.
+func writeNACHA(orig ACHOriginator, entries []achEntry, created, effective time.Time, modifier byte) []byte {
+	var records []string
+	odfi := orig.RoutingNumber[:8]
+
+	var credits, debits int
+	for _, e := range entries {
+		if e.isDebit() {
+			debits++
+		} else {
+			credits++
+		}
+	}
+	serviceClass, description := achServiceMixed, "TRANSFER"
+	switch {
+	case debits == 0:
+		serviceClass, description = achServiceCredits, "WITHDRAWAL"
+	case credits == 0:
+		serviceClass, description = achServiceDebits, "DEPOSIT"
+	}
+
+	records = append(records, "1"+"01"+
+		" "+orig.RoutingNumber+
+		achAlpha(orig.CompanyID, 10)+
+		created.Format("060102")+created.Format("1504")+
+		string(modifier)+
+		"094"+achNum(achBlockingFactor, 2)+"1"+
+		achAlpha(orig.BankName, 23)+
+		achAlpha(orig.CompanyName, 23)+
+		achAlpha("", 8))
+
+	const batchNumber = 1
+	records = append(records, "5"+serviceClass+
+		achAlpha(orig.CompanyName, 16)+
+		achAlpha("", 20)+
+		achAlpha(orig.CompanyID, 10)+
+		achSECCode+
+		achAlpha(description, 10)+
+		achAlpha("", 6)+
+		effective.Format("060102")+
+		achAlpha("", 3)+ // settlement date, filled in by the ACH operator
+		"1"+odfi+
+		achNum(batchNumber, 7))
+
+	var hash, debitTotal, creditTotal int64
+	for _, e := range entries {
+		rdfi, _ := strconv.ParseInt(e.RoutingNumber[:8], 10, 64)
+		hash += rdfi
+		if e.isDebit() {
+			debitTotal += e.Amount
+		} else {
+			creditTotal += e.Amount
+		}
+		records = append(records, "6"+e.TransactionCode+
+			e.RoutingNumber[:8]+e.RoutingNumber[8:9]+
+			achAlpha(e.AccountNumber, 17)+
+			achNum(e.Amount, 10)+
+			achAlpha(e.IndividualID, 15)+
+			achAlpha(e.Name, 22)+
+			achAlpha("", 2)+
+			"0"+
+			e.TraceNumber)
+	}
+	entryHash := achNum(hash, 10)
+
+	records = append(records, "8"+serviceClass+
+		achNum(int64(len(entries)), 6)+
+		entryHash+
+		achNum(debitTotal, 12)+
+		achNum(creditTotal, 12)+
+		achAlpha(orig.CompanyID, 10)+
+		achAlpha("", 19)+
+		achAlpha("", 6)+
+		odfi+
+		achNum(batchNumber, 7))
+
+	// Records so far plus this file control record, rounded up to whole blocks
+	blocks := (len(records) + 1 + achBlockingFactor - 1) / achBlockingFactor
+	records = append(records, "9"+
+		achNum(1, 6)+
+		achNum(int64(blocks), 6)+
+		achNum(int64(len(entries)), 8)+
+		entryHash+
+		achNum(debitTotal, 12)+
+		achNum(creditTotal, 12)+
+		achAlpha("", 39))
+	for len(records)%achBlockingFactor != 0 {
+		records = append(records, strings.Repeat("9", achRecordSize))
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		buf.WriteString(r)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// parseACHReturns reads the returned entries in a NACHA return file. Each
+// return is an entry detail record followed by a "99" addenda naming the
+// return code and the original entry's trace number.
+func parseACHReturns(data []byte) ([]achReturn, error) {
+	var returns []achReturn
+	var amount int64
+	haveEntry := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := strings.TrimRight(scanner.Text(), "\r")
+		if record == "" || record == strings.Repeat("9", achRecordSize) {
+			continue
+		}
+		if len(record) != achRecordSize {
+			return nil, fmt.Errorf("line %d is not a %d-character NACHA record", line, achRecordSize)
+		}
+		switch record[0] {
+		case '6':
+			n, err := strconv.ParseInt(record[29:39], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d has an invalid amount", line)
+			}
+			amount, haveEntry = n, true
+		case '7':
+			if record[1:3] != "99" {
+				continue
+			}
+			if !haveEntry {
+				return nil, fmt.Errorf("line %d is a return addenda without an entry", line)
+			}
+			returns = append(returns, achReturn{
+				Code:        record[3:6],
+				TraceNumber: record[6:21],
+				Amount:      amount,
+			})
+			haveEntry = false
+		case '1', '5', '8', '9':
+		default:
+			return nil, fmt.Errorf("line %d has unknown record type %q", line, record[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, errors.New("file is empty")
+	}
+	return returns, nil
+}
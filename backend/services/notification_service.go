@@ -29,6 +29,12 @@ func (s *NotificationService) GetNotifications(userID string, filterType string)
 
 // CreateNotification creates a new notification
 func (s *NotificationService) CreateNotification(userID, nType, title, body, icon, actionURL string) (*models.Notification, error) {
+	return createNotification(s.db, userID, nType, title, body, icon, actionURL)
+}
+
+// createNotification writes a notification with db, which may be the
+// transaction of the event being announced
+func createNotification(db *gorm.DB, userID, nType, title, body, icon, actionURL string) (*models.Notification, error) {
 	n := models.Notification{
 		UserID:    userID,
 		Type:      nType,
@@ -37,7 +43,7 @@ func (s *NotificationService) CreateNotification(userID, nType, title, body, ico
 		Icon:      icon,
 		ActionURL: actionURL,
 	}
-	if err := s.db.Create(&n).Error; err != nil {
+	if err := db.Create(&n).Error; err != nil {
 		return nil, err
 	}
 	return &n, nil
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Processor payment status values
+const (
+	PaymentAuthorized     = "authorized"      // funds reserved on the card, ready to capture
+	PaymentRequiresAction = "requires_action" // the cardholder must pass a 3-D Secure challenge first
+	PaymentCaptured       = "captured"
+	PaymentCapturePending = "capture_pending" // capture accepted, the result arrives by webhook
+	PaymentDeclined       = "declined"
+	PaymentRefunded       = "refunded"
+)
+
+// Processor webhook event types
+const (
+	EventPaymentAuthenticated = "payment.authenticated" // 3-D Secure passed; the payment is authorized
+	EventPaymentAuthFailed    = "payment.authentication_failed"
+	EventPaymentCaptured      = "payment.captured"
+	EventPaymentCaptureFailed = "payment.capture_failed"
+	EventPaymentRefunded      = "payment.refunded"
+)
+
+// PaymentProcessor charges cards for wallet top-ups. Production plugs in a
+// card processor's API; FakeProcessor stands in for it in development and
+// tests.
+type PaymentProcessor interface {
+	// Authorize reserves amount on the card behind a payment method token.
+	// reference is GatorPay's own ID for the payment.
+	Authorize(reference, paymentMethod string, amount decimal.Decimal, currency string) (*PaymentResult, error)
+	// Capture collects an authorized payment
+	Capture(paymentID string) (*PaymentResult, error)
+	// Refund returns part or all of a captured payment
+	Refund(paymentID string, amount decimal.Decimal) (*PaymentResult, error)
+	// ParseWebhook checks a webhook's signature and decodes its event
+	ParseWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+// PaymentResult is a processor's answer to a payment request
+type PaymentResult struct {
+	PaymentID      string
+	Status         string // one of the Payment* values
+	CardBrand      string
+	CardLast4      string
+	DeclineCode    string // set when declined, e.g. insufficient_funds
+	DeclineMessage string
+	ActionURL      string // set when a 3-D Secure challenge is required
+}
+
+// PaymentEvent is a webhook notification about a payment
+type PaymentEvent struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	PaymentID   string `json:"payment_id"`
+	FailureCode string `json:"failure_code,omitempty"`
+	Created     int64  `json:"created"`
+}
+
+// fakeCard is how FakeProcessor treats one test payment method
+type fakeCard struct {
+	brand, last4 string
+	decline      string // decline code at authorization
+	challenge    bool   // needs 3-D Secure
+	failsAuth    bool   // fails the 3-D Secure challenge
+	delayed      bool   // capture completes later by webhook
+	failsCapture bool   // the delayed capture fails
+}
+
+// fakeCards are the test payment methods FakeProcessor knows
+var fakeCards = map[string]fakeCard{
+	"pm_card_visa":                 {brand: "visa", last4: "4242"},
+	"pm_card_mastercard":           {brand: "mastercard", last4: "4444"},
+	"pm_card_declined":             {brand: "visa", last4: "0002", decline: "card_declined"},
+	"pm_card_insufficient_funds":   {brand: "visa", last4: "9995", decline: "insufficient_funds"},
+	"pm_card_expired":              {brand: "visa", last4: "0069", decline: "expired_card"},
+	"pm_card_3ds":                  {brand: "visa", last4: "3220", challenge: true},
+	"pm_card_3ds_fail":             {brand: "visa", last4: "3063", challenge: true, failsAuth: true},
+	"pm_card_delayed_capture":      {brand: "visa", last4: "0077", delayed: true},
+	"pm_card_delayed_capture_fail": {brand: "visa", last4: "0341", delayed: true, failsCapture: true},
+}
+
+// declineMessages are what the cardholder is told for each decline code
+var declineMessages = map[string]string{
+	"card_declined":      "Your card was declined.",
+	"insufficient_funds": "Your card has insufficient funds.",
+	"expired_card":       "Your card has expired.",
+	"unknown_card":       "This card is not recognised.",
+}
+
+// fakePayment is a payment held by FakeProcessor
+type fakePayment struct {
+	id       string
+	card     fakeCard
+	amount   decimal.Decimal
+	status   string
+	refunded decimal.Decimal
+}
+
+// FakeProcessor is a deterministic PaymentProcessor. The outcome depends only
+// on the payment method token, e.g. pm_card_visa succeeds, pm_card_declined is
+// declined, pm_card_3ds needs a challenge and pm_card_delayed_capture captures
+// later. Challenges and delayed captures are finished with CompleteChallenge
+// and CompleteCapture, which return the webhook the processor would send.
+type FakeProcessor struct {
+	mu       sync.Mutex
+	secret   []byte
+	seq      int
+	payments map[string]*fakePayment
+}
+
+// NewWebhookSecret returns the processor's webhook secret. Without one, a
+// secret is derived from fallbackSecret so development setups still verify
+// webhooks; production should set the processor's own secret.
+func NewWebhookSecret(secret, fallbackSecret string) string {
+	if secret != "" {
+		return secret
+	}
+	sum := sha256.Sum256([]byte("gatorpay-processor-webhook:" + fallbackSecret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Card processors that can be named in config
+const (
+	ProcessorFake = "fake" // FakeProcessor, for development only
+	ProcessorNone = "none" // card top-ups are turned off
+)
+
+// NewPaymentProcessor returns the card processor named in config, or nil when
+// card top-ups are turned off. FakeProcessor captures any amount on its test
+// cards, so it is refused in production.
+func NewPaymentProcessor(name, webhookSecret string, production bool) (PaymentProcessor, error) {
+	switch name {
+	case ProcessorNone:
+		return nil, nil
+	case ProcessorFake:
+		if production {
+			return nil, errors.New("the fake processor cannot be used in production")
+		}
+		return NewFakeProcessor(webhookSecret), nil
+	}
+	return nil, fmt.Errorf("unknown payment processor %q", name)
+}
+
+// NewFakeProcessor creates a FakeProcessor that signs webhooks with secret
+func NewFakeProcessor(secret string) *FakeProcessor {
+	return &FakeProcessor{secret: []byte(secret), payments: make(map[string]*fakePayment)}
+}
+
+// Authorize authorizes, declines or challenges depending on the payment method
+func (p *FakeProcessor) Authorize(reference, paymentMethod string, amount decimal.Decimal, currency string) (*PaymentResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	card, ok := fakeCards[paymentMethod]
+	if !ok {
+		return &PaymentResult{Status: PaymentDeclined, DeclineCode: "unknown_card", DeclineMessage: declineMessages["unknown_card"]}, nil
+	}
+	p.seq++
+	payment := &fakePayment{id: fmt.Sprintf("fake_pay_%06d", p.seq), card: card, amount: amount, status: PaymentAuthorized}
+	p.payments[payment.id] = payment
+
+	result := p.result(payment)
+	switch {
+	case card.decline != "":
+		payment.status = PaymentDeclined
+		result.Status = PaymentDeclined
+		result.DeclineCode = card.decline
+		result.DeclineMessage = declineMessages[card.decline]
+	case card.challenge:
+		payment.status = PaymentRequiresAction
+		result.Status = PaymentRequiresAction
+		result.ActionURL = "https://fake-processor.test/3ds/" + payment.id
+	}
+	return result, nil
+}
+
+// Capture captures an authorized payment, or accepts it for later capture
+func (p *FakeProcessor) Capture(paymentID string) (*PaymentResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, errors.New("payment not found")
+	}
+	if payment.status != PaymentAuthorized {
+		return nil, errors.New("payment is not authorized")
+	}
+	payment.status = PaymentCaptured
+	if payment.card.delayed {
+		payment.status = PaymentCapturePending
+	}
+	return p.result(payment), nil
+}
+
+// Refund refunds part or all of a captured payment
+func (p *FakeProcessor) Refund(paymentID string, amount decimal.Decimal) (*PaymentResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, errors.New("payment not found")
+	}
+	if payment.status != PaymentCaptured && payment.status != PaymentRefunded {
+		return nil, errors.New("payment is not captured")
+	}
+	if payment.refunded.Add(amount).GreaterThan(payment.amount) {
+		return nil, errors.New("refund exceeds the captured amount")
+	}
+	payment.refunded = payment.refunded.Add(amount)
+	if payment.refunded.Equal(payment.amount) {
+		payment.status = PaymentRefunded
+	}
+	return p.result(payment), nil
+}
+
+// ParseWebhook verifies the hex HMAC-SHA256 signature of a webhook
+func (p *FakeProcessor) ParseWebhook(payload []byte, signature string) (*PaymentEvent, error) {
+	expected := p.sign(payload)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errors.New("invalid webhook signature")
+	}
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.Type == "" || event.PaymentID == "" {
+		return nil, errors.New("invalid webhook payload")
+	}
+	return &event, nil
+}
+
+// CompleteChallenge finishes a payment's 3-D Secure challenge, passing or
+// failing it as its payment method dictates, and returns the webhook payload
+// and signature the processor sends
+func (p *FakeProcessor) CompleteChallenge(paymentID string) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok || payment.status != PaymentRequiresAction {
+		return nil, "", errors.New("payment has no pending challenge")
+	}
+	if payment.card.failsAuth {
+		payment.status = PaymentDeclined
+		return p.event(EventPaymentAuthFailed, payment, "authentication_failed")
+	}
+	payment.status = PaymentAuthorized
+	return p.event(EventPaymentAuthenticated, payment, "")
+}
+
+// CompleteCapture finishes a delayed capture and returns its webhook
+func (p *FakeProcessor) CompleteCapture(paymentID string) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok || payment.status != PaymentCapturePending {
+		return nil, "", errors.New("payment has no pending capture")
+	}
+	if payment.card.failsCapture {
+		payment.status = PaymentDeclined
+		return p.event(EventPaymentCaptureFailed, payment, "capture_failed")
+	}
+	payment.status = PaymentCaptured
+	return p.event(EventPaymentCaptured, payment, "")
+}
+
+func (p *FakeProcessor) result(payment *fakePayment) *PaymentResult {
+	return &PaymentResult{PaymentID: payment.id, Status: payment.status, CardBrand: payment.card.brand, CardLast4: payment.card.last4}
+}
+
+func (p *FakeProcessor) event(eventType string, payment *fakePayment, failureCode string) ([]byte, string, error) {
+	p.seq++
+	payload, err := json.Marshal(PaymentEvent{
+		ID:          fmt.Sprintf("fake_evt_%06d", p.seq),
+		Type:        eventType,
+		PaymentID:   payment.id,
+		FailureCode: failureCode,
+		Created:     time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, p.sign(payload), nil
+}
+
+func (p *FakeProcessor) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultRequestExpiryDays = 7
+	maxRequestExpiryDays     = 30
+	maxPendingRequests       = 5 // open requests one user may have with the same payer
+	maxRequestReminders      = 3
+	requestReminderInterval  = 24 * time.Hour
+)
+
+// errRequestExpired is returned for a pending request found past its expiry
+var errRequestExpired = errors.New("this request has expired")
+
+// PaymentRequestService lets users ask each other for money. Paying a
+// request is an ordinary transfer from the payer, with the same checks.
+type PaymentRequestService struct {
+	db        *gorm.DB
+	transfers *TransferService
+}
+
+// NewPaymentRequestService creates a new PaymentRequestService
+func NewPaymentRequestService(db *gorm.DB, transfers *TransferService) *PaymentRequestService {
+	return &PaymentRequestService{db: db, transfers: transfers}
+}
+
+// PaymentRequestInput is the DTO for requesting money
+type PaymentRequestInput struct {
+	Payer         string  `json:"payer" binding:"required"` // username, email, or phone
+	Amount        float64 `json:"amount" binding:"required"`
+	Currency      string  `json:"currency"` // defaults to USD
+	Note          string  `json:"note"`
+	ExpiresInDays int     `json:"expires_in_days"` // defaults to 7
+}
+
+// DeclineRequestInput is the DTO for declining a request
+type DeclineRequestInput struct {
+	Reason string `json:"reason"`
+}
+
+// PayRequestInput is the DTO for paying a request. Code is the emailed
+// one-time code, needed for large or flagged payments.
+type PayRequestInput struct {
+	Code string `json:"code" binding:"omitempty,len=6"`
+}
+
+// Create asks the payer for money and notifies them
+func (s *PaymentRequestService) Create(requesterID string, input PaymentRequestInput) (*models.PaymentRequest, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	days := input.ExpiresInDays
+	if days == 0 {
+		days = defaultRequestExpiryDays
+	}
+	if days < 1 || days > maxRequestExpiryDays {
+		return nil, fmt.Errorf("requests can stay open for 1 to %d days", maxRequestExpiryDays)
+	}
+	payer, err := findRecipient(s.db, input.Payer)
+	if err != nil {
+		return nil, errors.New("payer not found")
+	}
+	if payer.ID == requesterID {
+		return nil, errors.New("cannot request money from yourself")
+	}
+
+	var requester models.User
+	if err := s.db.Where("id = ?", requesterID).First(&requester).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	var open int64
+	if err := s.db.Model(&models.PaymentRequest{}).
+		Where("requester_id = ? AND payer_id = ? AND status = ? AND expires_at > ?", requesterID, payer.ID, models.PaymentRequestPending, time.Now()).
+		Count(&open).Error; err != nil {
+		return nil, errors.New("failed to check open requests")
+	}
+	if open >= maxPendingRequests {
+		return nil, fmt.Errorf("you already have %d open requests with %s", open, payer.Username)
+	}
+
+	request := models.PaymentRequest{
+		RequesterID: requesterID,
+		PayerID:     payer.ID,
+		Amount:      amount,
+		Currency:    currency,
+		Note:        input.Note,
+		Status:      models.PaymentRequestPending,
+		ExpiresAt:   time.Now().AddDate(0, 0, days),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return errors.New("failed to create payment request")
+		}
+		body := fmt.Sprintf("%s requested %s %s", requester.Username, amount.StringFixed(2), currency)
+		if request.Note != "" {
+			body += " for " + request.Note
+		}
+		_, err := createNotification(tx, payer.ID, "payment", "Money requested", body+".", "💸", "/transfer/requests/"+request.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	request.Requester, request.Payer = &requester, payer
+	return &request, nil
+}
+
+// GetRequests lists the requests a user sent, or with role "received" the
+// ones sent to them, optionally filtered by status
+func (s *PaymentRequestService) GetRequests(userID, role, status string) ([]models.PaymentRequest, error) {
+	query := s.db.Preload("Requester").Preload("Payer")
+	switch role {
+	case "", "sent":
+		query = query.Where("requester_id = ?", userID)
+	case "received":
+		query = query.Where("payer_id = ?", userID)
+	default:
+		return nil, errors.New("role must be sent or received")
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var requests []models.PaymentRequest
+	if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+		return nil, errors.New("failed to fetch payment requests")
+	}
+	return requests, nil
+}
+
+// GetRequest returns a request the user sent or received
+func (s *PaymentRequestService) GetRequest(userID, id string) (*models.PaymentRequest, error) {
+	var request models.PaymentRequest
+	if err := s.db.Preload("Requester").Preload("Payer").
+		Where("id = ? AND (requester_id = ? OR payer_id = ?)", id, userID, userID).First(&request).Error; err != nil {
+		return nil, errors.New("payment request not found")
+	}
+	return &request, nil
+}
+
+// Pay pays a request from the payer's wallet in the requested currency. It
+// goes through the same checks as SendMoney first.
+func (s *PaymentRequestService) Pay(payerID, id string, input PayRequestInput) (*models.PaymentRequest, error) {
+	pending, err := s.GetRequest(payerID, id)
+	if err != nil || pending.PayerID != payerID {
+		return nil, errors.New("payment request not found")
+	}
+	if err := s.transfers.verify(payerID, "payment_request", pending.Amount, pending.Currency, input.Code); err != nil {
+		return nil, err
+	}
+
+	var requester models.User
+	var paid *TransferResponse
+	request, err := s.respond("payer_id", payerID, id, func(tx *gorm.DB, r *models.PaymentRequest) error {
+		if err := tx.Where("id = ?", r.RequesterID).First(&requester).Error; err != nil {
+			return errors.New("requester not found")
+		}
+		note := "Payment request"
+		if r.Note != "" {
+			note += ": " + r.Note
+		}
+		var err error
+		if paid, err = s.transfers.transfer(tx, payerID, &requester, r.Amount, r.Currency, note); err != nil {
+			return err
+		}
+		r.Status = models.PaymentRequestPaid
+		r.TransactionID = &paid.TransactionID
+
+		var payer models.User
+		tx.Where("id = ?", payerID).First(&payer)
+		body := fmt.Sprintf("%s paid your request for %s %s.", payer.Username, r.Amount.StringFixed(2), r.Currency)
+		_, err = createNotification(tx, r.RequesterID, "payment", "Request paid", body, "✅", "/transfer/requests/"+r.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.transfers.awardCashback(payerID, paid)
+	return request, nil
+}
+
+// Decline turns a request down, telling the requester why if a reason is given
+func (s *PaymentRequestService) Decline(payerID, id, reason string) (*models.PaymentRequest, error) {
+	return s.respond("payer_id", payerID, id, func(tx *gorm.DB, r *models.PaymentRequest) error {
+		r.Status = models.PaymentRequestDeclined
+		r.DeclineReason = reason
+
+		var payer models.User
+		tx.Where("id = ?", payerID).First(&payer)
+		body := fmt.Sprintf("%s declined your request for %s %s", payer.Username, r.Amount.StringFixed(2), r.Currency)
+		if reason != "" {
+			body += ": " + reason
+		}
+		_, err := createNotification(tx, r.RequesterID, "payment", "Request declined", body+".", "🚫", "/transfer/requests/"+r.ID)
+		return err
+	})
+}
+
+// Cancel withdraws a pending request
+func (s *PaymentRequestService) Cancel(requesterID, id string) (*models.PaymentRequest, error) {
+	return s.respond("requester_id", requesterID, id, func(tx *gorm.DB, r *models.PaymentRequest) error {
+		r.Status = models.PaymentRequestCancelled
+		return nil
+	})
+}
+
+// Remind nudges the payer about a pending request, at most once a day and
+// maxRequestReminders times in all
+func (s *PaymentRequestService) Remind(requesterID, id string) (*models.PaymentRequest, error) {
+	var request *models.PaymentRequest
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if request, err = s.lockPending(tx, "requester_id", requesterID, id); err != nil {
+			return err
+		}
+		if request.Reminders >= maxRequestReminders {
+			return fmt.Errorf("a request can only be reminded %d times", maxRequestReminders)
+		}
+		now := time.Now()
+		if request.RemindedAt != nil && now.Sub(*request.RemindedAt) < requestReminderInterval {
+			return errors.New("you can only send one reminder a day")
+		}
+		request.Reminders++
+		request.RemindedAt = &now
+		if err := tx.Save(request).Error; err != nil {
+			return errors.New("failed to update payment request")
+		}
+
+		var requester models.User
+		tx.Where("id = ?", requesterID).First(&requester)
+		body := fmt.Sprintf("%s is still waiting for %s %s", requester.Username, request.Amount.StringFixed(2), request.Currency)
+		if request.Note != "" {
+			body += " for " + request.Note
+		}
+		_, err = createNotification(tx, request.PayerID, "payment", "Payment reminder", body+".", "⏰", "/transfer/requests/"+request.ID)
+		return err
+	})
+	if err != nil {
+		return nil, s.checkExpired(id, err)
+	}
+	return request, nil
+}
+
+// ExpireDue expires every pending request past its expiry time and tells
+// the requester. It is run by the scheduler.
+func (s *PaymentRequestService) ExpireDue() error {
+	var ids []string
+	if err := s.db.Model(&models.PaymentRequest{}).
+		Where("status = ? AND expires_at <= ?", models.PaymentRequestPending, time.Now()).
+		Limit(500).Pluck("id", &ids).Error; err != nil {
+		return errors.New("failed to find expired payment requests")
+	}
+
+	for _, id := range ids {
+		if err := s.expire(id); err != nil {
+			log.Printf("⚠️  Failed to expire payment request %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// expire marks a request expired if it is still pending past its expiry,
+// and tells the requester
+func (s *PaymentRequestService) expire(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var r models.PaymentRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&r).Error; err != nil {
+			return errors.New("payment request not found")
+		}
+		if r.Status != models.PaymentRequestPending || r.ExpiresAt.After(time.Now()) {
+			return nil
+		}
+		now := time.Now()
+		r.Status = models.PaymentRequestExpired
+		r.RespondedAt = &now
+		if err := tx.Save(&r).Error; err != nil {
+			return errors.New("failed to update payment request")
+		}
+		var payer models.User
+		tx.Where("id = ?", r.PayerID).First(&payer)
+		body := fmt.Sprintf("Your request to %s for %s %s expired without being paid.", payer.Username, r.Amount.StringFixed(2), r.Currency)
+		_, err := createNotification(tx, r.RequesterID, "payment", "Request expired", body, "⌛", "/transfer/requests/"+r.ID)
+		return err
+	})
+}
+
+// checkExpired expires a request that was found past its expiry rather than
+// wait for the next sweep, and passes err on
+func (s *PaymentRequestService) checkExpired(id string, err error) error {
+	if errors.Is(err, errRequestExpired) {
+		if expireErr := s.expire(id); expireErr != nil {
+			log.Printf("⚠️  Failed to expire payment request %s: %v", id, expireErr)
+		}
+	}
+	return err
+}
+
+// respond locks a pending request belonging to the user in column, applies
+// change and marks the request answered. A request found past its expiry is
+// expired instead.
+func (s *PaymentRequestService) respond(column, userID, id string, change func(tx *gorm.DB, r *models.PaymentRequest) error) (*models.PaymentRequest, error) {
+	var request *models.PaymentRequest
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if request, err = s.lockPending(tx, column, userID, id); err != nil {
+			return err
+		}
+		if err := change(tx, request); err != nil {
+			return err
+		}
+		now := time.Now()
+		request.RespondedAt = &now
+		if err := tx.Save(request).Error; err != nil {
+			return errors.New("failed to update payment request")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, s.checkExpired(id, err)
+	}
+	return s.GetRequest(userID, request.ID)
+}
+
+// lockPending locks a user's request and checks it can still be acted on
+func (s *PaymentRequestService) lockPending(tx *gorm.DB, column, userID, id string) (*models.PaymentRequest, error) {
+	var r models.PaymentRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND "+column+" = ?", id, userID).First(&r).Error; err != nil {
+		return nil, errors.New("payment request not found")
+	}
+	if r.Status == models.PaymentRequestPending && !r.ExpiresAt.After(time.Now()) {
+		return nil, errRequestExpired
+	}
+	if r.Status != models.PaymentRequestPending {
+		return nil, errors.New("this request is already " + r.Status)
+	}
+	return &r, nil
+}
@@ -0,0 +1,164 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBPaymentRequest() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.PaymentRequest{})
+	return db
+}
+
+func notificationCount(db *gorm.DB, userID, title string) int64 {
+	var count int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title = ?", userID, title).Count(&count)
+	return count
+}
+
+func TestPaymentRequestLifecycle(t *testing.T) {
+	db := setupTestDBPaymentRequest()
+	alice, bob := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	prs := services.NewPaymentRequestService(db, ts)
+	ws := services.NewWalletService(db, nil)
+
+	_, err := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "bob", Amount: 10})
+	assert.EqualError(t, err, "cannot request money from yourself")
+	_, err = prs.Create(bob.ID, services.PaymentRequestInput{Payer: "nobody", Amount: 10})
+	assert.EqualError(t, err, "payer not found")
+
+	// Bob asks Alice for dinner money and she pays it in one step
+	dinner, err := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 30, Note: "dinner"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestPending, dinner.Status)
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Money requested"))
+	received, _ := prs.GetRequests(alice.ID, "received", models.PaymentRequestPending)
+	assert.Len(t, received, 1)
+	assert.Equal(t, "bob", received[0].Requester.Username)
+
+	_, err = prs.Pay(bob.ID, dinner.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "payment request not found", "only the payer can pay")
+	paid, err := prs.Pay(alice.ID, dinner.ID, services.PayRequestInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestPaid, paid.Status)
+	assert.NotNil(t, paid.TransactionID)
+	assert.NotNil(t, paid.RespondedAt)
+	settledCashback(t, db, 1)
+
+	aliceWallet, _ := ws.GetWallet(alice.ID)
+	bobWallet, _ := ws.GetWallet(bob.ID)
+	assert.True(t, aliceWallet.Balance.Equal(decimal.NewFromFloat(170.30)), "paid plus 1% cashback")
+	assert.True(t, bobWallet.Balance.Equal(decimal.NewFromInt(30)))
+	var send models.Transaction
+	db.Where("id = ?", *paid.TransactionID).First(&send)
+	assert.Equal(t, "Transfer to bob - Payment request: dinner", send.Description)
+	assert.Equal(t, int64(1), notificationCount(db, bob.ID, "Request paid"))
+
+	_, err = prs.Pay(alice.ID, dinner.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "this request is already paid")
+
+	// A payment that fails the transfer checks leaves the request open
+	tooMuch, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 500})
+	_, err = prs.Pay(alice.ID, tooMuch.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "insufficient balance")
+	tooMuch, _ = prs.GetRequest(bob.ID, tooMuch.ID)
+	assert.Equal(t, models.PaymentRequestPending, tooMuch.Status)
+
+	// Alice declines it with a reason
+	declined, err := prs.Decline(alice.ID, tooMuch.ID, "that's not what we agreed")
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestDeclined, declined.Status)
+	assert.Equal(t, "that's not what we agreed", declined.DeclineReason)
+	assert.Equal(t, int64(1), notificationCount(db, bob.ID, "Request declined"))
+
+	// Bob reminds Alice once a day, then changes his mind
+	tickets, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 45, Note: "concert tickets"})
+	_, err = prs.Remind(alice.ID, tickets.ID)
+	assert.EqualError(t, err, "payment request not found", "only the requester can remind")
+	reminded, err := prs.Remind(bob.ID, tickets.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reminded.Reminders)
+	_, err = prs.Remind(bob.ID, tickets.ID)
+	assert.EqualError(t, err, "you can only send one reminder a day")
+	assert.Equal(t, int64(1), notificationCount(db, alice.ID, "Payment reminder"))
+
+	cancelled, err := prs.Cancel(bob.ID, tickets.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestCancelled, cancelled.Status)
+	_, err = prs.Pay(alice.ID, tickets.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "this request is already cancelled")
+
+	sent, _ := prs.GetRequests(bob.ID, "sent", "")
+	assert.Len(t, sent, 3)
+	_, err = prs.GetRequests(bob.ID, "everyone", "")
+	assert.EqualError(t, err, "role must be sent or received")
+}
+
+func TestPaymentRequestsExpire(t *testing.T) {
+	db := setupTestDBPaymentRequest()
+	alice, bob := seedRefundUsers(t, db)
+	prs := services.NewPaymentRequestService(db, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+
+	_, err := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 5, ExpiresInDays: 31})
+	assert.EqualError(t, err, "requests can stay open for 1 to 30 days")
+
+	swept, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 5})
+	late, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 6})
+	open, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 7})
+	db.Model(&models.PaymentRequest{}).Where("id IN ?", []string{swept.ID, late.ID}).Update("expires_at", time.Now().Add(-time.Minute))
+
+	// Acting on a request past its expiry expires it on the spot
+	_, err = prs.Pay(alice.ID, late.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "this request has expired")
+	late, _ = prs.GetRequest(bob.ID, late.ID)
+	assert.Equal(t, models.PaymentRequestExpired, late.Status)
+
+	assert.NoError(t, prs.ExpireDue())
+	swept, _ = prs.GetRequest(bob.ID, swept.ID)
+	assert.Equal(t, models.PaymentRequestExpired, swept.Status)
+	open, _ = prs.GetRequest(bob.ID, open.ID)
+	assert.Equal(t, models.PaymentRequestPending, open.Status)
+	assert.Equal(t, int64(2), notificationCount(db, bob.ID, "Request expired"))
+
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(200)))
+}
+
+func TestPayingARequestIsCheckedLikeATransfer(t *testing.T) {
+	db := setupTestDBPaymentRequest()
+	alice, bob := seedRefundUsers(t, db)
+	deposit(t, db, alice.ID, 2000)
+	prs := services.NewPaymentRequestService(db, newTransferVerification(db, 1000))
+
+	// A large payment needs the emailed code
+	rent, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 1200})
+	_, err := prs.Pay(alice.ID, rent.ID, services.PayRequestInput{})
+	assert.ErrorIs(t, err, services.ErrTransferCodeRequired)
+	assert.True(t, balanceOf(t, db, bob.ID).IsZero())
+	paid, err := prs.Pay(alice.ID, rent.ID, services.PayRequestInput{Code: transferCode(db, alice.ID)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentRequestPaid, paid.Status)
+	settledCashback(t, db, 1)
+
+	// One the risk engine blocks is refused and the request stays open
+	sendBurst(db, alice, bob)
+	car, _ := prs.Create(bob.ID, services.PaymentRequestInput{Payer: "alice", Amount: 1500})
+	_, err = prs.Pay(alice.ID, car.ID, services.PayRequestInput{})
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+	car, _ = prs.GetRequest(bob.ID, car.ID)
+	assert.Equal(t, models.PaymentRequestPending, car.Status)
+}
@@ -5,20 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"time"
 
 	"gatorpay-backend/models"
 
 	"github.com/shopspring/decimal"
 	"github.com/skip2/go-qrcode"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type QRService struct {
-	db *gorm.DB
+	db           *gorm.DB
+	limitService *LimitService
 }
 
-func NewQRService(db *gorm.DB) *QRService {
-	return &QRService{db: db}
+func NewQRService(db *gorm.DB, limitService *LimitService) *QRService {
+	return &QRService{db: db, limitService: limitService}
 }
 
 func (s *QRService) RegisterMerchant(userID string, bizName, category string) (*models.Merchant, error) {
@@ -87,80 +90,236 @@ func (s *QRService) LookupQR(codeString string) (map[string]interface{}, error)
 	}, nil
 }
 
+// qrHoldTTL is how long an authorized QR payment stays held for the
+// merchant to capture
+const qrHoldTTL = 24 * time.Hour
+
+// PayViaQR pays the merchant behind a QR code straight away
 func (s *QRService) PayViaQR(payerUserID string, codeString string, overrideAmount decimal.Decimal) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		var qr models.MerchantQRCode
-		if err := tx.Where("code_string = ?", codeString).First(&qr).Error; err != nil {
-			return errors.New("invalid QR code")
+		hold, merchant, err := s.authorize(tx, payerUserID, codeString, overrideAmount)
+		if err != nil {
+			return err
 		}
+		return s.capture(tx, hold, merchant, decimal.Zero)
+	})
+}
 
-		var merchant models.Merchant
-		if err := tx.Where("id = ?", qr.MerchantID).First(&merchant).Error; err != nil {
-			return errors.New("merchant no longer exists")
-		}
+// AuthorizeQR authorizes a payment to the merchant behind a QR code, holding
+// the amount on the payer's wallet until the merchant captures or releases
+// it. Uncaptured payments are released after qrHoldTTL.
+func (s *QRService) AuthorizeQR(payerUserID string, codeString string, overrideAmount decimal.Decimal) (*models.Hold, error) {
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		hold, _, err = s.authorize(tx, payerUserID, codeString, overrideAmount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
 
-		payAmount := qr.Amount
-		if overrideAmount.GreaterThan(decimal.NewFromInt(0)) && !qr.IsDynamic {
-			payAmount = overrideAmount
-		}
+// authorize places a QR hold on the payer's wallet for the payment
+func (s *QRService) authorize(tx *gorm.DB, payerUserID string, codeString string, overrideAmount decimal.Decimal) (*models.Hold, *models.Merchant, error) {
+	var qr models.MerchantQRCode
+	if err := tx.Where("code_string = ?", codeString).First(&qr).Error; err != nil {
+		return nil, nil, errors.New("invalid QR code")
+	}
 
-		if payAmount.LessThanOrEqual(decimal.NewFromInt(0)) {
-			return errors.New("invalid payment amount")
-		}
+	var merchant models.Merchant
+	if err := tx.Where("id = ?", qr.MerchantID).First(&merchant).Error; err != nil {
+		return nil, nil, errors.New("merchant no longer exists")
+	}
 
-		if merchant.UserID == payerUserID {
-			return errors.New("cannot pay yourself")
-		}
+	payAmount := qr.Amount
+	if overrideAmount.GreaterThan(decimal.NewFromInt(0)) && !qr.IsDynamic {
+		payAmount = overrideAmount
+	}
 
-		var payerWallet models.Wallet
-		if err := tx.Where("user_id = ?", payerUserID).First(&payerWallet).Error; err != nil {
-			return errors.New("payer wallet not found")
-		}
+	if payAmount.LessThanOrEqual(decimal.NewFromInt(0)) {
+		return nil, nil, errors.New("invalid payment amount")
+	}
 
-		if payerWallet.Balance.LessThan(payAmount) {
-			return errors.New("insufficient balance")
-		}
+	if merchant.UserID == payerUserID {
+		return nil, nil, errors.New("cannot pay yourself")
+	}
 
-		var merchantWallet models.Wallet
-		if err := tx.Where("user_id = ?", merchant.UserID).First(&merchantWallet).Error; err != nil {
-			merchantWallet = models.Wallet{UserID: merchant.UserID, Balance: decimal.NewFromInt(0)}
-			tx.Create(&merchantWallet)
-		}
+	payerWalletID, err := walletIDForUser(tx, payerUserID, models.DefaultCurrency)
+	if err != nil {
+		return nil, nil, errors.New("payer wallet not found")
+	}
 
-		merchantFee := payAmount.Mul(decimal.NewFromFloat(0.015))
-		payerCashback := payAmount.Mul(decimal.NewFromFloat(0.015))
-		netMerchant := payAmount.Sub(merchantFee)
+	hold, err := placeHold(tx, payerWalletID, models.HoldTypeQR, merchant.ID, "QR payment to "+merchant.BusinessName, payAmount, qrHoldTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.limitService.reserve(tx, payerUserID, models.LimitCategoryQR, payAmount, models.DefaultCurrency, hold.ID); err != nil {
+		return nil, nil, err
+	}
+	return hold, &merchant, nil
+}
 
-		payerWallet.Balance = payerWallet.Balance.Sub(payAmount).Add(payerCashback)
-		merchantWallet.Balance = merchantWallet.Balance.Add(netMerchant)
+// lockQRPayment loads a QR payment hold made to the user's merchant with
+// SELECT ... FOR UPDATE
+func lockQRPayment(tx *gorm.DB, merchantUserID, holdID string) (*models.Hold, *models.Merchant, error) {
+	var merchant models.Merchant
+	if err := tx.Where("user_id = ?", merchantUserID).First(&merchant).Error; err != nil {
+		return nil, nil, errors.New("merchant not found")
+	}
+	var hold models.Hold
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND type = ? AND reference = ?", holdID, models.HoldTypeQR, merchant.ID).
+		First(&hold).Error; err != nil {
+		return nil, nil, errors.New("payment not found")
+	}
+	return &hold, &merchant, nil
+}
 
-		if err := tx.Save(&payerWallet).Error; err != nil {
+// GetPendingPayments lists the QR payments waiting for the merchant to
+// capture them, oldest first
+func (s *QRService) GetPendingPayments(merchantUserID string) ([]models.Hold, error) {
+	var merchant models.Merchant
+	if err := s.db.Where("user_id = ?", merchantUserID).First(&merchant).Error; err != nil {
+		return nil, errors.New("merchant not found")
+	}
+	var holds []models.Hold
+	if err := s.db.Where("type = ? AND reference = ? AND status = ?", models.HoldTypeQR, merchant.ID, models.HoldStatusActive).
+		Order("created_at ASC").Find(&holds).Error; err != nil {
+		return nil, errors.New("failed to fetch payments")
+	}
+	return holds, nil
+}
+
+// CapturePayment settles a held QR payment for amount, or all of it when
+// amount is zero, and releases the rest. The payer is charged, the merchant
+// receives the net of the fee and the payer earns cashback.
+func (s *QRService) CapturePayment(merchantUserID, holdID string, amount decimal.Decimal) (*models.Hold, error) {
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		held, merchant, err := lockQRPayment(tx, merchantUserID, holdID)
+		if err != nil {
 			return err
 		}
-		if err := tx.Save(&merchantWallet).Error; err != nil {
+		hold = held
+		return s.capture(tx, hold, merchant, amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// capture settles a held QR payment inside tx
+func (s *QRService) capture(tx *gorm.DB, hold *models.Hold, merchant *models.Merchant, amount decimal.Decimal) error {
+	merchantWalletID, err := ensureWallet(tx, merchant.UserID, models.DefaultCurrency)
+	if err != nil {
+		return errors.New("failed to create merchant wallet")
+	}
+
+	// Lock both wallets in a fixed order before reading balances
+	wallets, err := lockWallets(tx, hold.WalletID, merchantWalletID)
+	if err != nil {
+		return err
+	}
+	payerWallet := wallets[hold.WalletID]
+	merchantWallet := wallets[merchantWalletID]
+
+	payAmount, err := settleHold(tx, hold, payerWallet, amount, true)
+	if err != nil {
+		return err
+	}
+	payerUserID := hold.UserID
+
+	merchantFee := payAmount.Mul(decimal.NewFromFloat(0.015)).Round(2)
+	payerCashback := payAmount.Mul(decimal.NewFromFloat(0.015)).Round(2)
+	netMerchant := payAmount.Sub(merchantFee)
+
+	// Payer pays in full; the merchant receives the net and the platform keeps the fee
+	entry, err := postJournal(tx, models.JournalTypeQRPayment, "QR payment to "+merchant.BusinessName,
+		debit(walletAccountCode(payerWallet.ID), payAmount),
+		credit(walletAccountCode(merchantWallet.ID), netMerchant),
+		credit(models.LedgerPlatformFees, merchantFee),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Transaction log for payer
+	payerTxn := models.Transaction{
+		WalletID:       payerWallet.ID,
+		FromUserID:     &payerUserID,
+		ToUserID:       &merchant.UserID,
+		Type:           models.TransactionTypeQRPayment,
+		Amount:         payAmount,
+		Description:    fmt.Sprintf("QR payment to %s (cashback: $%.2f)", merchant.BusinessName, payerCashback.InexactFloat64()),
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if err := tx.Create(&payerTxn).Error; err != nil {
+		return err
+	}
+	if err := moveUsage(tx, hold.ID, payerTxn.ID); err != nil {
+		return err
+	}
+
+	// Transaction log for merchant
+	merchantTxn := models.Transaction{
+		WalletID:       merchantWallet.ID,
+		FromUserID:     &payerUserID,
+		ToUserID:       &merchant.UserID,
+		Type:           models.TransactionTypeQRReceived,
+		Amount:         netMerchant,
+		Description:    fmt.Sprintf("QR payment received (fee: $%.2f)", merchantFee.InexactFloat64()),
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if err := tx.Create(&merchantTxn).Error; err != nil {
+		return err
+	}
+
+	if payerCashback.IsPositive() {
+		cashbackDesc := "QR cashback from " + merchant.BusinessName
+		cashbackEntry, err := postJournal(tx, models.JournalTypeCashback, cashbackDesc,
+			debit(models.LedgerPlatformCashback, payerCashback),
+			credit(walletAccountCode(payerWallet.ID), payerCashback),
+		)
+		if err != nil {
 			return err
 		}
 
-		// Transaction log for payer
-		payerTxn := models.Transaction{
-			WalletID:    payerWallet.ID,
-			Type:        "qr_payment",
-			Amount:      payAmount,
-			Description: fmt.Sprintf("QR payment to %s (cashback: $%.2f)", merchant.BusinessName, payerCashback.InexactFloat64()),
-			Status:      models.TransactionStatusSuccess,
+		cashbackTxn := models.Transaction{
+			WalletID:            payerWallet.ID,
+			ToUserID:            &payerUserID,
+			Type:                models.TransactionTypeCashback,
+			Amount:              payerCashback,
+			Description:         cashbackDesc,
+			Status:              models.TransactionStatusSuccess,
+			JournalEntryID:      &cashbackEntry.ID,
+			ParentTransactionID: &payerTxn.ID,
 		}
-		tx.Create(&payerTxn)
-
-		// Transaction log for merchant
-		merchantTxn := models.Transaction{
-			WalletID:    merchantWallet.ID,
-			Type:        "qr_received",
-			Amount:      netMerchant,
-			Description: fmt.Sprintf("QR payment received (fee: $%.2f)", merchantFee.InexactFloat64()),
-			Status:      models.TransactionStatusSuccess,
+		if err := tx.Create(&cashbackTxn).Error; err != nil {
+			return err
 		}
-		tx.Create(&merchantTxn)
+	}
 
-		return nil
+	return nil
+}
+
+// ReleasePayment declines a held QR payment, giving the funds back to the payer
+func (s *QRService) ReleasePayment(merchantUserID, holdID string) (*models.Hold, error) {
+	var hold *models.Hold
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, _, err := lockQRPayment(tx, merchantUserID, holdID); err != nil {
+			return err
+		}
+		var err error
+		hold, err = releaseHold(tx, holdID, models.HoldStatusReleased)
+		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
 }
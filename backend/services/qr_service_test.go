@@ -14,13 +14,14 @@ func setupTestDBQ() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	sqlDB, _ := db.DB()
 	sqlDB.SetMaxOpenConns(1)
-	db.AutoMigrate(&models.Merchant{}, &models.MerchantQRCode{}, &models.Wallet{}, &models.Transaction{})
+	db.AutoMigrate(&models.Merchant{}, &models.MerchantQRCode{}, &models.Wallet{}, &models.Transaction{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
 	return db
 }
 
 func TestQRGenerations(t *testing.T) {
 	db := setupTestDBQ()
-	qs := services.NewQRService(db)
+	qs := services.NewQRService(db, nil)
 
 	_, err := qs.RegisterMerchant("merch1_qr", "Gator Store", "Retail")
 	assert.NoError(t, err)
@@ -41,4 +42,83 @@ func TestQRGenerations(t *testing.T) {
 	db.First(&payerWallet, "user_id = ?", "u1_qr")
 	// Paid 50, but 1.5% cashback = 0.75 -> 50.75 remaining!
 	assert.True(t, payerWallet.Balance.Equal(decimal.NewFromFloat(50.75)))
+	assert.True(t, payerWallet.HeldBalance.IsZero())
+}
+
+func TestQRPaymentWaitsForCapture(t *testing.T) {
+	db := setupTestDBQ()
+	qs := services.NewQRService(db, nil)
+	qs.RegisterMerchant("merch1_qr", "Gator Store", "Retail")
+	qr, _ := qs.GenerateQR("merch1_qr", decimal.NewFromInt(50), false)
+	db.Create(&models.Wallet{UserID: "merch1_qr", Balance: decimal.Zero})
+	db.Create(&models.Wallet{UserID: "u1_qr", Balance: decimal.NewFromInt(100)})
+
+	hold, err := qs.AuthorizeQR("u1_qr", qr.CodeString, decimal.NewFromInt(50))
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldTypeQR, hold.Type)
+
+	// Nothing moves until the merchant captures the payment
+	var payerWallet models.Wallet
+	db.First(&payerWallet, "user_id = ?", "u1_qr")
+	assert.True(t, payerWallet.Balance.Equal(decimal.NewFromInt(100)))
+	assert.True(t, payerWallet.HeldBalance.Equal(decimal.NewFromInt(50)))
+
+	pending, err := qs.GetPendingPayments("merch1_qr")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	_, err = qs.CapturePayment("u1_qr", hold.ID, decimal.Zero)
+	assert.EqualError(t, err, "merchant not found")
+
+	hold, err = qs.CapturePayment("merch1_qr", hold.ID, decimal.Zero)
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusCaptured, hold.Status)
+
+	db.First(&payerWallet, "user_id = ?", "u1_qr")
+	assert.True(t, payerWallet.Balance.Equal(decimal.NewFromFloat(50.75)))
+	assert.True(t, payerWallet.HeldBalance.IsZero())
+}
+
+func TestQRPaymentPartialCaptureAndRelease(t *testing.T) {
+	db := setupTestDBQ()
+	qs := services.NewQRService(db, nil)
+	qs.RegisterMerchant("merch_qr", "Gator Gas", "Fuel")
+	qs.RegisterMerchant("other_qr", "Other Shop", "Retail")
+	qr, _ := qs.GenerateQR("merch_qr", decimal.NewFromInt(80), false)
+	db.Create(&models.Wallet{UserID: "payer_qr", Balance: decimal.NewFromInt(100)})
+
+	// The pump pre-authorizes 80 and the tank takes 40
+	hold, err := qs.AuthorizeQR("payer_qr", qr.CodeString, decimal.Zero)
+	assert.NoError(t, err)
+	_, err = qs.AuthorizeQR("payer_qr", qr.CodeString, decimal.Zero)
+	assert.EqualError(t, err, "insufficient balance")
+	_, err = qs.CapturePayment("other_qr", hold.ID, decimal.Zero)
+	assert.EqualError(t, err, "payment not found")
+
+	hold, err = qs.CapturePayment("merch_qr", hold.ID, decimal.NewFromInt(40))
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusCaptured, hold.Status)
+	assert.True(t, hold.CapturedAmount.Equal(decimal.NewFromInt(40)))
+	_, err = qs.ReleasePayment("merch_qr", hold.ID)
+	assert.EqualError(t, err, "hold is not active")
+
+	var payer, merchant models.Wallet
+	db.First(&payer, "user_id = ?", "payer_qr")
+	db.First(&merchant, "user_id = ?", "merch_qr")
+	assert.True(t, payer.Balance.Equal(decimal.NewFromFloat(60.6)), payer.Balance.String())
+	assert.True(t, payer.HeldBalance.IsZero())
+	assert.True(t, merchant.Balance.Equal(decimal.NewFromFloat(39.4)), merchant.Balance.String())
+
+	// A declined payment gives the payer everything back
+	coffee, _ := qs.GenerateQR("merch_qr", decimal.NewFromInt(20), false)
+	hold, err = qs.AuthorizeQR("payer_qr", coffee.CodeString, decimal.Zero)
+	assert.NoError(t, err)
+	hold, err = qs.ReleasePayment("merch_qr", hold.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldStatusReleased, hold.Status)
+	db.First(&payer, "user_id = ?", "payer_qr")
+	assert.True(t, payer.Balance.Equal(decimal.NewFromFloat(60.6)))
+	assert.True(t, payer.HeldBalance.IsZero())
+
+	pending, _ := qs.GetPendingPayments("merch_qr")
+	assert.Empty(t, pending)
 }
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// ReconciliationService recomputes every wallet's balance from its
+// transactions, ledger postings and holds, and saves each run's mismatches
+// together with the transactions that explain them
+type ReconciliationService struct {
+	db *gorm.DB
+}
+
+// NewReconciliationService creates a new ReconciliationService
+func NewReconciliationService(db *gorm.DB) *ReconciliationService {
+	return &ReconciliationService{db: db}
+}
+
+// walletCreditTypes are the transaction types that add to the wallet they are
+// recorded on. Every other type takes money out, except FX conversions,
+// whose incoming side is the row without a sender.
+var walletCreditTypes = []string{
+	models.TransactionTypeDeposit,
+	models.TransactionTypeP2PReceive,
+	models.TransactionTypeCashback,
+	models.TransactionTypeQRReceived,
+	models.TransactionTypeLoanDisbursement,
+	models.TransactionTypeRefund,
+	models.TransactionTypePocketWithdraw,
+	models.TransactionTypeSharedDeposit,
+	models.TransactionTypeWithdrawReturn,
+	models.TransactionTypeCardTopUp,
+	models.TransactionTypeInterest,
+	models.TransactionTypeClaimReceive,
+	models.TransactionTypeClaimRefund,
+}
+
+// transactionDelta is the signed effect of a transaction on its wallet
+func transactionDelta(txn models.Transaction) decimal.Decimal {
+	if txn.Type == models.TransactionTypeFXConversion {
+		if txn.FromUserID == nil {
+			return txn.Amount
+		}
+		return txn.Amount.Neg()
+	}
+	for _, t := range walletCreditTypes {
+		if txn.Type == t {
+			return txn.Amount
+		}
+	}
+	return txn.Amount.Neg()
+}
+
+// transactionDeltaSQL is transactionDelta as a SQL expression. Its arguments
+// are walletCreditTypes and the FX conversion type.
+const transactionDeltaSQL = "CASE WHEN type IN ? OR (type = ? AND from_user_id IS NULL) THEN amount ELSE -amount END"
+
+// walletFigures is what a wallet's balances should be according to each source
+type walletFigures struct {
+	transactions decimal.Decimal
+	ledger       decimal.Decimal
+	holds        decimal.Decimal
+}
+
+type walletSum struct {
+	WalletID string
+	Net      decimal.Decimal
+}
+
+// computeFigures sums transactions, postings and active holds per wallet.
+// No wallet IDs means every wallet.
+func computeFigures(db *gorm.DB, walletIDs ...string) (map[string]*walletFigures, error) {
+	figures := make(map[string]*walletFigures)
+	add := func(rows []walletSum, set func(*walletFigures, decimal.Decimal)) {
+		for _, r := range rows {
+			f, ok := figures[r.WalletID]
+			if !ok {
+				f = &walletFigures{}
+				figures[r.WalletID] = f
+			}
+			// Some databases sum decimals as floats; amounts are whole cents
+			set(f, r.Net.Round(2))
+		}
+	}
+	scoped := func(query *gorm.DB, column string) *gorm.DB {
+		if len(walletIDs) > 0 {
+			return query.Where(column+" IN ?", walletIDs)
+		}
+		return query
+	}
+
+	var txnSums []walletSum
+	if err := scoped(db.Model(&models.Transaction{}), "wallet_id").
+		Select("wallet_id, COALESCE(SUM("+transactionDeltaSQL+"), 0) AS net",
+			walletCreditTypes, models.TransactionTypeFXConversion).
+		Where("status = ?", models.TransactionStatusSuccess).
+		Group("wallet_id").Scan(&txnSums).Error; err != nil {
+		return nil, errors.New("failed to sum transactions")
+	}
+	add(txnSums, func(f *walletFigures, v decimal.Decimal) { f.transactions = v })
+
+	var postingSums []walletSum
+	if err := scoped(db.Table("postings").Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id"), "ledger_accounts.wallet_id").
+		Select("ledger_accounts.wallet_id AS wallet_id, "+
+			"COALESCE(SUM(CASE WHEN postings.direction = ? THEN postings.amount ELSE -postings.amount END), 0) AS net", models.PostingCredit).
+		Where("ledger_accounts.wallet_id IS NOT NULL").
+		Group("ledger_accounts.wallet_id").Scan(&postingSums).Error; err != nil {
+		return nil, errors.New("failed to sum postings")
+	}
+	add(postingSums, func(f *walletFigures, v decimal.Decimal) { f.ledger = v })
+
+	var holdSums []walletSum
+	if err := scoped(db.Model(&models.Hold{}), "wallet_id").
+		Select("wallet_id, COALESCE(SUM(amount - captured_amount), 0) AS net").
+		Where("status = ?", models.HoldStatusActive).
+		Group("wallet_id").Scan(&holdSums).Error; err != nil {
+		return nil, errors.New("failed to sum holds")
+	}
+	add(holdSums, func(f *walletFigures, v decimal.Decimal) { f.holds = v })
+
+	return figures, nil
+}
+
+// reconciles reports whether a wallet's stored balances match its figures
+func reconciles(wallet *models.Wallet, f *walletFigures) bool {
+	if f == nil {
+		f = &walletFigures{}
+	}
+	return wallet.Balance.Equal(f.transactions) &&
+		wallet.Balance.Equal(f.ledger) &&
+		wallet.HeldBalance.Equal(f.holds)
+}
+
+// Run reconciles every wallet and saves the result. Wallets that look wrong
+// in the first pass are checked again with their row locked, so a payment in
+// flight during the scan is not reported as a mismatch.
+func (s *ReconciliationService) Run(trigger string) (*models.ReconciliationRun, error) {
+	run := models.ReconciliationRun{
+		Trigger:   trigger,
+		Status:    models.ReconciliationStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(&run).Error; err != nil {
+		return nil, errors.New("failed to start reconciliation run")
+	}
+
+	mismatches, checked, err := s.reconcile()
+	now := time.Now()
+	run.FinishedAt = &now
+	run.WalletsChecked = checked
+	if err != nil {
+		run.Status = models.ReconciliationStatusFailed
+		run.Error = err.Error()
+		s.db.Save(&run)
+		return nil, err
+	}
+
+	run.Status = models.ReconciliationStatusCompleted
+	run.MismatchCount = len(mismatches)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range mismatches {
+			mismatches[i].RunID = run.ID
+			if err := tx.Create(&mismatches[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&run).Error
+	})
+	if err != nil {
+		return nil, errors.New("failed to save reconciliation run")
+	}
+	run.Mismatches = mismatches
+
+	if len(mismatches) > 0 {
+		log.Printf("⚠️  Reconciliation run %s found %d mismatched wallets", run.ID, len(mismatches))
+	}
+	return &run, nil
+}
+
+// RunScheduled is the scheduler's entry point
+func (s *ReconciliationService) RunScheduled() error {
+	_, err := s.Run(models.ReconciliationTriggerScheduled)
+	return err
+}
+
+func (s *ReconciliationService) reconcile() ([]models.ReconciliationMismatch, int, error) {
+	var wallets []models.Wallet
+	if err := s.db.Order("created_at").Find(&wallets).Error; err != nil {
+		return nil, 0, errors.New("failed to fetch wallets")
+	}
+	figures, err := computeFigures(s.db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mismatches := []models.ReconciliationMismatch{}
+	for i := range wallets {
+		if reconciles(&wallets[i], figures[wallets[i].ID]) {
+			continue
+		}
+		mismatch, err := s.confirmMismatch(wallets[i].ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if mismatch != nil {
+			mismatches = append(mismatches, *mismatch)
+		}
+	}
+	return mismatches, len(wallets), nil
+}
+
+// confirmMismatch rechecks one wallet under lock and, if it is still out,
+// works out which transactions are responsible
+func (s *ReconciliationService) confirmMismatch(walletID string) (*models.ReconciliationMismatch, error) {
+	var mismatch *models.ReconciliationMismatch
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		wallets, err := lockWallets(tx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[walletID]
+		figures, err := computeFigures(tx, walletID)
+		if err != nil {
+			return err
+		}
+		f := figures[walletID]
+		if reconciles(wallet, f) {
+			return nil
+		}
+		if f == nil {
+			f = &walletFigures{}
+		}
+
+		discrepancies, err := findDiscrepancies(tx, walletID)
+		if err != nil {
+			return err
+		}
+		mismatch = &models.ReconciliationMismatch{
+			WalletID:           wallet.ID,
+			UserID:             wallet.UserID,
+			Currency:           wallet.Currency,
+			StoredBalance:      wallet.Balance,
+			TransactionBalance: f.transactions,
+			LedgerBalance:      f.ledger,
+			HeldBalance:        wallet.HeldBalance,
+			ActiveHolds:        f.holds,
+			Difference:         wallet.Balance.Sub(f.transactions),
+			Discrepancies:      discrepancies,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mismatch, nil
+}
+
+type entryPosting struct {
+	JournalEntryID string
+	Type           string
+	Net            decimal.Decimal
+}
+
+// findDiscrepancies matches a wallet's transactions against the postings of
+// their journal entries and returns every entry where the two disagree
+func findDiscrepancies(tx *gorm.DB, walletID string) ([]models.ReconciliationDiscrepancy, error) {
+	var txns []models.Transaction
+	if err := tx.Where("wallet_id = ? AND status = ?", walletID, models.TransactionStatusSuccess).
+		Order("created_at").Find(&txns).Error; err != nil {
+		return nil, errors.New("failed to fetch transactions")
+	}
+
+	var postings []entryPosting
+	if err := tx.Table("postings").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+		Joins("JOIN journal_entries ON journal_entries.id = postings.journal_entry_id").
+		Select("postings.journal_entry_id AS journal_entry_id, journal_entries.type AS type, "+
+			"SUM(CASE WHEN postings.direction = ? THEN postings.amount ELSE -postings.amount END) AS net", models.PostingCredit).
+		Where("ledger_accounts.wallet_id = ?", walletID).
+		Group("postings.journal_entry_id, journal_entries.type").Scan(&postings).Error; err != nil {
+		return nil, errors.New("failed to fetch postings")
+	}
+
+	discrepancies := []models.ReconciliationDiscrepancy{}
+	recorded := make(map[string]decimal.Decimal)
+	firstTxn := make(map[string]string)
+	for _, txn := range txns {
+		if txn.JournalEntryID == nil {
+			id := txn.ID
+			discrepancies = append(discrepancies, models.ReconciliationDiscrepancy{
+				TransactionID: &id,
+				Issue:         models.DiscrepancyUnposted,
+				Recorded:      transactionDelta(txn),
+				Posted:        decimal.Zero,
+			})
+			continue
+		}
+		entryID := *txn.JournalEntryID
+		recorded[entryID] = recorded[entryID].Add(transactionDelta(txn))
+		if _, ok := firstTxn[entryID]; !ok {
+			firstTxn[entryID] = txn.ID
+		}
+	}
+
+	posted := make(map[string]entryPosting, len(postings))
+	for _, p := range postings {
+		p.Net = p.Net.Round(2)
+		posted[p.JournalEntryID] = p
+	}
+
+	entryIDs := make([]string, 0, len(recorded)+len(posted))
+	for id := range recorded {
+		entryIDs = append(entryIDs, id)
+	}
+	for id := range posted {
+		if _, ok := recorded[id]; !ok {
+			entryIDs = append(entryIDs, id)
+		}
+	}
+	sort.Strings(entryIDs)
+
+	for _, entryID := range entryIDs {
+		p, hasPostings := posted[entryID]
+		r, hasTxns := recorded[entryID]
+		if r.Equal(p.Net) {
+			continue
+		}
+		id := entryID
+		d := models.ReconciliationDiscrepancy{JournalEntryID: &id, Recorded: r, Posted: p.Net}
+		switch {
+		case hasTxns:
+			txnID := firstTxn[entryID]
+			d.TransactionID = &txnID
+			d.Issue = models.DiscrepancyAmount
+		case hasPostings && p.Type == models.JournalTypeOpeningBalance:
+			// Opening balances stand in for pre-ledger transactions on purpose
+			continue
+		default:
+			d.Issue = models.DiscrepancyUnrecorded
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, nil
+}
+
+// GetRuns lists recent reconciliation runs, newest first, without their mismatches
+func (s *ReconciliationService) GetRuns(limit int) ([]models.ReconciliationRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var runs []models.ReconciliationRun
+	if err := s.db.Order("started_at DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, errors.New("failed to fetch reconciliation runs")
+	}
+	return runs, nil
+}
+
+// GetRun returns a run with its mismatches and their discrepancies
+func (s *ReconciliationService) GetRun(runID string) (*models.ReconciliationRun, error) {
+	var run models.ReconciliationRun
+	if err := s.db.Preload("Mismatches", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Preload("Mismatches.Discrepancies").
+		Where("id = ?", runID).First(&run).Error; err != nil {
+		return nil, errors.New("reconciliation run not found")
+	}
+	return &run, nil
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBReconciliation() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.VirtualCard{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ReconciliationRun{}, &models.ReconciliationMismatch{}, &models.ReconciliationDiscrepancy{})
+	return db
+}
+
+func seedReconciliationWallets(t *testing.T, db *gorm.DB) {
+	ws := services.NewWalletService(db, nil)
+	for _, user := range []string{"u1", "u2"} {
+		db.Create(&models.Wallet{UserID: user, IsActive: true})
+		deposit(t, db, user, 100)
+	}
+	_, err := ws.Withdraw("u1", services.WithdrawInput{Amount: 30, LinkedAccountID: bankAccount(t, db, "u1")})
+	assert.NoError(t, err)
+
+	card := models.VirtualCard{UserID: "u2", CardNumber: "4000000000001234", Name: "Main"}
+	db.Create(&card)
+	_, err = services.NewCardService(db).Authorize(card.ID, "u2", services.CardAuthorizeInput{Amount: 20, Merchant: "Cafe"})
+	assert.NoError(t, err)
+}
+
+func TestReconciliationCleanRun(t *testing.T) {
+	db := setupTestDBReconciliation()
+	seedReconciliationWallets(t, db)
+	rs := services.NewReconciliationService(db)
+
+	run, err := rs.Run(models.ReconciliationTriggerManual)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReconciliationStatusCompleted, run.Status)
+	assert.Equal(t, 2, run.WalletsChecked)
+	assert.Equal(t, 0, run.MismatchCount)
+	assert.NotNil(t, run.FinishedAt)
+
+	runs, err := rs.GetRuns(10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, run.ID, runs[0].ID)
+}
+
+func TestReconciliationReportsOffendingTransactions(t *testing.T) {
+	db := setupTestDBReconciliation()
+	seedReconciliationWallets(t, db)
+	rs := services.NewReconciliationService(db)
+
+	var wallet models.Wallet
+	db.Where("user_id = ?", "u1").First(&wallet)
+
+	// A credit written straight to the wallet and its log, bypassing the ledger
+	db.Model(&wallet).Update("balance", gorm.Expr("balance + ?", 500))
+	db.Create(&models.Transaction{WalletID: wallet.ID, Type: models.TransactionTypeLoanDisbursement,
+		Amount: decimal.NewFromInt(500), Status: models.TransactionStatusSuccess})
+
+	// A deposit whose log disagrees with what was posted
+	var deposit models.Transaction
+	db.Where("wallet_id = ? AND type = ?", wallet.ID, models.TransactionTypeDeposit).First(&deposit)
+	db.Model(&deposit).Update("amount", 95)
+
+	run, err := rs.Run(models.ReconciliationTriggerScheduled)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run.MismatchCount)
+
+	saved, err := rs.GetRun(run.ID)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Mismatches, 1)
+
+	m := saved.Mismatches[0]
+	assert.Equal(t, wallet.ID, m.WalletID)
+	assert.True(t, m.StoredBalance.Equal(decimal.NewFromInt(600)))
+	assert.True(t, m.TransactionBalance.Equal(decimal.NewFromInt(595)))
+	assert.True(t, m.LedgerBalance.Equal(decimal.NewFromInt(100)))
+	assert.True(t, m.Difference.Equal(decimal.NewFromInt(5)))
+
+	issues := map[string]models.ReconciliationDiscrepancy{}
+	for _, d := range m.Discrepancies {
+		issues[d.Issue] = d
+	}
+	assert.Len(t, issues, 2)
+	assert.True(t, issues[models.DiscrepancyUnposted].Recorded.Equal(decimal.NewFromInt(500)))
+	assert.Equal(t, deposit.ID, *issues[models.DiscrepancyAmount].TransactionID)
+	assert.True(t, issues[models.DiscrepancyAmount].Recorded.Equal(decimal.NewFromInt(95)))
+	assert.True(t, issues[models.DiscrepancyAmount].Posted.Equal(decimal.NewFromInt(100)))
+}
+
+func TestReconciliationChecksHeldBalance(t *testing.T) {
+	db := setupTestDBReconciliation()
+	seedReconciliationWallets(t, db)
+
+	var wallet models.Wallet
+	db.Where("user_id = ?", "u2").First(&wallet)
+	db.Model(&wallet).Update("held_balance", 0)
+
+	run, err := services.NewReconciliationService(db).Run(models.ReconciliationTriggerManual)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run.MismatchCount)
+	assert.True(t, run.Mismatches[0].ActiveHolds.Equal(decimal.NewFromInt(20)))
+	assert.True(t, run.Mismatches[0].HeldBalance.IsZero())
+	assert.Empty(t, run.Mismatches[0].Discrepancies)
+}
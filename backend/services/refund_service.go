@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefundService reverses P2P, bill and QR payments in full or in part.
+// Every refund is linked to the payment it reverses and can never exceed
+// what is left of it.
+type RefundService struct {
+	db *gorm.DB
+}
+
+// NewRefundService creates a new RefundService
+func NewRefundService(db *gorm.DB) *RefundService {
+	return &RefundService{db: db}
+}
+
+// RefundInput is the DTO for refunding a payment
+type RefundInput struct {
+	Amount float64 `json:"amount"` // zero refunds everything still refundable
+	Reason string  `json:"reason"`
+}
+
+// RefundResponse is the response after a successful refund
+type RefundResponse struct {
+	Refund     models.Transaction `json:"refund"` // the original payer's credit
+	Original   models.Transaction `json:"original"`
+	Refunded   decimal.Decimal    `json:"refunded"`
+	Refundable decimal.Decimal    `json:"refundable"`
+
+	// Cashback the payer earned on the payment, taken back in proportion
+	CashbackReversed decimal.Decimal `json:"cashback_reversed"`
+}
+
+// payeeTypes maps each refundable payer-side type to its payee-side sibling
+var payeeTypes = map[string]string{
+	models.TransactionTypeP2PSend:   models.TransactionTypeP2PReceive,
+	models.TransactionTypeBillPay:   "",
+	models.TransactionTypeQRPayment: models.TransactionTypeQRReceived,
+}
+
+// Refund returns money from the payee of a P2P or QR payment to its payer.
+// Only the user who received the money may refund it.
+func (s *RefundService) Refund(userID, transactionID string, input RefundInput) (*RefundResponse, error) {
+	return s.refund(userID, transactionID, input)
+}
+
+// Reverse refunds any P2P, bill or QR payment on the platform's authority
+func (s *RefundService) Reverse(transactionID string, input RefundInput) (*RefundResponse, error) {
+	return s.refund("", transactionID, input)
+}
+
+// GetRefunds lists the refunds of a payment the user took part in
+func (s *RefundService) GetRefunds(userID, transactionID string) ([]models.Transaction, error) {
+	original, _, err := s.resolvePayment(s.db, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if !involves(original, userID) {
+		return nil, errors.New("transaction not found")
+	}
+
+	var refunds []models.Transaction
+	if err := s.db.Where("parent_transaction_id = ? AND type = ?", original.ID, models.TransactionTypeRefund).
+		Order("created_at").Find(&refunds).Error; err != nil {
+		return nil, errors.New("failed to fetch refunds")
+	}
+	return refunds, nil
+}
+
+// resolvePayment finds the payer-side record of a payment, and its payee-side
+// sibling if it has one, given the ID of either
+func (s *RefundService) resolvePayment(tx *gorm.DB, transactionID string) (*models.Transaction, *models.Transaction, error) {
+	var txn models.Transaction
+	if err := tx.Where("id = ?", transactionID).First(&txn).Error; err != nil {
+		return nil, nil, errors.New("transaction not found")
+	}
+
+	payerType := ""
+	for payer, payee := range payeeTypes {
+		if txn.Type == payer || (payee != "" && txn.Type == payee) {
+			payerType = payer
+		}
+	}
+	if payerType == "" {
+		return nil, nil, errors.New("only P2P, bill and QR payments can be refunded")
+	}
+	if txn.JournalEntryID == nil {
+		return nil, nil, errors.New("transaction predates the ledger and cannot be refunded")
+	}
+
+	// Both sides of a payment share its journal entry
+	var siblings []models.Transaction
+	if err := tx.Where("journal_entry_id = ?", *txn.JournalEntryID).Find(&siblings).Error; err != nil {
+		return nil, nil, errors.New("failed to load payment")
+	}
+	var original, payee *models.Transaction
+	for i := range siblings {
+		switch siblings[i].Type {
+		case payerType:
+			original = &siblings[i]
+		case payeeTypes[payerType]:
+			payee = &siblings[i]
+		}
+	}
+	if original == nil || (payeeTypes[payerType] != "" && payee == nil) {
+		return nil, nil, errors.New("payment records are incomplete")
+	}
+	return original, payee, nil
+}
+
+func involves(txn *models.Transaction, userID string) bool {
+	return (txn.FromUserID != nil && *txn.FromUserID == userID) || (txn.ToUserID != nil && *txn.ToUserID == userID)
+}
+
+// refundedSoFar sums the refunds already booked against a record
+func refundedSoFar(tx *gorm.DB, parentID, refundType string) (decimal.Decimal, error) {
+	var refunds []models.Transaction
+	if err := tx.Select("amount").Where("parent_transaction_id = ? AND type = ?", parentID, refundType).
+		Find(&refunds).Error; err != nil {
+		return decimal.Zero, errors.New("failed to sum refunds")
+	}
+	total := decimal.Zero
+	for _, r := range refunds {
+		total = total.Add(r.Amount)
+	}
+	return total, nil
+}
+
+// paymentCashback finds the cashback a payment earned, if any
+func paymentCashback(tx *gorm.DB, paymentID string) (*models.Transaction, error) {
+	var cashback []models.Transaction
+	if err := tx.Where("parent_transaction_id = ? AND type = ?", paymentID, models.TransactionTypeCashback).
+		Limit(1).Find(&cashback).Error; err != nil {
+		return nil, errors.New("failed to load cashback")
+	}
+	if len(cashback) == 0 {
+		return nil, nil
+	}
+	return &cashback[0], nil
+}
+
+func (s *RefundService) refund(actorID, transactionID string, input RefundInput) (*RefundResponse, error) {
+	var response RefundResponse
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		original, payee, err := s.resolvePayment(tx, transactionID)
+		if err != nil {
+			return err
+		}
+
+		if actorID != "" {
+			if original.Type == models.TransactionTypeBillPay {
+				return errors.New("bill payments can only be reversed by support")
+			}
+			if original.ToUserID == nil || *original.ToUserID != actorID {
+				return errors.New("only the recipient of a payment can refund it")
+			}
+		}
+
+		// Serialize refunds of the same payment on its payer-side row
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", original.ID).First(original).Error; err != nil {
+			return errors.New("transaction not found")
+		}
+		if original.Status != models.TransactionStatusSuccess {
+			return errors.New("only successful payments can be refunded")
+		}
+
+		refunded, err := refundedSoFar(tx, original.ID, models.TransactionTypeRefund)
+		if err != nil {
+			return err
+		}
+		refundable := original.Amount.Sub(refunded)
+
+		amount := decimal.NewFromFloat(input.Amount)
+		if amount.IsZero() {
+			amount = refundable
+		}
+		if !amount.IsPositive() {
+			if refundable.IsZero() {
+				return errors.New("payment has already been fully refunded")
+			}
+			return errors.New("amount must be greater than 0")
+		}
+		if !amount.Equal(amount.Round(2)) {
+			return errors.New("amount must have at most 2 decimal places")
+		}
+		if amount.GreaterThan(refundable) {
+			return fmt.Errorf("refund exceeds the refundable remainder of %s", refundable.StringFixed(2))
+		}
+
+		description := "Refund"
+		if input.Reason != "" {
+			description += ": " + input.Reason
+		}
+
+		payerCurrency := original.Currency
+		if payerCurrency == "" {
+			payerCurrency = models.DefaultCurrency
+		}
+
+		cashback, err := paymentCashback(tx, original.ID)
+		if err != nil {
+			return err
+		}
+		walletIDs := []string{original.WalletID}
+		if payee != nil {
+			walletIDs = append(walletIDs, payee.WalletID)
+		}
+		if cashback != nil {
+			walletIDs = append(walletIDs, cashback.WalletID)
+		}
+		wallets, err := lockWallets(tx, walletIDs...)
+		if err != nil {
+			return err
+		}
+
+		// Work out what comes back from the payee. It receives the net of any
+		// fee and possibly in another currency, so its share is proportional;
+		// the refund that empties the payment takes exactly what is left.
+		var lines []journalLine
+		payeeDebit := decimal.Zero
+		if payee == nil {
+			lines = []journalLine{
+				debit(platformCode(models.LedgerPlatformBillers, payerCurrency), amount),
+				credit(walletAccountCode(original.WalletID), amount),
+			}
+		} else {
+			payeeRefunded, err := refundedSoFar(tx, payee.ID, models.TransactionTypeRefundSent)
+			if err != nil {
+				return err
+			}
+			if amount.Equal(refundable) {
+				payeeDebit = payee.Amount.Sub(payeeRefunded)
+			} else {
+				payeeDebit = payee.Amount.Mul(amount).Div(original.Amount).Round(2)
+			}
+
+			payeeWallet := wallets[payee.WalletID]
+			if payeeWallet.Available().LessThan(payeeDebit) {
+				return errors.New("insufficient balance to refund")
+			}
+
+			switch {
+			case payeeWallet.Currency != payerCurrency:
+				lines = fxLines(payee.WalletID, payeeWallet.Currency, payeeDebit, original.WalletID, payerCurrency, amount)
+			case original.Type == models.TransactionTypeQRPayment:
+				// The platform gives back its share of the merchant fee
+				lines = []journalLine{
+					debit(walletAccountCode(payee.WalletID), payeeDebit),
+					credit(walletAccountCode(original.WalletID), amount),
+				}
+				if fee := amount.Sub(payeeDebit); fee.IsPositive() {
+					lines = append(lines, debit(models.LedgerPlatformFees, fee))
+				}
+			default:
+				lines = []journalLine{
+					debit(walletAccountCode(payee.WalletID), amount),
+					credit(walletAccountCode(original.WalletID), amount),
+				}
+			}
+		}
+
+		// The cashback the payment earned goes back in the same proportion
+		clawback := decimal.Zero
+		if cashback != nil {
+			reversed, err := refundedSoFar(tx, cashback.ID, models.TransactionTypeCashbackReversal)
+			if err != nil {
+				return err
+			}
+			clawback = cashback.Amount.Sub(reversed)
+			if !amount.Equal(refundable) {
+				clawback = decimal.Min(clawback, cashback.Amount.Mul(amount).Div(original.Amount).Round(2))
+			}
+			// The refund itself covers it unless the cashback went to another wallet
+			if cashback.WalletID != original.WalletID {
+				clawback = decimal.Min(clawback, decimal.Max(wallets[cashback.WalletID].Available(), decimal.Zero))
+			}
+			if clawback.IsPositive() {
+				lines = append(lines,
+					debit(walletAccountCode(cashback.WalletID), clawback),
+					credit(models.LedgerPlatformCashback, clawback),
+				)
+			}
+		}
+
+		entry, err := postJournal(tx, models.JournalTypeRefund, description, lines...)
+		if err != nil {
+			return err
+		}
+
+		payerID := original.FromUserID
+		refundTxn := models.Transaction{
+			WalletID:            original.WalletID,
+			FromUserID:          original.ToUserID,
+			ToUserID:            payerID,
+			Type:                models.TransactionTypeRefund,
+			Amount:              amount,
+			Currency:            payerCurrency,
+			Description:         description,
+			Status:              models.TransactionStatusSuccess,
+			JournalEntryID:      &entry.ID,
+			ParentTransactionID: &original.ID,
+		}
+
+		if payee != nil {
+			payeeCurrency := payee.Currency
+			if payeeCurrency == "" {
+				payeeCurrency = models.DefaultCurrency
+			}
+			sentTxn := models.Transaction{
+				WalletID:            payee.WalletID,
+				FromUserID:          payee.ToUserID,
+				ToUserID:            payerID,
+				Type:                models.TransactionTypeRefundSent,
+				Amount:              payeeDebit,
+				Currency:            payeeCurrency,
+				Description:         description,
+				Status:              models.TransactionStatusSuccess,
+				JournalEntryID:      &entry.ID,
+				ParentTransactionID: &payee.ID,
+			}
+			if payeeCurrency != payerCurrency {
+				sentTxn.FXRate, sentTxn.FXSpread = payee.FXRate, payee.FXSpread
+				sentTxn.CounterAmount, sentTxn.CounterCurrency = &amount, payerCurrency
+				refundTxn.FXRate, refundTxn.FXSpread = payee.FXRate, payee.FXSpread
+				refundTxn.CounterAmount, refundTxn.CounterCurrency = &payeeDebit, payeeCurrency
+			}
+			if err := tx.Create(&sentTxn).Error; err != nil {
+				return errors.New("failed to create refund record")
+			}
+		}
+		if err := tx.Create(&refundTxn).Error; err != nil {
+			return errors.New("failed to create refund record")
+		}
+		if err := releaseUsage(tx, original.ID, amount, refundable); err != nil {
+			return err
+		}
+		if clawback.IsPositive() {
+			reversalTxn := models.Transaction{
+				WalletID:            cashback.WalletID,
+				FromUserID:          payerID,
+				Type:                models.TransactionTypeCashbackReversal,
+				Amount:              clawback,
+				Currency:            cashback.Currency,
+				Description:         "Cashback reversed: " + cashback.Description,
+				Status:              models.TransactionStatusSuccess,
+				JournalEntryID:      &entry.ID,
+				ParentTransactionID: &cashback.ID,
+			}
+			if err := tx.Create(&reversalTxn).Error; err != nil {
+				return errors.New("failed to create refund record")
+			}
+		}
+
+		response = RefundResponse{
+			Refund:     refundTxn,
+			Original:   *original,
+			Refunded:   refunded.Add(amount),
+			Refundable: refundable.Sub(amount),
+
+			CashbackReversed: clawback,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,171 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBRefund() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Reward{},
+		&models.Biller{}, &models.BillPayment{}, &models.SavedBiller{}, &models.Merchant{}, &models.MerchantQRCode{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func seedRefundUsers(t *testing.T, db *gorm.DB) (alice, bob models.User) {
+	alice = models.User{Email: "a@test.com", Username: "alice", Phone: "1", FirstName: "A", LastName: "A"}
+	bob = models.User{Email: "b@test.com", Username: "bob", Phone: "2", FirstName: "B", LastName: "B"}
+	db.Create(&alice)
+	db.Create(&bob)
+	db.Create(&models.Wallet{UserID: alice.ID, IsActive: true})
+	db.Create(&models.Wallet{UserID: bob.ID, IsActive: true})
+	deposit(t, db, alice.ID, 200)
+	return alice, bob
+}
+
+// settledCashback waits for n asynchronous cashback awards and returns their total
+func settledCashback(t *testing.T, db *gorm.DB, n int64) decimal.Decimal {
+	assert.Eventually(t, func() bool {
+		var count int64
+		db.Model(&models.Reward{}).Count(&count)
+		return count == n
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var rewards []models.Reward
+	db.Find(&rewards)
+	total := decimal.Zero
+	for _, r := range rewards {
+		total = total.Add(r.Amount)
+	}
+	return total
+}
+
+func TestRefundP2PPartialThenRemainder(t *testing.T) {
+	db := setupTestDBRefund()
+	alice, bob := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	rs := services.NewRefundService(db)
+	ws := services.NewWalletService(db, nil)
+
+	sent, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 80})
+	assert.NoError(t, err)
+	cashback := settledCashback(t, db, 1)
+	assert.True(t, cashback.Equal(decimal.NewFromFloat(0.8)))
+
+	// Only the recipient may refund
+	_, err = rs.Refund(alice.ID, sent.TransactionID, services.RefundInput{Amount: 10})
+	assert.EqualError(t, err, "only the recipient of a payment can refund it")
+
+	resp, err := rs.Refund(bob.ID, sent.TransactionID, services.RefundInput{Amount: 30, Reason: "overpaid"})
+	assert.NoError(t, err)
+	assert.Equal(t, sent.TransactionID, *resp.Refund.ParentTransactionID)
+	assert.True(t, resp.Refundable.Equal(decimal.NewFromInt(50)))
+	assert.True(t, resp.CashbackReversed.Equal(decimal.NewFromFloat(0.3)), "cashback goes back in proportion")
+
+	_, err = rs.Refund(bob.ID, sent.TransactionID, services.RefundInput{Amount: 60})
+	assert.EqualError(t, err, "refund exceeds the refundable remainder of 50.00")
+
+	// Zero refunds the rest
+	resp, err = rs.Refund(bob.ID, sent.TransactionID, services.RefundInput{})
+	assert.NoError(t, err)
+	assert.True(t, resp.Refund.Amount.Equal(decimal.NewFromInt(50)))
+	assert.True(t, resp.Refundable.IsZero())
+	assert.True(t, resp.CashbackReversed.Equal(decimal.NewFromFloat(0.5)))
+
+	_, err = rs.Refund(bob.ID, sent.TransactionID, services.RefundInput{})
+	assert.EqualError(t, err, "payment has already been fully refunded")
+
+	aliceWallet, _ := ws.GetWallet(alice.ID)
+	bobWallet, _ := ws.GetWallet(bob.ID)
+	assert.True(t, aliceWallet.Balance.Equal(decimal.NewFromInt(200)), "a fully refunded payment earns no cashback")
+	assert.True(t, bobWallet.Balance.IsZero())
+
+	// Both sides of each refund link back to their own side of the payment
+	var sentRows []models.Transaction
+	db.Where("type = ?", models.TransactionTypeRefundSent).Find(&sentRows)
+	assert.Len(t, sentRows, 2)
+	var receive models.Transaction
+	db.Where("type = ?", models.TransactionTypeP2PReceive).First(&receive)
+	assert.Equal(t, receive.ID, *sentRows[0].ParentTransactionID)
+
+	refunds, err := rs.GetRefunds(alice.ID, receive.ID)
+	assert.NoError(t, err)
+	assert.Len(t, refunds, 2)
+}
+
+func TestRefundQRReturnsFeeShare(t *testing.T) {
+	db := setupTestDBRefund()
+	alice, bob := seedRefundUsers(t, db)
+	qs := services.NewQRService(db, nil)
+	rs := services.NewRefundService(db)
+	ls := services.NewLedgerService(db)
+
+	qs.RegisterMerchant(bob.ID, "Bob's Bagels", "Food")
+	qr, _ := qs.GenerateQR(bob.ID, decimal.NewFromInt(100), false)
+	err := qs.PayViaQR(alice.ID, qr.CodeString, decimal.NewFromInt(100))
+	assert.NoError(t, err)
+
+	var received models.Transaction
+	db.Where("type = ?", models.TransactionTypeQRReceived).First(&received)
+	assert.True(t, received.Amount.Equal(decimal.NewFromFloat(98.5)))
+
+	// Half the payment: the merchant returns half its net, the platform half its fee
+	resp, err := rs.Refund(bob.ID, received.ID, services.RefundInput{Amount: 50})
+	assert.NoError(t, err)
+	assert.True(t, resp.Refund.Amount.Equal(decimal.NewFromInt(50)))
+
+	var sent models.Transaction
+	db.Where("type = ?", models.TransactionTypeRefundSent).First(&sent)
+	assert.True(t, sent.Amount.Equal(decimal.NewFromFloat(49.25)))
+	assert.True(t, resp.CashbackReversed.Equal(decimal.NewFromFloat(0.75)), "half the 1.50 cashback goes back")
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromFloat(150.75)), wallet.Balance.String())
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformFees {
+			assert.True(t, a.Balance.Equal(decimal.NewFromFloat(0.75)))
+		}
+	}
+}
+
+func TestReverseBillPayment(t *testing.T) {
+	db := setupTestDBRefund()
+	alice, _ := seedRefundUsers(t, db)
+	bs := services.NewBillService(db, services.NewRewardService(db), nil)
+	rs := services.NewRefundService(db)
+
+	biller := models.Biller{Name: "Gainesville Water", Category: "water", IsActive: true}
+	db.Create(&biller)
+	_, err := bs.PayBill(alice.ID, services.BillPayInput{BillerID: biller.ID, AccountNumber: "42", Amount: 60})
+	assert.NoError(t, err)
+
+	var payment models.Transaction
+	db.Where("type = ?", models.TransactionTypeBillPay).First(&payment)
+
+	_, err = rs.Refund(alice.ID, payment.ID, services.RefundInput{})
+	assert.EqualError(t, err, "bill payments can only be reversed by support")
+
+	resp, err := rs.Reverse(payment.ID, services.RefundInput{Reason: "duplicate payment"})
+	assert.NoError(t, err)
+	assert.True(t, resp.Refund.Amount.Equal(decimal.NewFromInt(60)))
+	assert.Equal(t, alice.ID, *resp.Refund.ToUserID)
+	assert.Equal(t, "Refund: duplicate payment", resp.Refund.Description)
+
+	cashback := settledCashback(t, db, 1)
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(200).Add(cashback)))
+}
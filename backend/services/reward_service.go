@@ -38,9 +38,10 @@ type Offer struct {
 	IsActive    bool   `json:"is_active"`
 }
 
-// AwardCashback calculates and awards cashback to a user
-func (s *RewardService) AwardCashback(userID string, amount decimal.Decimal, rate float64, description string) {
-	cashbackAmount := amount.Mul(decimal.NewFromFloat(rate))
+// AwardCashback calculates and awards cashback to a user for the payment
+// with paymentID, which a refund of the payment takes back
+func (s *RewardService) AwardCashback(userID, paymentID string, amount decimal.Decimal, rate float64, description string) {
+	cashbackAmount := amount.Mul(decimal.NewFromFloat(rate)).Round(2)
 	points := int(amount.IntPart()) * 10 // 10 points per dollar
 
 	err := s.db.Transaction(func(tx *gorm.DB) error {
@@ -56,25 +57,35 @@ func (s *RewardService) AwardCashback(userID string, amount decimal.Decimal, rat
 			return errors.New("failed to create reward record")
 		}
 
-		// Credit wallet
-		var wallet models.Wallet
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
-			return errors.New("wallet not found")
+		// Tiny amounts round down to zero cashback but still earn points
+		if !cashbackAmount.IsPositive() {
+			return nil
 		}
 
-		wallet.Balance = wallet.Balance.Add(cashbackAmount)
-		if err := tx.Save(&wallet).Error; err != nil {
-			return errors.New("failed to credit wallet")
+		walletID, err := walletIDForUser(tx, userID, models.DefaultCurrency)
+		if err != nil {
+			return err
+		}
+
+		// Credit wallet from the platform's cashback budget
+		entry, err := postJournal(tx, models.JournalTypeCashback, description,
+			debit(models.LedgerPlatformCashback, cashbackAmount),
+			credit(walletAccountCode(walletID), cashbackAmount),
+		)
+		if err != nil {
+			return err
 		}
 
 		// Create cashback transaction
 		transaction := models.Transaction{
-			WalletID:    wallet.ID,
-			ToUserID:    &userID,
-			Type:        models.TransactionTypeCashback,
-			Amount:      cashbackAmount,
-			Description: description,
-			Status:      models.TransactionStatusSuccess,
+			WalletID:            walletID,
+			ToUserID:            &userID,
+			Type:                models.TransactionTypeCashback,
+			Amount:              cashbackAmount,
+			Description:         description,
+			Status:              models.TransactionStatusSuccess,
+			JournalEntryID:      &entry.ID,
+			ParentTransactionID: &paymentID,
 		}
 		if err := tx.Create(&transaction).Error; err != nil {
 			return errors.New("failed to create cashback transaction")
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScheduledTransferService manages future and recurring P2P transfers and
+// executes them when they fall due
+type ScheduledTransferService struct {
+	db        *gorm.DB
+	transfers *TransferService
+}
+
+// NewScheduledTransferService creates a new ScheduledTransferService
+func NewScheduledTransferService(db *gorm.DB, transfers *TransferService) *ScheduledTransferService {
+	return &ScheduledTransferService{db: db, transfers: transfers}
+}
+
+// ScheduledTransferInput is the DTO for scheduling a transfer
+type ScheduledTransferInput struct {
+	Recipient      string     `json:"recipient" binding:"required"` // username, email, or phone
+	Amount         float64    `json:"amount" binding:"required"`
+	Currency       string     `json:"currency"` // wallet to send from; defaults to USD
+	Note           string     `json:"note"`
+	Frequency      string     `json:"frequency"` // defaults to once
+	StartAt        time.Time  `json:"start_at" binding:"required"`
+	EndAt          *time.Time `json:"end_at"`
+	MaxOccurrences int        `json:"max_occurrences"`
+	Code           string     `json:"code" binding:"omitempty,len=6"` // emailed one-time code, for large or flagged transfers
+}
+
+// UpdateScheduledTransferInput is the DTO for editing a scheduled transfer.
+// Only the fields present are changed; a new StartAt restarts the schedule.
+type UpdateScheduledTransferInput struct {
+	Amount         *float64   `json:"amount"`
+	Note           *string    `json:"note"`
+	Frequency      *string    `json:"frequency"`
+	StartAt        *time.Time `json:"start_at"`
+	EndAt          *time.Time `json:"end_at"`
+	MaxOccurrences *int       `json:"max_occurrences"`
+	Code           string     `json:"code" binding:"omitempty,len=6"` // needed when a new amount is large or flagged
+}
+
+var transferFrequencies = map[string]bool{
+	models.TransferFrequencyOnce:     true,
+	models.TransferFrequencyDaily:    true,
+	models.TransferFrequencyWeekly:   true,
+	models.TransferFrequencyBiweekly: true,
+	models.TransferFrequencyMonthly:  true,
+}
+
+// nextOccurrence returns the occurrence after prev. Monthly transfers stay on
+// their starting day of the month, or the month's last day when it is shorter.
+func nextOccurrence(prev time.Time, frequency string, anchorDay int) time.Time {
+	switch frequency {
+	case models.TransferFrequencyDaily:
+		return prev.AddDate(0, 0, 1)
+	case models.TransferFrequencyWeekly:
+		return prev.AddDate(0, 0, 7)
+	case models.TransferFrequencyBiweekly:
+		return prev.AddDate(0, 0, 14)
+	}
+	firstOfNext := time.Date(prev.Year(), prev.Month()+1, 1, prev.Hour(), prev.Minute(), prev.Second(), prev.Nanosecond(), prev.Location())
+	day := anchorDay
+	if last := firstOfNext.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return firstOfNext.AddDate(0, 0, day-1)
+}
+
+// validateSchedule checks a scheduled transfer's amount and timing
+func validateSchedule(st *models.ScheduledTransfer) error {
+	if st.Amount.LessThanOrEqual(decimal.Zero) {
+		return errors.New("amount must be greater than 0")
+	}
+	if !st.Amount.Equal(st.Amount.Round(2)) {
+		return errors.New("amount must have at most 2 decimal places")
+	}
+	if !transferFrequencies[st.Frequency] {
+		return errors.New("frequency must be once, daily, weekly, biweekly or monthly")
+	}
+	if st.MaxOccurrences < 0 {
+		return errors.New("max occurrences cannot be negative")
+	}
+	if st.MaxOccurrences > 0 && st.Occurrences >= st.MaxOccurrences {
+		return errors.New("max occurrences must exceed the runs already made")
+	}
+	if st.EndAt != nil && st.NextRunAt != nil && st.EndAt.Before(*st.NextRunAt) {
+		return errors.New("end date must be after the next run")
+	}
+	return nil
+}
+
+// Create schedules a one-off or recurring transfer. The amount goes through
+// the same checks as SendMoney, and each run is screened again when it falls
+// due.
+func (s *ScheduledTransferService) Create(userID string, input ScheduledTransferInput) (*models.ScheduledTransfer, error) {
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := findRecipient(s.db, input.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.ID == userID {
+		return nil, errors.New("cannot send money to yourself")
+	}
+	if _, err := walletIDForUser(s.db, userID, currency); err != nil {
+		return nil, errors.New("no " + currency + " wallet to send from")
+	}
+	if input.StartAt.Before(time.Now().Add(-time.Minute)) {
+		return nil, errors.New("start time must be in the future")
+	}
+
+	frequency := input.Frequency
+	if frequency == "" {
+		frequency = models.TransferFrequencyOnce
+	}
+	startAt := input.StartAt
+	st := models.ScheduledTransfer{
+		UserID:         userID,
+		RecipientID:    recipient.ID,
+		Amount:         decimal.NewFromFloat(input.Amount),
+		Currency:       currency,
+		Note:           input.Note,
+		Frequency:      frequency,
+		StartAt:        startAt,
+		EndAt:          input.EndAt,
+		MaxOccurrences: input.MaxOccurrences,
+		NextRunAt:      &startAt,
+		Status:         models.ScheduledTransferStatusActive,
+	}
+	if frequency == models.TransferFrequencyOnce {
+		st.EndAt, st.MaxOccurrences = nil, 1
+	}
+	if err := validateSchedule(&st); err != nil {
+		return nil, err
+	}
+	if err := s.transfers.verify(userID, "scheduled_transfer", st.Amount, currency, input.Code); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&st).Error; err != nil {
+		return nil, errors.New("failed to schedule transfer")
+	}
+	st.Recipient = recipient
+	return &st, nil
+}
+
+// GetScheduledTransfers lists a user's scheduled transfers, optionally filtered by status
+func (s *ScheduledTransferService) GetScheduledTransfers(userID, status string) ([]models.ScheduledTransfer, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var transfers []models.ScheduledTransfer
+	if err := query.Preload("Recipient").Order("created_at DESC").Find(&transfers).Error; err != nil {
+		return nil, errors.New("failed to fetch scheduled transfers")
+	}
+	return transfers, nil
+}
+
+// GetScheduledTransfer returns one scheduled transfer with its run history
+func (s *ScheduledTransferService) GetScheduledTransfer(userID, id string) (*models.ScheduledTransfer, error) {
+	var st models.ScheduledTransfer
+	if err := s.db.Preload("Recipient").Preload("Runs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("due_at DESC")
+	}).Where("id = ? AND user_id = ?", id, userID).First(&st).Error; err != nil {
+		return nil, errors.New("scheduled transfer not found")
+	}
+	return &st, nil
+}
+
+// modify locks a user's scheduled transfer, applies change and saves it
+func (s *ScheduledTransferService) modify(userID, id string, change func(st *models.ScheduledTransfer) error) (*models.ScheduledTransfer, error) {
+	var st models.ScheduledTransfer
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", id, userID).First(&st).Error; err != nil {
+			return errors.New("scheduled transfer not found")
+		}
+		if err := change(&st); err != nil {
+			return err
+		}
+		return tx.Save(&st).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Update edits the amount, note or timing of an active or paused transfer. A
+// new amount goes through the same checks as SendMoney.
+func (s *ScheduledTransferService) Update(userID, id string, input UpdateScheduledTransferInput) (*models.ScheduledTransfer, error) {
+	if input.Amount != nil {
+		current, err := s.GetScheduledTransfer(userID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.transfers.verify(userID, "scheduled_transfer", decimal.NewFromFloat(*input.Amount), current.Currency, input.Code); err != nil {
+			return nil, err
+		}
+	}
+	return s.modify(userID, id, func(st *models.ScheduledTransfer) error {
+		if st.Status != models.ScheduledTransferStatusActive && st.Status != models.ScheduledTransferStatusPaused {
+			return errors.New("only active or paused transfers can be edited")
+		}
+		if input.Amount != nil {
+			st.Amount = decimal.NewFromFloat(*input.Amount)
+		}
+		if input.Note != nil {
+			st.Note = *input.Note
+		}
+		if input.Frequency != nil {
+			st.Frequency = *input.Frequency
+		}
+		if input.StartAt != nil {
+			if input.StartAt.Before(time.Now().Add(-time.Minute)) {
+				return errors.New("start time must be in the future")
+			}
+			startAt := *input.StartAt
+			st.StartAt = startAt
+			st.NextRunAt = &startAt
+		}
+		if input.EndAt != nil {
+			st.EndAt = input.EndAt
+		}
+		if input.MaxOccurrences != nil {
+			st.MaxOccurrences = *input.MaxOccurrences
+		}
+		if st.Frequency == models.TransferFrequencyOnce {
+			st.EndAt, st.MaxOccurrences = nil, st.Occurrences+1
+		}
+		return validateSchedule(st)
+	})
+}
+
+// Pause stops an active transfer from running until it is resumed
+func (s *ScheduledTransferService) Pause(userID, id string) (*models.ScheduledTransfer, error) {
+	return s.modify(userID, id, func(st *models.ScheduledTransfer) error {
+		if st.Status != models.ScheduledTransferStatusActive {
+			return errors.New("only active transfers can be paused")
+		}
+		st.Status = models.ScheduledTransferStatusPaused
+		return nil
+	})
+}
+
+// Resume reactivates a paused transfer. Recurring occurrences that fell due
+// while it was paused are skipped; a paused one-off transfer runs right away.
+func (s *ScheduledTransferService) Resume(userID, id string) (*models.ScheduledTransfer, error) {
+	return s.modify(userID, id, func(st *models.ScheduledTransfer) error {
+		if st.Status != models.ScheduledTransferStatusPaused {
+			return errors.New("only paused transfers can be resumed")
+		}
+		st.Status = models.ScheduledTransferStatusActive
+		if st.Frequency == models.TransferFrequencyOnce || st.NextRunAt == nil {
+			return nil
+		}
+
+		now := time.Now()
+		next := *st.NextRunAt
+		for next.Before(now) {
+			next = nextOccurrence(next, st.Frequency, st.StartAt.Day())
+		}
+		if st.EndAt != nil && next.After(*st.EndAt) {
+			st.Status = models.ScheduledTransferStatusCompleted
+			st.NextRunAt = nil
+			return nil
+		}
+		st.NextRunAt = &next
+		return nil
+	})
+}
+
+// Cancel permanently stops an active or paused transfer
+func (s *ScheduledTransferService) Cancel(userID, id string) (*models.ScheduledTransfer, error) {
+	return s.modify(userID, id, func(st *models.ScheduledTransfer) error {
+		if st.Status != models.ScheduledTransferStatusActive && st.Status != models.ScheduledTransferStatusPaused {
+			return errors.New("only active or paused transfers can be cancelled")
+		}
+		st.Status = models.ScheduledTransferStatusCancelled
+		st.NextRunAt = nil
+		return nil
+	})
+}
+
+// RunDue executes every scheduled transfer that has fallen due. It is run by
+// the scheduler; an occurrence missed while the server was down runs on the
+// next pass.
+func (s *ScheduledTransferService) RunDue() error {
+	var ids []string
+	if err := s.db.Model(&models.ScheduledTransfer{}).
+		Where("status = ? AND next_run_at <= ?", models.ScheduledTransferStatusActive, time.Now()).
+		Order("next_run_at").Limit(100).
+		Pluck("id", &ids).Error; err != nil {
+		return errors.New("failed to find due transfers")
+	}
+
+	for _, id := range ids {
+		if err := s.execute(id); err != nil {
+			log.Printf("⚠️  Failed to run scheduled transfer %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// execute runs one due occurrence. The payment, its run record and the
+// advanced schedule commit together, so an occurrence is never paid twice.
+// It is screened by the risk engine first; a blocked or flagged run fails.
+func (s *ScheduledTransferService) execute(id string) error {
+	var screened models.ScheduledTransfer
+	if err := s.db.Where("id = ?", id).First(&screened).Error; err != nil {
+		return errors.New("scheduled transfer not found")
+	}
+	refused := s.transfers.screen(screened.UserID, "scheduled_transfer", screened.Amount, screened.Currency)
+
+	var st models.ScheduledTransfer
+	var recipient models.User
+	var paid *TransferResponse
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&st).Error; err != nil {
+			return errors.New("scheduled transfer not found")
+		}
+		now := time.Now()
+		if st.Status != models.ScheduledTransferStatusActive || st.NextRunAt == nil || st.NextRunAt.After(now) {
+			// Already handled by another pass, or changed since it was picked up
+			return nil
+		}
+		if !st.Amount.Equal(screened.Amount) {
+			// Edited since it was screened; the next pass screens the new amount
+			return nil
+		}
+		due := *st.NextRunAt
+
+		// The payment runs in a savepoint so a declined one can still be recorded
+		run := models.ScheduledTransferRun{ScheduledTransferID: st.ID, DueAt: due}
+		err := tx.Where("id = ?", st.RecipientID).First(&recipient).Error
+		switch {
+		case err != nil:
+			err = errors.New("recipient not found")
+		case refused != nil:
+			err = refused
+		default:
+			err = tx.Transaction(func(sp *gorm.DB) error {
+				var err error
+				paid, err = s.transfers.transfer(sp, st.UserID, &recipient, st.Amount, st.Currency, st.Note)
+				return err
+			})
+		}
+
+		if err != nil {
+			paid = nil
+			run.Status = models.ScheduledRunStatusFailed
+			run.Error = err.Error()
+			st.FailureCount++
+			st.LastError = err.Error()
+
+			body := fmt.Sprintf("Your scheduled transfer of %s %s to %s could not be sent: %s",
+				st.Amount.StringFixed(2), st.Currency, recipient.Username, err.Error())
+			if _, err := createNotification(tx, st.UserID, "payment", "Scheduled transfer failed", body, "⚠️", ""); err != nil {
+				return err
+			}
+		} else {
+			run.Status = models.ScheduledRunStatusSuccess
+			run.TransactionID = &paid.TransactionID
+			st.LastError = ""
+		}
+		if err := tx.Create(&run).Error; err != nil {
+			return errors.New("failed to record scheduled transfer run")
+		}
+
+		st.Occurrences++
+		st.LastRunAt = &now
+		next := nextOccurrence(due, st.Frequency, st.StartAt.Day())
+		switch {
+		case st.Frequency == models.TransferFrequencyOnce && run.Status == models.ScheduledRunStatusFailed:
+			st.Status = models.ScheduledTransferStatusFailed
+			st.NextRunAt = nil
+		case st.Frequency == models.TransferFrequencyOnce,
+			st.MaxOccurrences > 0 && st.Occurrences >= st.MaxOccurrences,
+			st.EndAt != nil && next.After(*st.EndAt):
+			st.Status = models.ScheduledTransferStatusCompleted
+			st.NextRunAt = nil
+		default:
+			st.NextRunAt = &next
+		}
+		return tx.Save(&st).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if paid != nil {
+		s.transfers.awardCashback(st.UserID, paid)
+	}
+	return nil
+}
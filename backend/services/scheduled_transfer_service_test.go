@@ -0,0 +1,185 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBScheduled() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ScheduledTransfer{}, &models.ScheduledTransferRun{})
+	return db
+}
+
+func newScheduledTransferService(t *testing.T, db *gorm.DB) (*services.ScheduledTransferService, models.User, models.User) {
+	alice, bob := seedRefundUsers(t, db)
+	ts := allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil))
+	return services.NewScheduledTransferService(db, ts), alice, bob
+}
+
+// makeDue moves a scheduled transfer's next run into the past
+func makeDue(db *gorm.DB, id string) time.Time {
+	due := time.Now().Add(-time.Minute)
+	db.Model(&models.ScheduledTransfer{}).Where("id = ?", id).Update("next_run_at", due)
+	return due
+}
+
+func TestRecurringTransferRunsUntilMaxOccurrences(t *testing.T) {
+	db := setupTestDBScheduled()
+	ss, alice, bob := newScheduledTransferService(t, db)
+
+	st, err := ss.Create(alice.ID, services.ScheduledTransferInput{
+		Recipient: "bob", Amount: 25, Note: "rent share", Frequency: models.TransferFrequencyWeekly,
+		StartAt: time.Now().Add(time.Hour), MaxOccurrences: 3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, bob.ID, st.RecipientID)
+
+	// Nothing is due yet
+	assert.NoError(t, ss.RunDue())
+	var count int64
+	db.Model(&models.ScheduledTransferRun{}).Count(&count)
+	assert.Zero(t, count)
+
+	for i := 1; i <= 3; i++ {
+		due := makeDue(db, st.ID)
+		assert.NoError(t, ss.RunDue())
+		// A second pass over the same occurrence is a no-op
+		assert.NoError(t, ss.RunDue())
+
+		st, _ = ss.GetScheduledTransfer(alice.ID, st.ID)
+		assert.Equal(t, i, st.Occurrences)
+		assert.Len(t, st.Runs, i)
+		assert.Equal(t, models.ScheduledRunStatusSuccess, st.Runs[0].Status)
+		if i < 3 {
+			assert.True(t, st.NextRunAt.Equal(due.AddDate(0, 0, 7)))
+		}
+	}
+	assert.Equal(t, models.ScheduledTransferStatusCompleted, st.Status)
+	assert.Nil(t, st.NextRunAt)
+
+	bobWallet, _ := services.NewWalletService(db, nil).GetWallet(bob.ID)
+	assert.True(t, bobWallet.Balance.Equal(decimal.NewFromInt(75)))
+	settledCashback(t, db, 3)
+}
+
+func TestScheduledTransferRecordsInsufficientFunds(t *testing.T) {
+	db := setupTestDBScheduled()
+	ss, alice, _ := newScheduledTransferService(t, db)
+
+	recurring, err := ss.Create(alice.ID, services.ScheduledTransferInput{
+		Recipient: "bob", Amount: 500, Frequency: models.TransferFrequencyMonthly, StartAt: time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	once, err := ss.Create(alice.ID, services.ScheduledTransferInput{
+		Recipient: "bob", Amount: 300, StartAt: time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+
+	makeDue(db, recurring.ID)
+	makeDue(db, once.ID)
+	assert.NoError(t, ss.RunDue())
+
+	recurring, _ = ss.GetScheduledTransfer(alice.ID, recurring.ID)
+	assert.Equal(t, models.ScheduledTransferStatusActive, recurring.Status)
+	assert.Equal(t, 1, recurring.FailureCount)
+	assert.Equal(t, "insufficient balance", recurring.LastError)
+	assert.Equal(t, models.ScheduledRunStatusFailed, recurring.Runs[0].Status)
+	assert.NotNil(t, recurring.NextRunAt)
+
+	once, _ = ss.GetScheduledTransfer(alice.ID, once.ID)
+	assert.Equal(t, models.ScheduledTransferStatusFailed, once.Status)
+
+	var notifications int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title <> ?", alice.ID, "Deposit available").Count(&notifications)
+	assert.Equal(t, int64(2), notifications)
+
+	// The failed payments left no trace on the wallet
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(alice.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(200)))
+}
+
+func TestScheduledTransferPauseEditCancel(t *testing.T) {
+	db := setupTestDBScheduled()
+	ss, alice, _ := newScheduledTransferService(t, db)
+
+	st, err := ss.Create(alice.ID, services.ScheduledTransferInput{
+		Recipient: "bob", Amount: 10, Frequency: models.TransferFrequencyDaily, StartAt: time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+
+	_, err = ss.Create(alice.ID, services.ScheduledTransferInput{Recipient: "alice", Amount: 10, StartAt: time.Now().Add(time.Hour)})
+	assert.EqualError(t, err, "cannot send money to yourself")
+	_, err = ss.Create(alice.ID, services.ScheduledTransferInput{Recipient: "bob", Amount: 10, StartAt: time.Now().Add(-time.Hour)})
+	assert.EqualError(t, err, "start time must be in the future")
+
+	st, err = ss.Pause(alice.ID, st.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusPaused, st.Status)
+
+	// Paused transfers do not run
+	makeDue(db, st.ID)
+	assert.NoError(t, ss.RunDue())
+	st, _ = ss.GetScheduledTransfer(alice.ID, st.ID)
+	assert.Zero(t, st.Occurrences)
+
+	amount, note := 15.0, "allowance"
+	st, err = ss.Update(alice.ID, st.ID, services.UpdateScheduledTransferInput{Amount: &amount, Note: &note})
+	assert.NoError(t, err)
+	assert.True(t, st.Amount.Equal(decimal.NewFromInt(15)))
+
+	// Resuming skips the occurrence missed while paused
+	st, err = ss.Resume(alice.ID, st.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusActive, st.Status)
+	assert.True(t, st.NextRunAt.After(time.Now()))
+
+	st, err = ss.Cancel(alice.ID, st.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScheduledTransferStatusCancelled, st.Status)
+	_, err = ss.Update(alice.ID, st.ID, services.UpdateScheduledTransferInput{Amount: &amount})
+	assert.EqualError(t, err, "only active or paused transfers can be edited")
+
+	_, err = ss.Pause("someone-else", st.ID)
+	assert.EqualError(t, err, "scheduled transfer not found")
+}
+
+func TestScheduledTransfersAreCheckedLikeTransfers(t *testing.T) {
+	db := setupTestDBScheduled()
+	alice, bob := seedRefundUsers(t, db)
+	ss := services.NewScheduledTransferService(db, newTransferVerification(db, 1000))
+
+	weekly, err := ss.Create(alice.ID, services.ScheduledTransferInput{Recipient: "bob", Amount: 20, Frequency: models.TransferFrequencyWeekly, StartAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+
+	// Scheduling a large transfer needs the emailed code
+	rent := services.ScheduledTransferInput{Recipient: "bob", Amount: 1500, StartAt: time.Now().Add(time.Hour)}
+	_, err = ss.Create(alice.ID, rent)
+	assert.ErrorIs(t, err, services.ErrTransferCodeRequired)
+
+	// After a burst of transfers it is blocked even with the code, and runs
+	// that fall due are screened again and not sent
+	sendBurst(db, alice, bob)
+	rent.Code = transferCode(db, alice.ID)
+	_, err = ss.Create(alice.ID, rent)
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+
+	makeDue(db, weekly.ID)
+	assert.NoError(t, ss.RunDue())
+	weekly, _ = ss.GetScheduledTransfer(alice.ID, weekly.ID)
+	assert.Equal(t, 1, weekly.FailureCount)
+	assert.Contains(t, weekly.LastError, "for review")
+	assert.True(t, balanceOf(t, db, bob.ID).IsZero())
+}
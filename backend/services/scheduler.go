@@ -0,0 +1,75 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Scheduler runs background jobs on fixed intervals or at a fixed time of
+// day. Each job runs on its own goroutine and never overlaps with itself.
+type Scheduler struct {
+	jobs []scheduledJob
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type scheduledJob struct {
+	name string
+	next func(now time.Time) time.Duration // delay until the next run
+	run  func() error
+}
+
+// NewScheduler creates an empty Scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{stop: make(chan struct{})}
+}
+
+// Every registers a job to run once per interval after Start
+func (s *Scheduler) Every(name string, interval time.Duration, run func() error) {
+	next := func(time.Time) time.Duration { return interval }
+	s.jobs = append(s.jobs, scheduledJob{name: name, next: next, run: run})
+}
+
+// DailyAt registers a job to run once a day at hour:minute server local time
+func (s *Scheduler) DailyAt(name string, hour, minute int, run func() error) {
+	next := func(now time.Time) time.Duration {
+		at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at.Sub(now)
+	}
+	s.jobs = append(s.jobs, scheduledJob{name: name, next: next, run: run})
+}
+
+// Start launches every registered job
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+	log.Printf("⏱️  Scheduler started with %d jobs", len(s.jobs))
+}
+
+// Stop signals every job to exit and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job scheduledJob) {
+	defer s.wg.Done()
+	for {
+		timer := time.NewTimer(job.next(time.Now()))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := job.run(); err != nil {
+				log.Printf("⚠️  Job %s failed: %v", job.name, err)
+			}
+		}
+	}
+}
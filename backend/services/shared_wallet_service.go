@@ -0,0 +1,705 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sharedCapWindow is the rolling period member spending caps cover
+const sharedCapWindow = 30 * 24 * time.Hour
+
+// SharedWalletService manages joint wallets: members and their roles,
+// contributions, and payouts with spending caps and approvals
+type SharedWalletService struct {
+	db           *gorm.DB
+	limitService *LimitService
+	transfers    *TransferService // checks payouts the way SendMoney checks transfers
+}
+
+// NewSharedWalletService creates a new SharedWalletService
+func NewSharedWalletService(db *gorm.DB, limitService *LimitService, transfers *TransferService) *SharedWalletService {
+	return &SharedWalletService{db: db, limitService: limitService, transfers: transfers}
+}
+
+// CreateSharedWalletInput is the DTO for opening a shared wallet
+type CreateSharedWalletInput struct {
+	Name              string   `json:"name" binding:"required"`
+	Currency          string   `json:"currency"`           // defaults to USD
+	ApprovalThreshold *float64 `json:"approval_threshold"` // payouts above it need approval
+}
+
+// UpdateSharedWalletInput is the DTO for changing a shared wallet's settings.
+// An approval threshold of 0 turns approvals off.
+type UpdateSharedWalletInput struct {
+	Name              *string  `json:"name"`
+	ApprovalThreshold *float64 `json:"approval_threshold"`
+}
+
+// SharedMemberInput is the DTO for adding a member
+type SharedMemberInput struct {
+	User        string   `json:"user" binding:"required"` // username, email, or phone
+	Role        string   `json:"role" binding:"required"`
+	SpendingCap *float64 `json:"spending_cap"`
+}
+
+// UpdateSharedMemberInput is the DTO for changing a member's role or cap
+type UpdateSharedMemberInput struct {
+	Role              *string  `json:"role"`
+	SpendingCap       *float64 `json:"spending_cap"`
+	RemoveSpendingCap bool     `json:"remove_spending_cap"`
+}
+
+// ContributeInput is the DTO for funding a shared wallet
+type ContributeInput struct {
+	Amount float64 `json:"amount" binding:"required"`
+	Note   string  `json:"note"`
+}
+
+// SharedPayoutInput is the DTO for paying out of a shared wallet
+type SharedPayoutInput struct {
+	Recipient string  `json:"recipient" binding:"required"` // username, email, or phone
+	Amount    float64 `json:"amount" binding:"required"`
+	Note      string  `json:"note"`
+	Code      string  `json:"code" binding:"omitempty,len=6"` // emailed one-time code, for large or flagged payouts
+}
+
+// Create opens a shared wallet with the caller as its owner
+func (s *SharedWalletService) Create(userID string, input CreateSharedWalletInput) (*models.SharedWallet, error) {
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := approvalThreshold(input.ApprovalThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := models.SharedWallet{Name: input.Name, Currency: currency, CreatedBy: userID, ApprovalThreshold: threshold}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The backing wallet is keyed by the shared wallet's ID, so pick it first
+		shared.ID = uuid.New().String()
+		wallet := models.Wallet{UserID: shared.ID, Currency: currency, Balance: decimal.Zero, IsActive: true}
+		if err := tx.Create(&wallet).Error; err != nil {
+			return errors.New("failed to open wallet")
+		}
+		shared.WalletID = wallet.ID
+		if err := tx.Create(&shared).Error; err != nil {
+			return errors.New("failed to create shared wallet")
+		}
+		owner := models.SharedWalletMember{SharedWalletID: shared.ID, UserID: userID, Role: models.SharedRoleOwner}
+		if err := tx.Create(&owner).Error; err != nil {
+			return errors.New("failed to add owner")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSharedWallet(userID, shared.ID)
+}
+
+// GetSharedWallets lists the shared wallets the user belongs to
+func (s *SharedWalletService) GetSharedWallets(userID string) ([]models.SharedWallet, error) {
+	var wallets []models.SharedWallet
+	if err := s.db.Preload("Wallet").
+		Where("id IN (?)", s.db.Model(&models.SharedWalletMember{}).Select("shared_wallet_id").Where("user_id = ?", userID)).
+		Order("created_at DESC").Find(&wallets).Error; err != nil {
+		return nil, errors.New("failed to fetch shared wallets")
+	}
+	return wallets, nil
+}
+
+// GetSharedWallet returns a shared wallet with its balance and members
+func (s *SharedWalletService) GetSharedWallet(userID, id string) (*models.SharedWallet, error) {
+	if _, err := membership(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var shared models.SharedWallet
+	if err := s.db.Preload("Wallet").Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).Preload("Members.User").Where("id = ?", id).First(&shared).Error; err != nil {
+		return nil, errors.New("shared wallet not found")
+	}
+	return &shared, nil
+}
+
+// Update changes a shared wallet's name or approval threshold. Owners only.
+func (s *SharedWalletService) Update(userID, id string, input UpdateSharedWalletInput) (*models.SharedWallet, error) {
+	if _, err := requireRole(s.db, id, userID, models.SharedRoleOwner); err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		if *input.Name == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		updates["name"] = *input.Name
+	}
+	if input.ApprovalThreshold != nil {
+		threshold, err := approvalThreshold(input.ApprovalThreshold)
+		if err != nil {
+			return nil, err
+		}
+		updates["approval_threshold"] = threshold
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&models.SharedWallet{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return nil, errors.New("failed to update shared wallet")
+		}
+	}
+	return s.GetSharedWallet(userID, id)
+}
+
+// AddMember adds a user to a shared wallet. Owners only.
+func (s *SharedWalletService) AddMember(userID, id string, input SharedMemberInput) (*models.SharedWalletMember, error) {
+	if _, err := requireRole(s.db, id, userID, models.SharedRoleOwner); err != nil {
+		return nil, err
+	}
+	if !validSharedRole(input.Role) {
+		return nil, errors.New("role must be owner, member, or viewer")
+	}
+	spendCap, err := spendingCap(input.SpendingCap)
+	if err != nil {
+		return nil, err
+	}
+	user, err := findRecipient(s.db, input.User)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	member := models.SharedWalletMember{SharedWalletID: id, UserID: user.ID, Role: input.Role, SpendingCap: spendCap}
+	if err := s.db.Create(&member).Error; err != nil {
+		return nil, errors.New("user is already a member")
+	}
+	member.User = user
+	return &member, nil
+}
+
+// UpdateMember changes a member's role or spending cap. Owners only.
+func (s *SharedWalletService) UpdateMember(userID, id, memberUserID string, input UpdateSharedMemberInput) (*models.SharedWalletMember, error) {
+	var member models.SharedWalletMember
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := requireRole(tx, id, userID, models.SharedRoleOwner); err != nil {
+			return err
+		}
+		locked, err := lockMembers(tx, id)
+		if err != nil {
+			return err
+		}
+		target, ok := locked[memberUserID]
+		if !ok {
+			return errors.New("member not found")
+		}
+		member = *target
+
+		updates := map[string]interface{}{}
+		if input.Role != nil {
+			if !validSharedRole(*input.Role) {
+				return errors.New("role must be owner, member, or viewer")
+			}
+			if member.Role == models.SharedRoleOwner && *input.Role != models.SharedRoleOwner && countOwners(locked) == 1 {
+				return errors.New("a shared wallet needs at least one owner")
+			}
+			updates["role"] = *input.Role
+		}
+		if input.RemoveSpendingCap {
+			updates["spending_cap"] = nil
+		} else if input.SpendingCap != nil {
+			spendCap, err := spendingCap(input.SpendingCap)
+			if err != nil {
+				return err
+			}
+			updates["spending_cap"] = spendCap
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&member).Updates(updates).Error; err != nil {
+			return errors.New("failed to update member")
+		}
+		return tx.Where("id = ?", member.ID).First(&member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveMember takes a user out of a shared wallet. Owners may remove anyone;
+// other members may only leave.
+func (s *SharedWalletService) RemoveMember(userID, id, memberUserID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockMembers(tx, id)
+		if err != nil {
+			return err
+		}
+		caller, ok := locked[userID]
+		if !ok {
+			return errors.New("shared wallet not found")
+		}
+		if memberUserID != userID && caller.Role != models.SharedRoleOwner {
+			return errors.New("only owners can remove other members")
+		}
+		target, ok := locked[memberUserID]
+		if !ok {
+			return errors.New("member not found")
+		}
+		if target.Role == models.SharedRoleOwner && countOwners(locked) == 1 {
+			return errors.New("a shared wallet needs at least one owner")
+		}
+		if err := tx.Delete(target).Error; err != nil {
+			return errors.New("failed to remove member")
+		}
+		return nil
+	})
+}
+
+// Contribute moves money from the member's own wallet into the shared wallet
+func (s *SharedWalletService) Contribute(userID, id string, input ContributeInput) (*models.SharedWallet, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := requireRole(tx, id, userID, models.SharedRoleOwner, models.SharedRoleMember); err != nil {
+			return err
+		}
+		// Payouts by the same member are checked against their cap one at a time
+		member, err := lockMember(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		var shared models.SharedWallet
+		if err := tx.Where("id = ?", member.SharedWalletID).First(&shared).Error; err != nil {
+			return errors.New("shared wallet not found")
+		}
+
+		personalID, err := walletIDForUser(tx, userID, shared.Currency)
+		if err != nil {
+			return errors.New("you need a " + shared.Currency + " wallet to contribute")
+		}
+		wallets, err := lockWallets(tx, personalID, shared.WalletID)
+		if err != nil {
+			return err
+		}
+		personal := wallets[personalID]
+		if !personal.IsActive {
+			return errors.New("wallet is not active")
+		}
+		if personal.Available().LessThan(amount) {
+			return errors.New("insufficient balance")
+		}
+
+		description := "Contribution to " + shared.Name
+		if input.Note != "" {
+			description += " - " + input.Note
+		}
+		entry, err := postJournal(tx, models.JournalTypeSharedDeposit, description,
+			debit(walletAccountCode(personalID), amount),
+			credit(walletAccountCode(shared.WalletID), amount),
+		)
+		if err != nil {
+			return err
+		}
+
+		rows := []models.Transaction{
+			{WalletID: personalID, FromUserID: &userID, Type: models.TransactionTypeSharedContribution},
+			{WalletID: shared.WalletID, FromUserID: &userID, Type: models.TransactionTypeSharedDeposit},
+		}
+		for i := range rows {
+			rows[i].Amount = amount
+			rows[i].Currency = shared.Currency
+			rows[i].Description = description
+			rows[i].Status = models.TransactionStatusSuccess
+			rows[i].JournalEntryID = &entry.ID
+			if err := tx.Create(&rows[i]).Error; err != nil {
+				return errors.New("failed to record transaction")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSharedWallet(userID, id)
+}
+
+// RequestPayout pays out of the shared wallet to any user, including the
+// requester. Payouts above the approval threshold wait for another member.
+func (s *SharedWalletService) RequestPayout(userID, id string, input SharedPayoutInput) (*models.SharedWalletPayout, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	recipient, err := findRecipient(s.db, input.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	// Payouts to someone else go through the same checks as SendMoney
+	if recipient.ID != userID {
+		if _, err := requireRole(s.db, id, userID, models.SharedRoleOwner, models.SharedRoleMember); err != nil {
+			return nil, err
+		}
+		var shared models.SharedWallet
+		if err := s.db.Where("id = ?", id).First(&shared).Error; err != nil {
+			return nil, errors.New("shared wallet not found")
+		}
+		if err := s.transfers.verify(userID, "shared_payout", amount, shared.Currency, input.Code); err != nil {
+			return nil, err
+		}
+	}
+
+	var payout models.SharedWalletPayout
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		member, err := requireRole(tx, id, userID, models.SharedRoleOwner, models.SharedRoleMember)
+		if err != nil {
+			return err
+		}
+		var shared models.SharedWallet
+		if err := tx.Where("id = ?", id).First(&shared).Error; err != nil {
+			return errors.New("shared wallet not found")
+		}
+
+		payout = models.SharedWalletPayout{
+			SharedWalletID: id,
+			RequestedBy:    userID,
+			RecipientID:    recipient.ID,
+			Amount:         amount,
+			Note:           input.Note,
+			Status:         models.SharedPayoutPending,
+		}
+		if err := checkSpendingCap(tx, member, amount, ""); err != nil {
+			return err
+		}
+		if err := tx.Create(&payout).Error; err != nil {
+			return errors.New("failed to create payout")
+		}
+
+		if shared.ApprovalThreshold != nil && amount.GreaterThan(*shared.ApprovalThreshold) {
+			return notifyApprovers(tx, &shared, &payout)
+		}
+		return s.executePayout(tx, &shared, &payout)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getPayout(id, payout.ID)
+}
+
+// ApprovePayout lets another owner or member approve a pending payout, which
+// is then paid at once
+func (s *SharedWalletService) ApprovePayout(userID, id, payoutID string) (*models.SharedWalletPayout, error) {
+	return s.decidePayout(userID, id, payoutID, true)
+}
+
+// RejectPayout lets another owner or member decline a pending payout
+func (s *SharedWalletService) RejectPayout(userID, id, payoutID string) (*models.SharedWalletPayout, error) {
+	return s.decidePayout(userID, id, payoutID, false)
+}
+
+func (s *SharedWalletService) decidePayout(userID, id, payoutID string, approve bool) (*models.SharedWalletPayout, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := requireRole(tx, id, userID, models.SharedRoleOwner, models.SharedRoleMember); err != nil {
+			return err
+		}
+		var payout models.SharedWalletPayout
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND shared_wallet_id = ?", payoutID, id).First(&payout).Error; err != nil {
+			return errors.New("payout not found")
+		}
+		if payout.Status != models.SharedPayoutPending {
+			return errors.New("payout is not pending")
+		}
+		if payout.RequestedBy == userID {
+			return errors.New("payouts must be approved by another member")
+		}
+		var shared models.SharedWallet
+		if err := tx.Where("id = ?", id).First(&shared).Error; err != nil {
+			return errors.New("shared wallet not found")
+		}
+
+		now := time.Now()
+		payout.DecidedBy = &userID
+		payout.DecidedAt = &now
+		if !approve {
+			payout.Status = models.SharedPayoutRejected
+			if err := tx.Save(&payout).Error; err != nil {
+				return errors.New("failed to update payout")
+			}
+			body := "Your payout of " + payout.Amount.StringFixed(2) + " " + shared.Currency + " from " + shared.Name + " was declined."
+			_, err := createNotification(tx, payout.RequestedBy, "payment", "Payout declined", body, "🚫", "")
+			return err
+		}
+
+		// The requester may have left or lost spending rights since asking
+		requester, err := lockMember(tx, id, payout.RequestedBy)
+		if err != nil || requester.Role == models.SharedRoleViewer {
+			return errors.New("requester can no longer spend from this wallet")
+		}
+		if err := checkSpendingCap(tx, requester, payout.Amount, payout.ID); err != nil {
+			return err
+		}
+		if err := s.executePayout(tx, &shared, &payout); err != nil {
+			return err
+		}
+		body := "Your payout of " + payout.Amount.StringFixed(2) + " " + shared.Currency + " from " + shared.Name + " was approved and sent."
+		_, err = createNotification(tx, payout.RequestedBy, "payment", "Payout approved", body, "✅", "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getPayout(id, payoutID)
+}
+
+// executePayout moves a payout's money from the shared wallet to the
+// recipient inside tx and marks it executed
+func (s *SharedWalletService) executePayout(tx *gorm.DB, shared *models.SharedWallet, payout *models.SharedWalletPayout) error {
+	recipientWalletID, err := ensureWallet(tx, payout.RecipientID, shared.Currency)
+	if err != nil {
+		return errors.New("recipient wallet not found")
+	}
+	wallets, err := lockWallets(tx, shared.WalletID, recipientWalletID)
+	if err != nil {
+		return err
+	}
+	if wallets[shared.WalletID].Available().LessThan(payout.Amount) {
+		return errors.New("insufficient balance")
+	}
+	if !wallets[recipientWalletID].IsActive {
+		return errors.New("recipient wallet is not active")
+	}
+	// Paying someone else counts towards the requester's own P2P limit
+	if payout.RecipientID != payout.RequestedBy {
+		if err := s.limitService.reserve(tx, payout.RequestedBy, models.LimitCategoryP2P, payout.Amount, shared.Currency, payout.ID); err != nil {
+			return err
+		}
+	}
+
+	description := "Payout from " + shared.Name
+	if payout.Note != "" {
+		description += " - " + payout.Note
+	}
+	entry, err := postJournal(tx, models.JournalTypeSharedPayout, description,
+		debit(walletAccountCode(shared.WalletID), payout.Amount),
+		credit(walletAccountCode(recipientWalletID), payout.Amount),
+	)
+	if err != nil {
+		return err
+	}
+
+	requester := payout.RequestedBy
+	recipient := payout.RecipientID
+	debitTxn := models.Transaction{
+		WalletID:       shared.WalletID,
+		FromUserID:     &requester,
+		ToUserID:       &recipient,
+		Type:           models.TransactionTypeSharedPayout,
+		Amount:         payout.Amount,
+		Currency:       shared.Currency,
+		Description:    description,
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	creditTxn := debitTxn
+	creditTxn.WalletID = recipientWalletID
+	creditTxn.Type = models.TransactionTypeP2PReceive
+	for _, t := range []*models.Transaction{&debitTxn, &creditTxn} {
+		if err := tx.Create(t).Error; err != nil {
+			return errors.New("failed to record transaction")
+		}
+	}
+
+	payout.Status = models.SharedPayoutExecuted
+	payout.TransactionID = &debitTxn.ID
+	if err := tx.Save(payout).Error; err != nil {
+		return errors.New("failed to update payout")
+	}
+	return nil
+}
+
+// GetPayouts lists a shared wallet's payouts, optionally filtered by status
+func (s *SharedWalletService) GetPayouts(userID, id, status string) ([]models.SharedWalletPayout, error) {
+	if _, err := membership(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	query := s.db.Preload("Requester").Preload("Recipient").Where("shared_wallet_id = ?", id)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var payouts []models.SharedWalletPayout
+	if err := query.Order("created_at DESC").Find(&payouts).Error; err != nil {
+		return nil, errors.New("failed to fetch payouts")
+	}
+	return payouts, nil
+}
+
+// GetTransactions returns the shared wallet's history. FromUser on each row
+// is the member who contributed or paid out.
+func (s *SharedWalletService) GetTransactions(userID, id string, query TransactionQuery) (*TransactionListResponse, error) {
+	if _, err := membership(s.db, id, userID); err != nil {
+		return nil, err
+	}
+	var shared models.SharedWallet
+	if err := s.db.Select("id", "wallet_id").Where("id = ?", id).First(&shared).Error; err != nil {
+		return nil, errors.New("shared wallet not found")
+	}
+	return listTransactions(s.db, []string{shared.WalletID}, query)
+}
+
+func (s *SharedWalletService) getPayout(id, payoutID string) (*models.SharedWalletPayout, error) {
+	var payout models.SharedWalletPayout
+	if err := s.db.Preload("Requester").Preload("Recipient").
+		Where("id = ? AND shared_wallet_id = ?", payoutID, id).First(&payout).Error; err != nil {
+		return nil, errors.New("payout not found")
+	}
+	return &payout, nil
+}
+
+// membership returns the user's membership of a shared wallet. Non-members
+// are told the wallet does not exist.
+func membership(db *gorm.DB, id, userID string) (*models.SharedWalletMember, error) {
+	var member models.SharedWalletMember
+	if err := db.Where("shared_wallet_id = ? AND user_id = ?", id, userID).First(&member).Error; err != nil {
+		return nil, errors.New("shared wallet not found")
+	}
+	return &member, nil
+}
+
+// lockMember loads a member with SELECT ... FOR UPDATE
+func lockMember(tx *gorm.DB, id, userID string) (*models.SharedWalletMember, error) {
+	var member models.SharedWalletMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("shared_wallet_id = ? AND user_id = ?", id, userID).First(&member).Error; err != nil {
+		return nil, errors.New("shared wallet not found")
+	}
+	return &member, nil
+}
+
+// requireRole returns the user's membership if it has one of roles
+func requireRole(db *gorm.DB, id, userID string, roles ...string) (*models.SharedWalletMember, error) {
+	member, err := membership(db, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return member, nil
+		}
+	}
+	if len(roles) == 1 && roles[0] == models.SharedRoleOwner {
+		return nil, errors.New("only owners can do this")
+	}
+	return nil, errors.New("viewers cannot move money")
+}
+
+// lockMembers locks every membership of a shared wallet, keyed by user ID,
+// so role changes cannot race each other out of the last owner
+func lockMembers(tx *gorm.DB, id string) (map[string]*models.SharedWalletMember, error) {
+	var rows []models.SharedWalletMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("shared_wallet_id = ?", id).Order("id").Find(&rows).Error; err != nil {
+		return nil, errors.New("failed to load members")
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("shared wallet not found")
+	}
+	members := make(map[string]*models.SharedWalletMember, len(rows))
+	for i := range rows {
+		members[rows[i].UserID] = &rows[i]
+	}
+	return members, nil
+}
+
+func countOwners(members map[string]*models.SharedWalletMember) int {
+	n := 0
+	for _, m := range members {
+		if m.Role == models.SharedRoleOwner {
+			n++
+		}
+	}
+	return n
+}
+
+// checkSpendingCap rejects a payout that would take the member past their
+// cap. Pending payouts count, except the one being decided (skipID).
+func checkSpendingCap(tx *gorm.DB, member *models.SharedWalletMember, amount decimal.Decimal, skipID string) error {
+	if member.SpendingCap == nil {
+		return nil
+	}
+	query := tx.Model(&models.SharedWalletPayout{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("shared_wallet_id = ? AND requested_by = ? AND status IN ? AND created_at > ?",
+			member.SharedWalletID, member.UserID,
+			[]string{models.SharedPayoutPending, models.SharedPayoutExecuted}, time.Now().Add(-sharedCapWindow))
+	if skipID != "" {
+		query = query.Where("id <> ?", skipID)
+	}
+	var used decimal.Decimal
+	if err := query.Scan(&used).Error; err != nil {
+		return errors.New("failed to sum payouts")
+	}
+	// Some databases sum decimals as floats; amounts are whole cents
+	if used.Round(2).Add(amount).GreaterThan(*member.SpendingCap) {
+		remaining := member.SpendingCap.Sub(used.Round(2))
+		if remaining.IsNegative() {
+			remaining = decimal.Zero
+		}
+		return errors.New("spending cap exceeded: " + remaining.StringFixed(2) + " remaining")
+	}
+	return nil
+}
+
+// notifyApprovers tells every other owner and member a payout needs approval
+func notifyApprovers(tx *gorm.DB, shared *models.SharedWallet, payout *models.SharedWalletPayout) error {
+	var approvers []models.SharedWalletMember
+	if err := tx.Where("shared_wallet_id = ? AND user_id <> ? AND role IN ?", shared.ID, payout.RequestedBy,
+		[]string{models.SharedRoleOwner, models.SharedRoleMember}).Find(&approvers).Error; err != nil {
+		return errors.New("failed to load members")
+	}
+	if len(approvers) == 0 {
+		return errors.New("no other member can approve this payout")
+	}
+	body := "A payout of " + payout.Amount.StringFixed(2) + " " + shared.Currency + " from " + shared.Name + " needs your approval."
+	for _, m := range approvers {
+		if _, err := createNotification(tx, m.UserID, "payment", "Payout needs approval", body, "👥", ""); err != nil {
+			return errors.New("failed to notify members")
+		}
+	}
+	return nil
+}
+
+func validSharedRole(role string) bool {
+	return role == models.SharedRoleOwner || role == models.SharedRoleMember || role == models.SharedRoleViewer
+}
+
+// approvalThreshold converts an optional threshold, where 0 means no approvals
+func approvalThreshold(value *float64) (*decimal.Decimal, error) {
+	if value == nil || *value == 0 {
+		return nil, nil
+	}
+	threshold := decimal.NewFromFloat(*value)
+	if threshold.IsNegative() {
+		return nil, errors.New("approval threshold cannot be negative")
+	}
+	return &threshold, nil
+}
+
+func spendingCap(value *float64) (*decimal.Decimal, error) {
+	if value == nil {
+		return nil, nil
+	}
+	spendCap := decimal.NewFromFloat(*value)
+	if spendCap.IsNegative() {
+		return nil, errors.New("spending cap cannot be negative")
+	}
+	return &spendCap, nil
+}
@@ -0,0 +1,155 @@
+package services_test
+
+import (
+	"testing"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBShared() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Hold{}, &models.LimitUsage{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{},
+		&models.SharedWallet{}, &models.SharedWalletMember{}, &models.SharedWalletPayout{}, &models.TransactionAnnotation{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.ReconciliationRun{}, &models.ReconciliationMismatch{}, &models.ReconciliationDiscrepancy{})
+	return db
+}
+
+func TestSharedWalletRolesAndSpendingCaps(t *testing.T) {
+	db := setupTestDBShared()
+	alice, bob := seedRefundUsers(t, db)
+	carol := models.User{Email: "c@test.com", Username: "carol", Phone: "3", FirstName: "C", LastName: "C"}
+	db.Create(&carol)
+	ss := services.NewSharedWalletService(db, nil, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+	ws := services.NewWalletService(db, nil)
+
+	shared, err := ss.Create(alice.ID, services.CreateSharedWalletInput{Name: "Apartment"})
+	assert.NoError(t, err)
+	assert.Len(t, shared.Members, 1)
+	assert.Equal(t, models.SharedRoleOwner, shared.Members[0].Role)
+
+	spendCap := 50.0
+	_, err = ss.AddMember(alice.ID, shared.ID, services.SharedMemberInput{User: "bob", Role: models.SharedRoleMember, SpendingCap: &spendCap})
+	assert.NoError(t, err)
+	_, err = ss.AddMember(alice.ID, shared.ID, services.SharedMemberInput{User: "carol", Role: models.SharedRoleViewer})
+	assert.NoError(t, err)
+	_, err = ss.AddMember(bob.ID, shared.ID, services.SharedMemberInput{User: "carol", Role: models.SharedRoleOwner})
+	assert.EqualError(t, err, "only owners can do this")
+
+	shared, err = ss.Contribute(alice.ID, shared.ID, services.ContributeInput{Amount: 100, Note: "rent"})
+	assert.NoError(t, err)
+	assert.True(t, shared.Wallet.Balance.Equal(decimal.NewFromInt(100)))
+	personal, _ := ws.GetWallet(alice.ID)
+	assert.True(t, personal.Balance.Equal(decimal.NewFromInt(100)))
+
+	payout, err := ss.RequestPayout(bob.ID, shared.ID, services.SharedPayoutInput{Recipient: "bob", Amount: 40, Note: "groceries"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.SharedPayoutExecuted, payout.Status)
+	_, err = ss.RequestPayout(bob.ID, shared.ID, services.SharedPayoutInput{Recipient: "bob", Amount: 20})
+	assert.EqualError(t, err, "spending cap exceeded: 10.00 remaining")
+	_, err = ss.RequestPayout(carol.ID, shared.ID, services.SharedPayoutInput{Recipient: "carol", Amount: 5})
+	assert.EqualError(t, err, "viewers cannot move money")
+	_, err = ss.GetSharedWallet("stranger", shared.ID)
+	assert.EqualError(t, err, "shared wallet not found")
+
+	bobWallet, _ := ws.GetWallet(bob.ID)
+	assert.True(t, bobWallet.Balance.Equal(decimal.NewFromInt(40)))
+
+	// The history shows which member moved the money; viewers can read it
+	history, err := ss.GetTransactions(carol.ID, shared.ID, services.TransactionQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, history.Transactions, 2)
+	assert.Equal(t, models.TransactionTypeSharedPayout, history.Transactions[0].Type)
+	assert.Equal(t, "bob", history.Transactions[0].FromUser.Username)
+	assert.Equal(t, models.TransactionTypeSharedDeposit, history.Transactions[1].Type)
+	assert.Equal(t, "alice", history.Transactions[1].FromUser.Username)
+
+	// Owners cannot leave the wallet ownerless
+	err = ss.RemoveMember(alice.ID, shared.ID, alice.ID)
+	assert.EqualError(t, err, "a shared wallet needs at least one owner")
+	assert.NoError(t, ss.RemoveMember(carol.ID, shared.ID, carol.ID))
+
+	run, err := services.NewReconciliationService(db).Run(models.ReconciliationTriggerManual)
+	assert.NoError(t, err)
+	assert.Zero(t, run.MismatchCount)
+}
+
+func TestSharedWalletPayoutApprovals(t *testing.T) {
+	db := setupTestDBShared()
+	alice, bob := seedRefundUsers(t, db)
+	ss := services.NewSharedWalletService(db, nil, allowTransfers(db, services.NewTransferService(db, services.NewRewardService(db), nil, nil)))
+
+	threshold := 50.0
+	shared, err := ss.Create(alice.ID, services.CreateSharedWalletInput{Name: "Household", ApprovalThreshold: &threshold})
+	assert.NoError(t, err)
+	_, err = ss.Contribute(alice.ID, shared.ID, services.ContributeInput{Amount: 150})
+	assert.NoError(t, err)
+
+	// With nobody to approve, large payouts cannot be requested
+	_, err = ss.RequestPayout(alice.ID, shared.ID, services.SharedPayoutInput{Recipient: "alice", Amount: 80})
+	assert.EqualError(t, err, "no other member can approve this payout")
+
+	_, err = ss.AddMember(alice.ID, shared.ID, services.SharedMemberInput{User: "bob", Role: models.SharedRoleMember})
+	assert.NoError(t, err)
+
+	// Small payouts go straight through
+	small, err := ss.RequestPayout(alice.ID, shared.ID, services.SharedPayoutInput{Recipient: "alice", Amount: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, models.SharedPayoutExecuted, small.Status)
+
+	payout, err := ss.RequestPayout(alice.ID, shared.ID, services.SharedPayoutInput{Recipient: "bob", Amount: 80, Note: "utilities"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.SharedPayoutPending, payout.Status)
+	var notifications int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title = ?", bob.ID, "Payout needs approval").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	_, err = ss.ApprovePayout(alice.ID, shared.ID, payout.ID)
+	assert.EqualError(t, err, "payouts must be approved by another member")
+	payout, err = ss.ApprovePayout(bob.ID, shared.ID, payout.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SharedPayoutExecuted, payout.Status)
+	assert.Equal(t, bob.ID, *payout.DecidedBy)
+	_, err = ss.RejectPayout(bob.ID, shared.ID, payout.ID)
+	assert.EqualError(t, err, "payout is not pending")
+
+	rejected, err := ss.RequestPayout(alice.ID, shared.ID, services.SharedPayoutInput{Recipient: "alice", Amount: 60})
+	assert.NoError(t, err)
+	rejected, err = ss.RejectPayout(bob.ID, shared.ID, rejected.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SharedPayoutRejected, rejected.Status)
+
+	shared, _ = ss.GetSharedWallet(bob.ID, shared.ID)
+	assert.True(t, shared.Wallet.Balance.Equal(decimal.NewFromInt(40)))
+	bobWallet, _ := services.NewWalletService(db, nil).GetWallet(bob.ID)
+	assert.True(t, bobWallet.Balance.Equal(decimal.NewFromInt(80)))
+
+	pending, err := ss.GetPayouts(alice.ID, shared.ID, models.SharedPayoutPending)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestBlockedSharedPayoutIsRefused(t *testing.T) {
+	db := setupTestDBShared()
+	alice, bob := seedRefundUsers(t, db)
+	ss := services.NewSharedWalletService(db, nil, newTransferVerification(db, 1000))
+
+	shared, err := ss.Create(alice.ID, services.CreateSharedWalletInput{Name: "Savings"})
+	assert.NoError(t, err)
+
+	sendBurst(db, alice, bob)
+	_, err = ss.RequestPayout(alice.ID, shared.ID, services.SharedPayoutInput{Recipient: "bob", Amount: 1500})
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+	var payouts int64
+	db.Model(&models.SharedWalletPayout{}).Count(&payouts)
+	assert.Zero(t, payouts)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gatorpay-backend/config"
+)
+
+// SMSService handles sending text messages (phone verification codes, etc.)
+// through an HTTP SMS gateway
+type SMSService struct {
+	cfg    *config.Config
+	client *http.Client
+}
+
+// NewSMSService creates a new SMSService
+func NewSMSService(cfg *config.Config) *SMSService {
+	return &SMSService{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// IsConfigured returns true if an SMS gateway is set up
+func (s *SMSService) IsConfigured() bool {
+	return s.cfg.SMSGatewayURL != ""
+}
+
+// SendOTP texts an OTP code to a phone number, or prints to console if no
+// gateway is configured
+func (s *SMSService) SendOTP(phone, code, purpose string) error {
+	if !s.IsConfigured() {
+		// Dev mode: print to console
+		log.Printf("📱 [DEV] OTP for %s (%s): %s", phone, purpose, code)
+		return nil
+	}
+
+	body := fmt.Sprintf("Your GatorPay verification code is %s. It expires in 5 minutes.", code)
+	if err := s.send(phone, body); err != nil {
+		log.Printf("❌ Failed to text %s: %v", phone, err)
+		return errors.New("failed to send text message")
+	}
+
+	log.Printf("📱 OTP sent to %s for %s", phone, purpose)
+	return nil
+}
+
+// SendClaimLink tells someone without an account that money is waiting for
+// them, or prints the link to console if no gateway is configured
+func (s *SMSService) SendClaimLink(phone, senderName, amount, link string) error {
+	if !s.IsConfigured() {
+		log.Printf("📱 [DEV] Claim link for %s (%s from %s): %s", phone, amount, senderName, link)
+		return nil
+	}
+
+	body := fmt.Sprintf("%s sent you %s on GatorPay. Sign up with this phone number to claim it: %s", senderName, amount, link)
+	if err := s.send(phone, body); err != nil {
+		log.Printf("❌ Failed to text %s: %v", phone, err)
+		return err
+	}
+
+	log.Printf("📱 Claim link sent to %s", phone)
+	return nil
+}
+
+// send posts a message for a 10-digit US phone number to the gateway
+func (s *SMSService) send(phone, body string) error {
+	payload, err := json.Marshal(map[string]string{"from": s.cfg.SMSFrom, "to": "+1" + phone, "body": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.cfg.SMSGatewayURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.SMSGatewayToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.SMSGatewayToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("gateway answered %s", resp.Status)
+	}
+	return nil
+}
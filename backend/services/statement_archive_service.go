@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxStatementSize bounds files uploaded for verification
+const maxStatementSize = 10 << 20 // 10 MB
+
+// StatementArchiveService issues each wallet's monthly PDF statement, keeps
+// it in a BlobStore and signs its digest so it can later be shown to be
+// unchanged
+type StatementArchiveService struct {
+	db         *gorm.DB
+	statements *StatementService
+	store      BlobStore
+	key        ed25519.PrivateKey
+	keyID      string
+}
+
+// NewStatementArchiveService creates a new StatementArchiveService that
+// signs with key
+func NewStatementArchiveService(db *gorm.DB, statements *StatementService, store BlobStore, key ed25519.PrivateKey) *StatementArchiveService {
+	return &StatementArchiveService{db: db, statements: statements, store: store, key: key, keyID: signingKeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// NewStatementSigningKey decodes a base64 Ed25519 seed. Without one, a key
+// is derived from fallbackSecret so development setups still sign; production
+// should set a dedicated key.
+func NewStatementSigningKey(encoded, fallbackSecret string) (ed25519.PrivateKey, error) {
+	if encoded == "" {
+		seed := sha256.Sum256([]byte("gatorpay-statement-key:" + fallbackSecret))
+		return ed25519.NewKeyFromSeed(seed[:]), nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("statement signing key must be a base64 32-byte Ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// signingKeyID is a short fingerprint of a public key, recorded with each
+// signature so keys can be rotated
+func signingKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SigningKey is the public half of the statement key, for verifying
+// signatures outside GatorPay
+type SigningKey struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // base64
+}
+
+// StatementVerification is the outcome of checking a statement file
+type StatementVerification struct {
+	Valid          bool       `json:"valid"`
+	DigestMatches  bool       `json:"digest_matches"`  // the file is byte-for-byte the one issued
+	SignatureValid bool       `json:"signature_valid"` // the archive record is the one GatorPay signed
+	SHA256         string     `json:"sha256"`          // digest of the file that was checked
+	Reason         string     `json:"reason,omitempty"`
+	StatementID    string     `json:"statement_id,omitempty"`
+	UserID         string     `json:"user_id,omitempty"`
+	Period         string     `json:"period,omitempty"`
+	IssuedAt       *time.Time `json:"issued_at,omitempty"`
+}
+
+// GetSigningKey returns the public key statements are signed with
+func (s *StatementArchiveService) GetSigningKey() SigningKey {
+	return SigningKey{
+		KeyID:     s.keyID,
+		Algorithm: "Ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+	}
+}
+
+// RunDue issues last month's statements for any wallet still missing one.
+// It is safe to run repeatedly.
+func (s *StatementArchiveService) RunDue() error {
+	lastMonth := time.Now().UTC().AddDate(0, -1, 0)
+	n, err := s.IssueMonth(lastMonth.Format("2006-01"))
+	if n > 0 {
+		log.Printf("🧾 Issued %d statements for %s", n, lastMonth.Format("2006-01"))
+	}
+	return err
+}
+
+// IssueMonth issues the statement for a past month (YYYY-MM) for every
+// wallet that existed then and does not have one yet. It returns how many
+// were issued.
+func (s *StatementArchiveService) IssueMonth(period string) (int, error) {
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return 0, errors.New("period must be YYYY-MM")
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(time.Now().UTC()) {
+		return 0, errors.New("statements can only be issued for past months")
+	}
+
+	// Only users' own wallets; shared wallets have no holder to send to
+	var wallets []models.Wallet
+	if err := s.db.Joins("JOIN users ON users.id = wallets.user_id").
+		Where("wallets.created_at < ?", end).
+		Where("NOT EXISTS (SELECT 1 FROM archived_statements a WHERE a.wallet_id = wallets.id AND a.period = ?)", period).
+		Order("wallets.created_at ASC").Find(&wallets).Error; err != nil {
+		return 0, errors.New("failed to fetch wallets")
+	}
+
+	issued := 0
+	var firstErr error
+	for _, w := range wallets {
+		if _, err := s.issue(w, period, start, end); err != nil {
+			log.Printf("⚠️  Statement %s for wallet %s: %v", period, w.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		issued++
+	}
+	return issued, firstErr
+}
+
+// issue renders, stores and signs one wallet's statement
+func (s *StatementArchiveService) issue(wallet models.Wallet, period string, start, end time.Time) (*models.ArchivedStatement, error) {
+	st, err := s.statements.BuildStatement(wallet.UserID, StatementQuery{
+		Currency: wallet.Currency,
+		Start:    start.Format("2006-01-02"),
+		End:      end.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	st.GeneratedAt = issuedAt
+	data := generatePDF(st)
+	digest := sha256.Sum256(data)
+
+	record := models.ArchivedStatement{
+		ID:       uuid.New().String(),
+		UserID:   wallet.UserID,
+		WalletID: wallet.ID,
+		Currency: wallet.Currency,
+		Period:   period,
+		Opening:  st.Opening,
+		Closing:  st.Closing,
+		FileName: fmt.Sprintf("statement-%s-%s.pdf", wallet.Currency, period),
+		Size:     int64(len(data)),
+		SHA256:   hex.EncodeToString(digest[:]),
+		KeyID:    s.keyID,
+		IssuedAt: issuedAt,
+	}
+	record.BlobKey = "statements/" + wallet.UserID + "/" + record.ID + ".pdf"
+	record.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, signedStatementMessage(&record)))
+
+	if err := s.store.Put(record.BlobKey, bytes.NewReader(data)); err != nil {
+		return nil, errors.New("failed to store statement")
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return errors.New("failed to save statement")
+		}
+		body := fmt.Sprintf("Your %s statement for %s is ready.", wallet.Currency, start.Format("January 2006"))
+		_, err := createNotification(tx, wallet.UserID, "system", "Statement ready", body, "🧾", "/wallet/statements/"+record.ID)
+		return err
+	})
+	if err != nil {
+		// Another run may have issued it first; the stored file is unused
+		s.store.Delete(record.BlobKey)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// signedStatementMessage is what a statement's signature covers: the file
+// digest plus the record fields a reader relies on
+func signedStatementMessage(st *models.ArchivedStatement) []byte {
+	return []byte(fmt.Sprintf("gatorpay-statement:v1\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
+		st.ID, st.UserID, st.WalletID, st.Currency, st.Period,
+		st.Opening.StringFixed(2), st.Closing.StringFixed(2),
+		st.IssuedAt.UTC().Format(time.RFC3339), st.SHA256))
+}
+
+// GetStatements lists a user's issued statements, newest first
+func (s *StatementArchiveService) GetStatements(userID string) ([]models.ArchivedStatement, error) {
+	var statements []models.ArchivedStatement
+	if err := s.db.Where("user_id = ?", userID).Order("period DESC, currency ASC").Find(&statements).Error; err != nil {
+		return nil, errors.New("failed to fetch statements")
+	}
+	return statements, nil
+}
+
+// OpenStatement returns an issued statement and its file. The caller must
+// close the reader.
+func (s *StatementArchiveService) OpenStatement(userID, statementID string) (*models.ArchivedStatement, io.ReadCloser, error) {
+	var st models.ArchivedStatement
+	if err := s.db.Where("id = ? AND user_id = ?", statementID, userID).First(&st).Error; err != nil {
+		return nil, nil, errors.New("statement not found")
+	}
+	body, err := s.store.Get(st.BlobKey)
+	if err != nil {
+		return nil, nil, errors.New("statement file is missing")
+	}
+	return &st, body, nil
+}
+
+// Verify checks that a user's stored statement is still the one issued
+func (s *StatementArchiveService) Verify(userID, statementID string) (*StatementVerification, error) {
+	st, body, err := s.OpenStatement(userID, statementID)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.New("failed to read statement")
+	}
+	return s.check(st, data), nil
+}
+
+// VerifyDocument checks a statement file presented by anyone, e.g. a copy a
+// customer sent to a lender, against the archive
+func (s *StatementArchiveService) VerifyDocument(r io.Reader) (*StatementVerification, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxStatementSize+1))
+	if err != nil {
+		return nil, errors.New("failed to read upload")
+	}
+	if len(data) > maxStatementSize {
+		return nil, errors.New("file is too large to be a statement")
+	}
+	digest := sha256.Sum256(data)
+	var st models.ArchivedStatement
+	err = s.db.Where("sha256 = ?", hex.EncodeToString(digest[:])).First(&st).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &StatementVerification{
+			SHA256: hex.EncodeToString(digest[:]),
+			Reason: "no statement was issued with this content",
+		}, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to look up statement")
+	}
+	return s.check(&st, data), nil
+}
+
+// check compares a file with its archive record and the record with its signature
+func (s *StatementArchiveService) check(st *models.ArchivedStatement, data []byte) *StatementVerification {
+	digest := sha256.Sum256(data)
+	issuedAt := st.IssuedAt
+	v := &StatementVerification{
+		SHA256:      hex.EncodeToString(digest[:]),
+		StatementID: st.ID,
+		UserID:      st.UserID,
+		Period:      st.Period,
+		IssuedAt:    &issuedAt,
+	}
+	v.DigestMatches = v.SHA256 == st.SHA256
+
+	signature, err := base64.StdEncoding.DecodeString(st.Signature)
+	switch {
+	case st.KeyID != s.keyID:
+		v.Reason = "statement was signed with key " + st.KeyID + ", which is not the current key"
+	case err != nil || !ed25519.Verify(s.key.Public().(ed25519.PublicKey), signedStatementMessage(st), signature):
+		v.Reason = "archive record does not match its signature"
+	default:
+		v.SignatureValid = true
+	}
+	if v.SignatureValid && !v.DigestMatches {
+		v.Reason = "file has been changed since it was issued"
+	}
+	v.Valid = v.DigestMatches && v.SignatureValid
+	return v
+}
@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBArchive() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.Notification{}, &models.ArchivedStatement{})
+	return db
+}
+
+func TestMonthlyStatementArchive(t *testing.T) {
+	db := setupTestDBArchive()
+	dir := t.TempDir()
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	archive := services.NewStatementArchiveService(db, services.NewStatementService(db), services.NewLocalBlobStore(dir), key)
+
+	alice := "alice"
+	opened := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	db.Create(&models.User{ID: alice, Email: "a@example.com", Username: "alice", Phone: "1", FirstName: "Alice", LastName: "Ng"})
+	db.Create(&models.Wallet{ID: "wa", UserID: alice, Currency: "USD", IsActive: true, CreatedAt: opened})
+	db.Create(&models.Wallet{ID: "wb", UserID: alice, Currency: "EUR", IsActive: true, CreatedAt: opened.AddDate(0, 2, 0)})
+	// A shared wallet's money has no holder of its own and gets no statement
+	db.Create(&models.Wallet{ID: "ws", UserID: "shared-1", Currency: "USD", IsActive: true, CreatedAt: opened})
+	db.Create(&models.Transaction{WalletID: "wa", ToUserID: &alice, Type: models.TransactionTypeDeposit,
+		Amount: decimal.NewFromInt(250), Status: models.TransactionStatusSuccess, CreatedAt: opened.AddDate(0, 0, 2)})
+
+	_, err := archive.IssueMonth("2025-13")
+	assert.EqualError(t, err, "period must be YYYY-MM")
+	_, err = archive.IssueMonth(time.Now().UTC().Format("2006-01"))
+	assert.EqualError(t, err, "statements can only be issued for past months")
+
+	// Only the USD wallet existed in January
+	n, err := archive.IssueMonth("2025-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = archive.IssueMonth("2025-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n, "issuing again is a no-op")
+
+	statements, err := archive.GetStatements(alice)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+	st := statements[0]
+	assert.Equal(t, "2025-01", st.Period)
+	assert.True(t, st.Closing.Equal(decimal.NewFromInt(250)))
+	assert.Equal(t, archive.GetSigningKey().KeyID, st.KeyID)
+
+	var notifications int64
+	db.Model(&models.Notification{}).Where("user_id = ?", alice).Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	// The stored file is the signed one
+	_, body, err := archive.OpenStatement(alice, st.ID)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	sum := sha256.Sum256(data)
+	assert.Equal(t, st.SHA256, hex.EncodeToString(sum[:]))
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+
+	check, err := archive.Verify(alice, st.ID)
+	assert.NoError(t, err)
+	assert.True(t, check.Valid)
+	_, err = archive.Verify("bob", st.ID)
+	assert.EqualError(t, err, "statement not found")
+
+	// A copy checked by compliance is found by its content
+	check, err = archive.VerifyDocument(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, check.Valid)
+	assert.Equal(t, st.ID, check.StatementID)
+
+	altered := bytes.Replace(data, []byte("250.00"), []byte("950.00"), 1)
+	check, err = archive.VerifyDocument(bytes.NewReader(altered))
+	assert.NoError(t, err)
+	assert.False(t, check.Valid)
+	assert.Equal(t, "no statement was issued with this content", check.Reason)
+
+	// Changing the stored file is caught by the digest
+	path := filepath.Join(dir, "statements", alice, st.ID+".pdf")
+	assert.NoError(t, os.WriteFile(path, altered, 0o644))
+	check, _ = archive.Verify(alice, st.ID)
+	assert.False(t, check.Valid)
+	assert.True(t, check.SignatureValid)
+	assert.Equal(t, "file has been changed since it was issued", check.Reason)
+
+	// Re-pointing the record at the altered file is caught by the signature
+	sum = sha256.Sum256(altered)
+	db.Model(&models.ArchivedStatement{}).Where("id = ?", st.ID).Update("sha256", hex.EncodeToString(sum[:]))
+	check, _ = archive.Verify(alice, st.ID)
+	assert.False(t, check.Valid)
+	assert.True(t, check.DigestMatches)
+	assert.Equal(t, "archive record does not match its signature", check.Reason)
+
+	// By March both wallets get one
+	n, err = archive.IssueMonth("2025-03")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestStatementSigningKey(t *testing.T) {
+	a, err := services.NewStatementSigningKey("", "secret")
+	assert.NoError(t, err)
+	b, _ := services.NewStatementSigningKey("", "secret")
+	assert.True(t, a.Equal(b), "derived keys are stable across restarts")
+
+	_, err = services.NewStatementSigningKey("not-base64!", "")
+	assert.EqualError(t, err, "statement signing key must be a base64 32-byte Ed25519 seed")
+}
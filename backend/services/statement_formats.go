@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// statementInstitution identifies GatorPay in OFX and camt.053 files
+const statementInstitution = "GatorPay"
+
+// ofxTransactionTypes maps transaction types to OFX TRNTYPE values. Anything
+// else is a plain CREDIT or DEBIT.
+var ofxTransactionTypes = map[string]string{
+	models.TransactionTypeDeposit:      "DEP",
+	models.TransactionTypeP2PSend:      "XFER",
+	models.TransactionTypeP2PReceive:   "XFER",
+	models.TransactionTypeBillPay:      "PAYMENT",
+	models.TransactionTypeQRPayment:    "POS",
+	models.TransactionTypeCardSpend:    "POS",
+	models.TransactionTypeCashback:     "CREDIT",
+	models.TransactionTypeInterest:     "INT",
+	models.TransactionTypeClaimSend:    "XFER",
+	models.TransactionTypeClaimReceive: "XFER",
+}
+
+// OFX 2.2 document, limited to a single bank statement response
+
+type ofxDocument struct {
+	XMLName xml.Name     `xml:"OFX"`
+	Signon  ofxSignon    `xml:"SIGNONMSGSRSV1>SONRS"`
+	Stmt    ofxStmtTrnRs `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignon struct {
+	Status   ofxStatus `xml:"STATUS"`
+	DTServer string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+	Org      string    `xml:"FI>ORG"`
+}
+
+type ofxStmtTrnRs struct {
+	TrnUID string    `xml:"TRNUID"`
+	Status ofxStatus `xml:"STATUS"`
+	StmtRs ofxStmtRs `xml:"STMTRS"`
+}
+
+type ofxStmtRs struct {
+	CurDef    string       `xml:"CURDEF"`
+	BankID    string       `xml:"BANKACCTFROM>BANKID"`
+	AcctID    string       `xml:"BANKACCTFROM>ACCTID"`
+	AcctType  string       `xml:"BANKACCTFROM>ACCTTYPE"`
+	DTStart   string       `xml:"BANKTRANLIST>DTSTART"`
+	DTEnd     string       `xml:"BANKTRANLIST>DTEND"`
+	Trans     []ofxStmtTrn `xml:"BANKTRANLIST>STMTTRN"`
+	LedgerBal ofxBal       `xml:"LEDGERBAL"`
+	BalList   []ofxBalItem `xml:"BALLIST>BAL"`
+}
+
+type ofxStmtTrn struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DTPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FITID    string `xml:"FITID"`
+	Name     string `xml:"NAME,omitempty"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+type ofxBal struct {
+	BalAmt string `xml:"BALAMT"`
+	DTAsOf string `xml:"DTASOF"`
+}
+
+type ofxBalItem struct {
+	Name    string `xml:"NAME"`
+	Desc    string `xml:"DESC"`
+	BalType string `xml:"BALTYPE"`
+	Value   string `xml:"VALUE"`
+	DTAsOf  string `xml:"DTASOF"`
+}
+
+// ofxTime formats a time the way OFX expects, always in UTC
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// generateOFX writes an OFX 2.2 bank statement. OFX has no opening balance
+// element, so it is carried in BALLIST next to the closing LEDGERBAL.
+func generateOFX(st *Statement) ([]byte, error) {
+	success := ofxStatus{Code: 0, Severity: "INFO"}
+	rs := ofxStmtRs{
+		CurDef:    st.Currency,
+		BankID:    strings.ToUpper(statementInstitution),
+		AcctID:    st.AccountID,
+		AcctType:  "CHECKING",
+		DTStart:   ofxTime(st.Start),
+		DTEnd:     ofxTime(st.End),
+		LedgerBal: ofxBal{BalAmt: st.Closing.StringFixed(2), DTAsOf: ofxTime(st.End)},
+		BalList: []ofxBalItem{{
+			Name: "Opening balance", Desc: "Balance at the start of the period", BalType: "DOLLAR",
+			Value: st.Opening.StringFixed(2), DTAsOf: ofxTime(st.Start),
+		}},
+	}
+	for _, e := range st.Entries {
+		trnType, ok := ofxTransactionTypes[e.Type]
+		if !ok {
+			trnType = "DEBIT"
+			if e.Amount.IsPositive() {
+				trnType = "CREDIT"
+			}
+		}
+		name := e.Counterparty
+		if name == "" {
+			name = e.Description
+		}
+		rs.Trans = append(rs.Trans, ofxStmtTrn{
+			TrnType:  trnType,
+			DTPosted: ofxTime(e.Date),
+			TrnAmt:   e.Amount.StringFixed(2),
+			FITID:    e.ID,
+			Name:     truncate(singleLine(name), 32),
+			Memo:     truncate(singleLine(e.Description), 255),
+		})
+	}
+	doc := ofxDocument{
+		Signon: ofxSignon{Status: success, DTServer: ofxTime(st.GeneratedAt), Language: "ENG", Org: statementInstitution},
+		Stmt:   ofxStmtTrnRs{TrnUID: st.ID, Status: success, StmtRs: rs},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	buf.WriteString(`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, errors.New("failed to write OFX statement")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// singleLine collapses whitespace, including line breaks, to single spaces.
+// QIF fields are line based and import tools show OFX and camt text on one line.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// generateQIF writes a Quicken bank register. The opening balance is the
+// first record, the way Quicken itself exports a new account; QIF has no
+// closing balance. Each transaction's ID goes in the reference (N) field.
+func generateQIF(st *Statement) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!Type:Bank\n")
+	buf.WriteString("D" + st.Start.Format("01/02/2006") + "\n")
+	buf.WriteString("T" + st.Opening.StringFixed(2) + "\n")
+	buf.WriteString("CX\n")
+	buf.WriteString("POpening Balance\n")
+	buf.WriteString("L[" + statementInstitution + " " + st.Currency + "]\n")
+	buf.WriteString("^\n")
+	for _, e := range st.Entries {
+		payee := e.Counterparty
+		if payee == "" {
+			payee = e.Description
+		}
+		buf.WriteString("D" + e.Date.Format("01/02/2006") + "\n")
+		buf.WriteString("T" + e.Amount.StringFixed(2) + "\n")
+		buf.WriteString("C*\n")
+		buf.WriteString("N" + e.ID + "\n")
+		buf.WriteString("P" + singleLine(payee) + "\n")
+		if memo := singleLine(e.Description); memo != "" {
+			buf.WriteString("M" + memo + "\n")
+		}
+		buf.WriteString("^\n")
+	}
+	return buf.Bytes()
+}
+
+// ISO 20022 camt.053.001.02 bank-to-customer statement
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtDocument struct {
+	XMLName xml.Name   `xml:"Document"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	GrpHdr  camtGrpHdr `xml:"BkToCstmrStmt>GrpHdr"`
+	Stmt    camtStmt   `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtGrpHdr struct {
+	MsgID   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtStmt struct {
+	ID       string        `xml:"Id"`
+	CreDtTm  string        `xml:"CreDtTm"`
+	FrDtTm   string        `xml:"FrToDt>FrDtTm"`
+	ToDtTm   string        `xml:"FrToDt>ToDtTm"`
+	AcctID   string        `xml:"Acct>Id>Othr>Id"`
+	AcctCcy  string        `xml:"Acct>Ccy"`
+	Owner    string        `xml:"Acct>Ownr>Nm,omitempty"`
+	Servicer string        `xml:"Acct>Svcr>FinInstnId>Nm"`
+	Bal      []camtBal     `xml:"Bal"`
+	Summary  camtTxsSummry `xml:"TxsSummry"`
+	Entries  []camtNtry    `xml:"Ntry"`
+}
+
+type camtAmt struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBal struct {
+	Code      string  `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmt `xml:"Amt"`
+	CdtDbtInd string  `xml:"CdtDbtInd"`
+	Date      string  `xml:"Dt>Dt"`
+}
+
+type camtTotals struct {
+	Count     string `xml:"NbOfNtries"`
+	Sum       string `xml:"Sum"`
+	Net       string `xml:"TtlNetNtryAmt,omitempty"`
+	CdtDbtInd string `xml:"CdtDbtInd,omitempty"`
+}
+
+type camtTxsSummry struct {
+	Total  camtTotals `xml:"TtlNtries"`
+	Credit camtTotals `xml:"TtlCdtNtries"`
+	Debit  camtTotals `xml:"TtlDbtNtries"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm"`
+}
+
+type camtNtry struct {
+	Ref         string     `xml:"NtryRef"`
+	Amt         camtAmt    `xml:"Amt"`
+	CdtDbtInd   string     `xml:"CdtDbtInd"`
+	Status      string     `xml:"Sts"`
+	BookingDate string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>Dt"`
+	ServicerRef string     `xml:"AcctSvcrRef"`
+	Code        string     `xml:"BkTxCd>Prtry>Cd"`
+	Issuer      string     `xml:"BkTxCd>Prtry>Issr"`
+	TxRef       string     `xml:"NtryDtls>TxDtls>Refs>AcctSvcrRef"`
+	Debtor      *camtParty `xml:"NtryDtls>TxDtls>RltdPties>Dbtr,omitempty"`
+	Creditor    *camtParty `xml:"NtryDtls>TxDtls>RltdPties>Cdtr,omitempty"`
+	Remittance  string     `xml:"NtryDtls>TxDtls>RmtInf>Ustrd,omitempty"`
+}
+
+// creditDebit splits a signed amount into its size and camt.053 indicator
+func creditDebit(amount decimal.Decimal) (string, string) {
+	if amount.IsNegative() {
+		return amount.Neg().StringFixed(2), "DBIT"
+	}
+	return amount.StringFixed(2), "CRDT"
+}
+
+// generateCAMT053 writes an ISO 20022 camt.053 statement with booked
+// opening (OPBD) and closing (CLBD) balances
+func generateCAMT053(st *Statement) ([]byte, error) {
+	stmt := camtStmt{
+		ID:       st.ID,
+		CreDtTm:  st.GeneratedAt.UTC().Format(time.RFC3339),
+		FrDtTm:   st.Start.Format(time.RFC3339),
+		ToDtTm:   st.End.Add(-time.Second).Format(time.RFC3339),
+		AcctID:   st.AccountID,
+		AcctCcy:  st.Currency,
+		Owner:    truncate(st.HolderName, 70),
+		Servicer: statementInstitution,
+	}
+	for _, b := range []struct {
+		code   string
+		amount decimal.Decimal
+		date   time.Time
+	}{{"OPBD", st.Opening, st.Start}, {"CLBD", st.Closing, st.LastDay()}} {
+		value, ind := creditDebit(b.amount)
+		stmt.Bal = append(stmt.Bal, camtBal{
+			Code: b.code, Amt: camtAmt{Ccy: st.Currency, Value: value}, CdtDbtInd: ind, Date: b.date.Format("2006-01-02"),
+		})
+	}
+
+	credits, debits := decimal.Zero, decimal.Zero
+	var nCredits, nDebits int
+	for _, e := range st.Entries {
+		value, ind := creditDebit(e.Amount)
+		entry := camtNtry{
+			Ref:         e.ID,
+			Amt:         camtAmt{Ccy: st.Currency, Value: value},
+			CdtDbtInd:   ind,
+			Status:      "BOOK",
+			BookingDate: e.Date.Format(time.RFC3339),
+			ValueDate:   e.Date.Format("2006-01-02"),
+			ServicerRef: e.ID,
+			Code:        e.Type,
+			Issuer:      statementInstitution,
+			TxRef:       e.ID,
+			Remittance:  truncate(singleLine(e.Description), 140),
+		}
+		if ind == "CRDT" {
+			credits = credits.Add(e.Amount)
+			nCredits++
+			if e.Counterparty != "" {
+				entry.Debtor = &camtParty{Name: truncate(e.Counterparty, 70)}
+			}
+		} else {
+			debits = debits.Sub(e.Amount)
+			nDebits++
+			if e.Counterparty != "" {
+				entry.Creditor = &camtParty{Name: truncate(e.Counterparty, 70)}
+			}
+		}
+		stmt.Entries = append(stmt.Entries, entry)
+	}
+	stmt.Summary = camtTxsSummry{
+		Total:  camtTotals{Count: strconv.Itoa(len(st.Entries)), Sum: credits.Add(debits).StringFixed(2)},
+		Credit: camtTotals{Count: strconv.Itoa(nCredits), Sum: credits.StringFixed(2)},
+		Debit:  camtTotals{Count: strconv.Itoa(nDebits), Sum: debits.StringFixed(2)},
+	}
+	stmt.Summary.Total.Net, stmt.Summary.Total.CdtDbtInd = creditDebit(credits.Sub(debits))
+
+	doc := camtDocument{
+		Xmlns:  camt053Namespace,
+		GrpHdr: camtGrpHdr{MsgID: st.ID, CreDtTm: stmt.CreDtTm},
+		Stmt:   stmt,
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, errors.New("failed to write camt.053 statement")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
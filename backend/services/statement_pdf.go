@@ -0,0 +1,254 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement PDF layout, in points from the bottom left of a Letter page
+const (
+	pdfLeft      = 50.0
+	pdfRight     = 562.0
+	pdfBottom    = 70.0 // rows stop here to leave room for the footer
+	pdfRowHeight = 14.0
+	pdfBodySize  = 9.0
+)
+
+// Transaction table columns
+const (
+	colDate        = pdfLeft
+	colDescription = 118.0
+	colType        = 318.0
+	colAmountEnd   = 488.0
+	colBalanceEnd  = pdfRight
+)
+
+// statementTypeLabels are the names transaction types go by on a PDF statement
+var statementTypeLabels = map[string]string{
+	models.TransactionTypeDeposit:            "Deposit",
+	models.TransactionTypeWithdraw:           "Withdrawal",
+	models.TransactionTypeP2PSend:            "Transfer sent",
+	models.TransactionTypeP2PReceive:         "Transfer received",
+	models.TransactionTypeBillPay:            "Bill payment",
+	models.TransactionTypeCashback:           "Cashback",
+	models.TransactionTypeQRPayment:          "QR payment",
+	models.TransactionTypeQRReceived:         "QR payment received",
+	models.TransactionTypeLoanDisbursement:   "Loan disbursement",
+	models.TransactionTypeLoanPayment:        "Loan repayment",
+	models.TransactionTypeLoanReversal:       "Loan reversal",
+	models.TransactionTypeFXConversion:       "Currency conversion",
+	models.TransactionTypeCardSpend:          "Card purchase",
+	models.TransactionTypeRefund:             "Refund",
+	models.TransactionTypeRefundSent:         "Refund sent",
+	models.TransactionTypePocketDeposit:      "To savings pocket",
+	models.TransactionTypePocketWithdraw:     "From savings pocket",
+	models.TransactionTypeWithdrawReturn:     "Returned withdrawal",
+	models.TransactionTypeDepositReturn:      "Returned deposit",
+	models.TransactionTypeCardTopUp:          "Card top-up",
+	models.TransactionTypeTopUpRefund:        "Card top-up refund",
+	models.TransactionTypeInterest:           "Interest",
+	models.TransactionTypeClaimSend:          "Sent by claim link",
+	models.TransactionTypeClaimReceive:       "Claimed transfer",
+	models.TransactionTypeClaimRefund:        "Unclaimed transfer returned",
+	models.TransactionTypeCashbackReversal:   "Cashback reversed",
+	models.TransactionTypeSharedContribution: "Shared wallet contribution",
+	models.TransactionTypeSharedDeposit:      "Shared wallet deposit",
+	models.TransactionTypeSharedPayout:       "Shared wallet payout",
+}
+
+func statementTypeLabel(txnType string) string {
+	if label, ok := statementTypeLabels[txnType]; ok {
+		return label
+	}
+	label := strings.ReplaceAll(txnType, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// formatAmount writes an amount with thousands separators, e.g. -1,234.56
+func formatAmount(d decimal.Decimal) string {
+	s := d.Abs().StringFixed(2)
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	if d.IsNegative() {
+		b.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + cents
+}
+
+// typeSubtotal is the money in and out for one transaction type
+type typeSubtotal struct {
+	label string
+	count int
+	in    decimal.Decimal
+	out   decimal.Decimal
+}
+
+// generatePDF lays out a statement as a paginated PDF: a header on every
+// page, holder details and a balance summary on the first, the transactions
+// with a running balance, and subtotals per transaction type at the end
+func generatePDF(st *Statement) []byte {
+	period := st.Start.Format("Jan 2, 2006") + " - " + st.LastDay().Format("Jan 2, 2006")
+	pdf := &pdfWriter{}
+
+	newPage := func() float64 {
+		pdf.AddPage()
+		pdf.Text(pdfLeft, 748, pdfFontBold, 20, "GatorPay")
+		pdf.TextRight(pdfRight, 752, pdfFontBold, 11, "Account Statement")
+		pdf.TextRight(pdfRight, 738, pdfFontRegular, 9, period)
+		pdf.Line(pdfLeft, 728, pdfRight, 728, 1)
+		return 705
+	}
+	tableHeader := func(y float64) float64 {
+		pdf.FillRect(pdfLeft, y-4, pdfRight-pdfLeft, pdfRowHeight+2, 0.88)
+		pdf.Text(colDate+4, y, pdfFontBold, pdfBodySize, "Date")
+		pdf.Text(colDescription, y, pdfFontBold, pdfBodySize, "Description")
+		pdf.Text(colType, y, pdfFontBold, pdfBodySize, "Type")
+		pdf.TextRight(colAmountEnd, y, pdfFontBold, pdfBodySize, "Amount")
+		pdf.TextRight(colBalanceEnd-4, y, pdfFontBold, pdfBodySize, "Balance")
+		return y - pdfRowHeight - 4
+	}
+
+	totalIn, totalOut := decimal.Zero, decimal.Zero
+	subtotals := map[string]*typeSubtotal{}
+	for _, e := range st.Entries {
+		sub, ok := subtotals[e.Type]
+		if !ok {
+			sub = &typeSubtotal{label: statementTypeLabel(e.Type)}
+			subtotals[e.Type] = sub
+		}
+		sub.count++
+		if e.Amount.IsNegative() {
+			sub.out = sub.out.Sub(e.Amount)
+			totalOut = totalOut.Sub(e.Amount)
+		} else {
+			sub.in = sub.in.Add(e.Amount)
+			totalIn = totalIn.Add(e.Amount)
+		}
+	}
+
+	// Holder details on the left, balance summary on the right
+	y := newPage()
+	details := [][2]string{
+		{"Account holder", st.HolderName},
+		{"Email", st.HolderEmail},
+		{"Account number", st.AccountID},
+		{"Currency", st.Currency},
+		{"Statement period", period},
+		{"Statement ID", st.ID},
+	}
+	for i, d := range details {
+		rowY := y - float64(i)*pdfRowHeight
+		pdf.Text(pdfLeft, rowY, pdfFontBold, pdfBodySize, d[0])
+		pdf.Text(pdfLeft+85, rowY, pdfFontRegular, pdfBodySize, fitText(d[1], pdfBodySize, 200))
+	}
+	summary := [][2]string{
+		{"Opening balance", formatAmount(st.Opening)},
+		{"Money in", formatAmount(totalIn)},
+		{"Money out", formatAmount(totalOut.Neg())},
+		{"Closing balance", formatAmount(st.Closing)},
+	}
+	pdf.FillRect(350, y-3*pdfRowHeight-8, pdfRight-350, 4*pdfRowHeight+8, 0.94)
+	for i, s := range summary {
+		font := pdfFontRegular
+		if i == 0 || i == len(summary)-1 {
+			font = pdfFontBold
+		}
+		rowY := y - float64(i)*pdfRowHeight
+		pdf.Text(358, rowY, font, pdfBodySize, s[0])
+		pdf.TextRight(pdfRight-8, rowY, font, pdfBodySize, s[1]+" "+st.Currency)
+	}
+	y -= float64(len(details))*pdfRowHeight + 16
+
+	// Transactions, carrying the table header over to each new page
+	pdf.Text(pdfLeft, y, pdfFontBold, 12, "Transactions")
+	y = tableHeader(y - 22)
+	pdf.Text(colDate+4, y, pdfFontRegular, pdfBodySize, st.Start.Format("Jan 2, 2006"))
+	pdf.Text(colDescription, y, pdfFontBold, pdfBodySize, "Opening balance")
+	pdf.TextRight(colBalanceEnd-4, y, pdfFontBold, pdfBodySize, formatAmount(st.Opening))
+	y -= pdfRowHeight
+	if len(st.Entries) == 0 {
+		pdf.Text(colDescription, y, pdfFontRegular, pdfBodySize, "No transactions in this period.")
+		y -= pdfRowHeight
+	}
+	for i, e := range st.Entries {
+		if y < pdfBottom {
+			y = tableHeader(newPage())
+		}
+		if i%2 == 0 {
+			pdf.FillRect(pdfLeft, y-4, pdfRight-pdfLeft, pdfRowHeight, 0.97)
+		}
+		description := singleLine(e.Description)
+		if e.Counterparty != "" {
+			description = strings.TrimPrefix(description+" - "+e.Counterparty, " - ")
+		}
+		pdf.Text(colDate+4, y, pdfFontRegular, pdfBodySize, e.Date.Format("Jan 2, 2006"))
+		pdf.Text(colDescription, y, pdfFontRegular, pdfBodySize, fitText(description, pdfBodySize, colType-colDescription-8))
+		pdf.Text(colType, y, pdfFontRegular, pdfBodySize, fitText(statementTypeLabel(e.Type), pdfBodySize, 100))
+		pdf.TextRight(colAmountEnd, y, pdfFontRegular, pdfBodySize, formatAmount(e.Amount))
+		pdf.TextRight(colBalanceEnd-4, y, pdfFontRegular, pdfBodySize, formatAmount(e.Balance))
+		y -= pdfRowHeight
+	}
+	if y < pdfBottom {
+		y = tableHeader(newPage())
+	}
+	pdf.Line(pdfLeft, y+pdfRowHeight-4, pdfRight, y+pdfRowHeight-4, 0.5)
+	pdf.Text(colDescription, y-2, pdfFontBold, pdfBodySize, "Closing balance")
+	pdf.TextRight(colBalanceEnd-4, y-2, pdfFontBold, pdfBodySize, formatAmount(st.Closing))
+	y -= pdfRowHeight + 24
+
+	// Subtotals by type, kept together on one page
+	ordered := make([]*typeSubtotal, 0, len(subtotals))
+	for _, sub := range subtotals {
+		ordered = append(ordered, sub)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].label < ordered[j].label })
+	if y-float64(len(ordered)+3)*pdfRowHeight < pdfBottom {
+		y = newPage()
+	}
+	pdf.Text(pdfLeft, y, pdfFontBold, 12, "Summary by type")
+	y -= 22
+	pdf.FillRect(pdfLeft, y-4, pdfRight-pdfLeft, pdfRowHeight+2, 0.88)
+	pdf.Text(colDate+4, y, pdfFontBold, pdfBodySize, "Type")
+	pdf.TextRight(colType+40, y, pdfFontBold, pdfBodySize, "Count")
+	pdf.TextRight(colAmountEnd, y, pdfFontBold, pdfBodySize, "Money in")
+	pdf.TextRight(colBalanceEnd-4, y, pdfFontBold, pdfBodySize, "Money out")
+	y -= pdfRowHeight + 4
+	total := &typeSubtotal{label: "Total", count: len(st.Entries), in: totalIn, out: totalOut}
+	for _, sub := range append(ordered, total) {
+		font := pdfFontRegular
+		if sub == total {
+			font = pdfFontBold
+			pdf.Line(pdfLeft, y+pdfRowHeight-4, pdfRight, y+pdfRowHeight-4, 0.5)
+		}
+		pdf.Text(colDate+4, y, font, pdfBodySize, sub.label)
+		pdf.TextRight(colType+40, y, font, pdfBodySize, strconv.Itoa(sub.count))
+		pdf.TextRight(colAmountEnd, y, font, pdfBodySize, formatAmount(sub.in))
+		pdf.TextRight(colBalanceEnd-4, y, font, pdfBodySize, formatAmount(sub.out))
+		y -= pdfRowHeight
+	}
+
+	// Footers go on last, once the page count is known
+	pages := pdf.PageCount()
+	for i := 0; i < pages; i++ {
+		pdf.SetPage(i)
+		pdf.Line(pdfLeft, 44, pdfRight, 44, 0.5)
+		pdf.Text(pdfLeft, 30, pdfFontRegular, 8, "GatorPay - "+st.HolderName+" - "+st.AccountID)
+		pdf.TextRight(pdfRight, 30, pdfFontRegular, 8, "Page "+strconv.Itoa(i+1)+" of "+strconv.Itoa(pages))
+	}
+
+	return pdf.Bytes("GatorPay statement "+st.ID, st.GeneratedAt)
+}
@@ -2,14 +2,27 @@ package services
 
 import (
 	"bytes"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"gatorpay-backend/models"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// statementFormats maps each export format to its content type and file extension
+var statementFormats = map[string][2]string{
+	"csv":  {"text/csv; charset=utf-8", "csv"},
+	"pdf":  {"application/pdf", "pdf"},
+	"ofx":  {"application/x-ofx", "ofx"},
+	"qif":  {"application/qif", "qif"},
+	"camt": {"application/xml", "xml"},
+}
+
 type StatementService struct {
 	db *gorm.DB
 }
@@ -18,65 +31,235 @@ func NewStatementService(db *gorm.DB) *StatementService {
 	return &StatementService{db: db}
 }
 
-func (s *StatementService) GenerateStatement(userID string, format string, startDate string, endDate string) ([]byte, string, error) {
-	start, err1 := time.Parse("2006-01-02", startDate)
-	end, err2 := time.Parse("2006-01-02", endDate)
-	
-	var txns []models.Transaction
-	query := s.db.Where("from_user_id = ? OR to_user_id = ?", userID, userID)
-	
-	if err1 == nil && err2 == nil {
-		query = query.Where("created_at BETWEEN ? AND ?", start, end.Add(24*time.Hour))
-	}
-	query.Order("created_at DESC").Find(&txns)
+// StatementQuery selects the wallet, period and format of a statement.
+// Dates are YYYY-MM-DD and inclusive; the period defaults to the current
+// month up to today.
+type StatementQuery struct {
+	Format   string `form:"format"`
+	Currency string `form:"currency"`
+	Start    string `form:"start"`
+	End      string `form:"end"`
+}
+
+// Statement is one wallet's activity over a period, ready to be rendered
+type Statement struct {
+	ID          string // stable for the same wallet and period
+	AccountID   string // short wallet number shown to banks' import tools
+	WalletID    string
+	Currency    string
+	HolderName  string
+	HolderEmail string
+	Start       time.Time // first day of the period, midnight UTC
+	End         time.Time // midnight UTC after the last day
+	Opening     decimal.Decimal
+	Closing     decimal.Decimal
+	Entries     []StatementEntry
+	GeneratedAt time.Time
+}
+
+// LastDay is the last day the statement covers
+func (st *Statement) LastDay() time.Time {
+	return st.End.AddDate(0, 0, -1)
+}
+
+// StatementEntry is a transaction as it appears on a statement
+type StatementEntry struct {
+	ID           string
+	Date         time.Time
+	Type         string
+	Description  string
+	Counterparty string          // the other user, if any
+	Amount       decimal.Decimal // positive when money came in
+	Balance      decimal.Decimal // running balance after the entry
+}
+
+// StatementFile is a rendered statement
+type StatementFile struct {
+	Data        []byte
+	ContentType string
+	FileName    string
+}
 
-	if format == "csv" {
-		return generateCSV(txns), "text/csv; charset=utf-8", nil
-	} else if format == "pdf" {
-		return generatePDF(txns), "application/pdf", nil
+// GenerateStatement builds a statement and renders it in the requested format
+func (s *StatementService) GenerateStatement(userID string, query StatementQuery) (*StatementFile, error) {
+	format := strings.ToLower(query.Format)
+	if format == "" {
+		format = "csv"
+	}
+	if _, ok := statementFormats[format]; !ok {
+		return nil, errors.New("unsupported format " + query.Format)
 	}
 
-	return nil, "", fmt.Errorf("unsupported format")
+	st, err := s.BuildStatement(userID, query)
+	if err != nil {
+		return nil, err
+	}
+	data, err := RenderStatement(st, format)
+	if err != nil {
+		return nil, err
+	}
+	return &StatementFile{
+		Data:        data,
+		ContentType: statementFormats[format][0],
+		FileName:    fmt.Sprintf("statement-%s-%s.%s", st.Currency, st.Start.Format("2006-01"), statementFormats[format][1]),
+	}, nil
 }
 
-func generateCSV(txns []models.Transaction) []byte {
-	var buf bytes.Buffer
-	buf.WriteString("ID,Amount,Type,Description,Status,Date\n")
+// BuildStatement collects a wallet's settled transactions and balances for a period
+func (s *StatementService) BuildStatement(userID string, query StatementQuery) (*Statement, error) {
+	currency, err := normalizeCurrency(query.Currency)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := statementPeriod(query.Start, query.End, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.Select("id", "email", "first_name", "last_name").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	walletID, err := walletIDForUser(s.db, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var opening struct{ Net decimal.Decimal }
+	if err := s.db.Model(&models.Transaction{}).
+		Select("COALESCE(SUM("+transactionDeltaSQL+"), 0) AS net", walletCreditTypes, models.TransactionTypeFXConversion).
+		Where("wallet_id = ? AND status = ? AND created_at < ?", walletID, models.TransactionStatusSuccess, start).
+		Scan(&opening).Error; err != nil {
+		return nil, errors.New("failed to compute opening balance")
+	}
+
+	var txns []models.Transaction
+	if err := s.db.Preload("FromUser").Preload("ToUser").
+		Where("wallet_id = ? AND status = ? AND created_at >= ? AND created_at < ?",
+			walletID, models.TransactionStatusSuccess, start, end).
+		Order("created_at ASC, id ASC").Find(&txns).Error; err != nil {
+		return nil, errors.New("failed to fetch transactions")
+	}
+
+	st := &Statement{
+		AccountID:   statementAccountID(walletID),
+		WalletID:    walletID,
+		Currency:    currency,
+		HolderName:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+		HolderEmail: user.Email,
+		Start:       start,
+		End:         end,
+		Opening:     opening.Net.Round(2),
+		GeneratedAt: time.Now().UTC(),
+	}
+	st.ID = st.AccountID + "-" + start.Format("20060102") + "-" + st.LastDay().Format("20060102")
+
+	balance := st.Opening
 	for _, t := range txns {
-		val, _ := t.Amount.Float64()
-		row := fmt.Sprintf("%s,%.2f,%s,%s,%s,%s\n",
-			t.ID, val, t.Type, t.Description, t.Status, t.CreatedAt.Format("2006-01-02 15:04:05"))
-		buf.WriteString(row)
+		amount := transactionDelta(t)
+		balance = balance.Add(amount)
+		st.Entries = append(st.Entries, StatementEntry{
+			ID:           t.ID,
+			Date:         t.CreatedAt.UTC(),
+			Type:         t.Type,
+			Description:  t.Description,
+			Counterparty: counterpartyName(t, userID),
+			Amount:       amount,
+			Balance:      balance,
+		})
 	}
-	return buf.Bytes()
+	st.Closing = balance
+	return st, nil
 }
 
-func generatePDF(txns []models.Transaction) []byte {
-	var buf bytes.Buffer
-	buf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
-	buf.WriteString("=====================================\n")
-	buf.WriteString("        ACCOUNT STATEMENT            \n")
-	buf.WriteString("=====================================\n\n")
-	
-	totalIn := 0.0
-	totalOut := 0.0
+// RenderStatement writes a statement in one of the export formats
+func RenderStatement(st *Statement, format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return generateCSV(st)
+	case "pdf":
+		return generatePDF(st), nil
+	case "ofx":
+		return generateOFX(st)
+	case "qif":
+		return generateQIF(st), nil
+	case "camt":
+		return generateCAMT053(st)
+	}
+	return nil, errors.New("unsupported format " + format)
+}
 
-	for _, t := range txns {
-		val, _ := t.Amount.Float64()
-		if t.Type == "DEPOSIT" || t.Type == "CREDIT" {
-			totalIn += val
-		} else {
-			totalOut += val
+// statementPeriod parses the inclusive start and end dates into a half-open
+// UTC range
+func statementPeriod(startDate, endDate string, now time.Time) (time.Time, time.Time, error) {
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if endDate != "" {
+		var err error
+		if last, err = time.Parse("2006-01-02", endDate); err != nil {
+			return time.Time{}, time.Time{}, errors.New("end must be YYYY-MM-DD")
 		}
 	}
-	
-	buf.WriteString(fmt.Sprintf("Total In: $%.2f\nTotal Out: $%.2f\n\n", totalIn, totalOut))
-	buf.WriteString("Transactions:\n--------------------------\n")
-	for _, t := range txns {
-		val, _ := t.Amount.Float64()
-		buf.WriteString(fmt.Sprintf("%s | %s | %s | $%.2f | %s\n", 
-			t.CreatedAt.Format("2006-01-02"), t.Type, t.Description, val, t.Status))
+	first := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if startDate != "" {
+		var err error
+		if first, err = time.Parse("2006-01-02", startDate); err != nil {
+			return time.Time{}, time.Time{}, errors.New("start must be YYYY-MM-DD")
+		}
+	}
+	if last.Before(first) {
+		return time.Time{}, time.Time{}, errors.New("end must not be before start")
+	}
+	if last.Sub(first) > 366*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.New("a statement can cover at most one year")
+	}
+	return first, last.AddDate(0, 0, 1), nil
+}
+
+// statementAccountID shortens a wallet ID to the 16 characters import tools
+// accept as an account number
+func statementAccountID(walletID string) string {
+	id := strings.ToUpper(strings.ReplaceAll(walletID, "-", ""))
+	if len(id) > 16 {
+		id = id[:16]
 	}
+	return id
+}
+
+// counterpartyName is the display name of the other user on a transaction
+func counterpartyName(t models.Transaction, userID string) string {
+	other := t.ToUser
+	if t.ToUserID == nil || *t.ToUserID == userID {
+		other = t.FromUser
+	}
+	if other == nil || other.ID == userID {
+		return ""
+	}
+	return strings.TrimSpace(other.FirstName + " " + other.LastName)
+}
 
-	return buf.Bytes()
+func generateCSV(st *Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"ID", "Date", "Type", "Description", "Counterparty", "Amount", "Balance"})
+	w.Write([]string{"", st.Start.Format("2006-01-02"), "", "Opening balance", "", "", st.Opening.StringFixed(2)})
+	for _, e := range st.Entries {
+		w.Write([]string{
+			e.ID, e.Date.Format("2006-01-02 15:04:05"), e.Type, csvSafe(e.Description), csvSafe(e.Counterparty),
+			e.Amount.StringFixed(2), e.Balance.StringFixed(2),
+		})
+	}
+	w.Write([]string{"", st.LastDay().Format("2006-01-02"), "", "Closing balance", "", "", st.Closing.StringFixed(2)})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, errors.New("failed to write statement")
+	}
+	return buf.Bytes(), nil
+}
+
+// csvSafe stops spreadsheets from treating user text as a formula
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
 }
@@ -2,9 +2,17 @@ package services_test
 
 import (
 	"bytes"
+	"encoding/csv"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
 	"gatorpay-backend/models"
 	"gatorpay-backend/services"
-	"testing"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
@@ -12,19 +20,200 @@ import (
 	"gorm.io/gorm"
 )
 
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func setupTestDBStatement() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{})
+	return db
+}
+
 func TestStatements(t *testing.T) {
-	db, _ := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	db.AutoMigrate(&models.Transaction{})
+	db := setupTestDBStatement()
 	ss := services.NewStatementService(db)
 
 	u1 := "u1"
-	db.Create(&models.Transaction{FromUserID: &u1, Amount: decimal.NewFromInt(100), Type: "CREDIT", Description: "Paycheck"})
+	db.Create(&models.User{ID: u1, Email: "u1@example.com", Username: "u1", Phone: "1", FirstName: "Ann", LastName: "Lee"})
+	db.Create(&models.Wallet{ID: "w1", UserID: u1, Currency: "USD", IsActive: true})
+	db.Create(&models.Transaction{WalletID: "w1", ToUserID: &u1, Amount: decimal.NewFromInt(100), Type: models.TransactionTypeDeposit,
+		Description: "Paycheck", Status: models.TransactionStatusSuccess})
+
+	csvFile, err := ss.GenerateStatement("u1", services.StatementQuery{Format: "csv"})
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(csvFile.Data, []byte("Paycheck")))
+
+	pdfFile, err := ss.GenerateStatement("u1", services.StatementQuery{Format: "pdf"})
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdfFile.Data, []byte("%PDF-1.4")))
+	assert.True(t, bytes.Contains(pdfFile.Data, []byte("(Ann Lee)")))
+
+	_, err = ss.GenerateStatement("u1", services.StatementQuery{Format: "xls"})
+	assert.EqualError(t, err, "unsupported format xls")
+	_, err = ss.GenerateStatement("u1", services.StatementQuery{Start: "2026-02-01", End: "2026-01-01"})
+	assert.EqualError(t, err, "end must not be before start")
+}
+
+func TestStatementBalances(t *testing.T) {
+	db := setupTestDBStatement()
+	ss := services.NewStatementService(db)
+
+	alice, bob := "alice", "bob"
+	db.Create(&models.User{ID: alice, Email: "a@example.com", Username: "alice", Phone: "1", FirstName: "Alice", LastName: "Ng"})
+	db.Create(&models.User{ID: bob, Email: "b@example.com", Username: "bob", Phone: "2", FirstName: "Bob", LastName: "Smith"})
+	db.Create(&models.Wallet{ID: "wa", UserID: alice, Currency: "USD", IsActive: true, Balance: decimal.NewFromInt(145)})
+
+	at := func(day int) time.Time { return time.Date(2026, 9, day, 12, 0, 0, 0, time.UTC) }
+	for _, txn := range []models.Transaction{
+		{ID: "t1", Type: models.TransactionTypeDeposit, Amount: decimal.NewFromInt(100), ToUserID: &alice, CreatedAt: at(1).AddDate(0, -1, 0)},
+		{ID: "t2", Type: models.TransactionTypeP2PSend, Amount: decimal.NewFromInt(30), FromUserID: &alice, ToUserID: &bob, CreatedAt: at(3),
+			Description: `=HYPERLINK("x"), "quoted"`},
+		{ID: "t3", Type: models.TransactionTypeDeposit, Amount: decimal.NewFromInt(75), ToUserID: &alice, CreatedAt: at(10)},
+		{ID: "t4", Type: models.TransactionTypeWithdraw, Amount: decimal.NewFromInt(500), CreatedAt: at(11), Status: models.TransactionStatusFailed},
+		{ID: "t5", Type: models.TransactionTypeBillPay, Amount: decimal.NewFromInt(20), FromUserID: &alice, CreatedAt: at(1).AddDate(0, 1, 0)},
+	} {
+		txn.WalletID = "wa"
+		if txn.Status == "" {
+			txn.Status = models.TransactionStatusSuccess
+		}
+		db.Create(&txn)
+	}
+
+	st, err := ss.BuildStatement(alice, services.StatementQuery{Start: "2026-09-01", End: "2026-09-30"})
+	assert.NoError(t, err)
+	assert.True(t, st.Opening.Equal(decimal.NewFromInt(100)))
+	assert.True(t, st.Closing.Equal(decimal.NewFromInt(145)))
+	assert.Len(t, st.Entries, 2)
+	assert.Equal(t, "Bob Smith", st.Entries[0].Counterparty)
+	assert.True(t, st.Entries[0].Amount.Equal(decimal.NewFromInt(-30)))
+	assert.Equal(t, "Alice Ng", st.HolderName)
+
+	// The same period always gets the same statement ID
+	again, _ := ss.BuildStatement(alice, services.StatementQuery{Start: "2026-09-01", End: "2026-09-30"})
+	assert.Equal(t, st.ID, again.ID)
+
+	// CSV quotes user text and defuses formulas
+	file, err := ss.GenerateStatement(alice, services.StatementQuery{Format: "csv", Start: "2026-09-01", End: "2026-09-30"})
+	assert.NoError(t, err)
+	assert.Equal(t, "statement-USD-2026-09.csv", file.FileName)
+	rows, err := csv.NewReader(bytes.NewReader(file.Data)).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, `'=HYPERLINK("x"), "quoted"`, rows[2][3])
+	assert.Equal(t, "145.00", rows[4][6])
+
+	_, err = ss.BuildStatement(alice, services.StatementQuery{Currency: "EUR"})
+	assert.EqualError(t, err, "wallet not found")
+}
+
+// goldenStatement is a fixed statement so the rendered files never change
+func goldenStatement() *services.Statement {
+	day := func(d, h int) time.Time { return time.Date(2026, 9, d, h, 30, 0, 0, time.UTC) }
+	st := &services.Statement{
+		ID:          "0F3A9C2B7D4E4F10-20260901-20260930",
+		AccountID:   "0F3A9C2B7D4E4F10",
+		WalletID:    "0f3a9c2b-7d4e-4f10-9a8b-1c2d3e4f5a6b",
+		Currency:    "USD",
+		HolderName:  "Alice Ng",
+		Start:       time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		End:         time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Opening:     decimal.RequireFromString("120.50"),
+		GeneratedAt: time.Date(2026, 10, 1, 6, 0, 0, 0, time.UTC),
+	}
+	balance := st.Opening
+	for _, e := range []services.StatementEntry{
+		{ID: "6b1e0c4a-0001-4000-8000-000000000001", Date: day(2, 9), Type: models.TransactionTypeP2PSend,
+			Description: "Dinner & drinks <split>", Counterparty: "Bob Smith", Amount: decimal.RequireFromString("-25.00")},
+		{ID: "6b1e0c4a-0002-4000-8000-000000000002", Date: day(5, 14), Type: models.TransactionTypeDeposit,
+			Description: "Deposit from bank", Amount: decimal.RequireFromString("200.00")},
+		{ID: "6b1e0c4a-0003-4000-8000-000000000003", Date: day(15, 8), Type: models.TransactionTypeBillPay,
+			Description: "Electricity,\nSeptember", Amount: decimal.RequireFromString("-80.25")},
+		{ID: "6b1e0c4a-0004-4000-8000-000000000004", Date: day(20, 17), Type: models.TransactionTypeRefund,
+			Description: "Refund: concert tickets", Counterparty: "Café Olé", Amount: decimal.RequireFromString("10.00")},
+	} {
+		balance = balance.Add(e.Amount)
+		e.Balance = balance
+		st.Entries = append(st.Entries, e)
+	}
+	st.Closing = balance
+	return st
+}
+
+func TestStatementGoldenFiles(t *testing.T) {
+	for format, file := range map[string]string{
+		"ofx":  "statement.ofx",
+		"qif":  "statement.qif",
+		"camt": "statement.camt053.xml",
+		"csv":  "statement.csv",
+	} {
+		t.Run(format, func(t *testing.T) {
+			got, err := services.RenderStatement(goldenStatement(), format)
+			assert.NoError(t, err)
+
+			path := filepath.Join("testdata", file)
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(path, got, 0o644))
+			}
+			want, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+// checkPDF verifies the cross-reference table points at every object, which
+// is what viewers rely on to open the file
+func checkPDF(t *testing.T, data []byte) {
+	t.Helper()
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if !assert.NotNil(t, m) {
+		return
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	assert.True(t, bytes.HasPrefix(data[xref:], []byte("xref\n0 ")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(data[xref:], -1)
+	assert.NotEmpty(t, entries)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		assert.True(t, bytes.HasPrefix(data[off:], []byte(strconv.Itoa(i+1)+" 0 obj\n")), "object %d", i+1)
+	}
+	for _, stream := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindAllSubmatch(data, -1) {
+		length, _ := strconv.Atoi(string(stream[1]))
+		assert.Equal(t, length, len(stream[2]))
+	}
+}
 
-	csvData, _, err := ss.GenerateStatement("u1", "csv", "", "")
+func TestStatementPDF(t *testing.T) {
+	st := goldenStatement()
+	data, err := services.RenderStatement(st, "pdf")
 	assert.NoError(t, err)
-	assert.True(t, bytes.Contains(csvData, []byte("Paycheck")))
+	checkPDF(t, data)
+	assert.Contains(t, string(data), "/Count 1 ")
+	assert.Contains(t, string(data), "(Alice Ng)")
+	assert.Contains(t, string(data), "(225.25 USD)") // closing balance in the summary
+	assert.Contains(t, string(data), "(Dinner & drinks <split> - Bob Smith)")
+	assert.Contains(t, string(data), "Caf\\351 Ol\\351)") // WinAnsi-encoded accents
+	assert.Contains(t, string(data), "(Page 1 of 1)")
 
-	pdfData, _, err := ss.GenerateStatement("u1", "pdf", "", "")
+	// A long month spills onto more pages, each with a running balance
+	for i := 0; i < 120; i++ {
+		e := st.Entries[1]
+		e.ID = strconv.Itoa(i)
+		e.Amount = decimal.NewFromInt(1000)
+		st.Closing = st.Closing.Add(e.Amount)
+		e.Balance = st.Closing
+		st.Entries = append(st.Entries, e)
+	}
+	data, err = services.RenderStatement(st, "pdf")
 	assert.NoError(t, err)
-	assert.True(t, bytes.Contains(pdfData, []byte("%PDF")))
+	checkPDF(t, data)
+	assert.Contains(t, string(data), "/Count 4 ")
+	assert.Contains(t, string(data), "(Page 4 of 4)")
+	assert.Contains(t, string(data), "(120,225.25)")
+	assert.Contains(t, string(data), "(124)") // transactions in the type summary
 }
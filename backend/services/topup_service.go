@@ -0,0 +1,489 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How long a top-up may wait on the cardholder or the processor before
+// ExpireStale gives up on it
+const (
+	topUpActionTimeout  = time.Hour      // unfinished 3-D Secure challenges
+	topUpCaptureTimeout = 72 * time.Hour // delayed captures
+)
+
+// TopUpService adds money to wallets by charging cards through a
+// PaymentProcessor. A top-up may finish at once, wait for a 3-D Secure
+// challenge or a delayed capture, or fail; the wallet is only credited once
+// the charge is captured. Without a processor card top-ups are turned off.
+type TopUpService struct {
+	db        *gorm.DB
+	processor PaymentProcessor
+}
+
+// NewTopUpService creates a new TopUpService
+func NewTopUpService(db *gorm.DB, processor PaymentProcessor) *TopUpService {
+	return &TopUpService{db: db, processor: processor}
+}
+
+// TopUp charges input.PaymentMethod for input.Amount. The returned top-up
+// says where the charge stands: succeeded, requires_action (send the user to
+// ActionURL), processing, or failed with the reason.
+func (s *TopUpService) TopUp(userID string, input AddMoneyInput) (*models.CardTopUp, error) {
+	amount := decimal.NewFromFloat(input.Amount)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	if input.PaymentMethod == "" {
+		return nil, errors.New("payment method is required")
+	}
+	if s.processor == nil {
+		return nil, errors.New("card top-ups are not available")
+	}
+	if input.LinkedAccountID != "" {
+		return nil, errors.New("choose either a bank account or a card, not both")
+	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	topUp := models.CardTopUp{
+		UserID:        userID,
+		Amount:        amount,
+		Currency:      currency,
+		PaymentMethod: input.PaymentMethod,
+		Status:        models.TopUpPending,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		walletID, err := ensureWallet(tx, userID, currency)
+		if err != nil {
+			return err
+		}
+		var wallet models.Wallet
+		if err := tx.First(&wallet, "id = ?", walletID).Error; err != nil {
+			return errors.New("wallet not found")
+		}
+		if !wallet.IsActive {
+			return errors.New("wallet is not active")
+		}
+		topUp.WalletID = wallet.ID
+		if err := tx.Create(&topUp).Error; err != nil {
+			return errors.New("failed to create top-up")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.processor.Authorize(topUp.ID, input.PaymentMethod, amount, currency)
+	if err != nil {
+		s.fail(&topUp, "processor_error", "The payment processor could not be reached.")
+		return nil, errors.New("payment processor is unavailable, please try again")
+	}
+	if err := s.apply(&topUp, result, input.Description); err != nil {
+		return nil, err
+	}
+	return s.reload(topUp.ID)
+}
+
+// apply moves a top-up on according to the processor's latest answer
+func (s *TopUpService) apply(topUp *models.CardTopUp, result *PaymentResult, description string) error {
+	updates := map[string]interface{}{}
+	if result.PaymentID != "" && topUp.ProcessorPaymentID == nil {
+		updates["processor_payment_id"] = result.PaymentID
+		topUp.ProcessorPaymentID = &result.PaymentID
+	}
+	if result.CardLast4 != "" {
+		updates["card_brand"], updates["card_last4"] = result.CardBrand, result.CardLast4
+		topUp.CardBrand, topUp.CardLast4 = result.CardBrand, result.CardLast4
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(topUp).Updates(updates).Error; err != nil {
+			return errors.New("failed to update top-up")
+		}
+	}
+
+	switch result.Status {
+	case PaymentDeclined:
+		s.fail(topUp, result.DeclineCode, result.DeclineMessage)
+	case PaymentRequiresAction:
+		s.transition(topUp, models.TopUpPending, map[string]interface{}{
+			"status": models.TopUpRequiresAction, "action_url": result.ActionURL,
+		})
+	case PaymentAuthorized:
+		captured, err := s.processor.Capture(*topUp.ProcessorPaymentID)
+		if err != nil {
+			s.fail(topUp, "capture_failed", "The card payment could not be collected.")
+			return nil
+		}
+		return s.apply(topUp, captured, description)
+	case PaymentCapturePending:
+		s.transition(topUp, models.TopUpPending, map[string]interface{}{"status": models.TopUpProcessing})
+	case PaymentCaptured:
+		return s.credit(topUp.ID, description)
+	default:
+		return errors.New("unexpected payment status " + result.Status)
+	}
+	return nil
+}
+
+// credit puts a captured top-up into the wallet. If the wallet cannot take
+// it, the charge is refunded.
+func (s *TopUpService) credit(topUpID, description string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var topUp models.CardTopUp
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", topUpID).First(&topUp).Error; err != nil {
+			return errors.New("top-up not found")
+		}
+		if topUp.Status != models.TopUpPending && topUp.Status != models.TopUpProcessing {
+			return nil // already credited or failed
+		}
+		locked, err := lockWallets(tx, topUp.WalletID)
+		if err != nil {
+			return err
+		}
+		if !locked[topUp.WalletID].IsActive {
+			return errors.New("wallet is not active")
+		}
+
+		if description == "" {
+			description = "Card top-up"
+			if topUp.CardLast4 != "" {
+				description += " (" + cardBrandName(topUp.CardBrand) + " ••••" + topUp.CardLast4 + ")"
+			}
+		}
+		// Post to the ledger: owed by the processor, wallet liability up
+		entry, err := postJournal(tx, models.JournalTypeCardTopUp, description,
+			debit(platformCode(models.LedgerPlatformProcessor, topUp.Currency), topUp.Amount),
+			credit(walletAccountCode(topUp.WalletID), topUp.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		transaction := models.Transaction{
+			WalletID:       topUp.WalletID,
+			Type:           models.TransactionTypeCardTopUp,
+			Amount:         topUp.Amount,
+			Currency:       topUp.Currency,
+			Description:    description,
+			Status:         models.TransactionStatusSuccess,
+			JournalEntryID: &entry.ID,
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			return errors.New("failed to create transaction record")
+		}
+		return tx.Model(&topUp).Updates(map[string]interface{}{
+			"status":         models.TopUpSucceeded,
+			"transaction_id": transaction.ID,
+			"action_url":     "",
+			"completed_at":   time.Now(),
+		}).Error
+	})
+	if err == nil {
+		return nil
+	}
+
+	// The card was charged but the wallet could not be credited
+	topUp, loadErr := s.reload(topUpID)
+	if loadErr != nil || topUp.ProcessorPaymentID == nil {
+		return err
+	}
+	if _, refundErr := s.processor.Refund(*topUp.ProcessorPaymentID, topUp.Amount); refundErr != nil {
+		log.Printf("⚠️  Top-up %s was charged but neither credited nor refunded: %v", topUpID, refundErr)
+		return err
+	}
+	s.fail(topUp, "wallet_unavailable", "The money could not be added to your wallet, so the card was refunded.")
+	return nil
+}
+
+// HandleWebhook applies a processor webhook to the top-up it is about.
+// Events for unknown payments and repeated deliveries are ignored.
+func (s *TopUpService) HandleWebhook(payload []byte, signature string) error {
+	if s.processor == nil {
+		return errors.New("card processor is not configured")
+	}
+	event, err := s.processor.ParseWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+	var topUp models.CardTopUp
+	if err := s.db.Where("processor_payment_id = ?", event.PaymentID).First(&topUp).Error; err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case EventPaymentAuthenticated:
+		// Only one delivery gets to capture
+		if !s.transition(&topUp, models.TopUpRequiresAction, map[string]interface{}{"status": models.TopUpPending, "action_url": ""}) {
+			return nil
+		}
+		return s.apply(&topUp, &PaymentResult{PaymentID: event.PaymentID, Status: PaymentAuthorized}, "")
+	case EventPaymentAuthFailed:
+		if topUp.Status == models.TopUpRequiresAction {
+			s.fail(&topUp, "authentication_failed", "The card's 3-D Secure check was not passed.")
+		}
+	case EventPaymentCaptured:
+		if topUp.Status == models.TopUpProcessing {
+			return s.credit(topUp.ID, "")
+		}
+		if topUp.Status == models.TopUpFailed && topUp.FailureCode == "capture_timeout" {
+			// Captured after ExpireStale gave up on it: give the money back
+			if _, err := s.processor.Refund(event.PaymentID, topUp.Amount); err != nil {
+				log.Printf("⚠️  Top-up %s was captured after it expired and could not be refunded: %v", topUp.ID, err)
+				return err
+			}
+		}
+	case EventPaymentCaptureFailed:
+		if topUp.Status == models.TopUpProcessing {
+			s.fail(&topUp, "capture_failed", "The card payment could not be collected.")
+		}
+	}
+	return nil
+}
+
+// Refund takes a succeeded top-up back out of the wallet and refunds the
+// card. The amount is held while the processor is asked, outside any database
+// transaction, and only leaves the wallet once the processor agrees.
+func (s *TopUpService) Refund(topUpID string) (*models.CardTopUp, error) {
+	if s.processor == nil {
+		return nil, errors.New("card processor is not configured")
+	}
+	var topUp models.CardTopUp
+	var holdID string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", topUpID).First(&topUp).Error; err != nil {
+			return errors.New("top-up not found")
+		}
+		if topUp.Status != models.TopUpSucceeded {
+			return errors.New("only succeeded top-ups can be refunded")
+		}
+		locked, err := lockWallets(tx, topUp.WalletID)
+		if err != nil {
+			return err
+		}
+		if locked[topUp.WalletID].Available().LessThan(topUp.Amount) {
+			return errors.New("wallet balance is too low to refund this top-up")
+		}
+
+		description := "Refund of card top-up"
+		if topUp.CardLast4 != "" {
+			description += " to ••••" + topUp.CardLast4
+		}
+		hold, err := placeHold(tx, topUp.WalletID, models.HoldTypeTopUpRefund, topUp.ID, description, topUp.Amount, 0)
+		if err != nil {
+			return err
+		}
+		holdID = hold.ID
+		if err := tx.Model(&topUp).Update("status", models.TopUpRefunding).Error; err != nil {
+			return errors.New("failed to update top-up")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, refundErr := s.processor.Refund(*topUp.ProcessorPaymentID, topUp.Amount)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if refundErr != nil {
+			// Refused: the money stays in the wallet
+			if _, err := releaseHold(tx, holdID, models.HoldStatusReleased); err != nil {
+				return err
+			}
+			return tx.Model(&topUp).Update("status", models.TopUpSucceeded).Error
+		}
+		return finishRefund(tx, &topUp, holdID)
+	})
+	if err != nil {
+		log.Printf("⚠️  Top-up %s is stuck refunding: %v", topUp.ID, err)
+		return nil, err
+	}
+	if refundErr != nil {
+		return nil, errors.New("processor refused the refund: " + refundErr.Error())
+	}
+	return s.reload(topUpID)
+}
+
+// finishRefund takes a refunded top-up's held amount out of the wallet
+func finishRefund(tx *gorm.DB, topUp *models.CardTopUp, holdID string) error {
+	hold, wallet, err := lockHold(tx, holdID)
+	if err != nil {
+		return err
+	}
+	amount, err := settleHold(tx, hold, wallet, decimal.Zero, true)
+	if err != nil {
+		return err
+	}
+	entry, err := postJournal(tx, models.JournalTypeTopUpRefund, hold.Description,
+		debit(walletAccountCode(wallet.ID), amount),
+		credit(platformCode(models.LedgerPlatformProcessor, topUp.Currency), amount),
+	)
+	if err != nil {
+		return err
+	}
+	transaction := models.Transaction{
+		WalletID:            wallet.ID,
+		Type:                models.TransactionTypeTopUpRefund,
+		Amount:              amount,
+		Currency:            topUp.Currency,
+		Description:         hold.Description,
+		Status:              models.TransactionStatusSuccess,
+		JournalEntryID:      &entry.ID,
+		ParentTransactionID: topUp.TransactionID,
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return errors.New("failed to create transaction record")
+	}
+	if err := tx.Model(topUp).Update("status", models.TopUpRefunded).Error; err != nil {
+		return errors.New("failed to update top-up")
+	}
+	return nil
+}
+
+// ExpireStale fails top-ups stuck waiting on a 3-D Secure challenge or a
+// delayed capture. Nothing was credited for them; a capture that still
+// arrives later is refunded by HandleWebhook.
+func (s *TopUpService) ExpireStale() error {
+	now := time.Now()
+	stale := []struct {
+		statuses      []string
+		before        time.Time
+		code, message string
+	}{
+		{[]string{models.TopUpPending, models.TopUpRequiresAction}, now.Add(-topUpActionTimeout),
+			"expired", "The card check was not finished in time."},
+		{[]string{models.TopUpProcessing}, now.Add(-topUpCaptureTimeout),
+			"capture_timeout", "The card payment did not complete in time."},
+	}
+
+	expired := 0
+	for _, st := range stale {
+		var topUps []models.CardTopUp
+		if err := s.db.Where("status IN ? AND created_at < ?", st.statuses, st.before).Find(&topUps).Error; err != nil {
+			return errors.New("failed to find stale top-ups")
+		}
+		for i := range topUps {
+			if topUps[i].Status == models.TopUpProcessing {
+				log.Printf("⚠️  Top-up %s never heard back about its capture", topUps[i].ID)
+			}
+			s.fail(&topUps[i], st.code, st.message)
+		}
+		expired += len(topUps)
+	}
+	if expired > 0 {
+		log.Printf("⏱️  Expired %d card top-ups", expired)
+	}
+	return nil
+}
+
+// CompleteSimulated finishes a top-up's 3-D Secure challenge or delayed
+// capture on FakeProcessor and feeds the resulting webhook back in, so the
+// flow can be tried out in development. It fails with any other processor.
+func (s *TopUpService) CompleteSimulated(userID, topUpID string) (*models.CardTopUp, error) {
+	fake, ok := s.processor.(*FakeProcessor)
+	if !ok {
+		return nil, errors.New("top-ups can only be completed by hand with the fake processor")
+	}
+	topUp, err := s.GetTopUp(userID, topUpID)
+	if err != nil {
+		return nil, err
+	}
+	if topUp.ProcessorPaymentID == nil {
+		return nil, errors.New("top-up is not waiting on the processor")
+	}
+
+	var payload []byte
+	var signature string
+	switch topUp.Status {
+	case models.TopUpRequiresAction:
+		payload, signature, err = fake.CompleteChallenge(*topUp.ProcessorPaymentID)
+	case models.TopUpProcessing:
+		payload, signature, err = fake.CompleteCapture(*topUp.ProcessorPaymentID)
+	default:
+		return nil, errors.New("top-up is not waiting on the processor")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.HandleWebhook(payload, signature); err != nil {
+		return nil, err
+	}
+	return s.reload(topUp.ID)
+}
+
+// GetTopUps lists a user's card top-ups, newest first
+func (s *TopUpService) GetTopUps(userID string) ([]models.CardTopUp, error) {
+	var topUps []models.CardTopUp
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&topUps).Error; err != nil {
+		return nil, errors.New("failed to fetch top-ups")
+	}
+	return topUps, nil
+}
+
+// GetTopUp returns one of a user's card top-ups
+func (s *TopUpService) GetTopUp(userID, topUpID string) (*models.CardTopUp, error) {
+	var topUp models.CardTopUp
+	if err := s.db.Where("id = ? AND user_id = ?", topUpID, userID).First(&topUp).Error; err != nil {
+		return nil, errors.New("top-up not found")
+	}
+	return &topUp, nil
+}
+
+// transition applies updates only if the top-up is still in status from,
+// and reports whether it was
+func (s *TopUpService) transition(topUp *models.CardTopUp, from string, updates map[string]interface{}) bool {
+	result := s.db.Model(&models.CardTopUp{}).Where("id = ? AND status = ?", topUp.ID, from).Updates(updates)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// fail marks an unfinished top-up failed
+func (s *TopUpService) fail(topUp *models.CardTopUp, code, message string) {
+	s.db.Model(&models.CardTopUp{}).
+		Where("id = ? AND status IN ?", topUp.ID, []string{models.TopUpPending, models.TopUpRequiresAction, models.TopUpProcessing}).
+		Updates(map[string]interface{}{
+			"status":          models.TopUpFailed,
+			"failure_code":    code,
+			"failure_message": message,
+			"action_url":      "",
+			"completed_at":    time.Now(),
+		})
+}
+
+// cardBrandName is how a processor's card brand is shown to users
+func cardBrandName(brand string) string {
+	switch brand {
+	case "visa":
+		return "Visa"
+	case "mastercard":
+		return "Mastercard"
+	case "amex":
+		return "American Express"
+	case "discover":
+		return "Discover"
+	}
+	if brand == "" {
+		return "Card"
+	}
+	return strings.ToUpper(brand[:1]) + brand[1:]
+}
+
+func (s *TopUpService) reload(topUpID string) (*models.CardTopUp, error) {
+	var topUp models.CardTopUp
+	if err := s.db.Where("id = ?", topUpID).First(&topUp).Error; err != nil {
+		return nil, errors.New("top-up not found")
+	}
+	return &topUp, nil
+}
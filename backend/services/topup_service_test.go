@@ -0,0 +1,230 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBTopUp() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.CardTopUp{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func TestCardTopUpOutcomes(t *testing.T) {
+	db := setupTestDBTopUp()
+	processor := services.NewFakeProcessor("whsec")
+	topUps := services.NewTopUpService(db, processor)
+	ws := services.NewWalletService(db, nil)
+	ls := services.NewLedgerService(db)
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+
+	balance := func() decimal.Decimal {
+		wallet, _ := ws.GetWallet("u1")
+		return wallet.Balance
+	}
+	topUp := func(method string, amount float64) *models.CardTopUp {
+		result, err := topUps.TopUp("u1", services.AddMoneyInput{Amount: amount, PaymentMethod: method})
+		assert.NoError(t, err)
+		return result
+	}
+
+	// A plain card is authorized and captured straight away
+	ok := topUp("pm_card_visa", 50)
+	assert.Equal(t, models.TopUpSucceeded, ok.Status)
+	assert.Equal(t, "4242", ok.CardLast4)
+	assert.True(t, balance().Equal(decimal.NewFromInt(50)))
+	var txn models.Transaction
+	db.Where("id = ?", *ok.TransactionID).First(&txn)
+	assert.Equal(t, models.TransactionTypeCardTopUp, txn.Type)
+	assert.Equal(t, "Card top-up (Visa ••••4242)", txn.Description)
+
+	// Declines leave the wallet alone
+	declined := topUp("pm_card_insufficient_funds", 20)
+	assert.Equal(t, models.TopUpFailed, declined.Status)
+	assert.Equal(t, "insufficient_funds", declined.FailureCode)
+	assert.Equal(t, "Your card has insufficient funds.", declined.FailureMessage)
+	assert.Equal(t, "unknown_card", topUp("pm_nonsense", 20).FailureCode)
+	assert.True(t, balance().Equal(decimal.NewFromInt(50)))
+
+	// 3-D Secure: nothing is credited until the challenge webhook arrives
+	challenged := topUp("pm_card_3ds", 30)
+	assert.Equal(t, models.TopUpRequiresAction, challenged.Status)
+	assert.NotEmpty(t, challenged.ActionURL)
+	assert.True(t, balance().Equal(decimal.NewFromInt(50)))
+
+	payload, signature, err := processor.CompleteChallenge(*challenged.ProcessorPaymentID)
+	assert.NoError(t, err)
+	assert.EqualError(t, topUps.HandleWebhook(payload, "forged"), "invalid webhook signature")
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	assert.NoError(t, topUps.HandleWebhook(payload, signature), "redeliveries are ignored")
+	challenged, _ = topUps.GetTopUp("u1", challenged.ID)
+	assert.Equal(t, models.TopUpSucceeded, challenged.Status)
+	assert.Empty(t, challenged.ActionURL)
+	assert.True(t, balance().Equal(decimal.NewFromInt(80)))
+
+	failedChallenge := topUp("pm_card_3ds_fail", 30)
+	payload, signature, _ = processor.CompleteChallenge(*failedChallenge.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	failedChallenge, _ = topUps.GetTopUp("u1", failedChallenge.ID)
+	assert.Equal(t, models.TopUpFailed, failedChallenge.Status)
+	assert.Equal(t, "authentication_failed", failedChallenge.FailureCode)
+
+	// Delayed captures credit the wallet when the capture completes
+	delayed := topUp("pm_card_delayed_capture", 40)
+	assert.Equal(t, models.TopUpProcessing, delayed.Status)
+	payload, signature, _ = processor.CompleteCapture(*delayed.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	delayed, _ = topUps.GetTopUp("u1", delayed.ID)
+	assert.Equal(t, models.TopUpSucceeded, delayed.Status)
+	assert.True(t, balance().Equal(decimal.NewFromInt(120)))
+
+	lost := topUp("pm_card_delayed_capture_fail", 40)
+	payload, signature, _ = processor.CompleteCapture(*lost.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	lost, _ = topUps.GetTopUp("u1", lost.ID)
+	assert.Equal(t, models.TopUpFailed, lost.Status)
+	assert.True(t, balance().Equal(decimal.NewFromInt(120)))
+
+	// Refunds take the money back out before returning it to the card
+	refunded, err := topUps.Refund(ok.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TopUpRefunded, refunded.Status)
+	assert.True(t, balance().Equal(decimal.NewFromInt(70)))
+	_, err = topUps.Refund(ok.ID)
+	assert.EqualError(t, err, "only succeeded top-ups can be refunded")
+	_, err = topUps.Refund(declined.ID)
+	assert.EqualError(t, err, "only succeeded top-ups can be refunded")
+
+	// A refused refund leaves the money in the wallet
+	_, err = processor.Refund(*delayed.ProcessorPaymentID, decimal.NewFromInt(40))
+	assert.NoError(t, err)
+	_, err = topUps.Refund(delayed.ID)
+	assert.EqualError(t, err, "processor refused the refund: refund exceeds the captured amount")
+	delayed, _ = topUps.GetTopUp("u1", delayed.ID)
+	assert.Equal(t, models.TopUpSucceeded, delayed.Status)
+	wallet, _ := ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(70)))
+	assert.True(t, wallet.HeldBalance.IsZero())
+
+	list, _ := topUps.GetTopUps("u1")
+	assert.Len(t, list, 7)
+	_, err = topUps.GetTopUp("u2", ok.ID)
+	assert.EqualError(t, err, "top-up not found")
+
+	tb, _ := ls.GetTrialBalance()
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformProcessor {
+			assert.True(t, a.Balance.Equal(decimal.NewFromInt(70)), a.Balance.String())
+		}
+	}
+	checks, _ := ls.CheckWallets()
+	assert.True(t, checks[0].Matches)
+}
+
+func TestCardTopUpIsCreditedOnlyToActiveWallets(t *testing.T) {
+	db := setupTestDBTopUp()
+	processor := services.NewFakeProcessor("whsec")
+	topUps := services.NewTopUpService(db, processor)
+
+	wallet := models.Wallet{UserID: "u1", IsActive: true}
+	db.Create(&wallet)
+	delayed, err := topUps.TopUp("u1", services.AddMoneyInput{Amount: 25, PaymentMethod: "pm_card_delayed_capture"})
+	assert.NoError(t, err)
+
+	// The wallet is frozen before the capture completes: the card is refunded
+	db.Model(&wallet).Update("is_active", false)
+	payload, signature, _ := processor.CompleteCapture(*delayed.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	delayed, _ = topUps.GetTopUp("u1", delayed.ID)
+	assert.Equal(t, models.TopUpFailed, delayed.Status)
+	assert.Equal(t, "wallet_unavailable", delayed.FailureCode)
+	_, err = processor.Refund(*delayed.ProcessorPaymentID, decimal.NewFromInt(1))
+	assert.EqualError(t, err, "refund exceeds the captured amount", "already refunded in full")
+
+	_, err = topUps.TopUp("u1", services.AddMoneyInput{Amount: 25, PaymentMethod: "pm_card_visa"})
+	assert.EqualError(t, err, "wallet is not active")
+	_, err = topUps.TopUp("u1", services.AddMoneyInput{Amount: 25, PaymentMethod: "pm_card_visa", LinkedAccountID: "x"})
+	assert.EqualError(t, err, "choose either a bank account or a card, not both")
+}
+
+func TestStuckCardTopUpsExpire(t *testing.T) {
+	db := setupTestDBTopUp()
+	processor := services.NewFakeProcessor("whsec")
+	topUps := services.NewTopUpService(db, processor)
+	ws := services.NewWalletService(db, nil)
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+
+	challenged, _ := topUps.TopUp("u1", services.AddMoneyInput{Amount: 30, PaymentMethod: "pm_card_3ds"})
+	delayed, _ := topUps.TopUp("u1", services.AddMoneyInput{Amount: 40, PaymentMethod: "pm_card_delayed_capture"})
+	fresh, _ := topUps.TopUp("u1", services.AddMoneyInput{Amount: 50, PaymentMethod: "pm_card_3ds"})
+	db.Model(&models.CardTopUp{}).Where("id IN ?", []string{challenged.ID, delayed.ID}).
+		Update("created_at", time.Now().Add(-4*24*time.Hour))
+
+	assert.NoError(t, topUps.ExpireStale())
+	challenged, _ = topUps.GetTopUp("u1", challenged.ID)
+	assert.Equal(t, models.TopUpFailed, challenged.Status)
+	assert.Equal(t, "expired", challenged.FailureCode)
+	assert.Empty(t, challenged.ActionURL)
+	delayed, _ = topUps.GetTopUp("u1", delayed.ID)
+	assert.Equal(t, models.TopUpFailed, delayed.Status)
+	assert.Equal(t, "capture_timeout", delayed.FailureCode)
+	fresh, _ = topUps.GetTopUp("u1", fresh.ID)
+	assert.Equal(t, models.TopUpRequiresAction, fresh.Status)
+
+	// A challenge passed too late is never captured
+	payload, signature, _ := processor.CompleteChallenge(*challenged.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	challenged, _ = topUps.GetTopUp("u1", challenged.ID)
+	assert.Equal(t, models.TopUpFailed, challenged.Status)
+
+	// A capture that lands after the timeout is refunded, not credited
+	payload, signature, _ = processor.CompleteCapture(*delayed.ProcessorPaymentID)
+	assert.NoError(t, topUps.HandleWebhook(payload, signature))
+	_, err := processor.Refund(*delayed.ProcessorPaymentID, decimal.NewFromInt(1))
+	assert.EqualError(t, err, "refund exceeds the captured amount", "already refunded in full")
+	wallet, _ := ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.IsZero())
+
+	// The fresh one can still be finished by hand in development
+	fresh, err = topUps.CompleteSimulated("u1", fresh.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.TopUpSucceeded, fresh.Status)
+	_, err = topUps.CompleteSimulated("u1", fresh.ID)
+	assert.EqualError(t, err, "top-up is not waiting on the processor")
+}
+
+func TestPaymentProcessorFromConfig(t *testing.T) {
+	processor, err := services.NewPaymentProcessor(services.ProcessorFake, "whsec", false)
+	assert.NoError(t, err)
+	assert.IsType(t, &services.FakeProcessor{}, processor)
+	_, err = services.NewPaymentProcessor(services.ProcessorFake, "whsec", true)
+	assert.EqualError(t, err, "the fake processor cannot be used in production")
+	_, err = services.NewPaymentProcessor("stripe", "whsec", true)
+	assert.EqualError(t, err, `unknown payment processor "stripe"`)
+
+	// Without a processor card top-ups are turned off
+	processor, err = services.NewPaymentProcessor(services.ProcessorNone, "", true)
+	assert.NoError(t, err)
+	assert.Nil(t, processor)
+	db := setupTestDBTopUp()
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+	topUps := services.NewTopUpService(db, nil)
+	_, err = topUps.TopUp("u1", services.AddMoneyInput{Amount: 25, PaymentMethod: "pm_card_visa"})
+	assert.EqualError(t, err, "card top-ups are not available")
+	assert.EqualError(t, topUps.HandleWebhook([]byte("{}"), "sig"), "card processor is not configured")
+	_, err = topUps.CompleteSimulated("u1", "x")
+	assert.EqualError(t, err, "top-ups can only be completed by hand with the fake processor")
+}
@@ -5,6 +5,7 @@ import (
 
 	"gatorpay-backend/models"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
@@ -13,11 +14,62 @@ import (
 type TransferService struct {
 	db            *gorm.DB
 	rewardService *RewardService
+	fxService     *FXService
+	limitService  *LimitService
+	claims        *ClaimService                // set with SetClaims
+	verification  *TransferVerificationService // set with SetVerification
 }
 
-// NewTransferService creates a new TransferService
-func NewTransferService(db *gorm.DB, rewardService *RewardService) *TransferService {
-	return &TransferService{db: db, rewardService: rewardService}
+// errTransfersUnavailable is returned while no TransferVerificationService
+// is set, so that no transfer skips the step-up and risk checks
+var errTransfersUnavailable = errors.New("transfers are unavailable, please try again later")
+
+// NewTransferService creates a new TransferService. Transfers are refused
+// until SetVerification is called.
+func NewTransferService(db *gorm.DB, rewardService *RewardService, fxService *FXService, limitService *LimitService) *TransferService {
+	return &TransferService{db: db, rewardService: rewardService, fxService: fxService, limitService: limitService}
+}
+
+// SetVerification makes transfers go through v, which holds large or risky
+// ones until the sender confirms them
+func (s *TransferService) SetVerification(v *TransferVerificationService) {
+	s.verification = v
+}
+
+// verify puts a payment made outside SendMoney through the transfer checks,
+// refusing it while no TransferVerificationService is set
+func (s *TransferService) verify(senderID, txType string, amount decimal.Decimal, currency, code string) error {
+	if s.verification == nil {
+		return errTransfersUnavailable
+	}
+	return s.verification.verify(senderID, txType, amount, currency, code)
+}
+
+// screen runs a payment the sender is not there to confirm, such as a
+// scheduled transfer, past the risk engine. Blocked and flagged payments are
+// both refused.
+func (s *TransferService) screen(senderID, txType string, amount decimal.Decimal, currency string) error {
+	if s.verification == nil {
+		return errTransfersUnavailable
+	}
+	value, err := s.verification.usdValue(amount, currency)
+	if err != nil {
+		return err
+	}
+	_, flagged, err := s.verification.screen(senderID, txType, value)
+	if err != nil {
+		return err
+	}
+	if flagged {
+		return errors.New("this transfer was flagged for review; send it yourself to confirm it")
+	}
+	return nil
+}
+
+// SetClaims makes SendMoney send to an email or phone number with no
+// account behind it by claim link through c
+func (s *TransferService) SetClaims(c *ClaimService) {
+	s.claims = c
 }
 
 // TransferRequest is the DTO for sending money
@@ -25,6 +77,7 @@ type TransferRequest struct {
 	Recipient string  `json:"recipient" binding:"required"` // username, email, or phone
 	Amount    float64 `json:"amount" binding:"required"`
 	Note      string  `json:"note"`
+	Currency  string  `json:"currency"` // wallet to send from; defaults to USD
 }
 
 // TransferResponse is the response after a successful transfer
@@ -32,127 +85,257 @@ type TransferResponse struct {
 	TransactionID string              `json:"transaction_id"`
 	Recipient     models.UserResponse `json:"recipient"`
 	Amount        decimal.Decimal     `json:"amount"`
+	Currency      string              `json:"currency"`
 	Note          string              `json:"note"`
 	NewBalance    decimal.Decimal     `json:"new_balance"`
+
+	// The recipient is credited in the sending currency when they hold a
+	// wallet in it, otherwise in their USD wallet at FXRate
+	RecipientAmount   decimal.Decimal  `json:"recipient_amount"`
+	RecipientCurrency string           `json:"recipient_currency"`
+	FXRate            *decimal.Decimal `json:"fx_rate,omitempty"`
+	FXSpread          *decimal.Decimal `json:"fx_spread,omitempty"`
+
+	// Set instead of a recipient when nobody has an account under the email
+	// yet: the money waits in escrow until they sign up and claim it
+	Claim    *models.ClaimLink `json:"claim,omitempty"`
+	ClaimURL string            `json:"claim_url,omitempty"`
+
+	// Set when the transfer is held until the sender confirms it with the
+	// code emailed to them; nothing has moved yet
+	Verification *models.PendingTransfer `json:"verification,omitempty"`
 }
 
-// SendMoney transfers money from one user to another
+// SendMoney transfers money from one user to another. Large or risky
+// transfers are held until the sender confirms them with ConfirmTransfer.
 func (s *TransferService) SendMoney(senderID string, input TransferRequest) (*TransferResponse, error) {
 	amount := decimal.NewFromFloat(input.Amount)
-	if amount.LessThanOrEqual(decimal.Zero) {
-		return nil, errors.New("amount must be greater than 0")
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if s.verification == nil {
+		return nil, errTransfersUnavailable
 	}
+	if held, err := s.verification.hold(senderID, input.Recipient, amount, currency, input.Note); err != nil || held != nil {
+		return held, err
+	}
+	return s.send(senderID, input.Recipient, amount, currency, input.Note)
+}
 
-	// Resolve recipient by username, email, or phone
-	var recipient models.User
-	err := s.db.Where("username = ? OR email = ? OR phone = ?", input.Recipient, input.Recipient, input.Recipient).
-		First(&recipient).Error
+// ConfirmTransferInput is the DTO for confirming a held transfer
+type ConfirmTransferInput struct {
+	TransferID string `json:"transfer_id" binding:"required"`
+	Code       string `json:"code" binding:"required,len=6"`
+}
+
+// ConfirmTransfer sends a transfer that was held for verification once the
+// sender gives the code they were emailed
+func (s *TransferService) ConfirmTransfer(senderID string, input ConfirmTransferInput) (*TransferResponse, error) {
+	if s.verification == nil {
+		return nil, errTransfersUnavailable
+	}
+	return s.verification.confirm(senderID, input)
+}
+
+// send moves the money to the recipient, or into a claim link if nobody has
+// an account under the email
+func (s *TransferService) send(senderID, identifier string, amount decimal.Decimal, currency, note string) (*TransferResponse, error) {
+	recipient, err := findRecipient(s.db, identifier)
+	if err != nil {
+		if contact, contactType, ok := claimContact(identifier); ok && s.claims != nil {
+			return s.claims.send(senderID, contact, contactType, amount, currency, note)
+		}
+		return nil, err
+	}
+
+	var response *TransferResponse
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		response, err = s.transfer(tx, senderID, recipient, amount, currency, note)
+		return err
+	})
 	if err != nil {
+		return nil, err
+	}
+
+	s.awardCashback(senderID, response)
+	return response, nil
+}
+
+// findRecipient resolves a recipient by username, email, or phone
+func findRecipient(db *gorm.DB, identifier string) (*models.User, error) {
+	phone := identifier
+	if digits, ok := phoneNumber(identifier); ok {
+		phone = digits
+	}
+	var recipient models.User
+	if err := db.Where("username = ? OR email = ? OR phone = ?", identifier, identifier, phone).
+		First(&recipient).Error; err != nil {
 		return nil, errors.New("recipient not found")
 	}
+	return &recipient, nil
+}
+
+// transfer moves amount from the sender's wallet in currency to the
+// recipient inside tx. Every P2P payment, immediate or scheduled, goes
+// through these checks.
+func (s *TransferService) transfer(tx *gorm.DB, senderID string, recipient *models.User, amount decimal.Decimal, currency, note string) (*TransferResponse, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, errors.New("amount must be greater than 0")
+	}
 
 	// Prevent self-transfer
 	if recipient.ID == senderID {
 		return nil, errors.New("cannot send money to yourself")
 	}
 
-	var response TransferResponse
-	err = s.db.Transaction(func(tx *gorm.DB) error {
-		// Get sender wallet
-		var senderWallet models.Wallet
-		if err := tx.Where("user_id = ?", senderID).First(&senderWallet).Error; err != nil {
-			return errors.New("sender wallet not found")
-		}
-
-		if !senderWallet.IsActive {
-			return errors.New("sender wallet is not active")
-		}
+	senderWalletID, err := walletIDForUser(tx, senderID, currency)
+	if err != nil {
+		return nil, errors.New("sender wallet not found")
+	}
 
-		// Check sufficient balance
-		if senderWallet.Balance.LessThan(amount) {
-			return errors.New("insufficient balance")
+	// Pay into the recipient's wallet in the same currency, else convert into USD
+	recipientCurrency := currency
+	recipientWalletID, err := walletIDForUser(tx, recipient.ID, currency)
+	if err != nil {
+		recipientCurrency = models.DefaultCurrency
+		if recipientWalletID, err = walletIDForUser(tx, recipient.ID, recipientCurrency); err != nil {
+			return nil, errors.New("recipient wallet not found")
 		}
+	}
 
-		// Get recipient wallet
-		var recipientWallet models.Wallet
-		if err := tx.Where("user_id = ?", recipient.ID).First(&recipientWallet).Error; err != nil {
-			return errors.New("recipient wallet not found")
-		}
+	// Lock both wallets in a fixed order before reading balances
+	wallets, err := lockWallets(tx, senderWalletID, recipientWalletID)
+	if err != nil {
+		return nil, err
+	}
+	senderWallet := *wallets[senderWalletID]
+	recipientWallet := *wallets[recipientWalletID]
 
-		// Debit sender
-		senderWallet.Balance = senderWallet.Balance.Sub(amount)
-		if err := tx.Save(&senderWallet).Error; err != nil {
-			return errors.New("failed to debit sender")
-		}
+	if !senderWallet.IsActive {
+		return nil, errors.New("sender wallet is not active")
+	}
 
-		// Credit recipient
-		recipientWallet.Balance = recipientWallet.Balance.Add(amount)
-		if err := tx.Save(&recipientWallet).Error; err != nil {
-			return errors.New("failed to credit recipient")
-		}
+	// Check sufficient balance
+	if senderWallet.Available().LessThan(amount) {
+		return nil, errors.New("insufficient balance")
+	}
+	sendTxID := uuid.New().String()
+	if err := s.limitService.reserve(tx, senderID, models.LimitCategoryP2P, amount, currency, sendTxID); err != nil {
+		return nil, err
+	}
 
-		description := "Transfer to " + recipient.Username
-		if input.Note != "" {
-			description += " - " + input.Note
-		}
+	description := "Transfer to " + recipient.Username
+	if note != "" {
+		description += " - " + note
+	}
 
-		// Create p2p_send transaction (sender's record)
-		sendTx := models.Transaction{
-			WalletID:    senderWallet.ID,
-			FromUserID:  &senderID,
-			ToUserID:    &recipient.ID,
-			Type:        models.TransactionTypeP2PSend,
-			Amount:      amount,
-			Description: description,
-			Status:      models.TransactionStatusSuccess,
-		}
-		if err := tx.Create(&sendTx).Error; err != nil {
-			return errors.New("failed to create send transaction")
+	// Debit sender, credit recipient in a single journal entry
+	received := amount
+	var fx *fxPrice
+	lines := []journalLine{
+		debit(walletAccountCode(senderWallet.ID), amount),
+		credit(walletAccountCode(recipientWallet.ID), amount),
+	}
+	if recipientCurrency != currency {
+		if fx, err = s.fxService.price(currency, recipientCurrency, amount); err != nil {
+			return nil, err
 		}
+		received = fx.Target
+		lines = fxLines(senderWallet.ID, currency, amount, recipientWallet.ID, recipientCurrency, received)
+	}
+	entry, err := postJournal(tx, models.JournalTypeP2P, description, lines...)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("id = ?", senderWallet.ID).First(&senderWallet).Error; err != nil {
+		return nil, errors.New("sender wallet not found")
+	}
 
-		// Create p2p_receive transaction (recipient's record)
-		var sender models.User
-		tx.Where("id = ?", senderID).First(&sender)
+	// Create p2p_send transaction (sender's record)
+	sendTx := models.Transaction{
+		ID:             sendTxID,
+		WalletID:       senderWallet.ID,
+		FromUserID:     &senderID,
+		ToUserID:       &recipient.ID,
+		Type:           models.TransactionTypeP2PSend,
+		Amount:         amount,
+		Currency:       currency,
+		Description:    description,
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if fx != nil {
+		sendTx.FXRate, sendTx.FXSpread = &fx.Rate, &fx.Spread
+		sendTx.CounterAmount, sendTx.CounterCurrency = &received, recipientCurrency
+	}
+	if err := tx.Create(&sendTx).Error; err != nil {
+		return nil, errors.New("failed to create send transaction")
+	}
 
-		receiveDesc := "Received from " + sender.Username
-		if input.Note != "" {
-			receiveDesc += " - " + input.Note
-		}
+	// Create p2p_receive transaction (recipient's record)
+	var sender models.User
+	tx.Where("id = ?", senderID).First(&sender)
 
-		receiveTx := models.Transaction{
-			WalletID:    recipientWallet.ID,
-			FromUserID:  &senderID,
-			ToUserID:    &recipient.ID,
-			Type:        models.TransactionTypeP2PReceive,
-			Amount:      amount,
-			Description: receiveDesc,
-			Status:      models.TransactionStatusSuccess,
-		}
-		if err := tx.Create(&receiveTx).Error; err != nil {
-			return errors.New("failed to create receive transaction")
-		}
+	receiveDesc := "Received from " + sender.Username
+	if note != "" {
+		receiveDesc += " - " + note
+	}
 
-		response = TransferResponse{
-			TransactionID: sendTx.ID,
-			Recipient:     recipient.ToResponse(),
-			Amount:        amount,
-			Note:          input.Note,
-			NewBalance:    senderWallet.Balance,
-		}
+	receiveTx := models.Transaction{
+		WalletID:       recipientWallet.ID,
+		FromUserID:     &senderID,
+		ToUserID:       &recipient.ID,
+		Type:           models.TransactionTypeP2PReceive,
+		Amount:         received,
+		Currency:       recipientCurrency,
+		Description:    receiveDesc,
+		Status:         models.TransactionStatusSuccess,
+		JournalEntryID: &entry.ID,
+	}
+	if fx != nil {
+		receiveTx.FXRate, receiveTx.FXSpread = &fx.Rate, &fx.Spread
+		receiveTx.CounterAmount, receiveTx.CounterCurrency = &amount, currency
+	}
+	if err := tx.Create(&receiveTx).Error; err != nil {
+		return nil, errors.New("failed to create receive transaction")
+	}
 
-		return nil
-	})
+	response := TransferResponse{
+		TransactionID: sendTx.ID,
+		Recipient:     recipient.ToResponse(),
+		Amount:        amount,
+		Currency:      currency,
+		Note:          note,
+		NewBalance:    senderWallet.Balance,
 
-	if err != nil {
-		return nil, err
+		RecipientAmount:   received,
+		RecipientCurrency: recipientCurrency,
+	}
+	if fx != nil {
+		response.FXRate, response.FXSpread = &fx.Rate, &fx.Spread
 	}
-
-	// Award 1% cashback asynchronously
-	go s.rewardService.AwardCashback(senderID, amount, 0.01, "Cashback for P2P transfer to "+recipient.Username)
 
 	return &response, nil
 }
 
+// awardCashback pays 1% cashback on a completed transfer asynchronously, always in USD
+func (s *TransferService) awardCashback(senderID string, sent *TransferResponse) {
+	amount, currency := sent.Amount, sent.Currency
+	cashbackBase := amount
+	if currency != models.DefaultCurrency {
+		if mid, err := s.fxService.MidRate(currency, models.DefaultCurrency); err == nil {
+			cashbackBase = amount.Mul(mid).Round(2)
+		} else {
+			cashbackBase = decimal.Zero
+		}
+	}
+	if cashbackBase.IsPositive() {
+		go s.rewardService.AwardCashback(senderID, sent.TransactionID, cashbackBase, 0.01, "Cashback for P2P transfer to "+sent.Recipient.Username)
+	}
+}
+
 // GetRecentContacts returns the 10 most recent unique recipients
 func (s *TransferService) GetRecentContacts(userID string) ([]models.UserResponse, error) {
 	var transactions []models.Transaction
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// transferVerificationWindow is how long a held transfer waits for its
+// code. It matches how long an OTP code stays valid.
+const transferVerificationWindow = 5 * time.Minute
+
+// ErrTransferCodeRequired is returned for a payment made outside SendMoney
+// that needs a one-time code; the code has been emailed and the payment
+// should be retried with it
+var ErrTransferCodeRequired = errors.New("enter the code we emailed you to confirm this payment")
+
+// TransferVerificationService holds transfers above a threshold, or that the
+// risk engine flags, until the sender confirms them with a one-time code.
+// Other ways of paying people (requests, group settlements, scheduled and
+// bulk transfers, shared wallet payouts) go through verify instead.
+type TransferVerificationService struct {
+	db        *gorm.DB
+	transfers *TransferService
+	otp       *OTPService
+	fraud     *FraudService
+	threshold decimal.Decimal // USD value above which a transfer needs a code
+}
+
+// NewTransferVerificationService creates a new TransferVerificationService.
+// Pass it to TransferService.SetVerification to put transfers through it.
+func NewTransferVerificationService(db *gorm.DB, transfers *TransferService, otp *OTPService, fraud *FraudService, threshold decimal.Decimal) *TransferVerificationService {
+	return &TransferVerificationService{db: db, transfers: transfers, otp: otp, fraud: fraud, threshold: threshold}
+}
+
+// hold holds a transfer and emails the sender a code if it needs
+// verification. It returns nil when the transfer can go straight through,
+// including when it is bound to be refused anyway.
+func (s *TransferVerificationService) hold(senderID, identifier string, amount decimal.Decimal, currency, note string) (*TransferResponse, error) {
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return nil, nil
+	}
+	recipient, err := findRecipient(s.db, identifier)
+	if err != nil {
+		if _, _, ok := claimContact(identifier); !ok || s.transfers.claims == nil {
+			return nil, nil
+		}
+		recipient = nil
+	}
+	if recipient != nil && recipient.ID == senderID {
+		return nil, nil
+	}
+
+	value, err := s.usdValue(amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	score, flagged, err := s.screen(senderID, "p2p_transfer", value)
+	if err != nil {
+		return nil, err
+	}
+	reason := ""
+	switch {
+	case value.GreaterThan(s.threshold):
+		reason = models.StepUpReasonAmount
+	case flagged:
+		reason = models.StepUpReasonRisk
+	}
+	if reason == "" {
+		return nil, nil
+	}
+
+	pending := models.PendingTransfer{
+		SenderID:  senderID,
+		Recipient: identifier,
+		Amount:    amount,
+		Currency:  currency,
+		Note:      note,
+		Reason:    reason,
+		RiskScore: score,
+		Status:    models.PendingTransferVerification,
+		ExpiresAt: time.Now().Add(transferVerificationWindow),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// A new code replaces the old one, so older held transfers can no
+		// longer be confirmed
+		if err := tx.Model(&models.PendingTransfer{}).
+			Where("sender_id = ? AND status = ?", senderID, models.PendingTransferVerification).
+			Update("status", models.PendingTransferExpired).Error; err != nil {
+			return errors.New("failed to update held transfers")
+		}
+		if err := tx.Create(&pending).Error; err != nil {
+			return errors.New("failed to hold transfer")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sendCode(senderID); err != nil {
+		s.db.Model(&pending).Update("status", models.PendingTransferExpired)
+		return nil, err
+	}
+
+	response := &TransferResponse{Amount: amount, Currency: currency, Note: note, Verification: &pending}
+	if recipient != nil {
+		response.Recipient = recipient.ToResponse()
+	}
+	return response, nil
+}
+
+// screen runs a transfer worth value in USD past the risk engine, logging it
+// as txType unless it is allowed. Blocked transfers are refused; flagged ones
+// must be confirmed with a code.
+func (s *TransferVerificationService) screen(senderID, txType string, value decimal.Decimal) (float64, bool, error) {
+	if s.fraud == nil {
+		return 0, false, nil
+	}
+	score, action, factors := s.fraud.scoreTransaction(senderID, value.InexactFloat64())
+	if action != "allow" {
+		s.fraud.recordRisk(senderID, txType, score, action, factors)
+	}
+	switch action {
+	case "block":
+		return score, false, errors.New("this transfer was blocked for review; contact support if you think this is a mistake")
+	case "flag":
+		return score, true, nil
+	}
+	return score, false, nil
+}
+
+// verify puts a payment made outside SendMoney through the same checks:
+// blocked payments are refused, and ones above the threshold or flagged by
+// the risk engine need the sender's code. Without a code one is emailed and
+// ErrTransferCodeRequired returned. It must not run inside a transaction.
+func (s *TransferVerificationService) verify(senderID, txType string, amount decimal.Decimal, currency, code string) error {
+	value, err := s.usdValue(amount, currency)
+	if err != nil {
+		return err
+	}
+	_, flagged, err := s.screen(senderID, txType, value)
+	if err != nil {
+		return err
+	}
+	if !flagged && !value.GreaterThan(s.threshold) {
+		return nil
+	}
+	if code == "" {
+		if err := s.sendCode(senderID); err != nil {
+			return err
+		}
+		return ErrTransferCodeRequired
+	}
+	return s.otp.Verify(senderID, code, models.OTPPurposeTransfer)
+}
+
+// usdValue is what amount is worth in USD, the currency the threshold is in
+func (s *TransferVerificationService) usdValue(amount decimal.Decimal, currency string) (decimal.Decimal, error) {
+	if currency == models.DefaultCurrency || s.transfers.fxService == nil {
+		return amount, nil
+	}
+	mid, err := s.transfers.fxService.MidRate(currency, models.DefaultCurrency)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.Mul(mid).Round(2), nil
+}
+
+// sendCode emails the sender a fresh transfer code
+func (s *TransferVerificationService) sendCode(senderID string) error {
+	var sender models.User
+	if err := s.db.Where("id = ?", senderID).First(&sender).Error; err != nil {
+		return errors.New("user not found")
+	}
+	if err := s.otp.GenerateAndSend(senderID, sender.Email, models.OTPPurposeTransfer); err != nil {
+		return errors.New("failed to send verification code")
+	}
+	return nil
+}
+
+// confirm checks the sender's code and sends the held transfer. A transfer
+// whose window has passed cannot be confirmed.
+func (s *TransferVerificationService) confirm(senderID string, input ConfirmTransferInput) (*TransferResponse, error) {
+	var pending models.PendingTransfer
+	if err := s.db.Where("id = ? AND sender_id = ?", input.TransferID, senderID).First(&pending).Error; err != nil {
+		return nil, errors.New("transfer not found")
+	}
+	if pending.Status == models.PendingTransferVerification && !pending.ExpiresAt.After(time.Now()) {
+		s.db.Model(&pending).Update("status", models.PendingTransferExpired)
+		return nil, errors.New("this transfer has expired; send it again")
+	}
+	if pending.Status != models.PendingTransferVerification {
+		return nil, errors.New("this transfer was already " + pending.Status)
+	}
+	if err := s.otp.Verify(senderID, input.Code, models.OTPPurposeTransfer); err != nil {
+		return nil, err
+	}
+
+	// Take the transfer out of pending before sending it, so it can only be
+	// sent once
+	now := time.Now()
+	claimed := s.db.Model(&models.PendingTransfer{}).
+		Where("id = ? AND status = ?", pending.ID, models.PendingTransferVerification).
+		Updates(map[string]interface{}{"status": models.PendingTransferCompleted, "confirmed_at": now})
+	if claimed.Error != nil {
+		return nil, errors.New("failed to update transfer")
+	}
+	if claimed.RowsAffected == 0 {
+		return nil, errors.New("this transfer is no longer waiting for verification")
+	}
+
+	response, err := s.transfers.send(senderID, pending.Recipient, pending.Amount, pending.Currency, pending.Note)
+	if err != nil {
+		s.db.Model(&pending).Updates(map[string]interface{}{"status": models.PendingTransferFailed, "failure_reason": err.Error()})
+		return nil, err
+	}
+	s.db.Model(&pending).Update("transaction_id", response.TransactionID)
+	if err := s.db.Where("id = ?", pending.ID).First(&pending).Error; err == nil {
+		response.Verification = &pending
+	}
+	return response, nil
+}
@@ -0,0 +1,196 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"gatorpay-backend/config"
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBTransferVerification() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Reward{}, &models.Notification{},
+		&models.OTPCode{}, &models.RiskEvent{}, &models.FraudAlert{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{},
+		&models.PendingTransfer{})
+	return db
+}
+
+func newTransferVerification(db *gorm.DB, threshold int64) *services.TransferService {
+	ts := services.NewTransferService(db, services.NewRewardService(db), nil, nil)
+	otp := services.NewOTPService(db, services.NewEmailService(&config.Config{}))
+	ts.SetVerification(services.NewTransferVerificationService(db, ts, otp, services.NewFraudService(db), decimal.NewFromInt(threshold)))
+	return ts
+}
+
+// allowTransfers sets up transfer verification on ts with a threshold no
+// test transfer reaches and no risk scoring, for tests about other things
+func allowTransfers(db *gorm.DB, ts *services.TransferService) *services.TransferService {
+	otp := services.NewOTPService(db, services.NewEmailService(&config.Config{}))
+	ts.SetVerification(services.NewTransferVerificationService(db, ts, otp, nil, decimal.NewFromInt(1000000)))
+	return ts
+}
+
+// sendBurst records a burst of recent transfers from one user to another, so
+// a large transfer from a new account after it is blocked
+func sendBurst(db *gorm.DB, from, to models.User) {
+	for i := 0; i < 11; i++ {
+		db.Create(&models.Transaction{FromUserID: &from.ID, ToUserID: &to.ID, Amount: decimal.NewFromInt(1), Type: models.TransactionTypeP2PSend, Status: models.TransactionStatusSuccess})
+	}
+}
+
+// transferCode reads the latest transfer code emailed to the user
+func transferCode(db *gorm.DB, userID string) string {
+	var code models.OTPCode
+	db.Where("user_id = ? AND purpose = ?", userID, models.OTPPurposeTransfer).Order("created_at DESC").First(&code)
+	return code.Code
+}
+
+func TestLargeTransferWaitsForCode(t *testing.T) {
+	db := setupTestDBTransferVerification()
+	alice, bob := seedRefundUsers(t, db)
+	ts := newTransferVerification(db, 100)
+	ws := services.NewWalletService(db, nil)
+
+	small, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 20})
+	assert.NoError(t, err)
+	assert.Nil(t, small.Verification, "transfers under the threshold go straight through")
+	var events int64
+	db.Model(&models.RiskEvent{}).Count(&events)
+	assert.Zero(t, events, "allowed transfers are not logged")
+	settledCashback(t, db, 1)
+
+	held, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 150, Note: "rent"})
+	assert.NoError(t, err)
+	assert.NotNil(t, held.Verification)
+	assert.Equal(t, models.PendingTransferVerification, held.Verification.Status)
+	assert.Equal(t, models.StepUpReasonAmount, held.Verification.Reason)
+	assert.Empty(t, held.TransactionID)
+	wallet, _ := ws.GetWallet(bob.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(20)), "nothing moves until the code is entered")
+
+	code := transferCode(db, alice.ID)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: held.Verification.ID, Code: wrong})
+	assert.EqualError(t, err, "invalid verification code")
+	_, err = ts.ConfirmTransfer(bob.ID, services.ConfirmTransferInput{TransferID: held.Verification.ID, Code: code})
+	assert.EqualError(t, err, "transfer not found", "only the sender can confirm")
+
+	sent, err := ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: held.Verification.ID, Code: code})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, sent.TransactionID)
+	assert.Equal(t, models.PendingTransferCompleted, sent.Verification.Status)
+	assert.Equal(t, sent.TransactionID, *sent.Verification.TransactionID)
+	assert.NotNil(t, sent.Verification.ConfirmedAt)
+	settledCashback(t, db, 2)
+
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: held.Verification.ID, Code: code})
+	assert.EqualError(t, err, "this transfer was already completed")
+	wallet, _ = ws.GetWallet(bob.ID)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(170)), "sent exactly once")
+	var tx models.Transaction
+	db.Where("id = ?", sent.TransactionID).First(&tx)
+	assert.Equal(t, "Transfer to bob - rent", tx.Description, "the note is kept")
+}
+
+func TestHeldTransferExpires(t *testing.T) {
+	db := setupTestDBTransferVerification()
+	alice, bob := seedRefundUsers(t, db)
+	ts := newTransferVerification(db, 100)
+
+	first, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 120})
+	assert.NoError(t, err)
+	second, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 130})
+	assert.NoError(t, err)
+	code := transferCode(db, alice.ID)
+
+	// A newer transfer replaces the older one
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: first.Verification.ID, Code: code})
+	assert.EqualError(t, err, "this transfer was already expired")
+
+	db.Model(&models.PendingTransfer{}).Where("id = ?", second.Verification.ID).Update("expires_at", time.Now().Add(-time.Second))
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: second.Verification.ID, Code: code})
+	assert.EqualError(t, err, "this transfer has expired; send it again")
+
+	var pending models.PendingTransfer
+	db.Where("id = ?", second.Verification.ID).First(&pending)
+	assert.Equal(t, models.PendingTransferExpired, pending.Status)
+	wallet, _ := services.NewWalletService(db, nil).GetWallet(bob.ID)
+	assert.True(t, wallet.Balance.IsZero())
+}
+
+func TestRiskyTransferWaitsForCode(t *testing.T) {
+	db := setupTestDBTransferVerification()
+	alice, bob := seedRefundUsers(t, db)
+	ts := newTransferVerification(db, 1000)
+
+	// A burst of transfers in the last hour makes the risk engine flag the next
+	for i := 0; i < 11; i++ {
+		db.Create(&models.Transaction{FromUserID: &alice.ID, ToUserID: &bob.ID, Amount: decimal.NewFromInt(1), Type: models.TransactionTypeP2PSend, Status: models.TransactionStatusSuccess})
+	}
+
+	held, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 5})
+	assert.NoError(t, err)
+	assert.NotNil(t, held.Verification)
+	assert.Equal(t, models.StepUpReasonRisk, held.Verification.Reason)
+	assert.GreaterOrEqual(t, held.Verification.RiskScore, 40.0)
+
+	// A transfer that would fail anyway is refused up front, not held
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "alice", Amount: 5})
+	assert.EqualError(t, err, "cannot send money to yourself")
+
+	// Once confirmed, a transfer that can no longer be made is marked failed
+	_, err = ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 150})
+	assert.NoError(t, err)
+	db.Model(&models.Wallet{}).Where("user_id = ?", alice.ID).Update("balance", decimal.NewFromInt(100))
+	var pending models.PendingTransfer
+	db.Where("sender_id = ? AND status = ?", alice.ID, models.PendingTransferVerification).First(&pending)
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: pending.ID, Code: transferCode(db, alice.ID)})
+	assert.EqualError(t, err, "insufficient balance")
+	db.Where("id = ?", pending.ID).First(&pending)
+	assert.Equal(t, models.PendingTransferFailed, pending.Status)
+	assert.Equal(t, "insufficient balance", pending.FailureReason)
+}
+
+func TestBlockedTransferIsRefused(t *testing.T) {
+	db := setupTestDBTransferVerification()
+	alice, bob := seedRefundUsers(t, db)
+	ts := newTransferVerification(db, 1000)
+
+	// A new account sending a large amount after a burst of transfers is blocked
+	sendBurst(db, alice, bob)
+
+	_, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 1500})
+	assert.EqualError(t, err, "this transfer was blocked for review; contact support if you think this is a mistake")
+
+	var pending, events, alerts int64
+	db.Model(&models.PendingTransfer{}).Count(&pending)
+	assert.Zero(t, pending, "a blocked transfer cannot be confirmed with a code")
+	db.Model(&models.RiskEvent{}).Where("user_id = ? AND action = ?", alice.ID, "block").Count(&events)
+	assert.Equal(t, int64(1), events)
+	db.Model(&models.FraudAlert{}).Where("user_id = ?", alice.ID).Count(&alerts)
+	assert.Equal(t, int64(1), alerts)
+}
+
+func TestTransfersAreRefusedWithoutVerification(t *testing.T) {
+	db := setupTestDBTransferVerification()
+	alice, bob := seedRefundUsers(t, db)
+	ts := services.NewTransferService(db, services.NewRewardService(db), nil, nil)
+
+	_, err := ts.SendMoney(alice.ID, services.TransferRequest{Recipient: "bob", Amount: 20})
+	assert.EqualError(t, err, "transfers are unavailable, please try again later")
+	_, err = ts.ConfirmTransfer(alice.ID, services.ConfirmTransferInput{TransferID: "x", Code: "123456"})
+	assert.EqualError(t, err, "transfers are unavailable, please try again later")
+	assert.True(t, balanceOf(t, db, bob.ID).IsZero())
+}
@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDBConcurrent uses a file database so that several connections
+// really do run transactions side by side
+func setupTestDBConcurrent(t *testing.T) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), "stress.db") + "?_txlock=immediate&_busy_timeout=10000&_journal_mode=WAL"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(8)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.Reward{}, &models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.ACHFile{}, &models.Notification{}, &models.Hold{}, &models.LimitUsage{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+func TestConcurrentTransfersConserveMoney(t *testing.T) {
+	db := setupTestDBConcurrent(t)
+	ws := services.NewWalletService(db, nil)
+	rs := services.NewRewardService(db)
+	ts := allowTransfers(db, services.NewTransferService(db, rs, nil, nil))
+	ls := services.NewLedgerService(db)
+
+	const users = 5
+	funded := decimal.NewFromInt(500)
+	ids := make([]string, users)
+	names := make([]string, users)
+	banks := make([]string, users)
+	for i := 0; i < users; i++ {
+		u := models.User{
+			Email:     fmt.Sprintf("u%d@test.com", i),
+			Username:  fmt.Sprintf("user%d", i),
+			Phone:     fmt.Sprintf("555000%d", i),
+			FirstName: "Test",
+			LastName:  "User",
+		}
+		db.Create(&u)
+		db.Create(&models.Wallet{UserID: u.ID, IsActive: true})
+		banks[i] = bankAccount(t, db, u.ID)
+		deposit(t, db, u.ID, 500)
+		ids[i] = u.ID
+		names[i] = u.Username
+	}
+
+	var transfers, withdrawals atomic.Int64
+	var mu sync.Mutex
+	withdrawn := decimal.Zero
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < 25; i++ {
+				from := rng.Intn(users)
+				amount := float64(rng.Intn(15000)+1) / 100
+
+				if rng.Intn(5) == 0 {
+					if _, err := ws.Withdraw(ids[from], services.WithdrawInput{Amount: amount, LinkedAccountID: banks[from]}); err == nil {
+						withdrawals.Add(1)
+						mu.Lock()
+						withdrawn = withdrawn.Add(decimal.NewFromFloat(amount))
+						mu.Unlock()
+					}
+					continue
+				}
+
+				to := (from + 1 + rng.Intn(users-1)) % users
+				if _, err := ts.SendMoney(ids[from], services.TransferRequest{Recipient: names[to], Amount: amount}); err == nil {
+					transfers.Add(1)
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+	assert.Positive(t, transfers.Load())
+
+	// Cashback is credited asynchronously after each transfer
+	assert.Eventually(t, func() bool {
+		var n int64
+		db.Model(&models.Reward{}).Count(&n)
+		return n == transfers.Load()
+	}, 10*time.Second, 20*time.Millisecond)
+
+	var cashback decimal.Decimal
+	var rewards []models.Reward
+	db.Find(&rewards)
+	for _, r := range rewards {
+		cashback = cashback.Add(r.Amount)
+	}
+
+	var wallets []models.Wallet
+	db.Find(&wallets)
+	total := decimal.Zero
+	for _, wlt := range wallets {
+		assert.False(t, wlt.Available().IsNegative(), "wallet %s went negative", wlt.ID)
+		// Withdrawals stay held on the wallet until they settle;
+		// SQLite adds held balances as floats
+		total = total.Add(wlt.Available().Round(2))
+	}
+	expected := funded.Mul(decimal.NewFromInt(users)).Sub(withdrawn).Add(cashback)
+	assert.True(t, total.Equal(expected), "wallets hold %s, expected %s", total, expected)
+
+	checks, err := ls.CheckWallets()
+	assert.NoError(t, err)
+	for _, c := range checks {
+		assert.True(t, c.Matches, "wallet %s stored %s, ledger %s", c.WalletID, c.StoredBalance, c.LedgerBalance)
+	}
+
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+}
@@ -1,146 +1,234 @@
 package services
 
 import (
+	"encoding/base64"
 	"errors"
 	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"gatorpay-backend/models"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // WalletService handles wallet-related business logic
 type WalletService struct {
-	db *gorm.DB
+	db           *gorm.DB
+	limitService *LimitService
 }
 
 // NewWalletService creates a new WalletService
-func NewWalletService(db *gorm.DB) *WalletService {
-	return &WalletService{db: db}
+func NewWalletService(db *gorm.DB, limitService *LimitService) *WalletService {
+	return &WalletService{db: db, limitService: limitService}
 }
 
 // AddMoneyInput is the DTO for adding money
 type AddMoneyInput struct {
-	Amount      float64 `json:"amount" binding:"required"`
-	Source      string  `json:"source" binding:"required"`
-	Description string  `json:"description"`
+	Amount          float64 `json:"amount" binding:"required"`
+	LinkedAccountID string  `json:"linked_account_id" binding:"required_without=PaymentMethod"` // a verified linked bank account
+	PaymentMethod   string  `json:"payment_method"`                                             // or a card token, charged through the payment processor
+	Description     string  `json:"description"`
+	Currency        string  `json:"currency"` // defaults to USD, the only currency ACH carries; card top-ups open the wallet if needed
 }
 
 // WithdrawInput is the DTO for withdrawing money
 type WithdrawInput struct {
-	Amount      float64 `json:"amount" binding:"required"`
-	BankAccount string  `json:"bank_account" binding:"required"`
+	Amount          float64 `json:"amount" binding:"required"`
+	LinkedAccountID string  `json:"linked_account_id" binding:"required"` // a verified linked bank account
+	Currency        string  `json:"currency"`                             // must be USD, the only currency ACH carries
 }
 
-// TransactionListResponse is the paginated transaction response
+// TransactionQuery filters and pages a user's transaction history. Results
+// are ordered newest first by (created_at, id), and pages are walked with the
+// opaque NextCursor of the previous page.
+type TransactionQuery struct {
+	Cursor       string   `form:"cursor"`
+	Limit        int      `form:"limit"`
+	Page         int      `form:"page"` // offset paging for older clients; ignored when Cursor is set
+	Types        string   `form:"type"` // comma-separated, e.g. "p2p_send,p2p_receive"
+	Status       string   `form:"status"`
+	From         string   `form:"from"` // RFC 3339 time or YYYY-MM-DD
+	To           string   `form:"to"`   // inclusive; a bare date covers the whole day
+	MinAmount    *float64 `form:"min_amount"`
+	MaxAmount    *float64 `form:"max_amount"`
+	Counterparty string   `form:"counterparty"` // user ID, username, email or phone
+	Search       string   `form:"q"`            // case-insensitive description match
+	Tag          string   `form:"tag"`          // transactions the user tagged with this
+}
+
+// TransactionListResponse is a page of transaction history
 type TransactionListResponse struct {
 	Transactions []models.Transaction `json:"transactions"`
-	Total        int64                `json:"total"`
-	Page         int                  `json:"page"`
 	Limit        int                  `json:"limit"`
-	TotalPages   int                  `json:"total_pages"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+	HasMore      bool                 `json:"has_more"`
+
+	// Set only for offset paging
+	Total      int64 `json:"total,omitempty"`
+	Page       int   `json:"page,omitempty"`
+	TotalPages int   `json:"total_pages,omitempty"`
 }
 
-// GetWallet returns the wallet for a given user
+// GetWallet returns the primary (USD) wallet for a given user
 func (s *WalletService) GetWallet(userID string) (*models.Wallet, error) {
 	var wallet models.Wallet
-	if err := s.db.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+	if err := s.db.Where("user_id = ? AND currency = ?", userID, models.DefaultCurrency).First(&wallet).Error; err != nil {
 		return nil, errors.New("wallet not found")
 	}
 	return &wallet, nil
 }
 
-// AddMoney deposits money into the user's wallet atomically
-func (s *WalletService) AddMoney(userID string, input AddMoneyInput) (*models.Wallet, error) {
+// GetWallets returns every currency wallet a user holds, oldest first
+func (s *WalletService) GetWallets(userID string) ([]models.Wallet, error) {
+	var wallets []models.Wallet
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&wallets).Error; err != nil {
+		return nil, errors.New("failed to fetch wallets")
+	}
+	return wallets, nil
+}
+
+// AddMoney queues a deposit from a verified linked bank account for the next
+// ACH file. The deposit transaction stays pending, and the money only
+// reaches the wallet once the debit settles.
+func (s *WalletService) AddMoney(userID string, input AddMoneyInput) (*models.Deposit, error) {
 	amount := decimal.NewFromFloat(input.Amount)
 	if amount.LessThanOrEqual(decimal.Zero) {
 		return nil, errors.New("amount must be greater than 0")
 	}
+	if !amount.Equal(amount.Round(2)) {
+		return nil, errors.New("amount must have at most 2 decimal places")
+	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	// ACH only carries US dollars
+	if currency != models.DefaultCurrency {
+		return nil, errors.New("deposits from a bank account must be in USD")
+	}
 
-	var wallet models.Wallet
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// Lock the wallet row for update
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
-			return errors.New("wallet not found")
+	var deposit models.Deposit
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		bank, err := verifiedLinkedAccount(tx, userID, input.LinkedAccountID)
+		if err != nil {
+			return err
+		}
+		wallet, err := lockWalletByUser(tx, userID, currency)
+		if err != nil {
+			return err
 		}
-
 		if !wallet.IsActive {
 			return errors.New("wallet is not active")
 		}
 
-		// Update balance
-		wallet.Balance = wallet.Balance.Add(amount)
-		if err := tx.Save(&wallet).Error; err != nil {
-			return errors.New("failed to update balance")
-		}
-
-		// Create transaction record
 		description := input.Description
 		if description == "" {
-			description = "Deposit from " + input.Source
+			description = "Deposit from " + bank.Label()
 		}
+
+		// Nothing is posted until the debit settles
 		transaction := models.Transaction{
 			WalletID:    wallet.ID,
 			Type:        models.TransactionTypeDeposit,
 			Amount:      amount,
+			Currency:    currency,
 			Description: description,
-			Status:      models.TransactionStatusSuccess,
+			Status:      models.TransactionStatusPending,
 		}
 		if err := tx.Create(&transaction).Error; err != nil {
 			return errors.New("failed to create transaction record")
 		}
-
+		deposit = models.Deposit{
+			UserID:          userID,
+			WalletID:        wallet.ID,
+			TransactionID:   transaction.ID,
+			LinkedAccountID: bank.ID,
+			AccountLabel:    bank.Label(),
+			Amount:          amount,
+			Currency:        currency,
+			Status:          models.DepositPending,
+		}
+		if err := tx.Create(&deposit).Error; err != nil {
+			return errors.New("failed to queue deposit")
+		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &wallet, nil
+	return &deposit, nil
 }
 
-// Withdraw deducts money from the user's wallet atomically
+// Withdraw holds money on the user's wallet and queues the payout to the bank
+// account for the next ACH file. The held funds leave the wallet once the
+// payout settles.
 func (s *WalletService) Withdraw(userID string, input WithdrawInput) (*models.Wallet, error) {
 	amount := decimal.NewFromFloat(input.Amount)
 	if amount.LessThanOrEqual(decimal.Zero) {
 		return nil, errors.New("amount must be greater than 0")
 	}
+	currency, err := normalizeCurrency(input.Currency)
+	if err != nil {
+		return nil, err
+	}
+	// ACH only carries US dollars
+	if currency != models.DefaultCurrency {
+		return nil, errors.New("withdrawals to a bank account must be in USD")
+	}
 
 	var wallet models.Wallet
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
-			return errors.New("wallet not found")
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		bank, err := verifiedLinkedAccount(tx, userID, input.LinkedAccountID)
+		if err != nil {
+			return err
 		}
 
-		if !wallet.IsActive {
-			return errors.New("wallet is not active")
+		walletID, err := walletIDForUser(tx, userID, currency)
+		if err != nil {
+			return err
 		}
-
-		// Check sufficient balance
-		if wallet.Balance.LessThan(amount) {
-			return errors.New("insufficient balance")
+		// The funds stay in the wallet, held, until the payout settles
+		description := "Withdrawal to " + bank.Label()
+		hold, err := placeHold(tx, walletID, models.HoldTypeWithdrawal, bank.ID, description, amount, 0)
+		if err != nil {
+			return err
 		}
-
-		// Deduct balance
-		wallet.Balance = wallet.Balance.Sub(amount)
-		if err := tx.Save(&wallet).Error; err != nil {
-			return errors.New("failed to update balance")
+		if err := s.limitService.reserve(tx, userID, models.LimitCategoryWithdrawal, amount, currency, hold.ID); err != nil {
+			return err
 		}
 
-		// Create transaction record
 		transaction := models.Transaction{
-			WalletID:    wallet.ID,
+			WalletID:    walletID,
 			Type:        models.TransactionTypeWithdraw,
 			Amount:      amount,
-			Description: "Withdrawal to " + input.BankAccount,
-			Status:      models.TransactionStatusSuccess,
+			Currency:    currency,
+			Description: description,
+			Status:      models.TransactionStatusPending,
 		}
 		if err := tx.Create(&transaction).Error; err != nil {
 			return errors.New("failed to create transaction record")
 		}
+		withdrawal := models.Withdrawal{
+			UserID:          userID,
+			WalletID:        walletID,
+			TransactionID:   transaction.ID,
+			HoldID:          hold.ID,
+			LinkedAccountID: bank.ID,
+			AccountLabel:    bank.Label(),
+			Amount:          amount,
+			Currency:        currency,
+			Status:          models.WithdrawalPending,
+		}
+		if err := tx.Create(&withdrawal).Error; err != nil {
+			return errors.New("failed to create withdrawal")
+		}
 
-		return nil
+		return tx.Where("id = ?", walletID).First(&wallet).Error
 	})
 	if err != nil {
 		return nil, err
@@ -149,11 +237,16 @@ func (s *WalletService) Withdraw(userID string, input WithdrawInput) (*models.Wa
 	return &wallet, nil
 }
 
-// GetTransactions returns paginated transactions for a user's wallet
-func (s *WalletService) GetTransactions(userID string, page, limit int) (*TransactionListResponse, error) {
-	if page < 1 {
-		page = 1
-	}
+// GetTransactions returns a filtered page of the transactions on a user's wallets
+func (s *WalletService) GetTransactions(userID string, query TransactionQuery) (*TransactionListResponse, error) {
+	walletIDs := s.db.Model(&models.Wallet{}).Select("id").Where("user_id = ?", userID)
+	return listTransactions(s.db, walletIDs, query)
+}
+
+// listTransactions returns one page of the transactions recorded on
+// walletIDs, which may be a slice of IDs or a subquery
+func listTransactions(db *gorm.DB, walletIDs interface{}, query TransactionQuery) (*TransactionListResponse, error) {
+	limit := query.Limit
 	if limit < 1 {
 		limit = 20
 	}
@@ -161,35 +254,201 @@ func (s *WalletService) GetTransactions(userID string, page, limit int) (*Transa
 		limit = 100
 	}
 
+	base, err := filterTransactions(db, walletIDs, query)
+	if err != nil {
+		return nil, err
+	}
+	response := TransactionListResponse{Transactions: []models.Transaction{}, Limit: limit}
+
+	page := base.Session(&gorm.Session{}).Order("created_at DESC, id DESC")
+	if query.Cursor != "" {
+		createdAt, id, err := decodeTransactionCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		page = page.Where("created_at < ? OR (created_at = ? AND id < ?)", createdAt, createdAt, id)
+	} else if query.Page > 0 {
+		if err := base.Session(&gorm.Session{}).Count(&response.Total).Error; err != nil {
+			return nil, errors.New("failed to count transactions")
+		}
+		response.Page = query.Page
+		response.TotalPages = int(math.Ceil(float64(response.Total) / float64(limit)))
+		page = page.Offset((query.Page - 1) * limit)
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	if err := page.Preload("FromUser").Preload("ToUser").Preload("Annotation").
+		Limit(limit + 1).Find(&response.Transactions).Error; err != nil {
+		return nil, errors.New("failed to fetch transactions")
+	}
+	if len(response.Transactions) > limit {
+		response.Transactions = response.Transactions[:limit]
+		response.HasMore = true
+		last := response.Transactions[limit-1]
+		response.NextCursor = encodeTransactionCursor(last.CreatedAt, last.ID)
+	}
+	return &response, nil
+}
+
+// filterTransactions scopes the transactions table to walletIDs and applies
+// every filter in query
+func filterTransactions(conn *gorm.DB, walletIDs interface{}, query TransactionQuery) (*gorm.DB, error) {
+	db := conn.Model(&models.Transaction{}).Where("wallet_id IN (?)", walletIDs)
+
+	if query.Types != "" {
+		var types []string
+		for _, t := range strings.Split(query.Types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+		db = db.Where("type IN ?", types)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.From != "" {
+		from, _, err := parseHistoryTime(query.From)
+		if err != nil {
+			return nil, errors.New("invalid from date")
+		}
+		db = db.Where("created_at >= ?", from)
+	}
+	if query.To != "" {
+		to, dateOnly, err := parseHistoryTime(query.To)
+		if err != nil {
+			return nil, errors.New("invalid to date")
+		}
+		if dateOnly {
+			db = db.Where("created_at < ?", to.AddDate(0, 0, 1))
+		} else {
+			db = db.Where("created_at <= ?", to)
+		}
+	}
+	if query.MinAmount != nil {
+		db = db.Where("amount >= ?", decimal.NewFromFloat(*query.MinAmount))
+	}
+	if query.MaxAmount != nil {
+		db = db.Where("amount <= ?", decimal.NewFromFloat(*query.MaxAmount))
+	}
+	if query.Counterparty != "" {
+		var counterparty models.User
+		if err := conn.Select("id").
+			Where("id = ? OR username = ? OR email = ? OR phone = ?",
+				query.Counterparty, query.Counterparty, query.Counterparty, query.Counterparty).
+			First(&counterparty).Error; err != nil {
+			return nil, errors.New("counterparty not found")
+		}
+		db = db.Where("from_user_id = ? OR to_user_id = ?", counterparty.ID, counterparty.ID)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(query.Tag)); tag != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(tag)
+		db = db.Where("id IN (?)", conn.Model(&models.TransactionAnnotation{}).Select("transaction_id").
+			Where(`tags LIKE ? ESCAPE '\'`, `%"`+escaped+`"%`))
+	}
+	if search := strings.TrimSpace(query.Search); search != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(search))
+		db = db.Where(`LOWER(description) LIKE ? ESCAPE '\'`, "%"+escaped+"%")
+	}
+	return db, nil
+}
+
+// parseHistoryTime accepts an RFC 3339 time or a bare date, reporting which it got
+func parseHistoryTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// encodeTransactionCursor packs the sort key of the last row on a page
+func encodeTransactionCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeTransactionCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	return createdAt, id, nil
+}
+
+// normalizeCurrency upper-cases a currency code, defaulting to USD, and
+// rejects currencies wallets cannot hold
+func normalizeCurrency(code string) (string, error) {
+	if code == "" {
+		return models.DefaultCurrency, nil
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !models.IsSupportedCurrency(code) {
+		return "", errors.New("unsupported currency " + code)
+	}
+	return code, nil
+}
+
+// lockWalletByUser loads a user's wallet in a currency with
+// SELECT ... FOR UPDATE so the balance cannot change underneath the caller
+// until its transaction ends
+func lockWalletByUser(tx *gorm.DB, userID, currency string) (*models.Wallet, error) {
 	var wallet models.Wallet
-	if err := s.db.Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND currency = ?", userID, currency).First(&wallet).Error; err != nil {
 		return nil, errors.New("wallet not found")
 	}
+	return &wallet, nil
+}
 
-	var total int64
-	s.db.Model(&models.Transaction{}).
-		Where("wallet_id = ? OR from_user_id = ? OR to_user_id = ?", wallet.ID, userID, userID).
-		Count(&total)
-
-	var transactions []models.Transaction
-	offset := (page - 1) * limit
-	if err := s.db.Where("wallet_id = ? OR from_user_id = ? OR to_user_id = ?", wallet.ID, userID, userID).
-		Preload("FromUser").
-		Preload("ToUser").
-		Order("created_at DESC").
-		Offset(offset).
-		Limit(limit).
-		Find(&transactions).Error; err != nil {
-		return nil, errors.New("failed to fetch transactions")
+// lockWallets locks several wallets in ascending ID order. Every code path
+// that holds more than one wallet lock takes them in this order, so two
+// opposite transfers between the same wallets cannot deadlock.
+func lockWallets(tx *gorm.DB, walletIDs ...string) (map[string]*models.Wallet, error) {
+	ids := append([]string(nil), walletIDs...)
+	sort.Strings(ids)
+
+	wallets := make(map[string]*models.Wallet, len(ids))
+	for _, id := range ids {
+		if _, ok := wallets[id]; ok {
+			continue
+		}
+		var wallet models.Wallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", id).First(&wallet).Error; err != nil {
+			return nil, errors.New("wallet not found")
+		}
+		wallets[id] = &wallet
 	}
+	return wallets, nil
+}
 
-	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+// walletIDForUser returns the ID of a user's wallet in a currency without locking it
+func walletIDForUser(tx *gorm.DB, userID, currency string) (string, error) {
+	var wallet models.Wallet
+	if err := tx.Select("id").Where("user_id = ? AND currency = ?", userID, currency).First(&wallet).Error; err != nil {
+		return "", errors.New("wallet not found")
+	}
+	return wallet.ID, nil
+}
 
-	return &TransactionListResponse{
-		Transactions: transactions,
-		Total:        total,
-		Page:         page,
-		Limit:        limit,
-		TotalPages:   totalPages,
-	}, nil
+// ensureWallet returns the ID of a user's wallet in a currency, opening an
+// empty one the first time the user receives money in that currency
+func ensureWallet(tx *gorm.DB, userID, currency string) (string, error) {
+	if id, err := walletIDForUser(tx, userID, currency); err == nil {
+		return id, nil
+	}
+	wallet := models.Wallet{UserID: userID, Currency: currency, Balance: decimal.Zero, IsActive: true}
+	// Another transaction may open the same wallet concurrently
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&wallet).Error; err != nil {
+		return "", errors.New("failed to open wallet")
+	}
+	return walletIDForUser(tx, userID, currency)
 }
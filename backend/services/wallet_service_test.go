@@ -0,0 +1,131 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBHistory() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.TransactionAnnotation{})
+	return db
+}
+
+// seedHistory writes n rows for alice, several sharing a timestamp so the id tiebreak matters
+func seedHistory(db *gorm.DB, n int) (alice, bob models.User, wallet models.Wallet) {
+	alice = models.User{Email: "a@test.com", Username: "alice", Phone: "1", FirstName: "A", LastName: "A"}
+	bob = models.User{Email: "b@test.com", Username: "bob", Phone: "2", FirstName: "B", LastName: "B"}
+	db.Create(&alice)
+	db.Create(&bob)
+	wallet = models.Wallet{UserID: alice.ID, IsActive: true}
+	db.Create(&wallet)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		txn := models.Transaction{
+			WalletID:    wallet.ID,
+			Type:        models.TransactionTypeDeposit,
+			Amount:      decimal.NewFromInt(int64(i + 1)),
+			Description: fmt.Sprintf("Deposit %d", i),
+			Status:      models.TransactionStatusSuccess,
+			CreatedAt:   start.Add(time.Duration(i/3) * time.Hour),
+		}
+		if i%5 == 0 {
+			txn.Type = models.TransactionTypeP2PReceive
+			txn.FromUserID = &bob.ID
+			txn.Description = fmt.Sprintf("Lunch 100%% split %d", i)
+		}
+		db.Create(&txn)
+	}
+	return alice, bob, wallet
+}
+
+func TestHistoryCursorWalksEveryRowOnce(t *testing.T) {
+	db := setupTestDBHistory()
+	alice, _, wallet := seedHistory(db, 25)
+	ws := services.NewWalletService(db, nil)
+
+	seen := map[string]bool{}
+	var cursor string
+	for pages := 0; ; pages++ {
+		page, err := ws.GetTransactions(alice.ID, services.TransactionQuery{Cursor: cursor, Limit: 10})
+		assert.NoError(t, err)
+		for _, txn := range page.Transactions {
+			assert.False(t, seen[txn.ID], "row repeated across pages")
+			seen[txn.ID] = true
+		}
+
+		// A payment landing mid-walk belongs before the first page, not in later ones
+		if pages == 0 {
+			db.Create(&models.Transaction{WalletID: wallet.ID, Type: models.TransactionTypeDeposit,
+				Amount: decimal.NewFromInt(7), Status: models.TransactionStatusSuccess})
+		}
+		if !page.HasMore {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Len(t, seen, 25)
+
+	_, err := ws.GetTransactions(alice.ID, services.TransactionQuery{Cursor: "not-a-cursor"})
+	assert.EqualError(t, err, "invalid cursor")
+}
+
+func TestHistoryFilters(t *testing.T) {
+	db := setupTestDBHistory()
+	alice, bob, _ := seedHistory(db, 25)
+	ws := services.NewWalletService(db, nil)
+
+	list := func(q services.TransactionQuery) []models.Transaction {
+		page, err := ws.GetTransactions(alice.ID, q)
+		assert.NoError(t, err)
+		return page.Transactions
+	}
+
+	assert.Len(t, list(services.TransactionQuery{Types: "p2p_receive"}), 5)
+	assert.Len(t, list(services.TransactionQuery{Types: "deposit, p2p_receive", Limit: 100}), 25)
+	assert.Len(t, list(services.TransactionQuery{Counterparty: "bob"}), 5)
+	assert.Len(t, list(services.TransactionQuery{Counterparty: bob.Email}), 5)
+
+	min, max := 10.0, 12.0
+	assert.Len(t, list(services.TransactionQuery{MinAmount: &min, MaxAmount: &max}), 3)
+
+	// Wildcards in the search text are matched literally
+	assert.Len(t, list(services.TransactionQuery{Search: "100%"}), 5)
+	assert.Len(t, list(services.TransactionQuery{Search: "LUNCH"}), 5)
+	assert.Empty(t, list(services.TransactionQuery{Search: "1_0"}))
+
+	// Rows are spread three an hour from noon; a bare "to" date covers the whole day
+	assert.Len(t, list(services.TransactionQuery{From: "2026-03-01T14:00:00Z", To: "2026-03-01T15:00:00Z"}), 6)
+	assert.Len(t, list(services.TransactionQuery{From: "2026-03-01", To: "2026-03-01", Limit: 100}), 25)
+	assert.Empty(t, list(services.TransactionQuery{From: "2026-03-02"}))
+
+	_, err := ws.GetTransactions(alice.ID, services.TransactionQuery{Counterparty: "nobody"})
+	assert.EqualError(t, err, "counterparty not found")
+	_, err = ws.GetTransactions(alice.ID, services.TransactionQuery{From: "yesterday"})
+	assert.EqualError(t, err, "invalid from date")
+}
+
+func TestHistoryOffsetPaging(t *testing.T) {
+	db := setupTestDBHistory()
+	alice, _, _ := seedHistory(db, 25)
+
+	page, err := services.NewWalletService(db, nil).GetTransactions(alice.ID, services.TransactionQuery{Page: 3, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 5)
+	assert.Equal(t, int64(25), page.Total)
+	assert.Equal(t, 3, page.TotalPages)
+	assert.False(t, page.HasMore)
+}
@@ -0,0 +1,661 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gatorpay-backend/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// achSettlementDays is how long a submitted withdrawal or deposit waits
+// before it is treated as settled. Banks return most entries within two
+// banking days.
+const achSettlementDays = 3
+
+// achFileModifiers tell apart files sent on the same day
+const achFileModifiers = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// errReturnFileProcessed marks a return file that has been applied before
+var errReturnFileProcessed = errors.New("return file was already processed")
+
+// WithdrawalService moves withdrawals and bank deposits through ACH: pending
+// ones are written to a NACHA file for the sponsor bank, return files dropped
+// back by the bank undo them, and the rest settle once the return window
+// passes.
+type WithdrawalService struct {
+	db         *gorm.DB
+	accounts   *LinkedAccountService
+	originator ACHOriginator
+	outboxDir  string // where outbound NACHA files are written for the bank
+	returnsDir string // where the bank drops return files
+}
+
+// NewWithdrawalService creates a new WithdrawalService
+func NewWithdrawalService(db *gorm.DB, accounts *LinkedAccountService, originator ACHOriginator, outboxDir, returnsDir string) *WithdrawalService {
+	return &WithdrawalService{db: db, accounts: accounts, originator: originator, outboxDir: outboxDir, returnsDir: returnsDir}
+}
+
+// RunBatch applies new return files, settles withdrawals and deposits past
+// the return window and sends pending ones in a new ACH file. It is safe to run
+// repeatedly.
+func (s *WithdrawalService) RunBatch() error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	returned, err := s.ProcessReturns()
+	keep(err)
+	settled, err := s.SettleDue()
+	keep(err)
+	file, err := s.SubmitPending()
+	keep(err)
+
+	if returned > 0 || settled > 0 || file != nil {
+		submitted := 0
+		if file != nil {
+			submitted = file.EntryCount
+		}
+		log.Printf("🏦 ACH batch: %d submitted, %d settled, %d returned", submitted, settled, returned)
+	}
+	return firstErr
+}
+
+// SubmitPending writes every pending withdrawal and deposit into one NACHA
+// file in the outbox and marks them submitted. It returns nil when there was
+// nothing to send.
+func (s *WithdrawalService) SubmitPending() (*models.ACHFile, error) {
+	var file *models.ACHFile
+	var path string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var pending []models.Withdrawal
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ?", models.WithdrawalPending).
+			Order("created_at ASC").Find(&pending).Error; err != nil {
+			return errors.New("failed to fetch pending withdrawals")
+		}
+		var deposits []models.Deposit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ?", models.DepositPending).
+			Order("created_at ASC").Find(&deposits).Error; err != nil {
+			return errors.New("failed to fetch pending deposits")
+		}
+		if len(pending) == 0 && len(deposits) == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		var tracedWithdrawals, tracedDeposits, sentToday int64
+		tx.Model(&models.Withdrawal{}).Where("trace_number <> ''").Count(&tracedWithdrawals)
+		tx.Model(&models.Deposit{}).Where("trace_number <> ''").Count(&tracedDeposits)
+		tx.Model(&models.ACHFile{}).Where("direction = ? AND created_at >= ?", models.ACHFileOutbound,
+			now.Truncate(24*time.Hour)).Count(&sentToday)
+		traced := tracedWithdrawals + tracedDeposits
+
+		entries := make([]achEntry, 0, len(pending)+len(deposits))
+		total := decimal.Zero
+		for _, w := range pending {
+			entry, err := s.entry(tx, w.LinkedAccountID, w.UserID, w.Amount, false)
+			if err != nil {
+				return fmt.Errorf("withdrawal %s: %v", w.ID, err)
+			}
+			entry.TraceNumber = s.originator.RoutingNumber[:8] + achNum(traced+int64(len(entries))+1, 7)
+			entries = append(entries, entry)
+			total = total.Add(w.Amount)
+		}
+		for _, d := range deposits {
+			entry, err := s.entry(tx, d.LinkedAccountID, d.UserID, d.Amount, true)
+			if err != nil {
+				return fmt.Errorf("deposit %s: %v", d.ID, err)
+			}
+			entry.TraceNumber = s.originator.RoutingNumber[:8] + achNum(traced+int64(len(entries))+1, 7)
+			entries = append(entries, entry)
+			total = total.Add(d.Amount)
+		}
+
+		modifier := achFileModifiers[sentToday%int64(len(achFileModifiers))]
+		data := writeNACHA(s.originator, entries, now, nextBankingDay(now), modifier)
+		digest := sha256.Sum256(data)
+		file = &models.ACHFile{
+			Direction:   models.ACHFileOutbound,
+			FileName:    fmt.Sprintf("gatorpay-%s-%c.ach", now.Format("20060102-150405"), modifier),
+			SHA256:      hex.EncodeToString(digest[:]),
+			EntryCount:  len(entries),
+			TotalAmount: total,
+		}
+		if err := tx.Create(file).Error; err != nil {
+			return errors.New("failed to record ACH file")
+		}
+		for i := range pending {
+			if err := tx.Model(&pending[i]).Updates(map[string]interface{}{
+				"status":       models.WithdrawalSubmitted,
+				"ach_file_id":  file.ID,
+				"trace_number": entries[i].TraceNumber,
+				"submitted_at": now,
+			}).Error; err != nil {
+				return errors.New("failed to update withdrawal")
+			}
+		}
+		for i := range deposits {
+			if err := tx.Model(&deposits[i]).Updates(map[string]interface{}{
+				"status":       models.DepositSubmitted,
+				"ach_file_id":  file.ID,
+				"trace_number": entries[len(pending)+i].TraceNumber,
+				"submitted_at": now,
+			}).Error; err != nil {
+				return errors.New("failed to update deposit")
+			}
+		}
+
+		// Written last so a failure here rolls the batch back
+		path = filepath.Join(s.outboxDir, file.FileName)
+		return writeFileAtomic(path, data)
+	})
+	if err != nil {
+		if path != "" {
+			os.Remove(path)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// entry builds the ACH entry paying amount to a linked account or, for a
+// deposit, pulling it from there
+func (s *WithdrawalService) entry(tx *gorm.DB, accountID, userID string, amount decimal.Decimal, pull bool) (achEntry, error) {
+	var account models.LinkedBankAccount
+	// The account may have been unlinked since; the entry still goes to it
+	if err := tx.Unscoped().Where("id = ?", accountID).First(&account).Error; err != nil {
+		return achEntry{}, errors.New("bank account not found")
+	}
+	number, err := s.accounts.AccountNumber(&account)
+	if err != nil {
+		return achEntry{}, err
+	}
+	code := achCheckingCredit
+	switch {
+	case pull && account.AccountType == models.BankAccountSavings:
+		code = achSavingsDebit
+	case pull:
+		code = achCheckingDebit
+	case account.AccountType == models.BankAccountSavings:
+		code = achSavingsCredit
+	}
+	return achEntry{
+		TransactionCode: code,
+		RoutingNumber:   account.RoutingNumber,
+		AccountNumber:   number,
+		Amount:          amount.Shift(2).IntPart(),
+		IndividualID:    strings.ReplaceAll(userID, "-", ""),
+		Name:            account.HolderName,
+	}, nil
+}
+
+// settleWithdrawal takes a withdrawal's held funds out of its wallet once
+// its return window has passed and marks its withdraw transaction a success
+func settleWithdrawal(tx *gorm.DB, w *models.Withdrawal) error {
+	hold, wallet, err := lockHold(tx, w.HoldID)
+	if err != nil {
+		return err
+	}
+	amount, err := settleHold(tx, hold, wallet, decimal.Zero, true)
+	if err != nil {
+		return fmt.Errorf("withdrawal %s: %v", w.ID, err)
+	}
+	// The money has left the settlement account
+	entry, err := postJournal(tx, models.JournalTypeACHSettlement, hold.Description,
+		debit(walletAccountCode(wallet.ID), amount),
+		credit(platformCode(models.LedgerPlatformCash, w.Currency), amount),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", w.TransactionID).Updates(map[string]interface{}{
+		"status":           models.TransactionStatusSuccess,
+		"journal_entry_id": entry.ID,
+	}).Error; err != nil {
+		return errors.New("failed to update transaction")
+	}
+	return nil
+}
+
+// settleDeposit credits a deposit to its wallet once its return window has
+// passed and marks its deposit transaction a success
+func settleDeposit(tx *gorm.DB, d *models.Deposit) error {
+	if _, err := lockWallets(tx, d.WalletID); err != nil {
+		return err
+	}
+	entry, err := postJournal(tx, models.JournalTypeDeposit, "Deposit from "+d.AccountLabel,
+		debit(platformCode(models.LedgerPlatformCash, d.Currency), d.Amount),
+		credit(walletAccountCode(d.WalletID), d.Amount),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Transaction{}).Where("id = ?", d.TransactionID).Updates(map[string]interface{}{
+		"status":           models.TransactionStatusSuccess,
+		"journal_entry_id": entry.ID,
+	}).Error; err != nil {
+		return errors.New("failed to update transaction")
+	}
+	body := fmt.Sprintf("Your deposit of $%s from %s has arrived and is ready to use.", d.Amount.StringFixed(2), d.AccountLabel)
+	_, err = createNotification(tx, d.UserID, "payment", "Deposit available", body, "🏦", "/wallet/deposits")
+	return err
+}
+
+// SettleDue settles submitted withdrawals and deposits whose return window
+// has passed and returns how many it settled
+func (s *WithdrawalService) SettleDue() (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -achSettlementDays)
+	var due []models.Withdrawal
+	if err := s.db.Where("status = ? AND submitted_at <= ?", models.WithdrawalSubmitted, cutoff).
+		Order("submitted_at ASC").Find(&due).Error; err != nil {
+		return 0, errors.New("failed to fetch submitted withdrawals")
+	}
+	var deposits []models.Deposit
+	if err := s.db.Where("status = ? AND submitted_at <= ?", models.DepositSubmitted, cutoff).
+		Order("submitted_at ASC").Find(&deposits).Error; err != nil {
+		return 0, errors.New("failed to fetch submitted deposits")
+	}
+
+	settled := 0
+	for _, w := range due {
+		w := w
+		moved, err := s.settle(&w, w.ID, models.WithdrawalSubmitted, models.WithdrawalSettled, func(tx *gorm.DB) error {
+			return settleWithdrawal(tx, &w)
+		})
+		if err != nil {
+			return settled, err
+		}
+		if moved {
+			settled++
+		}
+	}
+	for _, d := range deposits {
+		d := d
+		moved, err := s.settle(&d, d.ID, models.DepositSubmitted, models.DepositSettled, func(tx *gorm.DB) error {
+			return settleDeposit(tx, &d)
+		})
+		if err != nil {
+			return settled, err
+		}
+		if moved {
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// settle moves one withdrawal or deposit from submitted to settled and
+// applies the settlement in the same transaction. It reports false when a
+// return was applied since the row was read.
+func (s *WithdrawalService) settle(model interface{}, id, submitted, settled string, apply func(tx *gorm.DB) error) (bool, error) {
+	moved := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(model).
+			Where("id = ? AND status = ?", id, submitted).
+			Updates(map[string]interface{}{"status": settled, "settled_at": time.Now()})
+		if result.Error != nil {
+			return errors.New("failed to update ACH entry")
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		moved = true
+		return apply(tx)
+	})
+	return moved, err
+}
+
+// ProcessReturns applies every return file in the drop directory and moves
+// each one to processed/ or, if it cannot be read, to failed/. It returns how
+// many withdrawals were returned.
+func (s *WithdrawalService) ProcessReturns() (int, error) {
+	dirEntries, err := os.ReadDir(s.returnsDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.New("failed to read ACH return directory")
+	}
+
+	returned := 0
+	var firstErr error
+	for _, entry := range dirEntries {
+		// Skip files the bank is still writing
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		path := filepath.Join(s.returnsDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		dest := "processed"
+		file, err := s.ApplyReturnFile(entry.Name(), data)
+		switch {
+		case err == nil:
+			returned += file.Applied
+		case errors.Is(err, errReturnFileProcessed):
+		default:
+			log.Printf("⚠️  ACH return file %s: %v", entry.Name(), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			dest = "failed"
+		}
+		if err := moveFile(path, filepath.Join(s.returnsDir, dest, entry.Name())); err != nil {
+			log.Printf("⚠️  ACH return file %s could not be moved: %v", entry.Name(), err)
+		}
+	}
+	return returned, firstErr
+}
+
+// ApplyReturnFile returns the withdrawals and deposits named in a NACHA
+// return file, moving the money back and notifying their owners. A file is
+// only applied once; entries that match nothing submitted are skipped.
+func (s *WithdrawalService) ApplyReturnFile(name string, data []byte) (*models.ACHFile, error) {
+	returns, err := parseACHReturns(data)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	file := &models.ACHFile{
+		Direction:  models.ACHFileReturn,
+		FileName:   name,
+		SHA256:     hex.EncodeToString(digest[:]),
+		EntryCount: len(returns),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var seen int64
+		tx.Model(&models.ACHFile{}).Where("sha256 = ?", file.SHA256).Count(&seen)
+		if seen > 0 {
+			return errReturnFileProcessed
+		}
+		total := decimal.Zero
+		for _, r := range returns {
+			ok, err := s.applyReturn(tx, r)
+			if err != nil {
+				return err
+			}
+			if ok {
+				file.Applied++
+				total = total.Add(decimal.New(r.Amount, -2))
+			}
+		}
+		file.TotalAmount = total
+		if err := tx.Create(file).Error; err != nil {
+			return errors.New("failed to record ACH file")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// applyReturn gives one returned withdrawal back to its wallet, releasing its
+// hold or, once settled, re-crediting it. Entries that are not withdrawals are
+// returned deposits. It reports false when the entry matches nothing that can
+// be returned.
+func (s *WithdrawalService) applyReturn(tx *gorm.DB, r achReturn) (bool, error) {
+	var w models.Withdrawal
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("trace_number = ?", r.TraceNumber).First(&w).Error; err != nil {
+		return s.applyDepositReturn(tx, r)
+	}
+	if w.Status != models.WithdrawalSubmitted && w.Status != models.WithdrawalSettled {
+		return false, nil
+	}
+	if w.Amount.Shift(2).IntPart() != r.Amount {
+		log.Printf("⚠️  ACH return for withdrawal %s is for %d cents, not %s", w.ID, r.Amount, w.Amount.StringFixed(2))
+		return false, nil
+	}
+
+	reason := achReturnReason(r.Code)
+	updates := map[string]interface{}{
+		"status":        models.WithdrawalReturned,
+		"return_code":   r.Code,
+		"return_reason": reason,
+		"returned_at":   time.Now(),
+	}
+	if w.Status == models.WithdrawalSubmitted {
+		// Still held: the funds never left the wallet
+		if _, err := releaseHold(tx, w.HoldID, models.HoldStatusReleased); err != nil {
+			return false, err
+		}
+		if err := tx.Model(&models.Transaction{}).Where("id = ?", w.TransactionID).
+			Update("status", models.TransactionStatusFailed).Error; err != nil {
+			return false, errors.New("failed to update transaction")
+		}
+	} else {
+		recredit, err := recreditWithdrawal(tx, &w, reason)
+		if err != nil {
+			return false, err
+		}
+		if err := releaseUsage(tx, w.HoldID, w.Amount, w.Amount); err != nil {
+			return false, err
+		}
+		updates["return_transaction_id"] = recredit.ID
+	}
+	if err := tx.Model(&w).Updates(updates).Error; err != nil {
+		return false, errors.New("failed to update withdrawal")
+	}
+
+	body := fmt.Sprintf("Your withdrawal of $%s to %s was returned by your bank (%s: %s). The money is back in your wallet.",
+		w.Amount.StringFixed(2), w.AccountLabel, r.Code, reason)
+	if _, err := createNotification(tx, w.UserID, "payment", "Withdrawal returned", body, "↩️", "/wallet/withdrawals"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyDepositReturn fails a deposit whose debit the user's bank refused. A
+// deposit still in its return window never reached the wallet; a settled one
+// is taken back out of it. It reports false when the entry matches no deposit
+// that can be returned.
+func (s *WithdrawalService) applyDepositReturn(tx *gorm.DB, r achReturn) (bool, error) {
+	var d models.Deposit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("trace_number = ?", r.TraceNumber).First(&d).Error; err != nil {
+		log.Printf("⚠️  ACH return %s for unknown trace number %s", r.Code, r.TraceNumber)
+		return false, nil
+	}
+	if d.Status != models.DepositSubmitted && d.Status != models.DepositSettled {
+		return false, nil
+	}
+	if d.Amount.Shift(2).IntPart() != r.Amount {
+		log.Printf("⚠️  ACH return for deposit %s is for %d cents, not %s", d.ID, r.Amount, d.Amount.StringFixed(2))
+		return false, nil
+	}
+
+	reason := achReturnReason(r.Code)
+	updates := map[string]interface{}{
+		"status":        models.DepositReturned,
+		"return_code":   r.Code,
+		"return_reason": reason,
+		"returned_at":   time.Now(),
+	}
+	body := fmt.Sprintf("Your deposit of $%s from %s was returned by your bank (%s: %s), so it was not added to your wallet.",
+		d.Amount.StringFixed(2), d.AccountLabel, r.Code, reason)
+	if d.Status == models.DepositSubmitted {
+		if err := tx.Model(&models.Transaction{}).Where("id = ?", d.TransactionID).
+			Update("status", models.TransactionStatusFailed).Error; err != nil {
+			return false, errors.New("failed to update transaction")
+		}
+	} else {
+		chargeBack, shortfall, err := chargeBackDeposit(tx, &d, reason)
+		if err != nil {
+			return false, err
+		}
+		if chargeBack != nil {
+			updates["return_transaction_id"] = chargeBack.ID
+		}
+		body = fmt.Sprintf("Your deposit of $%s from %s was returned by your bank (%s: %s), so it was taken back out of your wallet.",
+			d.Amount.StringFixed(2), d.AccountLabel, r.Code, reason)
+		if shortfall.IsPositive() {
+			body += fmt.Sprintf(" $%s of it had already been spent; your wallet is frozen until you contact support.", shortfall.StringFixed(2))
+		}
+	}
+	if err := tx.Model(&d).Updates(updates).Error; err != nil {
+		return false, errors.New("failed to update deposit")
+	}
+
+	if _, err := createNotification(tx, d.UserID, "payment", "Deposit returned", body, "↩️", "/wallet/deposits"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// chargeBackDeposit takes a settled deposit the bank returned back out of
+// its wallet. Whatever has already been spent cannot be taken; it is
+// reported as the shortfall and the wallet is frozen for support to recover
+// it. The charge-back transaction is nil when nothing was left to take.
+func chargeBackDeposit(tx *gorm.DB, d *models.Deposit, reason string) (*models.Transaction, decimal.Decimal, error) {
+	wallets, err := lockWallets(tx, d.WalletID)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	wallet := wallets[d.WalletID]
+	amount := decimal.Min(d.Amount, wallet.Available())
+	shortfall := d.Amount.Sub(amount)
+	if shortfall.IsPositive() {
+		log.Printf("⚠️  Returned deposit %s is %s short; freezing wallet %s", d.ID, shortfall.StringFixed(2), wallet.ID)
+		if err := tx.Model(wallet).Update("is_active", false).Error; err != nil {
+			return nil, decimal.Zero, errors.New("failed to freeze wallet")
+		}
+	}
+	if !amount.IsPositive() {
+		return nil, shortfall, nil
+	}
+
+	description := "Returned deposit from " + d.AccountLabel + ": " + reason
+	entry, err := postJournal(tx, models.JournalTypeACHReturn, description,
+		debit(walletAccountCode(d.WalletID), amount),
+		credit(platformCode(models.LedgerPlatformCash, d.Currency), amount),
+	)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	chargeBack := models.Transaction{
+		WalletID:            d.WalletID,
+		Type:                models.TransactionTypeDepositReturn,
+		Amount:              amount,
+		Currency:            d.Currency,
+		Description:         description,
+		Status:              models.TransactionStatusSuccess,
+		JournalEntryID:      &entry.ID,
+		ParentTransactionID: &d.TransactionID,
+	}
+	if err := tx.Create(&chargeBack).Error; err != nil {
+		return nil, decimal.Zero, errors.New("failed to create transaction record")
+	}
+	return &chargeBack, shortfall, nil
+}
+
+// recreditWithdrawal pays a returned withdrawal back into its wallet once
+// the funds have left it
+func recreditWithdrawal(tx *gorm.DB, w *models.Withdrawal, reason string) (*models.Transaction, error) {
+	if _, err := lockWallets(tx, w.WalletID); err != nil {
+		return nil, err
+	}
+	// The payout comes back into the settlement account
+	description := "Returned withdrawal to " + w.AccountLabel + ": " + reason
+	entry, err := postJournal(tx, models.JournalTypeACHReturn, description,
+		debit(platformCode(models.LedgerPlatformCash, w.Currency), w.Amount),
+		credit(walletAccountCode(w.WalletID), w.Amount),
+	)
+	if err != nil {
+		return nil, err
+	}
+	recredit := models.Transaction{
+		WalletID:            w.WalletID,
+		Type:                models.TransactionTypeWithdrawReturn,
+		Amount:              w.Amount,
+		Currency:            w.Currency,
+		Description:         description,
+		Status:              models.TransactionStatusSuccess,
+		JournalEntryID:      &entry.ID,
+		ParentTransactionID: &w.TransactionID,
+	}
+	if err := tx.Create(&recredit).Error; err != nil {
+		return nil, errors.New("failed to create transaction record")
+	}
+	return &recredit, nil
+}
+
+// GetWithdrawals lists a user's withdrawals, newest first
+func (s *WithdrawalService) GetWithdrawals(userID string) ([]models.Withdrawal, error) {
+	var withdrawals []models.Withdrawal
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&withdrawals).Error; err != nil {
+		return nil, errors.New("failed to fetch withdrawals")
+	}
+	return withdrawals, nil
+}
+
+// GetDeposits lists a user's bank deposits, newest first
+func (s *WithdrawalService) GetDeposits(userID string) ([]models.Deposit, error) {
+	var deposits []models.Deposit
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&deposits).Error; err != nil {
+		return nil, errors.New("failed to fetch deposits")
+	}
+	return deposits, nil
+}
+
+// GetFiles lists recent ACH files, newest first
+func (s *WithdrawalService) GetFiles(limit int) ([]models.ACHFile, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var files []models.ACHFile
+	if err := s.db.Order("created_at DESC").Limit(limit).Find(&files).Error; err != nil {
+		return nil, errors.New("failed to fetch ACH files")
+	}
+	return files, nil
+}
+
+// nextBankingDay is the first weekday after t
+func nextBankingDay(t time.Time) time.Time {
+	t = t.AddDate(0, 0, 1)
+	for t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// writeFileAtomic writes data through a temporary file so the bank never
+// picks up a partial file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// moveFile moves a file into a directory created as needed
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
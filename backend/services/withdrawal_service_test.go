@@ -0,0 +1,296 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gatorpay-backend/models"
+	"gatorpay-backend/services"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBWithdrawal() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&models.User{}, &models.Wallet{}, &models.Transaction{}, &models.Notification{},
+		&models.LinkedBankAccount{}, &models.Withdrawal{}, &models.Deposit{}, &models.Hold{}, &models.SpendingLimit{}, &models.LimitUsage{}, &models.ACHFile{},
+		&models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{})
+	return db
+}
+
+// achRecord pads a NACHA record to its fixed width
+func achRecord(s string) string {
+	return s + strings.Repeat(" ", 94-len(s))
+}
+
+// returnFile builds the bank's return file for one entry of an outbound file
+func returnFile(entry, code string) []byte {
+	trace := entry[79:94]
+	return []byte(strings.Join([]string{
+		achRecord("101 063100277 0631002772501011200A094101SPONSOR BANK           GATORPAY"),
+		entry,
+		achRecord("799" + code + trace + "      " + entry[3:11]),
+		strings.Repeat("9", 94),
+	}, "\n") + "\n")
+}
+
+func TestWithdrawalACHLifecycle(t *testing.T) {
+	db := setupTestDBWithdrawal()
+	dir := t.TempDir()
+	outbox, returns := filepath.Join(dir, "outbound"), filepath.Join(dir, "returns")
+	bank := services.NewSimulatedBankAdapter()
+	accounts := services.NewLinkedAccountService(db, bank, testBankKey)
+	limits := services.NewLimitService(db, nil)
+	assert.NoError(t, limits.EnsureDefaults())
+	ws := services.NewWalletService(db, limits)
+	ls := services.NewLedgerService(db)
+	withdrawals := services.NewWithdrawalService(db, accounts, testOriginator, outbox, returns)
+
+	db.Create(&models.User{ID: "u1", Email: "a@example.com", Username: "alice", Phone: "1", FirstName: "Alice", LastName: "Ng"})
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+	account, err := accounts.LinkAccount("u1", models.LinkAccountRequest{RoutingNumber: "021000021", AccountNumber: "000123456789", HolderName: "Alice Ng"})
+	assert.NoError(t, err)
+	sent, _ := bank.LastDeposit("000123456789")
+	_, err = accounts.VerifyAccount("u1", account.ID, []float64{float64(sent.Amounts[0]) / 100, float64(sent.Amounts[1]) / 100})
+	assert.NoError(t, err)
+
+	deposit(t, db, "u1", 300)
+	_, err = ws.Withdraw("u1", services.WithdrawInput{Amount: 100, LinkedAccountID: account.ID})
+	assert.NoError(t, err)
+	wallet, err := ws.Withdraw("u1", services.WithdrawInput{Amount: 50.25, LinkedAccountID: account.ID})
+	assert.NoError(t, err)
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(300)))
+	assert.True(t, wallet.Available().Equal(decimal.NewFromFloat(149.75)))
+	withdrawalUsed := func() decimal.Decimal {
+		summary, err := limits.GetRemaining("u1")
+		assert.NoError(t, err)
+		return findLimit(summary, models.LimitCategoryWithdrawal, models.LimitPeriodDaily).Used
+	}
+	assert.True(t, withdrawalUsed().Equal(decimal.NewFromFloat(150.25)))
+
+	list, _ := withdrawals.GetWithdrawals("u1")
+	assert.Len(t, list, 2)
+	assert.Equal(t, models.WithdrawalPending, list[0].Status)
+	_, err = services.NewHoldService(db).Capture(list[0].HoldID, services.CaptureHoldInput{})
+	assert.EqualError(t, err, "withdrawal holds are settled by the payment that placed them")
+
+	// Pending withdrawals go out in one NACHA file
+	file, err := withdrawals.SubmitPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, file.EntryCount)
+	assert.True(t, file.TotalAmount.Equal(decimal.NewFromFloat(150.25)))
+	data, err := os.ReadFile(filepath.Join(outbox, file.FileName))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(t, lines, 10, "padded to a whole block")
+	for _, line := range lines {
+		assert.Len(t, line, 94)
+	}
+	assert.True(t, strings.HasPrefix(lines[0], "101 063100277"))
+	assert.True(t, strings.HasPrefix(lines[1], "5220GATORPAY"))
+	assert.Contains(t, lines[1], "PPDWITHDRAWAL")
+	assert.Equal(t, "622021000021000123456789     0000010000", lines[2][:39])
+	assert.Equal(t, "0000005025", lines[3][29:39])
+	assert.Equal(t, "82200000020004200004000000000000000000015025", lines[4][:44])
+	assert.True(t, strings.HasPrefix(lines[5], "9000001000001000000020004200004"))
+	assert.Equal(t, strings.Repeat("9", 94), lines[9])
+
+	file, err = withdrawals.SubmitPending()
+	assert.NoError(t, err)
+	assert.Nil(t, file, "nothing left to send")
+
+	// Submitted payouts stay held and pending until they settle
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(300)))
+	assert.True(t, wallet.HeldBalance.Equal(decimal.NewFromFloat(150.25)))
+	var firstTxn, secondTxn models.Transaction
+	db.Where("type = ? AND amount = ?", models.TransactionTypeWithdraw, 100).First(&firstTxn)
+	db.Where("type = ? AND amount = ?", models.TransactionTypeWithdraw, 50.25).First(&secondTxn)
+	assert.Equal(t, models.TransactionStatusPending, firstTxn.Status)
+
+	var first, second models.Withdrawal
+	db.Where("amount = ?", 100).First(&first)
+	db.Where("amount = ?", 50.25).First(&second)
+	assert.Equal(t, models.WithdrawalSubmitted, first.Status)
+	assert.Equal(t, "063100270000002", first.TraceNumber, "trace numbers carry on from the deposit's")
+	assert.Equal(t, first.TraceNumber, lines[2][79:])
+
+	// The bank returns the first one before it settles: its hold is released
+	assert.NoError(t, os.MkdirAll(returns, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(returns, "return-1.ach"), returnFile(lines[2], "R03"), 0o644))
+	n, err := withdrawals.ProcessReturns()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(filepath.Join(returns, "processed", "return-1.ach"))
+	assert.NoError(t, err)
+
+	db.First(&first, "id = ?", first.ID)
+	assert.Equal(t, models.WithdrawalReturned, first.Status)
+	assert.Equal(t, "R03", first.ReturnCode)
+	assert.Equal(t, "No account or unable to locate account", first.ReturnReason)
+	assert.Nil(t, first.ReturnTransactionID)
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(300)))
+	assert.True(t, wallet.Available().Equal(decimal.NewFromFloat(249.75)))
+	db.First(&firstTxn, "id = ?", firstTxn.ID)
+	assert.Equal(t, models.TransactionStatusFailed, firstTxn.Status)
+	assert.True(t, withdrawalUsed().Equal(decimal.NewFromFloat(50.25)), "a returned withdrawal gives its limit back")
+	var notification models.Notification
+	assert.NoError(t, db.Where("user_id = ?", "u1").Order("created_at DESC").First(&notification).Error)
+	assert.Equal(t, "Withdrawal returned", notification.Title)
+
+	// The same file dropped again is not applied twice; unreadable files are set aside
+	assert.NoError(t, os.WriteFile(filepath.Join(returns, "return-1-copy.ach"), returnFile(lines[2], "R03"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(returns, "garbage.ach"), []byte("not a nacha file\n"), 0o644))
+	n, err = withdrawals.ProcessReturns()
+	assert.EqualError(t, err, "line 1 is not a 94-character NACHA record")
+	assert.Equal(t, 0, n)
+	_, err = os.Stat(filepath.Join(returns, "failed", "garbage.ach"))
+	assert.NoError(t, err)
+
+	// The other settles once the return window has passed
+	n, err = withdrawals.SettleDue()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	db.Model(&second).Update("submitted_at", time.Now().AddDate(0, 0, -4))
+	n, err = withdrawals.SettleDue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	db.First(&second, "id = ?", second.ID)
+	assert.Equal(t, models.WithdrawalSettled, second.Status)
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromFloat(249.75)))
+	assert.True(t, wallet.HeldBalance.IsZero())
+	db.First(&secondTxn, "id = ?", secondTxn.ID)
+	assert.Equal(t, models.TransactionStatusSuccess, secondTxn.Status)
+	assert.NotNil(t, secondTxn.JournalEntryID)
+
+	// A late return still re-credits the wallet
+	returned, err := withdrawals.ApplyReturnFile("late.ach", returnFile(lines[3], "R99"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, returned.Applied)
+	db.First(&second, "id = ?", second.ID)
+	assert.Equal(t, "Returned by the receiving bank (R99)", second.ReturnReason)
+
+	var recredits int64
+	db.Model(&models.Transaction{}).Where("type = ?", models.TransactionTypeWithdrawReturn).Count(&recredits)
+	assert.Equal(t, int64(1), recredits, "only the settled withdrawal needed one")
+	assert.True(t, withdrawalUsed().IsZero())
+
+	// Every dollar is back where it started
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(300)))
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	for _, a := range tb.Accounts {
+		if a.Code == models.LedgerPlatformCash {
+			assert.True(t, a.Balance.Equal(decimal.NewFromInt(300)), a.Balance.String())
+		}
+	}
+	checks, _ := ls.CheckWallets()
+	assert.True(t, checks[0].Matches)
+}
+
+func TestDepositACHLifecycle(t *testing.T) {
+	db := setupTestDBWithdrawal()
+	dir := t.TempDir()
+	accounts := services.NewLinkedAccountService(db, services.NewSimulatedBankAdapter(), testBankKey)
+	ws := services.NewWalletService(db, nil)
+	ls := services.NewLedgerService(db)
+	ach := services.NewWithdrawalService(db, accounts, testOriginator, filepath.Join(dir, "outbound"), filepath.Join(dir, "returns"))
+
+	db.Create(&models.User{ID: "u1", Email: "a@example.com", Username: "alice", Phone: "1", FirstName: "Alice", LastName: "Ng"})
+	db.Create(&models.Wallet{UserID: "u1", IsActive: true})
+	bank := bankAccount(t, db, "u1")
+
+	_, err := ws.AddMoney("u1", services.AddMoneyInput{Amount: 10, LinkedAccountID: bank, Currency: "EUR"})
+	assert.EqualError(t, err, "deposits from a bank account must be in USD")
+	first, err := ws.AddMoney("u1", services.AddMoneyInput{Amount: 100, LinkedAccountID: bank})
+	assert.NoError(t, err)
+	assert.Equal(t, models.DepositPending, first.Status)
+	second, err := ws.AddMoney("u1", services.AddMoneyInput{Amount: 40, LinkedAccountID: bank})
+	assert.NoError(t, err)
+
+	// Nothing reaches the wallet until the debit settles
+	wallet, _ := ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.IsZero())
+	var txn models.Transaction
+	db.First(&txn, "id = ?", first.TransactionID)
+	assert.Equal(t, models.TransactionStatusPending, txn.Status)
+	assert.Nil(t, txn.JournalEntryID)
+	_, err = ws.Withdraw("u1", services.WithdrawInput{Amount: 10, LinkedAccountID: bank})
+	assert.Error(t, err)
+
+	// Both are pulled in one debit batch
+	file, err := ach.SubmitPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, file.EntryCount)
+	data, err := os.ReadFile(filepath.Join(dir, "outbound", file.FileName))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.True(t, strings.HasPrefix(lines[1], "5225GATORPAY"))
+	assert.Contains(t, lines[1], "PPDDEPOSIT")
+	assert.Equal(t, "627021000021000123456789     0000010000", lines[2][:39])
+	assert.Equal(t, "000000014000000000000000", lines[4][20:44], "debits total, no credits")
+
+	// The bank refuses the first before it settles: it never reaches the wallet
+	returned, err := ach.ApplyReturnFile("return-1.ach", returnFile(lines[2], "R01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, returned.Applied)
+	db.First(&first, "id = ?", first.ID)
+	assert.Equal(t, models.DepositReturned, first.Status)
+	assert.Equal(t, "Insufficient funds", first.ReturnReason)
+	db.First(&txn, "id = ?", first.TransactionID)
+	assert.Equal(t, models.TransactionStatusFailed, txn.Status)
+	var notification models.Notification
+	db.Where("user_id = ?", "u1").First(&notification)
+	assert.Equal(t, "Deposit returned", notification.Title)
+
+	// The second settles once the return window has passed
+	db.Model(second).Update("submitted_at", time.Now().AddDate(0, 0, -4))
+	n, err := ach.SettleDue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(40)))
+	var settled models.Transaction
+	db.First(&settled, "id = ?", second.TransactionID)
+	assert.Equal(t, models.TransactionStatusSuccess, settled.Status)
+
+	// A late return takes back what has not been spent and freezes the wallet
+	_, err = ws.Withdraw("u1", services.WithdrawInput{Amount: 30, LinkedAccountID: bank})
+	assert.NoError(t, err)
+	_, err = ach.ApplyReturnFile("return-2.ach", returnFile(lines[3], "R10"))
+	assert.NoError(t, err)
+	db.First(&second, "id = ?", second.ID)
+	assert.Equal(t, models.DepositReturned, second.Status)
+	assert.NotNil(t, second.ReturnTransactionID)
+	var chargeBack models.Transaction
+	db.First(&chargeBack, "id = ?", *second.ReturnTransactionID)
+	assert.Equal(t, models.TransactionTypeDepositReturn, chargeBack.Type)
+	assert.True(t, chargeBack.Amount.Equal(decimal.NewFromInt(10)))
+	wallet, _ = ws.GetWallet("u1")
+	assert.True(t, wallet.Balance.Equal(decimal.NewFromInt(30)))
+	assert.False(t, wallet.IsActive)
+	var latest models.Notification
+	db.Where("user_id = ?", "u1").Order("created_at DESC").First(&latest)
+	assert.Contains(t, latest.Body, "$30.00 of it had already been spent")
+
+	deposits, err := ach.GetDeposits("u1")
+	assert.NoError(t, err)
+	assert.Len(t, deposits, 2)
+	tb, err := ls.GetTrialBalance()
+	assert.NoError(t, err)
+	assert.True(t, tb.Balanced)
+	checks, _ := ls.CheckWallets()
+	assert.True(t, checks[0].Matches)
+}